@@ -9,6 +9,8 @@ Summary: Retrieve account ID (assumed to be a single value) for the current
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	color "github.com/logrusorgru/aurora"
 )
 
@@ -17,12 +19,12 @@ import (
 // It relies a supplied AccountIDService struct which has a single method: Account.
 // It also relies on a supplied ActivityMonitor which it uses to inform the user of
 // what it is doing.
-func GetAccountID(cis *AccountIDService, am ActivityMonitor) string {
+func GetAccountID(ctx aws.Context, cis *AccountIDService, am ActivityMonitor) string {
 	// Indicate activity
 	am.StartAction("Retrieving Account ID")
 
 	// Get the caller's identity
-	accountID, err := cis.Account()
+	accountID, err := cis.Account(ctx)
 
 	// Check for error
 	am.CheckError(err)
@@ -32,3 +34,33 @@ func GetAccountID(cis *AccountIDService, am ActivityMonitor) string {
 
 	return accountID
 }
+
+// GetAccountIdentity returns the Amazon Account ID and the partition (e.g., "aws"
+// or "aws-us-gov") of the caller of the supplied session, showing activity in the
+// process and handling potential errors. Both are taken from the ARN of the
+// caller's identity.
+func GetAccountIdentity(ctx aws.Context, cis *AccountIDService, am ActivityMonitor) (string, string) {
+	// Indicate activity
+	am.StartAction("Retrieving Account ID")
+
+	// Get the caller's identity
+	callerARN, err := cis.CallerARN(ctx)
+	if am.CheckError(err) {
+		return "", ""
+	}
+
+	// Which account (and partition) does it belong to?
+	parsed, err := arn.Parse(callerARN)
+	if am.CheckError(err) {
+		return "", ""
+	}
+
+	// Indicate end of activity (mentioning any partition other than the commercial one)
+	if parsed.Partition != PartitionAWS {
+		am.EndAction("OK (%s in %s)", color.Bold(parsed.AccountID), parsed.Partition)
+	} else {
+		am.EndAction("OK (%s)", color.Bold(parsed.AccountID))
+	}
+
+	return parsed.AccountID, parsed.Partition
+}
@@ -8,10 +8,12 @@ Summary: Unit test for accountId
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 
@@ -26,10 +28,10 @@ type fakeSecurityTokenService struct {
 	Resp *sts.GetCallerIdentityOutput
 }
 
-// This fake GetCallerIdentity method takes an arbitrary input and returns
+// This fake GetCallerIdentityWithContext method takes an arbitrary input and returns
 // either an error (if the supplied response object is nil) or the supplied
 // response (in the form of a GetCallerIdentityOutput pointer).
-func (m *fakeSecurityTokenService) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+func (m *fakeSecurityTokenService) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, _ ...request.Option) (*sts.GetCallerIdentityOutput, error) {
 	// Was the provided Response present?
 	if m.Resp != nil {
 		// Return it with no error
@@ -77,7 +79,7 @@ func TestGetAccountID(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Get the account ID
-		actualAccountID := GetAccountID(svc, mon)
+		actualAccountID := GetAccountID(context.Background(), svc, mon)
 
 		// Do we expect an error to occur?
 		if c.ExpectError {
@@ -8,9 +8,11 @@ Summary: The ActivityMonitor interface along with a Terminal-based monitor.
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	color "github.com/logrusorgru/aurora"
@@ -23,6 +25,7 @@ type ActivityMonitor interface {
 	Message(string, ...interface{})
 	StartAction(string, ...interface{})
 	CheckError(error) bool
+	RecordError(error)
 	ActionError(string, ...interface{})
 	SubResourceError(string, ...interface{})
 	EndAction(string, ...interface{})
@@ -30,15 +33,27 @@ type ActivityMonitor interface {
 }
 
 // TerminalActivityMonitor is our terminal-based activity monitor. It allows
-// the caller to supply an io.Writer to direct output to.
+// the caller to supply an io.Writer to direct output to. It is safe to use
+// from multiple goroutines (as is done when regions are scanned concurrently).
+//
+// If ContinueOnError is set, errors passed to CheckError are recorded (see
+// Errors) rather than ending the program.
 type TerminalActivityMonitor struct {
 	io.Writer
-	ExitFn func(int)
+	ExitFn          func(int)
+	ContinueOnError bool
+
+	// Serializes all writes to the associated io.Writer (and our errors)
+	mu     sync.Mutex
+	errors []*CounterError
 }
 
 // Message constructs a simple message from the format string and arguments
 // and sends it to the associated io.Writer.
 func (tam *TerminalActivityMonitor) Message(format string, v ...interface{}) {
+	tam.mu.Lock()
+	defer tam.mu.Unlock()
+
 	fmt.Fprintf(tam.Writer, format, v...)
 }
 
@@ -48,6 +63,9 @@ func (tam *TerminalActivityMonitor) StartAction(format string, v ...interface{})
 }
 
 // CheckError checks the supplied error. If no error, then it returns immediately.
+// If we are continuing on errors, the error is recorded (see RecordError) unless
+// it indicates that there are no credentials at all. Errors of cancelled requests
+// are always recorded, so that the partial counts are kept.
 // Otherwise, it checks for specific AWS errors (returning a specific error message).
 // If no specific AWS error found, it simply sends the error message to the ActionError
 // method.
@@ -57,8 +75,18 @@ func (tam *TerminalActivityMonitor) CheckError(err error) bool {
 		return false
 	}
 
+	// Is this an AWS Error? (Possibly wrapped by a CounterError)
+	var aerr awserr.Error
+	isAWSError := errors.As(err, &aerr)
+
+	// Should we record the error and keep going? Without credentials, nothing will succeed.
+	if tam.ContinueOnError && !(isAWSError && aerr.Code() == "NoCredentialProviders") || IsCanceled(err) {
+		tam.RecordError(err)
+		return true
+	}
+
 	// Is this an AWS Error?
-	if aerr, ok := err.(awserr.Error); ok {
+	if isAWSError {
 		// Split the message by newline
 		parts := strings.Split(aerr.Message(), "\n")
 
@@ -83,12 +111,46 @@ func (tam *TerminalActivityMonitor) CheckError(err error) bool {
 	return true
 }
 
+// RecordError records the supplied error as a CounterError and displays it
+// (in the same manner as SubResourceError) without exiting the tool.
+func (tam *TerminalActivityMonitor) RecordError(err error) {
+	// Convert the error into a structured form
+	ce := NewCounterError("", "", err)
+
+	// Record it
+	tam.mu.Lock()
+	tam.errors = append(tam.errors, ce)
+	tam.mu.Unlock()
+
+	// Display it
+	tam.SubResourceError("%s", ce.Error())
+}
+
+// Errors returns the list of errors recorded so far.
+func (tam *TerminalActivityMonitor) Errors() []*CounterError {
+	tam.mu.Lock()
+	defer tam.mu.Unlock()
+
+	return append([]*CounterError(nil), tam.errors...)
+}
+
+// ClearErrors forgets the errors recorded so far (e.g., between the runs of a
+// long-lived process).
+func (tam *TerminalActivityMonitor) ClearErrors() {
+	tam.mu.Lock()
+	defer tam.mu.Unlock()
+
+	tam.errors = nil
+}
+
 // ActionError formats the supplied format string (and associated parameters) in
 // RED and exits the tool.
 func (tam *TerminalActivityMonitor) ActionError(format string, v ...interface{}) {
 	// Display an error message (and newline)
+	tam.mu.Lock()
 	fmt.Fprintln(tam.Writer, color.Red(fmt.Sprintf(format, v...)))
 	fmt.Fprintln(tam.Writer)
+	tam.mu.Unlock()
 
 	// Exit the program
 	tam.Exit(1)
@@ -97,6 +159,9 @@ func (tam *TerminalActivityMonitor) ActionError(format string, v ...interface{})
 // SubResourceError formats the supplied format string (and associated parameters) in
 // RED.
 func (tam *TerminalActivityMonitor) SubResourceError(format string, v ...interface{}) {
+	tam.mu.Lock()
+	defer tam.mu.Unlock()
+
 	// Display an error message (and newline)
 	fmt.Fprintln(tam.Writer, color.Red(fmt.Sprintf(fmt.Sprintf("   - [ERROR] %s", format), v...)))
 }
@@ -104,6 +169,9 @@ func (tam *TerminalActivityMonitor) SubResourceError(format string, v ...interfa
 // EndAction receives a format string (and arguments) and sends to the supplied
 // Writer.
 func (tam *TerminalActivityMonitor) EndAction(format string, v ...interface{}) {
+	tam.mu.Lock()
+	defer tam.mu.Unlock()
+
 	fmt.Fprintln(tam.Writer, fmt.Sprintf(format, v...))
 }
 
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 )
 
 func TestTerminalActivityMonitorMessage(t *testing.T) {
@@ -122,3 +124,91 @@ func TestTerminalActivityMonitorCheckError(t *testing.T) {
 		}
 	}
 }
+
+func TestTerminalActivityMonitorConcurrentMessages(t *testing.T) {
+	// Create a builder to hold our contents...
+	builder := strings.Builder{}
+
+	// Create an instance of the Terminal Activity Monitor
+	mon := TerminalActivityMonitor{
+		Writer: &builder,
+	}
+
+	// Send it many progress dots from many goroutines...
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mon.Message(".")
+		}()
+	}
+	wg.Wait()
+
+	// Did we receive all of them?
+	if builder.String() != strings.Repeat(".", 50) {
+		t.Errorf("Unexpected message: expected %d dots, actual %s", 50, builder.String())
+	}
+}
+
+func TestTerminalActivityMonitorContinueOnError(t *testing.T) {
+	// Create some test cases...
+	cases := []struct {
+		Error          error
+		ExpectExit     bool
+		ExpectRecorded bool
+	}{
+		{
+			Error:          NewCounterError("Lightsail", "eu-south-1", awserr.New("AccessDeniedException", "Not for you", nil)),
+			ExpectRecorded: true,
+		},
+		{
+			Error:          errors.New("Something is very wrong"),
+			ExpectRecorded: true,
+		},
+		{
+			Error:      awserr.New("NoCredentialProviders", "blah", nil),
+			ExpectExit: true,
+		},
+	}
+
+	// Errors of cancelled requests are recorded even without ContinueOnError
+	mon := TerminalActivityMonitor{Writer: &strings.Builder{}, ExitFn: func(int) { t.Errorf("Unexpected exit") }}
+	if !mon.CheckError(awserr.New(request.CanceledErrorCode, "request context canceled", nil)) || len(mon.Errors()) != 1 {
+		t.Errorf("Expected the cancelled request to be recorded, but it was not")
+	}
+
+	// Loop through the test cases...
+	for _, c := range cases {
+		// Create an exit function which simply records that it was called
+		var exited bool
+		exitFn := func(resultCode int) {
+			exited = true
+		}
+
+		// Create a builder to hold our contents...
+		builder := strings.Builder{}
+
+		// Create an instance of the Terminal Activity Monitor
+		mon := TerminalActivityMonitor{
+			Writer:          &builder,
+			ExitFn:          exitFn,
+			ContinueOnError: true,
+		}
+
+		// Check for error
+		if !mon.CheckError(c.Error) {
+			t.Errorf("Expected CheckError to return true, but it did not")
+		}
+
+		// Was the error recorded?
+		recorded := len(mon.Errors()) == 1
+		if exited != c.ExpectExit {
+			t.Errorf("Unexpected exit: expected %v, actual %v", c.ExpectExit, exited)
+		} else if recorded != c.ExpectRecorded {
+			t.Errorf("Unexpected recording of error: expected %v, actual %v", c.ExpectRecorded, recorded)
+		} else if recorded && !strings.Contains(builder.String(), mon.Errors()[0].Message) {
+			t.Errorf("Expected the recorded error to be displayed, but it was not: %s", builder.String())
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
@@ -20,10 +21,14 @@ import (
 	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
 	"github.com/aws/aws-sdk-go/service/lightsail"
 	"github.com/aws/aws-sdk-go/service/lightsail/lightsailiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -32,6 +37,21 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
+// EndpointServiceNames are the names of the services whose endpoint can be
+// overridden (e.g., by --service-endpoints).
+var EndpointServiceNames = []string{
+	ec2.EndpointsID,
+	ecs.EndpointsID,
+	eks.EndpointsID,
+	iam.EndpointsID,
+	lambda.EndpointsID,
+	lightsail.EndpointsID,
+	organizations.EndpointsID,
+	rds.EndpointsID,
+	s3.EndpointsID,
+	sts.EndpointsID,
+}
+
 // DefaultRegion is used if the caller does not supply a region
 // on the command line or the profile does not have a default
 // region associated with it.
@@ -39,6 +59,10 @@ const DefaultRegion = "us-east-1"
 
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
 // Abstract Services (hides details of Cloud Provider API)
+//
+// Every method takes a context which, when cancelled (or when its deadline
+// passes), stops the request (and any further pages) with a RequestCanceled
+// error.
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
 
 // AccountIDService is a struct that knows how get the AWS
@@ -51,12 +75,12 @@ type AccountIDService struct {
 // Account uses the supplied AccountIDService to invoke
 // the associated GetCallerIdentity method on the struct's
 // Client object.
-func (aids *AccountIDService) Account() (string, error) {
+func (aids *AccountIDService) Account(ctx aws.Context) (string, error) {
 	// Construct the input parameter
 	input := &sts.GetCallerIdentityInput{}
 
 	// Get the caller's identity
-	result, err := aids.Client.GetCallerIdentity(input)
+	result, err := aids.Client.GetCallerIdentityWithContext(ctx, input)
 	if err != nil {
 		return "", err
 	}
@@ -64,6 +88,52 @@ func (aids *AccountIDService) Account() (string, error) {
 	return *result.Account, nil
 }
 
+// CallerARN uses the supplied AccountIDService to invoke the associated
+// GetCallerIdentity method on the struct's Client object. It returns the
+// ARN of the caller (a user, a root user or an assumed role).
+func (aids *AccountIDService) CallerARN(ctx aws.Context) (string, error) {
+	// Construct the input parameter
+	input := &sts.GetCallerIdentityInput{}
+
+	// Get the caller's identity
+	result, err := aids.Client.GetCallerIdentityWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	return *result.Arn, nil
+}
+
+// IAMService is a struct that knows how to simulate the policies of a principal
+// using an object that implements the Identity and Access Management API interface.
+type IAMService struct {
+	Client iamiface.IAMAPI
+}
+
+// SimulatePrincipalPolicy takes an input specification (naming the principal and
+// the actions) and a function that is invoked for each page of results
+// (SimulatePolicyResponse). The supplied function can determine when to stop
+// iterating through the results.
+func (iams *IAMService) SimulatePrincipalPolicy(ctx aws.Context, input *iam.SimulatePrincipalPolicyInput,
+	fn func(*iam.SimulatePolicyResponse, bool) bool) error {
+	return iams.Client.SimulatePrincipalPolicyPagesWithContext(ctx, input, fn)
+}
+
+// OrganizationService is a struct that knows how to list the member
+// accounts of an AWS Organization using an object that implements the
+// Organizations API interface.
+type OrganizationService struct {
+	Client organizationsiface.OrganizationsAPI
+}
+
+// ListAccounts takes an input specification (ListAccountsInput) and a function
+// that is invoked for each page of results (ListAccountsOutput). The supplied
+// function can determine when to stop iterating through accounts.
+func (ors *OrganizationService) ListAccounts(ctx aws.Context, input *organizations.ListAccountsInput,
+	fn func(*organizations.ListAccountsOutput, bool) bool) error {
+	return ors.Client.ListAccountsPagesWithContext(ctx, input, fn)
+}
+
 // EC2InstanceService is a struct that knows how to get the
 // descriptions of all EC2 instances as well as accessbile
 // regions using an object that implements the Elastic
@@ -75,23 +145,23 @@ type EC2InstanceService struct {
 // InspectInstances takes an input filter specification (for the types of instances)
 // and a function to evaluate a DescribeInstanceOutput struct. The supplied function
 // can determine when to stop iterating through EC2 instances.
-func (ec2i *EC2InstanceService) InspectInstances(input *ec2.DescribeInstancesInput,
+func (ec2i *EC2InstanceService) InspectInstances(ctx aws.Context, input *ec2.DescribeInstancesInput,
 	fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
-	return ec2i.Client.DescribeInstancesPages(input, fn)
+	return ec2i.Client.DescribeInstancesPagesWithContext(ctx, input, fn)
 }
 
 // GetRegions returns the list of available regions for EC2 instances based on the
 // set of input parameters.
-func (ec2i *EC2InstanceService) GetRegions(input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
-	return ec2i.Client.DescribeRegions(input)
+func (ec2i *EC2InstanceService) GetRegions(ctx aws.Context, input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
+	return ec2i.Client.DescribeRegionsWithContext(ctx, input)
 }
 
 // InspectVolumes takes an input filter specification (for the types of volumes)
 // and a function to evalatuate a DescribeVolumesOutput struct. The supplied function
 // can determine when to stop iterating through EBS volumes.
-func (ec2i *EC2InstanceService) InspectVolumes(input *ec2.DescribeVolumesInput,
+func (ec2i *EC2InstanceService) InspectVolumes(ctx aws.Context, input *ec2.DescribeVolumesInput,
 	fn func(*ec2.DescribeVolumesOutput, bool) bool) error {
-	return ec2i.Client.DescribeVolumesPages(input, fn)
+	return ec2i.Client.DescribeVolumesPagesWithContext(ctx, input, fn)
 }
 
 // RDSInstanceService is a struct that knows how to get the
@@ -104,9 +174,9 @@ type RDSInstanceService struct {
 // InspectInstances takes an input filter specification (for the types of instances)
 // and a function to evaluate a DescribeDBInstancesOutput struct. The supplied function
 // can determine when to stop iterating through RDS instances.
-func (rdsis *RDSInstanceService) InspectInstances(input *rds.DescribeDBInstancesInput,
+func (rdsis *RDSInstanceService) InspectInstances(ctx aws.Context, input *rds.DescribeDBInstancesInput,
 	fn func(*rds.DescribeDBInstancesOutput, bool) bool) error {
-	return rdsis.Client.DescribeDBInstancesPages(input, fn)
+	return rdsis.Client.DescribeDBInstancesPagesWithContext(ctx, input, fn)
 }
 
 // S3Service is a struct that knows how to get all of the S3 buckets using an object
@@ -117,8 +187,14 @@ type S3Service struct {
 
 // ListBuckets takes an input filter specification (for the types of S3 buckets) and
 // returns a ListBucketsOutput struct.
-func (s3s *S3Service) ListBuckets(input *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
-	return s3s.Client.ListBuckets(input)
+func (s3s *S3Service) ListBuckets(ctx aws.Context, input *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+	return s3s.Client.ListBucketsWithContext(ctx, input)
+}
+
+// GetBucketLocation takes an input specification (naming a bucket) and returns a
+// GetBucketLocationOutput struct that holds the bucket's location constraint.
+func (s3s *S3Service) GetBucketLocation(ctx aws.Context, input *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
+	return s3s.Client.GetBucketLocationWithContext(ctx, input)
 }
 
 // LambdaService is a struct that knows how to get all of the Lambda functions using
@@ -129,9 +205,9 @@ type LambdaService struct {
 
 // ListFunctions takes an input structure to identify specific lambda functions along
 // with a function which is supplied a "page" of lambda functions.
-func (ls *LambdaService) ListFunctions(input *lambda.ListFunctionsInput,
+func (ls *LambdaService) ListFunctions(ctx aws.Context, input *lambda.ListFunctionsInput,
 	fn func(*lambda.ListFunctionsOutput, bool) bool) error {
-	return ls.Client.ListFunctionsPages(input, fn)
+	return ls.Client.ListFunctionsPagesWithContext(ctx, input, fn)
 }
 
 // ContainerService is a struct that knows how to get a list of all task definition
@@ -143,15 +219,15 @@ type ContainerService struct {
 // ListTaskDefinitions takes an input specification (ListTaskDefinitionsInput) and
 // a function that is invoked for each page of results (ListTaskDefinitionsOutput).
 // This allows a caller to obtain a list of all task definitions.
-func (cs *ContainerService) ListTaskDefinitions(input *ecs.ListTaskDefinitionsInput,
+func (cs *ContainerService) ListTaskDefinitions(ctx aws.Context, input *ecs.ListTaskDefinitionsInput,
 	fn func(output *ecs.ListTaskDefinitionsOutput, lastPage bool) bool) error {
-	return cs.Client.ListTaskDefinitionsPages(input, fn)
+	return cs.Client.ListTaskDefinitionsPagesWithContext(ctx, input, fn)
 }
 
 // InspectTaskDefinition takes an input specification (DescribeTaskDefinitionInput)
 // that describes a single task definition and returns information about it.
-func (cs *ContainerService) InspectTaskDefinition(input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
-	return cs.Client.DescribeTaskDefinition(input)
+func (cs *ContainerService) InspectTaskDefinition(ctx aws.Context, input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+	return cs.Client.DescribeTaskDefinitionWithContext(ctx, input)
 }
 
 // LightsailService is a struct that knows how to get a list of all Lightsail
@@ -161,13 +237,13 @@ type LightsailService struct {
 }
 
 // GetRegions returns a list of available regions for Lightsail instances
-func (lss *LightsailService) GetRegions(input *lightsail.GetRegionsInput) (*lightsail.GetRegionsOutput, error) {
-	return lss.Client.GetRegions(input)
+func (lss *LightsailService) GetRegions(ctx aws.Context, input *lightsail.GetRegionsInput) (*lightsail.GetRegionsOutput, error) {
+	return lss.Client.GetRegionsWithContext(ctx, input)
 }
 
 // InspectInstances returns a full description of all Lightsail instances.
-func (lss *LightsailService) InspectInstances(input *lightsail.GetInstancesInput) (*lightsail.GetInstancesOutput, error) {
-	return lss.Client.GetInstances(input)
+func (lss *LightsailService) InspectInstances(ctx aws.Context, input *lightsail.GetInstancesInput) (*lightsail.GetInstancesOutput, error) {
+	return lss.Client.GetInstancesWithContext(ctx, input)
 }
 
 // EKSService is a struct that knows how to get a list of all EKS clusters and
@@ -179,22 +255,22 @@ type EKSService struct {
 // ListClusters takes an input filter specification and a function
 // to evaluate a ListClustersOutput struct. The supplied function
 // can determine when to stop iterating through EKS clusters.
-func (eksi *EKSService) ListClusters(input *eks.ListClustersInput,
+func (eksi *EKSService) ListClusters(ctx aws.Context, input *eks.ListClustersInput,
 	fn func(*eks.ListClustersOutput, bool) bool) error {
-	return eksi.Client.ListClustersPages(input, fn)
+	return eksi.Client.ListClustersPagesWithContext(ctx, input, fn)
 }
 
 // ListNodeGroups takes an input filter specification and a function
 // to evaluate a ListNodeGroupsOutput struct. The supplied function
 // can determine when to stop iterating through Nodegroups.
-func (eksi *EKSService) ListNodeGroups(input *eks.ListNodegroupsInput,
+func (eksi *EKSService) ListNodeGroups(ctx aws.Context, input *eks.ListNodegroupsInput,
 	fn func(*eks.ListNodegroupsOutput, bool) bool) error {
-	return eksi.Client.ListNodegroupsPages(input, fn)
+	return eksi.Client.ListNodegroupsPagesWithContext(ctx, input, fn)
 }
 
 // DescribeNodegroups returns a full description of a Nodegroup
-func (eksi *EKSService) DescribeNodegroups(input *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
-	return eksi.Client.DescribeNodegroup(input)
+func (eksi *EKSService) DescribeNodegroups(ctx aws.Context, input *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
+	return eksi.Client.DescribeNodegroupWithContext(ctx, input)
 }
 
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
@@ -206,6 +282,8 @@ type ServiceFactory interface {
 	Init()
 	GetCurrentRegion() string
 	GetAccountIDService() *AccountIDService
+	GetOrganizationService() *OrganizationService
+	GetIAMService() *IAMService
 	GetEC2InstanceService(string) *EC2InstanceService
 	GetEKSService(string) *EKSService
 	GetRDSInstanceService(string) *RDSInstanceService
@@ -219,20 +297,51 @@ type ServiceFactory interface {
 // an actual AWS Session object (pointer) and uses it to return
 // other specialized services, such as the AccountIDService.
 // It also accepts a profile name, overriding region and file
-// to use to send trace information.
+// to use to send trace information. A factory for another
+// account can be derived from it by calling AssumeRole.
+//
+// If a RecordDir is supplied, every request (and its response) is recorded in
+// it. If a ReplayDir is supplied, the responses recorded in it are served in
+// place of AWS, so that no credentials (or network) are needed. If an
+// EndpointURL is supplied, every request is sent to it (rather than AWS). The
+// ServiceEndpoints override the endpoint of individual services (keyed by the
+// names in EndpointServiceNames). If S3PathStyle is set, S3 buckets are
+// addressed by path rather than by host name. The Partition (if supplied)
+// chooses the region of a session that has none. The Throttling (if supplied)
+// controls how requests are retried and rate limited.
 type AWSServiceFactory struct {
-	Session     *session.Session
-	ProfileName string
-	RegionName  string
-	TraceWriter io.Writer
-	UseSSO      bool
+	Session          *session.Session
+	ProfileName      string
+	RegionName       string
+	TraceWriter      io.Writer
+	UseSSO           bool
+	RecordDir        string
+	ReplayDir        string
+	EndpointURL      string
+	ServiceEndpoints map[string]string
+	S3PathStyle      bool
+	Partition        string
+	Throttling       *ThrottleControl
+
+	// The ARN of the role assumed by this factory (if any)
+	RoleARN string
 }
 
 // Init initializes the AWS service factory by creating an
 // initial AWS Session object (pointer). It inspects the profiles
 // in the current user's directories and prepares the session for
-// tracing (if requested).
+// tracing (if requested). It panics if the session cannot be
+// created (see InitSession).
 func (awssf *AWSServiceFactory) Init() {
+	if err := awssf.InitSession(); err != nil {
+		panic(err)
+	}
+}
+
+// InitSession initializes the AWS service factory (see Init), returning
+// an error if the session cannot be created (e.g., as the shared
+// configuration is invalid). The factory's session is left as it was.
+func (awssf *AWSServiceFactory) InitSession() error {
 	config := &aws.Config{}
 
 	// Was a region specified by the user?
@@ -252,13 +361,33 @@ func (awssf *AWSServiceFactory) Init() {
 		}))
 	}
 
+	// Was an endpoint specified by the user? If so, it is used by every service
+	// (unless overridden for the service).
+	if awssf.EndpointURL != "" {
+		config = config.WithEndpoint(awssf.EndpointURL)
+	}
+
+	// Should S3 buckets be addressed by path? This is needed by endpoints whose host
+	// has no subdomain for each bucket (e.g., http://localhost:4566).
+	if awssf.S3PathStyle {
+		config = config.WithS3ForcePathStyle(true)
+	}
+
+	// Are we replaying a recording? If so, we never need to retry.
+	if awssf.ReplayDir != "" {
+		config = config.WithMaxRetries(0)
+	}
+
 	// Construct our session Options object
 	options := session.Options{
 		Config: *config,
 	}
 
-	// options to set if using SSO
-	if awssf.UseSSO {
+	// Which credentials should we use? None are needed to replay a recording.
+	if awssf.ReplayDir != "" {
+		options.Config.Credentials = credentials.AnonymousCredentials
+	} else if awssf.UseSSO {
+		// options to set if using SSO
 		options.SharedConfigState = session.SharedConfigEnable
 		options.Profile = awssf.ProfileName
 	} else {
@@ -276,15 +405,111 @@ func (awssf *AWSServiceFactory) Init() {
 	}
 
 	// Ensure that we have a session
-	sess := session.Must(session.NewSessionWithOptions(options))
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return err
+	}
 
-	// Does this session have a region? If not, use the default region
+	// Does this session have a region? If not, use the bootstrap region of our
+	// partition (which is the default region, unless another partition was supplied)
 	if *sess.Config.Region == "" {
-		sess = sess.Copy(&aws.Config{Region: aws.String(DefaultRegion)})
+		sess = sess.Copy(&aws.Config{Region: aws.String(BootstrapRegion(awssf.Partition))})
+	}
+
+	// Should we control the retries (and rate) of our requests? A recording is
+	// replayed without either.
+	if awssf.Throttling != nil && awssf.ReplayDir == "" {
+		awssf.Throttling.Apply(sess)
 	}
 
 	// Store the session in our struct
 	awssf.Session = sess
+	awssf.recordOrReplay()
+
+	return nil
+}
+
+// Refresh renews the credentials of the factory's session, so that a factory can
+// be reused across runs (e.g., by the daemon subcommand). The cached credentials
+// are expired and retrieved again; if that fails, the session is rebuilt from the
+// shared configuration (which picks up, e.g., a new SSO token from "aws sso login")
+// and the credentials are retrieved once more. An error is returned if the session
+// cannot be rebuilt (e.g., as the shared configuration became invalid). No
+// credentials are needed to replay a recording.
+func (awssf *AWSServiceFactory) Refresh(ctx aws.Context) error {
+	if awssf.ReplayDir != "" {
+		return nil
+	}
+
+	// Can we renew the credentials of our session?
+	creds := awssf.Session.Config.Credentials
+	creds.Expire()
+	if _, err := creds.GetWithContext(ctx); err == nil {
+		return nil
+	}
+
+	// Rebuild our session and try once more
+	if err := awssf.InitSession(); err != nil {
+		return err
+	}
+	_, err := awssf.Session.Config.Credentials.GetWithContext(ctx)
+
+	return err
+}
+
+// Add the handlers that record (or replay) the requests of our session. The
+// requests of each profile and role are kept apart.
+func (awssf *AWSServiceFactory) recordOrReplay() {
+	// What is the scope of our requests?
+	scope := awssf.ProfileName
+	if awssf.RoleARN != "" {
+		scope += "/" + awssf.RoleARN
+	}
+
+	// Are we recording or replaying?
+	if awssf.ReplayDir != "" {
+		ReplaySession(awssf.Session, awssf.ReplayDir, scope)
+	} else if awssf.RecordDir != "" {
+		RecordSession(awssf.Session, awssf.RecordDir, scope)
+	}
+}
+
+// AssumeRole returns a new AWS service factory whose session uses temporary
+// credentials obtained by assuming the supplied role. The credentials of this
+// factory's session are used to call sts:AssumeRole; they are refreshed
+// automatically when they expire.
+func (awssf *AWSServiceFactory) AssumeRole(roleARN string) *AWSServiceFactory {
+	// Which credentials should we use? None are needed to replay a recording.
+	stsClient := sts.New(awssf.Session, awssf.serviceConfig(sts.EndpointsID, ""))
+	creds := stscreds.NewCredentialsWithClient(stsClient, roleARN)
+	if awssf.ReplayDir != "" {
+		creds = credentials.AnonymousCredentials
+	}
+
+	// Construct a session which uses the assumed role's credentials
+	sess := awssf.Session.Copy(&aws.Config{
+		Credentials: creds,
+	})
+
+	// Construct the factory (with its own scope of recorded requests)
+	factory := &AWSServiceFactory{
+		Session:          sess,
+		ProfileName:      awssf.ProfileName,
+		RegionName:       awssf.RegionName,
+		TraceWriter:      awssf.TraceWriter,
+		UseSSO:           awssf.UseSSO,
+		RecordDir:        awssf.RecordDir,
+		ReplayDir:        awssf.ReplayDir,
+		EndpointURL:      awssf.EndpointURL,
+		ServiceEndpoints: awssf.ServiceEndpoints,
+		S3PathStyle:      awssf.S3PathStyle,
+		Partition:        awssf.Partition,
+		Throttling:       awssf.Throttling,
+		RoleARN:          roleARN,
+	}
+	factory.recordOrReplay()
+
+	return factory
 }
 
 // GetCurrentRegion returns the name of the current region.
@@ -292,11 +517,48 @@ func (awssf *AWSServiceFactory) GetCurrentRegion() string {
 	return *awssf.Session.Config.Region
 }
 
+// Construct the configuration of a client of the named service (one of
+// EndpointServiceNames): its region (if supplied) and its endpoint (if it is
+// overridden for the service). Every client is constructed with it so that the
+// settings of the factory are honored consistently.
+func (awssf *AWSServiceFactory) serviceConfig(serviceName string, regionName string) *aws.Config {
+	config := aws.NewConfig()
+
+	// Was a region supplied?
+	if regionName != "" {
+		config = config.WithRegion(regionName)
+	}
+
+	// Is the endpoint of this service overridden?
+	if endpointURL, ok := awssf.ServiceEndpoints[serviceName]; ok {
+		config = config.WithEndpoint(endpointURL)
+	}
+
+	return config
+}
+
 // GetAccountIDService returns an instance of an AccountIDService associated
 // with our session.
 func (awssf *AWSServiceFactory) GetAccountIDService() *AccountIDService {
 	return &AccountIDService{
-		Client: sts.New(awssf.Session),
+		Client: sts.New(awssf.Session, awssf.serviceConfig(sts.EndpointsID, "")),
+	}
+}
+
+// GetOrganizationService returns an instance of an OrganizationService associated
+// with our session. AWS Organizations is a global service, so there is no way to
+// accept a different region name.
+func (awssf *AWSServiceFactory) GetOrganizationService() *OrganizationService {
+	return &OrganizationService{
+		Client: organizations.New(awssf.Session, awssf.serviceConfig(organizations.EndpointsID, "")),
+	}
+}
+
+// GetIAMService returns an instance of an IAMService associated with our session.
+// IAM is a global service, so there is no way to accept a different region name.
+func (awssf *AWSServiceFactory) GetIAMService() *IAMService {
+	return &IAMService{
+		Client: iam.New(awssf.Session, awssf.serviceConfig(iam.EndpointsID, "")),
 	}
 }
 
@@ -304,16 +566,8 @@ func (awssf *AWSServiceFactory) GetAccountIDService() *AccountIDService {
 // with our session. The caller can supply an optional region name to contruct
 // an instance associated with that region.
 func (awssf *AWSServiceFactory) GetEC2InstanceService(regionName string) *EC2InstanceService {
-	// Construct our service client
-	var client ec2iface.EC2API
-	if regionName == "" {
-		client = ec2.New(awssf.Session)
-	} else {
-		client = ec2.New(awssf.Session, aws.NewConfig().WithRegion(regionName))
-	}
-
 	return &EC2InstanceService{
-		Client: client,
+		Client: ec2.New(awssf.Session, awssf.serviceConfig(ec2.EndpointsID, regionName)),
 	}
 }
 
@@ -321,16 +575,8 @@ func (awssf *AWSServiceFactory) GetEC2InstanceService(regionName string) *EC2Ins
 // with our session. The caller can supply an optional region name to construct
 // an instance associated with that region.
 func (awssf *AWSServiceFactory) GetRDSInstanceService(regionName string) *RDSInstanceService {
-	// Construct our service client
-	var client rdsiface.RDSAPI
-	if regionName == "" {
-		client = rds.New(awssf.Session)
-	} else {
-		client = rds.New(awssf.Session, aws.NewConfig().WithRegion(regionName))
-	}
-
 	return &RDSInstanceService{
-		Client: client,
+		Client: rds.New(awssf.Session, awssf.serviceConfig(rds.EndpointsID, regionName)),
 	}
 }
 
@@ -338,7 +584,7 @@ func (awssf *AWSServiceFactory) GetRDSInstanceService(regionName string) *RDSIns
 // There is currently no way to accept a different region name.
 func (awssf *AWSServiceFactory) GetS3Service() *S3Service {
 	return &S3Service{
-		Client: s3.New(awssf.Session),
+		Client: s3.New(awssf.Session, awssf.serviceConfig(s3.EndpointsID, "")),
 	}
 }
 
@@ -346,16 +592,8 @@ func (awssf *AWSServiceFactory) GetS3Service() *S3Service {
 // The caller can supply an optional region name to construct an instance associated with
 // that region.
 func (awssf *AWSServiceFactory) GetLambdaService(regionName string) *LambdaService {
-	// Construct our service client
-	var client lambdaiface.LambdaAPI
-	if regionName == "" {
-		client = lambda.New(awssf.Session)
-	} else {
-		client = lambda.New(awssf.Session, aws.NewConfig().WithRegion(regionName))
-	}
-
 	return &LambdaService{
-		Client: client,
+		Client: lambda.New(awssf.Session, awssf.serviceConfig(lambda.EndpointsID, regionName)),
 	}
 }
 
@@ -363,16 +601,8 @@ func (awssf *AWSServiceFactory) GetLambdaService(regionName string) *LambdaServi
 // The caller can supply an optional region name to construct an instance associated with
 // that region.
 func (awssf *AWSServiceFactory) GetContainerService(regionName string) *ContainerService {
-	// Construct our service client
-	var client ecsiface.ECSAPI
-	if regionName == "" {
-		client = ecs.New(awssf.Session)
-	} else {
-		client = ecs.New(awssf.Session, aws.NewConfig().WithRegion(regionName))
-	}
-
 	return &ContainerService{
-		Client: client,
+		Client: ecs.New(awssf.Session, awssf.serviceConfig(ecs.EndpointsID, regionName)),
 	}
 }
 
@@ -380,16 +610,8 @@ func (awssf *AWSServiceFactory) GetContainerService(regionName string) *Containe
 // The caller can supply an optional region name to construct an instance associated with
 // that region.
 func (awssf *AWSServiceFactory) GetLightsailService(regionName string) *LightsailService {
-	// Construct our service client
-	var client lightsailiface.LightsailAPI
-	if regionName == "" {
-		client = lightsail.New(awssf.Session)
-	} else {
-		client = lightsail.New(awssf.Session, aws.NewConfig().WithRegion(regionName))
-	}
-
 	return &LightsailService{
-		Client: client,
+		Client: lightsail.New(awssf.Session, awssf.serviceConfig(lightsail.EndpointsID, regionName)),
 	}
 }
 
@@ -397,15 +619,7 @@ func (awssf *AWSServiceFactory) GetLightsailService(regionName string) *Lightsai
 // with our session. The caller can supply an optional region name to contruct
 // an instance associated with that region.
 func (awssf *AWSServiceFactory) GetEKSService(regionName string) *EKSService {
-	// Construct our service client
-	var client eksiface.EKSAPI
-	if regionName == "" {
-		client = eks.New(awssf.Session)
-	} else {
-		client = eks.New(awssf.Session, aws.NewConfig().WithRegion(regionName))
-	}
-
 	return &EKSService{
-		Client: client,
+		Client: eks.New(awssf.Session, awssf.serviceConfig(eks.EndpointsID, regionName)),
 	}
 }
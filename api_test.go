@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/lightsail"
 	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func TestAwsServiceFactoryRegionResolution(t *testing.T) {
@@ -128,6 +129,52 @@ func TestAwsServiceFactoryGetAccountIDService(t *testing.T) {
 	}
 }
 
+func TestAwsServiceFactoryGetOrganizationService(t *testing.T) {
+	// Create a new session
+	session, err := session.NewSession()
+	if err != nil {
+		t.Errorf("Unexpected error while creating a new session: %v", err)
+	}
+
+	// Create an AWS Service Factory
+	sf := &AWSServiceFactory{
+		Session: session,
+	}
+
+	// Get the desired service
+	service := sf.GetOrganizationService()
+
+	// Is the service nil?
+	if service == nil {
+		t.Errorf("No service returned for %s", "GetOrganizationService")
+	}
+}
+
+func TestAwsServiceFactoryAssumeRole(t *testing.T) {
+	// Create a new AWS Service Factory
+	sf := &AWSServiceFactory{
+		ProfileName: "non-existent-profile-name",
+		RegionName:  "us-west-2",
+	}
+
+	// Initialize it...
+	sf.Init()
+
+	// Derive a factory for a member account
+	memberSF := sf.AssumeRole(OrganizationRoleARN(PartitionAWS, "222222222222", DefaultOrganizationRoleName))
+
+	// Is it a different session in the same region?
+	if memberSF.Session == sf.Session {
+		t.Errorf("Expected AssumeRole to construct a new session, but it did not")
+	} else if *memberSF.Session.Config.Region != "us-west-2" {
+		t.Errorf("Unexpected value for Region: expected %s, actual %s", "us-west-2", *memberSF.Session.Config.Region)
+	} else if memberSF.Session.Config.Credentials == sf.Session.Config.Credentials {
+		t.Errorf("Expected AssumeRole to construct new credentials, but it did not")
+	} else if memberSF.ProfileName != sf.ProfileName {
+		t.Errorf("Unexpected value for ProfileName: expected %s, actual %s", sf.ProfileName, memberSF.ProfileName)
+	}
+}
+
 func TestAwsServiceFactoryGetEC2InstanceService(t *testing.T) {
 	// Create our test cases
 	cases := []struct {
@@ -438,3 +485,37 @@ func TestAwsServiceFactoryGetEKSService(t *testing.T) {
 		})
 	}
 }
+
+func TestAwsServiceFactoryEndpoints(t *testing.T) {
+	// Create a new AWS Service Factory that sends requests to a stand-in for AWS
+	// (with another stand-in for S3)
+	sf := &AWSServiceFactory{
+		ProfileName:      "non-existent-profile-name",
+		RegionName:       "us-west-2",
+		EndpointURL:      "http://localhost:4566",
+		ServiceEndpoints: map[string]string{"s3": "http://localhost:9000"},
+		S3PathStyle:      true,
+	}
+
+	// Initialize it...
+	sf.Init()
+
+	// Loop through the factory and a factory for a member account...
+	for _, factory := range []*AWSServiceFactory{sf, sf.AssumeRole(OrganizationRoleARN(PartitionAWS, "222222222222", DefaultOrganizationRoleName))} {
+		// Do regional services use the global endpoint?
+		ec2Client := factory.GetEC2InstanceService("eu-west-1").Client.(*ec2.EC2)
+		if ec2Client.Endpoint != "http://localhost:4566" {
+			t.Errorf("Unexpected EC2 endpoint: expected %s, actual %s", "http://localhost:4566", ec2Client.Endpoint)
+		} else if *ec2Client.Config.Region != "eu-west-1" {
+			t.Errorf("Unexpected EC2 region: expected %s, actual %s", "eu-west-1", *ec2Client.Config.Region)
+		}
+
+		// Does S3 use its own endpoint (addressing buckets by path)?
+		s3Client := factory.GetS3Service().Client.(*s3.S3)
+		if s3Client.Endpoint != "http://localhost:9000" {
+			t.Errorf("Unexpected S3 endpoint: expected %s, actual %s", "http://localhost:9000", s3Client.Endpoint)
+		} else if !aws.BoolValue(s3Client.Config.S3ForcePathStyle) {
+			t.Errorf("Expected S3 to use path-style addressing, but it did not")
+		}
+	}
+}
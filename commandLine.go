@@ -10,48 +10,193 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	color "github.com/logrusorgru/aurora"
 )
 
+// BreakdownRegion is the value of --breakdown that writes a row for each region
+const BreakdownRegion = "region"
+
+// SubcommandServe is the subcommand that counts resources repeatedly, exporting
+// the counts as Prometheus metrics over HTTP
+const SubcommandServe = "serve"
+
+// SubcommandDaemon is the subcommand that counts resources on a schedule,
+// rotating its output files by date
+const SubcommandDaemon = "daemon"
+
+// The defaults of the serve subcommand
+const (
+	DefaultListenAddress = ":9180"
+	DefaultServeInterval = time.Hour
+)
+
+// The default schedule of the daemon subcommand
+const DefaultDaemonSchedule = "@daily"
+
+// The values of --rotate, which start a new output file every day or month
+const (
+	RotateDaily   = "daily"
+	RotateMonthly = "monthly"
+)
+
 // CommandLineSettings defines the command line settings supplied by
 // the caller.
 type CommandLineSettings struct {
+	// The subcommand whose arguments are processed (if any). Some arguments are
+	// only accepted by a subcommand.
+	subcommand string
+
+	// Configuration file
+	configFileName string
+
 	// Profile related settings
 	profileName        string
+	profileNames       []string
 	defaultProfileName string
 	useSSO             bool
 
+	// Organization related settings
+	organization bool
+	roleName     string
+
+	// Roles to assume (in place of the accounts of the profiles)
+	roleARNs []string
+
 	// Region related settings
-	allRegions bool
-	regionName string
+	partition      string
+	allRegions     bool
+	regionName     string
+	regions        []string
+	excludeRegions []string
+	concurrency    int
+	breakdown      string
+
+	// Output file (and, with --rotate, the name from which the name of each file
+	// is derived)
+	format             string
+	outputFileName     string
+	outputFile         *os.File
+	appendToOutput     bool
+	noOutputFile       bool
+	rotate             string
+	baseOutputFileName string
 
-	// Output (CSV) file
-	outputFileName string
-	outputFile     *os.File
-	appendToOutput bool
-	noOutputFile   bool
+	// History store (e.g., sqlite:resources.db)
+	storeSpec string
+	store     *Store
+
+	// Inventory file (which is appended to after the first run of the serve and
+	// daemon subcommands)
+	inventoryFileName string
+	inventoryFile     *os.File
+	appendToInventory bool
 
 	// Trace file
 	traceFileName string
 	traceFile     *os.File
+
+	// Folders of recorded AWS responses
+	recordDir string
+	replayDir string
+
+	// Endpoint related settings: the URL to send every AWS request to (in place of
+	// AWS), the URLs of individual services and how S3 buckets are addressed
+	endpointURL        string
+	serviceEndpoints   map[string]string
+	s3PathStyle        bool
+	noRegionValidation bool
+
+	// Error handling
+	continueOnError bool
+
+	// How requests are retried (and rate limited)
+	retryPolicy RetryPolicy
+	rateLimit   float64
+
+	// How long the run (and each region) may take
+	timeout       time.Duration
+	regionTimeout time.Duration
+
+	// Check the permissions of the caller before counting
+	preflight bool
+
+	// Rules that the counts must keep (and the previous runs that their growth is
+	// measured against)
+	rulesFileName string
+	rules         []Rule
+	previousRuns  []HistoryRow
+
+	// Prometheus related settings: the textfile to write and (for the serve
+	// subcommand) the address to listen on and the interval between runs
+	prometheusTextfile string
+	listenAddress      string
+	interval           time.Duration
+
+	// The schedule of the daemon subcommand (and whether it counts at once)
+	scheduleSpec string
+	schedule     Schedule
+	runNow       bool
+
+	// The selected counters
+	counters []Counter
 }
 
 // Process inspects the command line for valid arguments.
 //
 // Usage of aws-resource-counter
+//   --config CF:      Read settings from YAML file CF (overridden by arguments)
 //   --sso:            Use SSO for authentication
+//   --organization:   Count resources in every ACTIVE account of the organization
+//   --role-name RN:   Assume role RN in each member account (with --organization)
+//   --assume-roles RA: Count resources in the accounts of the (comma separated) role ARNs RA
+//   --format FMT:     Write the results in format FMT (csv, json or ndjson)
 //   --output-file OF: Write the results to file OF. Defaults to 'resources.csv'
 //   --no-output:      If set, then the results are not saved to any file.
+//   --inventory IF:   Write a record for each resource inspected to file IF
+//   --store ST:       Save the counts of each run to history store ST (e.g., sqlite:resources.db)
 //   --profile PN:     Use the credentials associated with shared profile PN
+//   --profiles PL:    Count resources for each profile in the comma separated list PL
 //   --region RN:      View resource counts for the AWS region RN
+//   --regions RL:     Only examine the regions in the comma separated list RL (names or globs)
+//   --exclude-regions RL: Do not examine the regions in the comma separated list RL (names or globs)
+//   --partition P:    Use partition P (aws, aws-us-gov or aws-cn). Detected from the caller if omitted
+//   --concurrency N:  Scan up to N regions at the same time
+//   --breakdown region: Write a row for each region along with the totals
+//   --only CL:        Only run the counters in the comma separated list CL
+//   --skip CL:        Do not run the counters in the comma separated list CL
+//   --continue-on-error: Record errors and keep counting instead of exiting
+//   --max-attempts N: Make up to N attempts at each (throttled or failed) request
+//   --max-backoff D:  Wait at most duration D between the attempts at a request
+//   --retry-jitter F: Randomize the fraction F (0 to 1) of each wait between attempts
+//   --rate-limit R:   Send at most R requests per second to each service in each region
+//   --timeout D:      Stop the run after duration D, keeping the partial results
+//   --region-timeout D: Give up on a region after a counter spends duration D on it
+//   --preflight:      Check the permissions of the caller before counting
+//   --rules RF:       Check the counts against the rules in YAML file RF
+//   --prometheus-textfile PF: Write the counts as Prometheus metrics to file PF
+//   --listen A:       Serve the metrics over HTTP on address A (serve only)
+//   --interval D:     Count the resources every duration D (serve only)
+//   --schedule S:     Count the resources on cron schedule S (daemon only)
+//   --run-now:        Count the resources at once, then on the schedule (daemon only)
+//   --rotate R:       Start a new output file every day or month (daemon only)
 //   --trace-file TF:  Create a trace file that contains all calls to AWS.
+//   --record DIR:     Record every AWS response in folder DIR
+//   --replay DIR:     Serve the AWS responses recorded in folder DIR (no credentials needed)
+//   --endpoint-url U: Send every AWS request to URL U (e.g., a local stand-in for AWS)
+//   --service-endpoints SE: Send the requests of each service to a URL (comma separated SERVICE=URL list SE)
+//   --s3-path-style:  Address S3 buckets by path rather than by host name
+//   --no-region-validation: Accept any region name (e.g., one known only to a stand-in for AWS)
 //   --version:        Display version information
 //
 func (cls *CommandLineSettings) Process(args []string, am ActivityMonitor) func() {
 	var showVersion bool
+	var profileList, roleARNList, onlyList, skipList, serviceEndpointList, regionList, excludeRegionList string
 	emptyFn := func() {}
 
 	// What is our default profile?
@@ -60,41 +205,252 @@ func (cls *CommandLineSettings) Process(args []string, am ActivityMonitor) func(
 	}
 
 	// Define a new FlagSet
-	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagSet := flag.NewFlagSet(strings.TrimSpace(os.Args[0]+" "+cls.subcommand), flag.ExitOnError)
 
 	// Define and parse the command line arguments...
+	flagSet.StringVar(&cls.configFileName, "config", "", "Read settings from a YAML configuration `file`. Arguments on the command line override the settings in the file.")
 	flagSet.BoolVar(&cls.useSSO, "sso", false, "Use SSO for authentication (default false)")
-	flagSet.StringVar(&cls.outputFileName, "output-file", "", "CSV Output File. Specify a path to a `file` to save the generated CSV file. (default resources.csv)")
+	flagSet.BoolVar(&cls.organization, "organization", false, "Count resources in every ACTIVE account of the AWS Organization. Must be run from the management account. (default false)")
+	flagSet.StringVar(&cls.roleName, "role-name", DefaultOrganizationRoleName, "The name of the `role` to assume in each member account (used with --organization).")
+	flagSet.StringVar(&roleARNList, "assume-roles", "", "Count resources in the account of each role in a comma separated `list` of role ARNs (rather than the account of the profile).")
+	flagSet.StringVar(&cls.format, "format", FormatCSV, "The `format` of the output file: csv, json or ndjson.")
+	flagSet.StringVar(&cls.outputFileName, "output-file", "", "Output File. Specify a path to a `file` to save the generated results. (default resources.csv, resources.json or resources.ndjson)")
 	flagSet.BoolVar(&cls.noOutputFile, "no-output", false, "Do not save the results of this run into any file. (default false--save results to a file)")
+	flagSet.StringVar(&cls.storeSpec, "store", "", "Save the counts (and errors) of each run to a history `store` (e.g., sqlite:resources.db), which can be queried with the query subcommand.")
+	flagSet.StringVar(&cls.inventoryFileName, "inventory", "", "Write a record for each resource inspected (and whether it was counted) to a `file`. The file is written as CSV if its name ends in .csv or as NDJSON otherwise.")
 	flagSet.StringVar(&cls.profileName, "profile", cls.defaultProfileName, "The name of the AWS Profile to use.")
+	flagSet.StringVar(&profileList, "profiles", "", "Count resources for each AWS Profile in a comma separated `list` of profile names.")
 	flagSet.StringVar(&cls.regionName, "region", "", "The name of the AWS Region to use. If omitted, then all regions will be examined. This is the default behavior.")
+	flagSet.StringVar(&regionList, "regions", "", "Only examine the regions in a comma separated `list` of region names or glob patterns (e.g., us-*). The regions that are not enabled for an account are left out.")
+	flagSet.StringVar(&excludeRegionList, "exclude-regions", "", "Do not examine the regions in a comma separated `list` of region names or glob patterns (e.g., ap-*).")
+	flagSet.StringVar(&cls.partition, "partition", "", fmt.Sprintf("The `partition` of the accounts (%s). If omitted, it is detected from the identity of the caller (and any --region).", strings.Join(Partitions, ", ")))
+	flagSet.IntVar(&cls.concurrency, "concurrency", 1, "The maximum `number` of regions to scan at the same time.")
+	flagSet.StringVar(&cls.breakdown, "breakdown", "", "Break down the counts of each account. Use `region` to write a row for each region that was examined, followed by a row with the totals.")
+	flagSet.StringVar(&onlyList, "only", "", fmt.Sprintf("Only run the counters in a comma separated `list` of counter names (%s).", strings.Join(CounterNames(), ", ")))
+	flagSet.StringVar(&skipList, "skip", "", "Do not run the counters in a comma separated `list` of counter names.")
+	flagSet.BoolVar(&cls.continueOnError, "continue-on-error", false, "Record errors (e.g., access denied in a region) and keep counting rather than exiting. Incomplete counts are marked in the output. (default false)")
+	flagSet.IntVar(&cls.retryPolicy.MaxAttempts, "max-attempts", DefaultMaxAttempts, "The maximum `number` of attempts at each request that is throttled (or fails in a way that can be retried).")
+	flagSet.DurationVar(&cls.retryPolicy.MaxBackoff, "max-backoff", DefaultMaxBackoff, "The maximum `duration` to wait between the attempts at a request (e.g., 30s). The wait doubles with each attempt, up to this cap.")
+	flagSet.Float64Var(&cls.retryPolicy.Jitter, "retry-jitter", DefaultRetryJitter, "The `fraction` (0 to 1) of each wait between attempts that is random, so that throttled requests do not retry in lockstep.")
+	flagSet.Float64Var(&cls.rateLimit, "rate-limit", 0, "The maximum `number` of requests per second sent to each service in each region. If omitted (or 0), requests are not limited.")
+	flagSet.DurationVar(&cls.timeout, "timeout", 0, "The maximum `duration` of the run (e.g., 30m). When it is reached, counting stops and the partial results are saved (marked as incomplete). If omitted (or 0), the run is not limited.")
+	flagSet.DurationVar(&cls.regionTimeout, "region-timeout", 0, "The maximum `duration` that a counter may spend in a single region (e.g., 2m). A region that takes longer is marked as incomplete. If omitted (or 0), regions are not limited.")
+	flagSet.BoolVar(&cls.preflight, "preflight", false, "Check that the caller is allowed to call every action needed by the selected counters before counting. (default false)")
+	flagSet.StringVar(&cls.rulesFileName, "rules", "", "Check the counts against the rules in a YAML `file` (e.g., lightsail == 0 or ec2 growth < 20%). The tool exits with code 4 if any rule is broken.")
+	flagSet.StringVar(&cls.prometheusTextfile, "prometheus-textfile", "", "Write the counts as Prometheus metrics to a `file` (e.g., for the textfile collector of node_exporter).")
+	if cls.subcommand == SubcommandServe {
+		flagSet.StringVar(&cls.listenAddress, "listen", DefaultListenAddress, "The `address` on which the metrics are served over HTTP (at /metrics).")
+		flagSet.DurationVar(&cls.interval, "interval", DefaultServeInterval, "The `duration` between the starts of two runs (e.g., 30m).")
+	}
+	if cls.subcommand == SubcommandDaemon {
+		flagSet.StringVar(&cls.scheduleSpec, "schedule", DefaultDaemonSchedule, "The `schedule` of the runs: a cron specification in local time (e.g., '0 2 * * 1-5'), @hourly, @daily, @weekly, @monthly or @every followed by a duration (e.g., '@every 6h').")
+		flagSet.BoolVar(&cls.runNow, "run-now", false, "Count the resources as soon as the daemon starts, rather than waiting for the first scheduled run. (default false)")
+		flagSet.StringVar(&cls.rotate, "rotate", "", fmt.Sprintf("Start a new output file every `period` (%s or %s), adding the date to its name (e.g., resources-2024-05-01.csv).", RotateDaily, RotateMonthly))
+	}
 	flagSet.StringVar(&cls.traceFileName, "trace-file", "", "AWS Trace Log. Specify a `file` to record API calls being made. Each subsequent run OVERWRITES the prior run.")
+	flagSet.StringVar(&cls.recordDir, "record", "", "Record every request made to AWS (and its response) in a `folder`, so that the run can be replayed with --replay.")
+	flagSet.StringVar(&cls.replayDir, "replay", "", "Serve the responses recorded (by --record) in a `folder` in place of AWS. No credentials or network access are needed.")
+	flagSet.StringVar(&cls.endpointURL, "endpoint-url", "", "Send every AWS request to a `URL` (e.g., a local stand-in for AWS) rather than to the endpoints of AWS.")
+	flagSet.StringVar(&serviceEndpointList, "service-endpoints", "", fmt.Sprintf("Send the requests of individual services to other URLs, using a comma separated `list` of SERVICE=URL (services: %s). Overrides --endpoint-url.", strings.Join(EndpointServiceNames, ", ")))
+	flagSet.BoolVar(&cls.s3PathStyle, "s3-path-style", false, "Address S3 buckets by path (http://host/bucket) rather than by host name (http://bucket.host). Needed by most local stand-ins for AWS. (default false)")
+	flagSet.BoolVar(&cls.noRegionValidation, "no-region-validation", false, "Accept any --region name, rather than just the regions known to this tool. (default false)")
 	flagSet.BoolVar(&showVersion, "version", false, "Shows the version number.")
 	flagSet.Parse(args)
 
-	// Check for a valid AWS Region
+	// Collect all of the problems with our settings, so that they can be reported at once
+	var problems []string
+
+	// Was a configuration file supplied? If so, merge its settings with ours.
+	if cls.configFileName != "" {
+		problems = append(problems, ApplyConfigFile(cls.configFileName, flagSet)...)
+	}
+
+	// Split our lists of profiles and roles
+	cls.profileNames = splitList(profileList)
+	cls.roleARNs = splitList(roleARNList)
+
+	// Select our counters
+	var counterProblems []string
+	cls.counters, counterProblems = SelectCounters(splitList(onlyList), splitList(skipList))
+	problems = append(problems, counterProblems...)
+	if len(counterProblems) == 0 && len(cls.counters) == 0 {
+		problems = append(problems, "No counters are selected by --only and --skip!")
+	}
+
+	// Check for a valid partition
+	if cls.partition != "" && !Contains(Partitions, cls.partition) {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid partition (expected one of %s).", cls.partition, strings.Join(Partitions, ", ")))
+	}
+
+	// Split our lists of regions
+	cls.regions = splitList(regionList)
+	cls.excludeRegions = splitList(excludeRegionList)
+
+	// Check for a valid AWS Region (of the partition, if supplied)
 	if cls.regionName != "" {
-		// If not valid region name, then get out now...
-		if !IsValidRegionName(cls.regionName) {
-			am.ActionError("Error: '%s' is not a valid AWS Region name.", cls.regionName)
-			return emptyFn
+		// If not valid region name (and we are validating them), then complain...
+		if !cls.noRegionValidation && !IsValidRegionName(cls.partition, cls.regionName) {
+			if cls.partition != "" {
+				problems = append(problems, fmt.Sprintf("'%s' is not a valid AWS Region name in partition %s.", cls.regionName, cls.partition))
+			} else {
+				problems = append(problems, fmt.Sprintf("'%s' is not a valid AWS Region name.", cls.regionName))
+			}
+		}
+
+		// If no partition was supplied, use the partition of the region (if known)
+		if cls.partition == "" {
+			cls.partition = PartitionOfRegion(cls.regionName)
 		}
 	} else {
 		// Record that all regions are being examined
 		cls.allRegions = true
 	}
 
+	// Check the selection of regions
+	problems = append(problems, cls.checkRegionSelection()...)
+
+	// Ensure that we scan at least one region at a time
+	if cls.concurrency < 1 {
+		problems = append(problems, fmt.Sprintf("--concurrency must be at least 1 (not %d).", cls.concurrency))
+	}
+
+	// Check our retry policy and rate limit
+	if cls.retryPolicy.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("--max-attempts must be at least 1 (not %d).", cls.retryPolicy.MaxAttempts))
+	}
+	if cls.retryPolicy.MaxBackoff <= 0 {
+		problems = append(problems, fmt.Sprintf("--max-backoff must be greater than 0 (not %v).", cls.retryPolicy.MaxBackoff))
+	}
+	if cls.retryPolicy.Jitter < 0 || cls.retryPolicy.Jitter > 1 {
+		problems = append(problems, fmt.Sprintf("--retry-jitter must be between 0 and 1 (not %v).", cls.retryPolicy.Jitter))
+	}
+	if cls.rateLimit < 0 {
+		problems = append(problems, fmt.Sprintf("--rate-limit cannot be negative (not %v).", cls.rateLimit))
+	}
+
+	// Check our timeouts
+	if cls.timeout < 0 {
+		problems = append(problems, fmt.Sprintf("--timeout cannot be negative (not %v).", cls.timeout))
+	}
+	if cls.regionTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("--region-timeout cannot be negative (not %v).", cls.regionTimeout))
+	}
+
+	// Read our rules
+	if cls.rulesFileName != "" {
+		var rulesProblems []string
+		cls.rules, rulesProblems = ReadRulesFile(cls.rulesFileName)
+		problems = append(problems, rulesProblems...)
+	}
+
+	// Check for a valid breakdown
+	if cls.breakdown != "" && cls.breakdown != BreakdownRegion {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid breakdown (expected %s).", cls.breakdown, BreakdownRegion))
+	}
+
+	// If sweeping an organization, we must have a role to assume
+	if cls.organization && cls.roleName == "" {
+		problems = append(problems, "Must specify a non-empty --role-name with --organization!")
+	}
+
+	// Check each of the roles to assume
+	if len(cls.roleARNs) > 0 && cls.organization {
+		problems = append(problems, "Cannot specify both --assume-roles and --organization!")
+	}
+	for _, roleARN := range cls.roleARNs {
+		if !IsValidRoleARN(roleARN) {
+			problems = append(problems, fmt.Sprintf("'%s' is not a valid IAM role ARN.", roleARN))
+		}
+	}
+
+	// If both --profile and --profiles specified, then complain
+	if len(cls.profileNames) > 0 && isSet(flagSet, "profile") {
+		problems = append(problems, "Cannot specify both --profile and --profiles!")
+	}
+
+	// Check for a valid output format
+	if !Contains(OutputFormats, cls.format) {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid output format (expected one of %s).", cls.format, strings.Join(OutputFormats, ", ")))
+	}
+
 	// If both --output-file and --no-output specified, then complain
 	if cls.outputFileName != "" && cls.noOutputFile {
-		// Show error...
-		am.ActionError("Error: Cannot specify both --output-file and -no-output!")
+		problems = append(problems, "Cannot specify both --output-file and -no-output!")
+	}
+
+	// Check the settings of the serve subcommand. It only writes an output file if
+	// one is named.
+	if cls.subcommand == SubcommandServe {
+		if cls.interval <= 0 {
+			problems = append(problems, fmt.Sprintf("--interval must be greater than 0 (not %v).", cls.interval))
+		}
+		if cls.outputFileName == "" {
+			cls.noOutputFile = true
+		}
+	}
+
+	// Check the settings of the daemon subcommand
+	if cls.subcommand == SubcommandDaemon {
+		var err error
+		if cls.schedule, err = ParseSchedule(cls.scheduleSpec); err != nil {
+			problems = append(problems, err.Error()+".")
+		}
+		if cls.rotate != "" && cls.rotate != RotateDaily && cls.rotate != RotateMonthly {
+			problems = append(problems, fmt.Sprintf("'%s' is not a valid rotation (expected %s or %s).", cls.rotate, RotateDaily, RotateMonthly))
+		}
+		if cls.rotate != "" && cls.noOutputFile {
+			problems = append(problems, "Cannot specify both --rotate and --no-output!")
+		}
+	}
+
+	// The runs of the serve and daemon subcommands are appended to their output
+	// file, so it cannot be written in JSON (a single document)
+	if (cls.subcommand == SubcommandServe || cls.subcommand == SubcommandDaemon) && !cls.noOutputFile && cls.format == FormatJSON {
+		problems = append(problems, fmt.Sprintf("Cannot write a JSON output file with the %s subcommand (use csv or ndjson)!", cls.subcommand))
+	}
+
+	// Check for a valid history store
+	if cls.storeSpec != "" {
+		if _, _, err := ParseStoreSpec(cls.storeSpec); err != nil {
+			problems = append(problems, err.Error()+".")
+		}
+	}
+
+	// Check our recording settings
+	if cls.recordDir != "" && cls.replayDir != "" {
+		problems = append(problems, "Cannot specify both --record and --replay!")
+	}
+	if cls.replayDir != "" && !DirExists(cls.replayDir) {
+		problems = append(problems, fmt.Sprintf("'%s' is not a folder of recorded responses.", cls.replayDir))
+	}
+
+	// Check for a valid endpoint URL
+	if cls.endpointURL != "" && !IsValidEndpointURL(cls.endpointURL) {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid endpoint URL (expected, e.g., http://localhost:4566).", cls.endpointURL))
+	}
+	var endpointProblems []string
+	cls.serviceEndpoints, endpointProblems = parseServiceEndpoints(splitList(serviceEndpointList))
+	problems = append(problems, endpointProblems...)
+
+	// Did we find any problems? If so, report all of them.
+	if len(problems) == 1 {
+		am.ActionError("Error: %s", problems[0])
+		return emptyFn
+	} else if len(problems) > 1 {
+		am.ActionError("Error: Found %d problems with the settings:\n - %s", len(problems), strings.Join(problems, "\n - "))
 		return emptyFn
 	}
 
 	// If no output file specified, then use a default name (assuming that we are not barring output)
 	if cls.outputFileName == "" && !cls.noOutputFile {
-		// Set the default output file
-		cls.outputFileName = "resources.csv"
+		// Set the default output file (with an extension matching the format)
+		cls.outputFileName = "resources." + cls.format
+	}
+
+	// Are we rotating our output file? If so, add the date to its name.
+	cls.baseOutputFileName = cls.outputFileName
+	if cls.rotate != "" {
+		cls.outputFileName = RotatedFileName(cls.baseOutputFileName, cls.rotate, time.Now())
 	}
 
 	// Did the user just want to see the version?
@@ -107,11 +463,40 @@ func (cls *CommandLineSettings) Process(args []string, am ActivityMonitor) func(
 
 	// Check whether a response file is being specified
 	if cls.outputFileName != "" && !cls.noOutputFile {
-		// Determine whether to append the output file or not
-		cls.appendToOutput = FileExists(cls.outputFileName)
+		// Read the previous runs, so that the growth of our counts can be checked
+		// (before a JSON file is overwritten)
+		if len(cls.rules) > 0 && FileExists(cls.outputFileName) {
+			var err error
+			if cls.previousRuns, err = ReadHistoryFile(cls.outputFileName); err != nil {
+				am.ActionError("Error: Unable to read the previous runs in %s: %v", cls.outputFileName, err)
+				return emptyFn
+			}
+		}
 
 		// Try to open the file for writing
-		cls.outputFile = OpenFileForWriting(cls.outputFileName, "CSV", am, cls.appendToOutput)
+		if !cls.openOutputFile(am) {
+			return emptyFn
+		}
+	}
+
+	// Open our history store (upgrading its schema, if needed)
+	if cls.storeSpec != "" {
+		var err error
+		if cls.store, err = OpenStore(cls.storeSpec); err != nil {
+			am.ActionError("Error: Unable to open the store %s: %v", cls.storeSpec, err)
+			return emptyFn
+		}
+	}
+
+	// Check whether an inventory file is being specified
+	if cls.inventoryFileName != "" {
+		// Try to open the file for writing
+		cls.inventoryFile = OpenFileForWriting(cls.inventoryFileName, "inventory", am, false)
+	}
+
+	// Make sure that our recording folder exists
+	if cls.recordDir != "" && am.CheckError(os.MkdirAll(cls.recordDir, 0777)) {
+		return emptyFn
 	}
 
 	// Check whether a trace file is being specified
@@ -125,20 +510,188 @@ func (cls *CommandLineSettings) Process(args []string, am ActivityMonitor) func(
 		if !NilInterface(cls.outputFile) {
 			cls.outputFile.Close()
 		}
+		if cls.store != nil {
+			cls.store.Close()
+		}
+		if !NilInterface(cls.inventoryFile) {
+			cls.inventoryFile.Close()
+		}
 		if !NilInterface(cls.traceFile) {
 			cls.traceFile.Close()
 		}
 	}
 }
 
+// Open the output file for writing (recording an error if it cannot be opened).
+// It returns false if the file cannot be appended to.
+func (cls *CommandLineSettings) openOutputFile(am ActivityMonitor) bool {
+	// Determine whether to append the output file or not. A JSON file holds a
+	// single document, so it is always overwritten.
+	cls.appendToOutput = cls.format != FormatJSON && FileExists(cls.outputFileName)
+
+	// When appending to a CSV file, its columns must match ours
+	if cls.appendToOutput && cls.format == FormatCSV {
+		header, err := ReadCSVHeader(cls.outputFileName)
+		if am.CheckError(err) {
+			return false
+		}
+
+		// Does the file (if not empty) have the same columns?
+		columns := ResultColumns(cls.counters, cls.breakdown == BreakdownRegion)
+		if header != nil && strings.Join(header, ",") != strings.Join(columns, ",") {
+			am.ActionError("Error: Cannot append to %s as its columns do not match the selected counters.\n   File:     %s\n   Expected: %s",
+				cls.outputFileName, strings.Join(header, ", "), strings.Join(columns, ", "))
+			return false
+		}
+	}
+
+	// Try to open the file for writing
+	cls.outputFile = OpenFileForWriting(cls.outputFileName, strings.ToUpper(cls.format), am, cls.appendToOutput)
+
+	return true
+}
+
+// rotateOutputFile moves on to the output file for the supplied time (with
+// --rotate), closing the current one. It returns false if the new file cannot be
+// appended to.
+func (cls *CommandLineSettings) rotateOutputFile(now time.Time, am ActivityMonitor) bool {
+	// Is it time for another file?
+	fileName := RotatedFileName(cls.baseOutputFileName, cls.rotate, now)
+	if cls.rotate == "" || cls.noOutputFile || fileName == cls.outputFileName {
+		return true
+	}
+
+	// Close the current file and open the next
+	if !NilInterface(cls.outputFile) {
+		cls.outputFile.Close()
+	}
+	cls.outputFileName = fileName
+	am.Message("\nWriting the results to %s\n", cls.outputFileName)
+
+	return cls.openOutputFile(am)
+}
+
+// ProfileNames returns the names of the profiles whose credentials are used to
+// count resources: those in --profiles or, if omitted, the one in --profile.
+func (cls *CommandLineSettings) ProfileNames() []string {
+	if len(cls.profileNames) > 0 {
+		return cls.profileNames
+	}
+
+	return []string{cls.profileName}
+}
+
+// counterSelected returns whether the named counter was selected
+func (cls *CommandLineSettings) counterSelected(name string) bool {
+	for _, counter := range cls.counters {
+		if counter.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check the regions selected by --regions and --exclude-regions. If no partition
+// was supplied, the partition of the first selected region name (if known) is
+// used. The returned list describes every problem found.
+func (cls *CommandLineSettings) checkRegionSelection() []string {
+	var problems []string
+
+	// Nothing selected?
+	if len(cls.regions) == 0 && len(cls.excludeRegions) == 0 {
+		return nil
+	}
+
+	// The selection only applies when all regions are examined
+	if cls.regionName != "" {
+		return []string{"Cannot specify --regions or --exclude-regions with --region!"}
+	}
+
+	// Check each of the region names and patterns (unless we are not validating them)
+	for _, pattern := range append(append([]string{}, cls.regions...), cls.excludeRegions...) {
+		if !cls.noRegionValidation && !IsValidRegionPattern(cls.partition, pattern) {
+			problems = append(problems, fmt.Sprintf("'%s' does not match any AWS Region name.", pattern))
+		}
+	}
+
+	// If no partition was supplied, use the partition of the selected regions (if known)
+	for _, regionName := range cls.regions {
+		if cls.partition == "" && !IsRegionPattern(regionName) {
+			cls.partition = PartitionOfRegion(regionName)
+		}
+	}
+
+	return problems
+}
+
+// Determine whether the named argument was set (on the command line or by the
+// configuration file)
+func isSet(flagSet *flag.FlagSet, name string) bool {
+	found := false
+	flagSet.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+
+	return found
+}
+
+// Split a comma separated list, ignoring empty elements
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Parse a list of service endpoints (each SERVICE=URL) into a map of URLs keyed
+// by the name of the service. The returned list describes every problem found.
+func parseServiceEndpoints(list []string) (map[string]string, []string) {
+	var problems []string
+	endpoints := make(map[string]string)
+	for _, item := range list {
+		// Split the item into its service and URL
+		serviceName, endpointURL, found := strings.Cut(item, "=")
+		serviceName = strings.ToLower(strings.TrimSpace(serviceName))
+		endpointURL = strings.TrimSpace(endpointURL)
+
+		// Check both of them
+		if !found || !Contains(EndpointServiceNames, serviceName) {
+			problems = append(problems, fmt.Sprintf("'%s' is not a valid service endpoint (expected SERVICE=URL, where SERVICE is one of %s).", item, strings.Join(EndpointServiceNames, ", ")))
+		} else if !IsValidEndpointURL(endpointURL) {
+			problems = append(problems, fmt.Sprintf("'%s' is not a valid endpoint URL for %s.", endpointURL, serviceName))
+		} else {
+			endpoints[serviceName] = endpointURL
+		}
+	}
+
+	return endpoints, problems
+}
+
 // Display constructs a listing of all command line settings to the Activity Monitor
 func (cls *CommandLineSettings) Display(am ActivityMonitor) {
 	// What is the region being selected?
 	var displayRegionName string
-	if cls.regionName == "" {
-		displayRegionName = "(All regions supported by this account)"
-	} else {
+	switch {
+	case cls.regionName != "":
 		displayRegionName = cls.regionName
+	case len(cls.regions) > 0 || len(cls.excludeRegions) > 0:
+		displayRegionName = "(Regions supported by this account"
+		if len(cls.regions) > 0 {
+			displayRegionName += " matching " + strings.Join(cls.regions, ", ")
+		}
+		if len(cls.excludeRegions) > 0 {
+			displayRegionName += " except " + strings.Join(cls.excludeRegions, ", ")
+		}
+		displayRegionName += ")"
+	default:
+		displayRegionName = "(All regions supported by this account)"
 	}
 
 	// What is the file name for the output file
@@ -151,10 +704,122 @@ func (cls *CommandLineSettings) Display(am ActivityMonitor) {
 
 	// Output information about utility running
 	am.Message("%s (v%s) running with:\n", color.Bold("Cloud Resource Counter"), version)
-	am.Message(" o %s: %s\n", color.Italic("AWS Profile"), cls.profileName)
+	am.Message(" o %s: %s\n", color.Italic("AWS Profile"), strings.Join(cls.ProfileNames(), ", "))
 	am.Message(" o %s:  %s\n", color.Italic("AWS Region"), displayRegionName)
+
+	// Was a partition selected?
+	if cls.partition != "" {
+		am.Message(" o %s: %s\n", color.Italic("AWS Partition"), cls.partition)
+	}
 	am.Message(" o %s: %s\n", color.Italic("Output file"), displayOutputFile)
 
+	// Are we writing something other than CSV?
+	if cls.format != "" && cls.format != FormatCSV && cls.outputFileName != "" {
+		am.Message(" o %s: %s\n", color.Italic("Output format"), strings.ToUpper(cls.format))
+	}
+
+	// Are we scanning regions concurrently?
+	if cls.concurrency > 1 {
+		am.Message(" o %s: %d regions at a time\n", color.Italic("Concurrency"), cls.concurrency)
+	}
+
+	// Are we limiting how long we run?
+	if cls.timeout > 0 {
+		am.Message(" o %s: %v\n", color.Italic("Timeout"), cls.timeout)
+	}
+	if cls.regionTimeout > 0 {
+		am.Message(" o %s: %v\n", color.Italic("Region timeout"), cls.regionTimeout)
+	}
+
+	// Are we breaking down the counts?
+	if cls.breakdown == BreakdownRegion {
+		am.Message(" o %s: One row per region, followed by the totals\n", color.Italic("Breakdown"))
+	}
+
+	// Are we continuing on errors?
+	if cls.continueOnError {
+		am.Message(" o %s: Yes (incomplete counts are marked)\n", color.Italic("Continue on error"))
+	}
+
+	// Are we checking permissions first?
+	if cls.preflight {
+		am.Message(" o %s: Yes (permissions are checked before counting)\n", color.Italic("Preflight"))
+	}
+
+	// Are we exporting metrics?
+	if cls.prometheusTextfile != "" {
+		am.Message(" o %s: %s\n", color.Italic("Prometheus textfile"), cls.prometheusTextfile)
+	}
+	if cls.subcommand == SubcommandServe {
+		am.Message(" o %s: http://%s/metrics (counting every %v)\n", color.Italic("Serving metrics"), cls.listenAddress, cls.interval)
+	}
+
+	// Are we counting on a schedule?
+	if cls.subcommand == SubcommandDaemon {
+		am.Message(" o %s: %s\n", color.Italic("Schedule"), cls.scheduleSpec)
+	}
+	if cls.rotate != "" {
+		am.Message(" o %s: %s (%s)\n", color.Italic("Rotate output"), cls.rotate, cls.baseOutputFileName)
+	}
+
+	// Are we checking rules?
+	if cls.rulesFileName != "" {
+		am.Message(" o %s: %s (%d rules)\n", color.Italic("Rules"), cls.rulesFileName, len(cls.rules))
+	}
+
+	// Are we sweeping an organization?
+	if cls.organization {
+		am.Message(" o %s: All ACTIVE accounts (role %s)\n", color.Italic("Organization"), cls.roleName)
+	}
+
+	// Are we assuming roles?
+	if len(cls.roleARNs) > 0 {
+		am.Message(" o %s: %s\n", color.Italic("Assume roles"), strings.Join(cls.roleARNs, ", "))
+	}
+
+	// Did we read a configuration file?
+	if cls.configFileName != "" {
+		am.Message(" o %s: %s\n", color.Italic("Config file"), cls.configFileName)
+	}
+
+	// Are we saving our counts to a store?
+	if cls.storeSpec != "" {
+		am.Message(" o %s: %s\n", color.Italic("Store"), cls.storeSpec)
+	}
+
+	// Are we keeping an inventory?
+	if cls.inventoryFileName != "" {
+		am.Message(" o %s: %s (%s)\n", color.Italic("Inventory file"), cls.inventoryFileName, strings.ToUpper(InventoryFormat(cls.inventoryFileName)))
+	}
+
+	// Are we recording or replaying?
+	if cls.recordDir != "" {
+		am.Message(" o %s: %s\n", color.Italic("Recording to"), cls.recordDir)
+	}
+	if cls.replayDir != "" {
+		am.Message(" o %s: %s (no calls are made to AWS)\n", color.Italic("Replaying from"), cls.replayDir)
+	}
+
+	// Are we using other endpoints?
+	if cls.endpointURL != "" {
+		am.Message(" o %s: %s\n", color.Italic("Endpoint URL"), cls.endpointURL)
+	}
+	if len(cls.serviceEndpoints) > 0 {
+		var endpoints []string
+		for _, serviceName := range EndpointServiceNames {
+			if endpointURL, ok := cls.serviceEndpoints[serviceName]; ok {
+				endpoints = append(endpoints, serviceName+"="+endpointURL)
+			}
+		}
+		am.Message(" o %s: %s\n", color.Italic("Service endpoints"), strings.Join(endpoints, ", "))
+	}
+	if cls.s3PathStyle {
+		am.Message(" o %s: Path-style (http://host/bucket)\n", color.Italic("S3 addressing"))
+	}
+	if cls.noRegionValidation {
+		am.Message(" o %s: Off (any region name is accepted)\n", color.Italic("Region validation"))
+	}
+
 	// Are we tracing?
 	if cls.traceFileName != "" {
 		am.Message(" o %s:  %s\n", color.Italic("Trace file"), cls.traceFileName)
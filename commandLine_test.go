@@ -2,8 +2,10 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/expel-io/aws-resource-counter/mock"
 )
@@ -12,6 +14,16 @@ func TestCommandLineProcess(t *testing.T) {
 	// Our temp file
 	const tempFile = "temp-output-file"
 
+	// A valid and an invalid rules file
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rulesFile, []byte("rules:\n  - lightsail == 0\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while writing rules file: %v", err)
+	}
+	badRulesFile := filepath.Join(t.TempDir(), "bad-rules.yaml")
+	if err := os.WriteFile(badRulesFile, []byte("rules:\n  - lightsail is zero\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while writing rules file: %v", err)
+	}
+
 	// Construct our test cases...
 	cases := []struct {
 		Args             []string
@@ -20,6 +32,8 @@ func TestCommandLineProcess(t *testing.T) {
 		ExpectAppend     bool
 		ExpectAllRegions bool
 		ExpectSSO        bool
+		ExpectOrg        bool
+		ExpectContinue   bool
 	}{
 		{
 			Args:             []string{"--output-file", tempFile},
@@ -49,6 +63,122 @@ func TestCommandLineProcess(t *testing.T) {
 			ExpectAllRegions: true,
 			ExpectSSO:        true,
 		},
+		{
+			Args:             []string{"--organization", "--no-output"},
+			ExpectAllRegions: true,
+			ExpectOrg:        true,
+		},
+		{
+			Args:             []string{"--continue-on-error", "--no-output"},
+			ExpectAllRegions: true,
+			ExpectContinue:   true,
+		},
+		{
+			Args:        []string{"--organization", "--role-name", "", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--format", "xml", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--breakdown", "region", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--breakdown", "service", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--format", "ndjson", "--output-file", tempFile},
+			ExpectAppend:     true,
+			ExpectAllRegions: true,
+		},
+		{
+			Args:             []string{"--format", "json", "--output-file", tempFile},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:             []string{"--replay", ".", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--replay", "no-such-recording", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--record", ".", "--replay", ".", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--endpoint-url", "http://localhost:4566", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--endpoint-url", "localhost:4566", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--service-endpoints", "s3=http://localhost:9000,ec2=http://localhost:4566", "--s3-path-style", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--service-endpoints", "dynamodb=http://localhost:4566", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--service-endpoints", "s3", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args: []string{"--region", "local-1", "--no-region-validation", "--no-output"},
+		},
+		{
+			Args: []string{"--region", "us-gov-west-1", "--no-output"},
+		},
+		{
+			Args: []string{"--partition", "aws-cn", "--region", "cn-north-1", "--no-output"},
+		},
+		{
+			Args:        []string{"--partition", "aws-cn", "--region", "us-east-1", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--partition", "aws-iso", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--regions", "us-east-1,eu-*", "--exclude-regions", "eu-central-?", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--regions", "us-east-1,xx-*", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--region", "us-east-1", "--exclude-regions", "ap-*", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--regions", "local-*", "--no-region-validation", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:             []string{"--timeout", "30m", "--region-timeout", "2m", "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--region-timeout", "-1s", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:             []string{"--rules", rulesFile, "--no-output"},
+			ExpectAllRegions: true,
+		},
+		{
+			Args:        []string{"--rules", badRulesFile, "--no-output"},
+			ExpectError: true,
+		},
 	}
 
 	// Does the file exist?
@@ -90,6 +220,10 @@ func TestCommandLineProcess(t *testing.T) {
 			t.Errorf("Unexpected AllRegions: expected %v, actual: %v", c.ExpectAllRegions, settings.allRegions)
 		} else if c.ExpectSSO != settings.useSSO {
 			t.Errorf("Unexpected SSO: expected %v, actual: %v", c.ExpectSSO, settings.useSSO)
+		} else if c.ExpectOrg != settings.organization {
+			t.Errorf("Unexpected Organization: expected %v, actual: %v", c.ExpectOrg, settings.organization)
+		} else if c.ExpectContinue != settings.continueOnError {
+			t.Errorf("Unexpected ContinueOnError: expected %v, actual: %v", c.ExpectContinue, settings.continueOnError)
 		}
 	}
 
@@ -196,3 +330,208 @@ func TestCommandLineDisplay(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandLineAppendColumns(t *testing.T) {
+	// Create an output file holding the columns of all counters
+	allCounters, _ := SelectCounters(nil, nil)
+	outputFileName := filepath.Join(t.TempDir(), "resources.csv")
+	header := strings.Join(ResultColumns(allCounters, false), ",") + "\n"
+	if err := os.WriteFile(outputFileName, []byte(header), 0666); err != nil {
+		t.Fatalf("Unexpected error while writing output file: %v", err)
+	}
+
+	// Construct our test cases...
+	cases := []struct {
+		Args        []string
+		ExpectError bool
+	}{
+		{
+			Args: []string{"--output-file", outputFileName},
+		},
+		{
+			Args:        []string{"--output-file", outputFileName, "--only", "ec2,s3"},
+			ExpectError: true,
+		},
+		{
+			Args: []string{"--output-file", outputFileName, "--only", "ec2,s3", "--format", "ndjson"},
+		},
+		{
+			Args:        []string{"--no-output", "--only", "ec2,dynamodb"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--no-output", "--only", "ec2", "--skip", "ec2"},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a Command Line
+		settings := &CommandLineSettings{}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Invoke the Process method
+		cleanupFn := settings.Process(c.Args, mon)
+		cleanupFn()
+
+		// Did we get the expected error?
+		if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured for %v: expected %v, actual %v (%v)", c.Args, c.ExpectError, mon.ErrorOccured, mon.Messages)
+		}
+	}
+}
+
+func TestCommandLineServe(t *testing.T) {
+	outputFileName := filepath.Join(t.TempDir(), "resources.ndjson")
+
+	// Construct our test cases...
+	cases := []struct {
+		Args             []string
+		ExpectError      bool
+		ExpectNoOutput   bool
+		ExpectedListen   string
+		ExpectedInterval time.Duration
+	}{
+		{
+			ExpectNoOutput:   true,
+			ExpectedListen:   DefaultListenAddress,
+			ExpectedInterval: DefaultServeInterval,
+		},
+		{
+			Args:             []string{"--listen", "127.0.0.1:9999", "--interval", "15m", "--format", "ndjson", "--output-file", outputFileName},
+			ExpectedListen:   "127.0.0.1:9999",
+			ExpectedInterval: 15 * time.Minute,
+		},
+		{
+			Args:        []string{"--interval", "0s"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--format", "json", "--output-file", outputFileName},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a Command Line for the serve subcommand
+		settings := &CommandLineSettings{subcommand: SubcommandServe}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Invoke the Process method
+		cleanupFn := settings.Process(c.Args, mon)
+		cleanupFn()
+
+		// Did we get the expected settings?
+		if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured for %v: expected %v, actual %v (%v)", c.Args, c.ExpectError, mon.ErrorOccured, mon.Messages)
+		} else if !c.ExpectError && (settings.noOutputFile != c.ExpectNoOutput || settings.listenAddress != c.ExpectedListen || settings.interval != c.ExpectedInterval) {
+			t.Errorf("Unexpected settings for %v: no output %v, listen %s, interval %v", c.Args, settings.noOutputFile, settings.listenAddress, settings.interval)
+		}
+	}
+}
+
+func TestCommandLineDaemon(t *testing.T) {
+	outputFileName := filepath.Join(t.TempDir(), "resources.csv")
+	today := time.Now()
+
+	// Construct our test cases...
+	cases := []struct {
+		Args               []string
+		ExpectError        bool
+		ExpectedSchedule   string
+		ExpectedOutputFile string
+	}{
+		{
+			Args:               []string{"--output-file", outputFileName},
+			ExpectedSchedule:   DefaultDaemonSchedule,
+			ExpectedOutputFile: outputFileName,
+		},
+		{
+			Args:               []string{"--schedule", "0 2 * * 1-5", "--rotate", "daily", "--output-file", outputFileName},
+			ExpectedSchedule:   "0 2 * * 1-5",
+			ExpectedOutputFile: RotatedFileName(outputFileName, RotateDaily, today),
+		},
+		{
+			Args:        []string{"--schedule", "0 25 * * *"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--rotate", "weekly"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--rotate", "daily", "--no-output"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--format", "json"},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a Command Line for the daemon subcommand
+		settings := &CommandLineSettings{subcommand: SubcommandDaemon}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Invoke the Process method
+		cleanupFn := settings.Process(c.Args, mon)
+		cleanupFn()
+
+		// Did we get the expected settings?
+		if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured for %v: expected %v, actual %v (%v)", c.Args, c.ExpectError, mon.ErrorOccured, mon.Messages)
+		} else if !c.ExpectError && (settings.scheduleSpec != c.ExpectedSchedule || settings.schedule == nil || settings.outputFileName != c.ExpectedOutputFile) {
+			t.Errorf("Unexpected settings for %v: schedule %s, output file %s", c.Args, settings.scheduleSpec, settings.outputFileName)
+		}
+	}
+}
+
+func TestCommandLineStore(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Construct our test cases...
+	cases := []struct {
+		Args        []string
+		ExpectError bool
+	}{
+		{
+			Args: []string{"--no-output", "--store", "sqlite:" + filepath.Join(tempDir, "resources.db")},
+		},
+		{
+			Args:        []string{"--no-output", "--store", filepath.Join(tempDir, "resources.db")},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--no-output", "--store", "sqlite:" + filepath.Join(tempDir, "missing", "resources.db")},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		settings := &CommandLineSettings{}
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Invoke the Process method
+		cleanupFn := settings.Process(c.Args, mon)
+		opened := settings.store != nil
+		cleanupFn()
+
+		// Did we get the expected settings?
+		if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured for %v: expected %v, actual %v (%v)", c.Args, c.ExpectError, mon.ErrorOccured, mon.Messages)
+		} else if !c.ExpectError && !opened {
+			t.Errorf("Expected the store to be opened for %v", c.Args)
+		}
+	}
+}
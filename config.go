@@ -0,0 +1,194 @@
+/******************************************************************************
+Cloud Resource Counter
+File: config.go
+
+Summary: Reads settings from a YAML configuration file (--config) and merges
+         them with the settings supplied on the command line.
+******************************************************************************/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Keys of the configuration file that cannot be used. These correspond to
+// command line arguments that only make sense on the command line.
+var unsupportedConfigKeys = map[string]bool{
+	"config":  true,
+	"help":    true,
+	"version": true,
+}
+
+// Keys of the configuration file that accept a list of values. The values are
+// joined with commas, as they would be on the command line.
+var listConfigKeys = map[string]bool{
+	"assume_roles":    true,
+	"exclude_regions": true,
+	"only":            true,
+	"profiles":        true,
+	"regions":         true,
+	"skip":            true,
+}
+
+// Keys of the configuration file that accept a map of values. Each entry is
+// written as KEY=VALUE and the entries are joined with commas, as they would be
+// on the command line.
+var mapConfigKeys = map[string]bool{
+	"service_endpoints": true,
+}
+
+// Keys of the configuration file that are ignored when a conflicting argument
+// is supplied on the command line (e.g., the file's "output_file" is ignored
+// when --no-output is supplied).
+var overriddenConfigKeys = map[string][]string{
+	"assume_roles":    {"organization"},
+	"exclude_regions": {"region"},
+	"no_output":       {"output-file"},
+	"organization":    {"assume-roles"},
+	"output_file":     {"no-output"},
+	"profile":         {"profiles"},
+	"profiles":        {"profile"},
+	"region":          {"regions", "exclude-regions"},
+	"regions":         {"region"},
+}
+
+// ConfigFlagName returns the name of the command line argument that corresponds
+// to the supplied key of a configuration file (e.g., "output_file" is the key
+// for --output-file).
+func ConfigFlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// ApplyConfigFile reads the supplied YAML configuration file and uses each of
+// its keys to set the corresponding command line argument of the FlagSet. Any
+// argument that was explicitly supplied on the command line is left as is. The
+// returned list describes every problem found in the file (rather than just the
+// first one).
+func ApplyConfigFile(fileName string, flagSet *flag.FlagSet) []string {
+	// Read the file
+	contents, err := os.ReadFile(fileName)
+	if err != nil {
+		return []string{fmt.Sprintf("Unable to read config file: %v", err)}
+	}
+
+	// Parse the file
+	var values map[string]interface{}
+	if err = yaml.Unmarshal(contents, &values); err != nil {
+		return []string{fmt.Sprintf("Unable to parse config file %s: %v", fileName, err)}
+	}
+
+	// Which arguments were explicitly supplied on the command line?
+	explicit := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	// Visit the keys in a predictable order
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Loop through the keys...
+	var problems []string
+	for _, key := range keys {
+		// Is this a known key? It may be written with dashes or underscores, so it
+		// is normalized (to underscores) to look it up in our maps.
+		flagName := ConfigFlagName(key)
+		name := strings.ReplaceAll(flagName, "-", "_")
+		if unsupportedConfigKeys[name] || flagSet.Lookup(flagName) == nil {
+			problems = append(problems, fmt.Sprintf("%s: unknown key '%s'", fileName, key))
+			continue
+		}
+
+		// Convert the value into the form used on the command line
+		value, err := configValue(name, values[key])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid value for '%s': %v", fileName, key, err))
+			continue
+		}
+
+		// Was this (or a conflicting) argument supplied on the command line?
+		if overridden(flagName, overriddenConfigKeys[name], explicit) {
+			continue
+		}
+
+		// Set the argument. If the value is invalid, the argument's prior value is
+		// restored so that it is not reported again by later validation.
+		prior := flagSet.Lookup(flagName).Value.String()
+		if err = flagSet.Set(flagName, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid value '%s' for '%s': %v", fileName, value, key, err))
+			flagSet.Lookup(flagName).Value.Set(prior)
+		}
+	}
+
+	return problems
+}
+
+// Convert a value from the configuration file into a string
+func configValue(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("a value is required")
+	case []interface{}:
+		// Does this key accept a list?
+		if !listConfigKeys[key] {
+			return "", fmt.Errorf("a single value is required, not a list")
+		}
+
+		// Join the (single) values
+		var items []string
+		for _, item := range v {
+			s, err := configValue("", item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+
+		return strings.Join(items, ","), nil
+	case map[interface{}]interface{}:
+		// Does this key accept a map?
+		if !mapConfigKeys[key] {
+			return "", fmt.Errorf("a single value is required, not a map")
+		}
+
+		// Join the (single) values with their keys (in a predictable order)
+		var items []string
+		for k, item := range v {
+			s, err := configValue("", item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, fmt.Sprintf("%v=%s", k, s))
+		}
+		sort.Strings(items)
+
+		return strings.Join(items, ","), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// Determine whether the supplied argument (or one that conflicts with it) was
+// explicitly supplied on the command line
+func overridden(flagName string, conflicts []string, explicit map[string]bool) bool {
+	if explicit[flagName] {
+		return true
+	}
+	for _, conflict := range conflicts {
+		if explicit[conflict] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,225 @@
+/******************************************************************************
+Cloud Resource Counter
+File: config_test.go
+
+Summary: The Unit Test for config.
+******************************************************************************/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+// Write the supplied contents to a configuration file in a temporary folder
+func writeConfigFile(t *testing.T, contents string) string {
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fileName, []byte(contents), 0666); err != nil {
+		t.Fatalf("Unexpected error while writing config file: %v", err)
+	}
+
+	return fileName
+}
+
+func TestConfigFile(t *testing.T) {
+	// A configuration file for a scheduled job (writing to a temporary folder)
+	outputFileName := filepath.Join(t.TempDir(), "counts.ndjson")
+	config := fmt.Sprintf(`
+profiles:
+  - dev
+  - prod
+region: us-west-2
+concurrency: 4
+continue_on_error: true
+breakdown: region
+format: ndjson
+output_file: %s
+assume_roles:
+  - arn:aws:iam::111122223333:role/Counter
+  - arn:aws:iam::444455556666:role/Counter
+service_endpoints:
+  s3: http://localhost:9000
+  ec2: http://localhost:4566
+s3_path_style: true
+`, outputFileName)
+
+	// Construct our test cases...
+	cases := []struct {
+		Args                []string
+		ExpectedProfiles    []string
+		ExpectedRegion      string
+		ExpectedRegions     []string
+		ExpectedConcurrency int
+		ExpectedOutputFile  string
+		ExpectNoOutput      bool
+		ExpectedRoleARNs    []string
+		ExpectOrganization  bool
+	}{
+		{
+			ExpectedProfiles:    []string{"dev", "prod"},
+			ExpectedRegion:      "us-west-2",
+			ExpectedConcurrency: 4,
+			ExpectedOutputFile:  outputFileName,
+			ExpectedRoleARNs:    []string{"arn:aws:iam::111122223333:role/Counter", "arn:aws:iam::444455556666:role/Counter"},
+		},
+		{
+			Args:                []string{"--profile", "ops", "--concurrency", "2", "--no-output", "--assume-roles", "arn:aws:iam::777788889999:role/Other"},
+			ExpectedProfiles:    []string{"ops"},
+			ExpectedRegion:      "us-west-2",
+			ExpectedConcurrency: 2,
+			ExpectNoOutput:      true,
+			ExpectedRoleARNs:    []string{"arn:aws:iam::777788889999:role/Other"},
+		},
+		{
+			// The file's region gives way to --regions...
+			Args:                []string{"--regions", "us-*"},
+			ExpectedProfiles:    []string{"dev", "prod"},
+			ExpectedRegions:     []string{"us-*"},
+			ExpectedConcurrency: 4,
+			ExpectedOutputFile:  outputFileName,
+			ExpectedRoleARNs:    []string{"arn:aws:iam::111122223333:role/Counter", "arn:aws:iam::444455556666:role/Counter"},
+		},
+		{
+			// ...and to --exclude-regions
+			Args:                []string{"--exclude-regions", "ap-*"},
+			ExpectedProfiles:    []string{"dev", "prod"},
+			ExpectedConcurrency: 4,
+			ExpectedOutputFile:  outputFileName,
+			ExpectedRoleARNs:    []string{"arn:aws:iam::111122223333:role/Counter", "arn:aws:iam::444455556666:role/Counter"},
+		},
+		{
+			// The file's roles give way to --organization
+			Args:                []string{"--organization"},
+			ExpectedProfiles:    []string{"dev", "prod"},
+			ExpectedRegion:      "us-west-2",
+			ExpectedConcurrency: 4,
+			ExpectedOutputFile:  outputFileName,
+			ExpectOrganization:  true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a Command Line
+		settings := &CommandLineSettings{}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Invoke the Process method
+		cleanupFn := settings.Process(append([]string{"--config", writeConfigFile(t, config)}, c.Args...), mon)
+		cleanupFn()
+
+		// Does it match?
+		if mon.ErrorOccured {
+			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+		} else if !reflect.DeepEqual(settings.ProfileNames(), c.ExpectedProfiles) {
+			t.Errorf("Unexpected profiles: expected %v, actual %v", c.ExpectedProfiles, settings.ProfileNames())
+		} else if settings.regionName != c.ExpectedRegion || !reflect.DeepEqual(settings.regions, c.ExpectedRegions) {
+			t.Errorf("Unexpected regions: expected %s %v, actual %s %v", c.ExpectedRegion, c.ExpectedRegions, settings.regionName, settings.regions)
+		} else if settings.concurrency != c.ExpectedConcurrency {
+			t.Errorf("Unexpected concurrency: expected %d, actual %d", c.ExpectedConcurrency, settings.concurrency)
+		} else if settings.outputFileName != c.ExpectedOutputFile {
+			t.Errorf("Unexpected output file: expected %s, actual %s", c.ExpectedOutputFile, settings.outputFileName)
+		} else if c.ExpectNoOutput != settings.noOutputFile {
+			t.Errorf("Unexpected NoOutput: expected %v, actual %v", c.ExpectNoOutput, settings.noOutputFile)
+		} else if !reflect.DeepEqual(settings.roleARNs, c.ExpectedRoleARNs) || settings.organization != c.ExpectOrganization {
+			t.Errorf("Unexpected roles: expected %v (organization %v), actual %v (organization %v)", c.ExpectedRoleARNs, c.ExpectOrganization, settings.roleARNs, settings.organization)
+		} else if expected := map[string]string{"s3": "http://localhost:9000", "ec2": "http://localhost:4566"}; !reflect.DeepEqual(settings.serviceEndpoints, expected) {
+			t.Errorf("Unexpected service endpoints: expected %v, actual %v", expected, settings.serviceEndpoints)
+		} else if !settings.continueOnError || settings.breakdown != BreakdownRegion || settings.format != FormatNDJSON || !settings.s3PathStyle {
+			t.Errorf("Unexpected settings: continueOnError=%v, breakdown=%s, format=%s, s3PathStyle=%v", settings.continueOnError, settings.breakdown, settings.format, settings.s3PathStyle)
+		}
+	}
+}
+
+func TestConfigFileDashedKeys(t *testing.T) {
+	// A configuration file whose keys are written with dashes
+	config := `
+output-file: counts.csv
+assume-roles:
+  - arn:aws:iam::111122223333:role/Counter
+exclude-regions:
+  - ap-*
+`
+
+	// Create a Command Line
+	settings := &CommandLineSettings{}
+
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// The file's keys give way to the conflicting arguments
+	cleanupFn := settings.Process([]string{"--config", writeConfigFile(t, config), "--no-output", "--organization", "--region", "us-east-1"}, mon)
+	cleanupFn()
+
+	// Does it match?
+	if mon.ErrorOccured {
+		t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+	} else if !settings.noOutputFile || settings.outputFileName != "" {
+		t.Errorf("Unexpected output file: %s (no output %v)", settings.outputFileName, settings.noOutputFile)
+	} else if len(settings.roleARNs) > 0 || !settings.organization {
+		t.Errorf("Unexpected roles: %v (organization %v)", settings.roleARNs, settings.organization)
+	} else if len(settings.excludeRegions) > 0 || settings.regionName != "us-east-1" {
+		t.Errorf("Unexpected regions: %s (excluding %v)", settings.regionName, settings.excludeRegions)
+	}
+}
+
+func TestConfigFileProblems(t *testing.T) {
+	// A configuration file with many problems
+	config := `
+profile: default
+colour: blue
+concurrency: lots
+region: us-nowhere-1
+format:
+  - csv
+  - json
+assume_roles: arn:aws:s3:::not-a-role
+`
+
+	// Create a Command Line
+	settings := &CommandLineSettings{}
+
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Invoke the Process method
+	cleanupFn := settings.Process([]string{"--config", writeConfigFile(t, config), "--no-output"}, mon)
+	cleanupFn()
+
+	// Were all of the problems reported at once?
+	if !mon.ErrorOccured {
+		t.Fatal("Expected an error to occur, but it did not... :^(")
+	}
+	message := strings.Join(mon.Messages, "\n")
+	for _, expected := range []string{"'colour'", "'concurrency'", "us-nowhere-1", "'format'", "arn:aws:s3:::not-a-role", "Found 5 problems"} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected the error to mention %s, but it did not: %s", expected, message)
+		}
+	}
+}
+
+func TestConfigFileMissing(t *testing.T) {
+	// Create a Command Line
+	settings := &CommandLineSettings{}
+
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Invoke the Process method with a file that does not exist
+	cleanupFn := settings.Process([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml"), "--no-output"}, mon)
+	cleanupFn()
+
+	// Did it fail?
+	if !mon.ErrorOccured {
+		t.Error("Expected an error to occur, but it did not... :^(")
+	}
+}
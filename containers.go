@@ -8,55 +8,62 @@ Summary: Counts the number of unique container images.
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecs"
-	color "github.com/logrusorgru/aurora"
 )
 
 // UniqueContainerImages reviews all of the ECS containers either in the current region
-// or (if allRegions is true) in all regions. It inspects the task definitions for all
+// or (if rc.AllRegions is true) in all regions. It inspects the task definitions for all
 // containers, looking at the image definition. It then counts the number of unique
 // images across all containers in the given region (or all regions).
-func UniqueContainerImages(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving Unique container counts")
-
-	// Should we get the counts for all regions?
-	var containerImageMap map[string]bool = make(map[string]bool)
-	if allRegions {
-		// Get the list of all enabled regions for this account
-		regionsSlice := GetEC2Regions(sf.GetEC2InstanceService(""), am)
-
-		// Loop through all of the regions
-		for _, regionName := range regionsSlice {
-			// Get the container image names for a specific region
-			containerImagesSlice := containerImagesForSingleRegion(sf.GetContainerService(regionName), am)
-
-			// Add the container names to our map
-			for _, cntrImg := range containerImagesSlice {
-				containerImageMap[cntrImg] = true
-			}
-		}
-	} else {
-		// Get the container image names for a specific region
-		containerImagesSlice := containerImagesForSingleRegion(sf.GetContainerService(""), am)
+func UniqueContainerImages(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(ContainerCounter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-		// Add the container names to our map
-		for _, cntrImg := range containerImagesSlice {
+// containerCounter counts the unique container images of a region.
+type containerCounter struct {
+	CounterInfo
+}
+
+// ContainerCounter is the registered Counter for unique container images. As the
+// same image may be used in several regions, the total is the number of unique
+// images across all regions (rather than the sum of the per-region counts).
+var ContainerCounter = containerCounter{CounterInfo{
+	CounterName:  "containers",
+	ColumnName:   "# of Unique Containers",
+	ServiceName:  "ECS",
+	ActivityName: "Unique container",
+	Actions:      []string{"ecs:ListTaskDefinitions", "ecs:DescribeTaskDefinition"},
+	IsRegional:   true,
+	Unique:       true,
+}}
+
+// Count the unique container images of the supplied region
+func (containerCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	// Get the container image names of all tasks
+	names, err := containerImagesForSingleRegion(ctx.RequestContext(), ctx.ServiceFactory.GetContainerService(regionName), ctx.Monitor)
+
+	// Find the unique names
+	var uniqueNames []string
+	var items []InventoryItem
+	containerImageMap := make(map[string]bool)
+	for _, cntrImg := range names {
+		if !containerImageMap[cntrImg] {
 			containerImageMap[cntrImg] = true
+			uniqueNames = append(uniqueNames, cntrImg)
+			items = append(items, CountedItem(cntrImg, "", "container image"))
 		}
 	}
 
-	// Get our container count
-	containerCount := len(containerImageMap)
+	// An image used in several regions is listed in each (but counted once)
+	result := NewInventoryResult(items, err)
+	result.Names = uniqueNames
 
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(containerCount))
-
-	return containerCount
+	return result
 }
 
 // Get a list of all container images used by all tasks for this region
-func containerImagesForSingleRegion(cs *ContainerService, am ActivityMonitor) []string {
+func containerImagesForSingleRegion(c aws.Context, cs *ContainerService, am ActivityMonitor) ([]string, error) {
 	// Construct our input to find all Task Definitions
 	input := &ecs.ListTaskDefinitionsInput{}
 
@@ -65,7 +72,8 @@ func containerImagesForSingleRegion(cs *ContainerService, am ActivityMonitor) []
 
 	// Invoke our service
 	var containerImageNames []string
-	err := cs.ListTaskDefinitions(input, func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+	var describeErr error
+	err := cs.ListTaskDefinitions(c, input, func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
 		// Loop through the results...
 		for _, taskDefnArn := range page.TaskDefinitionArns {
 			// Construct an input struct for the specific task definition
@@ -74,11 +82,12 @@ func containerImagesForSingleRegion(cs *ContainerService, am ActivityMonitor) []
 			}
 
 			// Inspect the task definition details
-			taskDefn, err := cs.InspectTaskDefinition(input)
+			taskDefn, err := cs.InspectTaskDefinition(c, input)
 
 			// Error?
-			if am.CheckError(err) {
+			if err != nil {
 				// Stop iterating
+				describeErr = err
 				return false
 			}
 
@@ -94,8 +103,10 @@ func containerImagesForSingleRegion(cs *ContainerService, am ActivityMonitor) []
 		return true
 	})
 
-	// Check for error
-	am.CheckError(err)
+	// Did we fail to describe a task definition?
+	if err == nil {
+		err = describeErr
+	}
 
-	return containerImageNames
+	return containerImageNames, err
 }
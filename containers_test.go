@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
@@ -143,10 +144,10 @@ type fakeContainerService struct {
 	TaskInfo *TaskInfo
 }
 
-// Implement the ListTaskDefinitionsPages method by returning the pre-canned array
+// Implement the ListTaskDefinitionsPagesWithContext method by returning the pre-canned array
 // of ListTaskDefinitionsOutput structs.
-func (fake *fakeContainerService) ListTaskDefinitionsPages(input *ecs.ListTaskDefinitionsInput,
-	fn func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool) error {
+func (fake *fakeContainerService) ListTaskDefinitionsPagesWithContext(ctx aws.Context, input *ecs.ListTaskDefinitionsInput,
+	fn func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool, _ ...request.Option) error {
 	// If there is no TaskInfo, simulate an error...
 	if fake.TaskInfo == nil {
 		return errors.New("ListTaskDefinitionsPages encountered an unexpected error: 2468")
@@ -177,9 +178,9 @@ func (fake *fakeContainerService) ListTaskDefinitionsPages(input *ecs.ListTaskDe
 	return nil
 }
 
-// Implement the DescribeTaskDefinition method by returning a pre-canned response
+// Implement the DescribeTaskDefinitionWithContext method by returning a pre-canned response
 // keyed by the task definition ARN.
-func (fake *fakeContainerService) DescribeTaskDefinition(input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
+func (fake *fakeContainerService) DescribeTaskDefinitionWithContext(ctx aws.Context, input *ecs.DescribeTaskDefinitionInput, _ ...request.Option) (*ecs.DescribeTaskDefinitionOutput, error) {
 	// We ensure that the input does not contain unexpected fields
 	if input.Include != nil {
 		return nil, errors.New("The unit test does not support a DescribeTaskDefinitionInput that contains anything other than a TaskDefinition")
@@ -220,6 +221,16 @@ func (fsf fakeCntrServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeCntrServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeCntrServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // This implementation of GetEC2InstanceService is limited to supporting DescribeRegions API
 // only.
 func (fsf fakeCntrServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
@@ -318,18 +329,20 @@ func TestUniqueContainerImages(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our UniqueContainerImages function
-		actualCount := UniqueContainerImages(sf, mon, c.AllRegions)
+		actualCount := UniqueContainerImages(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: UniqueContainerImages returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: UniqueContainerImages returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
@@ -0,0 +1,174 @@
+/******************************************************************************
+Cloud Resource Counter
+File: countResult.go
+
+Summary: The CountResult struct returned by every counter, along with the
+         CounterError struct which describes why a count is incomplete.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	color "github.com/logrusorgru/aurora"
+)
+
+// IncompleteSuffix is appended to counts in the output file that do not include
+// every region (or sub-resource) because of an error.
+const IncompleteSuffix = " (incomplete)"
+
+// CountResult is the result of a single counter: the number of resources found
+// and whether some of them could not be inspected due to errors.
+type CountResult struct {
+	Count      int
+	Incomplete bool
+
+	// The count for each region that was examined. This is nil if the counter
+	// cannot attribute its resources to regions.
+	ByRegion map[string]int
+
+	// The regions whose counts are incomplete. An error that is not associated
+	// with any region is recorded under the empty string.
+	IncompleteRegions map[string]bool
+}
+
+// String formats the count as it is stored in the output file.
+func (cr CountResult) String() string {
+	if cr.Incomplete {
+		return fmt.Sprintf("%d%s", cr.Count, IncompleteSuffix)
+	}
+
+	return fmt.Sprintf("%d", cr.Count)
+}
+
+// ParseCount parses a count as it is stored in the output file (see String).
+func ParseCount(value string) (CountResult, error) {
+	trimmed := strings.TrimSuffix(value, IncompleteSuffix)
+	count, err := strconv.Atoi(trimmed)
+	if err != nil {
+		return CountResult{}, fmt.Errorf("'%s' is not a count", value)
+	}
+
+	return CountResult{Count: count, Incomplete: trimmed != value}, nil
+}
+
+// ForRegion returns the portion of the count attributed to the supplied region.
+func (cr CountResult) ForRegion(regionName string) CountResult {
+	return CountResult{
+		Count:      cr.ByRegion[regionName],
+		Incomplete: cr.IncompleteRegions[regionName] || cr.IncompleteRegions[""],
+	}
+}
+
+// CounterError describes a failure to inspect a service in a single region.
+type CounterError struct {
+	Service string `json:"service"`
+	Region  string `json:"region"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// The original error (if any)
+	err error
+}
+
+// NewCounterError constructs a CounterError for the supplied service and region
+// from an arbitrary error. For AWS errors, the error code and the first line of
+// the message are recorded.
+func NewCounterError(service string, region string, err error) *CounterError {
+	// Is it already a CounterError?
+	var ce *CounterError
+	if errors.As(err, &ce) {
+		return ce
+	}
+
+	// Is this an AWS Error?
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return &CounterError{
+			Service: service,
+			Region:  region,
+			Code:    aerr.Code(),
+			Message: strings.Split(aerr.Message(), "\n")[0],
+			err:     err,
+		}
+	}
+
+	return &CounterError{
+		Service: service,
+		Region:  region,
+		Message: err.Error(),
+		err:     err,
+	}
+}
+
+// Error formats the CounterError as a single line.
+func (ce *CounterError) Error() string {
+	// Describe where the error occurred
+	var where string
+	switch {
+	case ce.Service != "" && ce.Region != "":
+		where = fmt.Sprintf("%s in %s: ", ce.Service, ce.Region)
+	case ce.Service != "":
+		where = fmt.Sprintf("%s: ", ce.Service)
+	}
+
+	// Describe what occurred
+	if ce.Code != "" {
+		return fmt.Sprintf("%s%s: %s", where, ce.Code, ce.Message)
+	}
+
+	return where + ce.Message
+}
+
+// Unwrap returns the original error.
+func (ce *CounterError) Unwrap() error {
+	return ce.err
+}
+
+// IsCanceled returns whether the supplied error occurred because its request was
+// cancelled (e.g., the run was interrupted or a region ran out of time).
+func IsCanceled(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == request.CanceledErrorCode
+}
+
+// EndCount ends the current action by reporting the supplied count. If there
+// were any errors, the count is reported as incomplete and each error is sent
+// to the ActivityMonitor's CheckError method (which may end the program).
+func EndCount(am ActivityMonitor, count int, errs []error) CountResult {
+	// Without errors, simply report the count
+	if len(errs) == 0 {
+		am.EndAction("OK (%d)", color.Bold(count))
+
+		return CountResult{Count: count}
+	}
+
+	// Report the partial count, followed by each error
+	am.EndAction("INCOMPLETE (%d)", color.Bold(count))
+	for _, err := range errs {
+		am.CheckError(err)
+	}
+
+	return CountResult{Count: count, Incomplete: true, IncompleteRegions: IncompleteRegions(errs)}
+}
+
+// IncompleteRegions returns the set of regions named by the supplied errors.
+func IncompleteRegions(errs []error) map[string]bool {
+	regions := make(map[string]bool)
+	for _, err := range errs {
+		regions[NewCounterError("", "", err).Region] = true
+	}
+
+	return regions
+}
@@ -0,0 +1,248 @@
+/******************************************************************************
+Cloud Resource Counter
+File: countResult_test.go
+
+Summary: The Unit Test for countResult.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestCountResultString(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Result   CountResult
+		Expected string
+	}{
+		{
+			Result:   CountResult{Count: 12},
+			Expected: "12",
+		},
+		{
+			Result:   CountResult{Count: 7, Incomplete: true},
+			Expected: "7 (incomplete)",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		// Format it as the Results struct does
+		if actual := fmt.Sprintf("%v", c.Result); actual != c.Expected {
+			t.Errorf("Unexpected formatted count: expected %s, actual %s", c.Expected, actual)
+		}
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Value         string
+		Expected      CountResult
+		ExpectedError bool
+	}{
+		{
+			Value:    "12",
+			Expected: CountResult{Count: 12},
+		},
+		{
+			Value:    "7 (incomplete)",
+			Expected: CountResult{Count: 7, Incomplete: true},
+		},
+		{
+			Value:         "lots",
+			ExpectedError: true,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		actual, err := ParseCount(c.Value)
+		if c.ExpectedError {
+			if err == nil {
+				t.Errorf("Expected an error parsing '%s'", c.Value)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", c.Value, err)
+		} else if actual.Count != c.Expected.Count || actual.Incomplete != c.Expected.Incomplete {
+			t.Errorf("Unexpected count parsing '%s': expected %v, actual %v", c.Value, c.Expected, actual)
+		}
+	}
+}
+
+func TestNewCounterError(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Error           error
+		ExpectedCode    string
+		ExpectedMessage string
+		ExpectedString  string
+	}{
+		{
+			Error:           awserr.New("AccessDeniedException", "You don't have access\nAnd another thing", nil),
+			ExpectedCode:    "AccessDeniedException",
+			ExpectedMessage: "You don't have access",
+			ExpectedString:  "Lightsail in eu-south-1: AccessDeniedException: You don't have access",
+		},
+		{
+			Error:           errors.New("Something is very wrong"),
+			ExpectedMessage: "Something is very wrong",
+			ExpectedString:  "Lightsail in eu-south-1: Something is very wrong",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		// Construct the CounterError
+		ce := NewCounterError("Lightsail", "eu-south-1", c.Error)
+
+		// Does it match?
+		if ce.Code != c.ExpectedCode {
+			t.Errorf("Unexpected Code: expected %s, actual %s", c.ExpectedCode, ce.Code)
+		} else if ce.Message != c.ExpectedMessage {
+			t.Errorf("Unexpected Message: expected %s, actual %s", c.ExpectedMessage, ce.Message)
+		} else if ce.Error() != c.ExpectedString {
+			t.Errorf("Unexpected Error(): expected %s, actual %s", c.ExpectedString, ce.Error())
+		} else if !errors.Is(ce, c.Error) {
+			t.Errorf("Expected CounterError to wrap the original error, but it did not")
+		}
+
+		// Wrapping it again should return the same error
+		if NewCounterError("S3", "", ce) != ce {
+			t.Errorf("Expected an existing CounterError to be returned as is, but it was not")
+		}
+	}
+}
+
+func TestIsCanceled(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Error    error
+		Expected bool
+	}{
+		{Error: context.Canceled, Expected: true},
+		{Error: context.DeadlineExceeded, Expected: true},
+		{Error: awserr.New(request.CanceledErrorCode, "request context canceled", context.DeadlineExceeded), Expected: true},
+		{Error: NewCounterError("EC2", "us-west-2", awserr.New(request.CanceledErrorCode, "request context canceled", nil)), Expected: true},
+		{Error: awserr.New("AccessDeniedException", "Not for you", nil)},
+		{Error: errors.New("Something is very wrong")},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		if actual := IsCanceled(c.Error); actual != c.Expected {
+			t.Errorf("Unexpected IsCanceled(%v): expected %v, actual %v", c.Error, c.Expected, actual)
+		}
+	}
+}
+
+func TestEndCount(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Errors            []error
+		ExpectError       bool
+		ExpectedResult    CountResult
+		ExpectedEndAction string
+	}{
+		{
+			ExpectedResult:    CountResult{Count: 5},
+			ExpectedEndAction: "OK",
+		},
+		{
+			Errors:            []error{NewCounterError("RDS", "us-east-2", errors.New("boom"))},
+			ExpectError:       true,
+			ExpectedResult:    CountResult{Count: 5, Incomplete: true},
+			ExpectedEndAction: "INCOMPLETE",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// End the count
+		actual := EndCount(mon, 5, c.Errors)
+
+		// Does it match?
+		if actual.Count != c.ExpectedResult.Count || actual.Incomplete != c.ExpectedResult.Incomplete {
+			t.Errorf("Unexpected result: expected %v, actual %v", c.ExpectedResult, actual)
+		} else if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured: expected %v, actual %v", c.ExpectError, mon.ErrorOccured)
+		} else if len(mon.Messages) == 0 || !strings.HasPrefix(mon.Messages[0], c.ExpectedEndAction) {
+			t.Errorf("Unexpected EndAction: expected %s, actual %v", c.ExpectedEndAction, mon.Messages)
+		}
+	}
+}
+
+func TestCountResultForRegion(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Result     CountResult
+		RegionName string
+		Expected   CountResult
+	}{
+		{
+			Result:     CountResult{Count: 5, ByRegion: map[string]int{"us-east-1": 2, "us-west-2": 3}},
+			RegionName: "us-west-2",
+			Expected:   CountResult{Count: 3},
+		},
+		{
+			Result:     CountResult{Count: 5, ByRegion: map[string]int{"us-east-1": 2, "us-west-2": 3}},
+			RegionName: "eu-west-1",
+			Expected:   CountResult{Count: 0},
+		},
+		{
+			Result: CountResult{
+				Count:             2,
+				Incomplete:        true,
+				ByRegion:          map[string]int{"us-east-1": 2, "us-west-2": 0},
+				IncompleteRegions: map[string]bool{"us-west-2": true},
+			},
+			RegionName: "us-east-1",
+			Expected:   CountResult{Count: 2},
+		},
+		{
+			Result: CountResult{
+				Count:             2,
+				Incomplete:        true,
+				ByRegion:          map[string]int{"us-east-1": 2, "us-west-2": 0},
+				IncompleteRegions: map[string]bool{"us-west-2": true},
+			},
+			RegionName: "us-west-2",
+			Expected:   CountResult{Count: 0, Incomplete: true},
+		},
+		{
+			Result: CountResult{
+				Count:             8,
+				Incomplete:        true,
+				ByRegion:          map[string]int{"us-east-1": 7},
+				IncompleteRegions: map[string]bool{"": true},
+			},
+			RegionName: "us-east-1",
+			Expected:   CountResult{Count: 7, Incomplete: true},
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		// Get the portion of the count for the region
+		actual := c.Result.ForRegion(c.RegionName)
+
+		// Does it match?
+		if actual.Count != c.Expected.Count || actual.Incomplete != c.Expected.Incomplete {
+			t.Errorf("Unexpected count for %s: expected %v, actual %v", c.RegionName, c.Expected, actual)
+		}
+	}
+}
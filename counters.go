@@ -0,0 +1,486 @@
+/******************************************************************************
+Cloud Resource Counter
+File: counters.go
+
+Summary: The Counter interface, the registry of all counters and the runner
+         which invokes a counter for each region of an account.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	color "github.com/logrusorgru/aurora"
+)
+
+// CountContext holds everything that a counter needs to count resources: the
+// factory for AWS services, the activity monitor and the run settings. The ID of
+// the account being counted is only needed by the inventory. The partition of
+// the account determines which services are available (every service is
+// available if it is empty). The regions of the account are resolved once and
+// shared by every counter. The Context (if nil, that of the run) is passed to
+// every AWS request; each region is counted with its own (see WithContext).
+type CountContext struct {
+	ServiceFactory ServiceFactory
+	Monitor        ActivityMonitor
+	Run            *RunContext
+	AccountID      string
+	Timestamp      string
+	Partition      string
+	Regions        []RegionInfo
+	Context        context.Context
+
+	// The running EC2 instances of each region (keyed by region name), described
+	// once and shared by the EC2, Spot and EC2 K8 counters. This is shared by
+	// the copies made by WithContext.
+	ec2Scans *sync.Map
+}
+
+// RequestContext returns the context of the AWS requests made by counters.
+func (ctx *CountContext) RequestContext() context.Context {
+	if ctx.Context == nil {
+		return ctx.Run.RequestContext()
+	}
+
+	return ctx.Context
+}
+
+// WithContext returns a copy of the CountContext whose AWS requests use the
+// supplied context.
+func (ctx *CountContext) WithContext(c context.Context) *CountContext {
+	copied := *ctx
+	copied.Context = c
+
+	return &copied
+}
+
+// RegionNames returns the names of the regions that the counters should examine,
+// resolving them on first use.
+func (ctx *CountContext) RegionNames() []string {
+	if ctx.Regions == nil {
+		ctx.Regions = ctx.Run.ResolveRegions(ctx.ServiceFactory, ctx.Monitor)
+	}
+
+	return RegionInfoNames(ctx.Regions)
+}
+
+// RegionResult is the result of counting resources in a single region (or, for
+// a global counter, in all regions).
+type RegionResult struct {
+	// The number of resources found
+	Count int
+
+	// The names of the resources found. This is only needed by counters whose
+	// total is the number of unique names across all regions.
+	Names []string
+
+	// The count for each region. This is only needed by global counters that
+	// can attribute their resources to regions.
+	ByRegion map[string]int
+
+	// The errors that prevented some resources from being counted
+	Errs []error
+
+	// The resources that were inspected (and whether each was counted). This is
+	// only provided by counters that support the inventory.
+	Inventory []InventoryItem
+}
+
+// NewRegionResult constructs a RegionResult from a count and a (possibly nil) error.
+func NewRegionResult(count int, err error) RegionResult {
+	if err != nil {
+		return RegionResult{Count: count, Errs: []error{err}}
+	}
+
+	return RegionResult{Count: count}
+}
+
+// Counter is implemented by each type of resource that can be counted.
+type Counter interface {
+	// The name of the counter (as used by --only and --skip)
+	Name() string
+
+	// The column that holds the count in the results
+	Column() string
+
+	// The AWS service that is inspected (as shown in error messages)
+	Service() string
+
+	// What is being counted (e.g., "EBS volume")
+	Activity() string
+
+	// The IAM actions that the counter needs to be allowed to call (when counts
+	// are broken down by region, or not)
+	IAMActions(byRegion bool) []string
+
+	// Whether the counter is invoked once for each region (true) or once
+	// for all regions (false)
+	Regional() bool
+
+	// Count the resources in the named region. Global counters are invoked
+	// with an empty region name.
+	Count(ctx *CountContext, regionName string) RegionResult
+}
+
+// RegionLister is implemented by counters whose service is available in a
+// different set of regions than EC2. It returns the regions to examine.
+type RegionLister interface {
+	RegionNames(ctx *CountContext) ([]string, error)
+}
+
+// CounterInfo describes a counter. Embedding it in a type provides all of the
+// methods of the Counter interface except Count.
+type CounterInfo struct {
+	CounterName  string
+	ColumnName   string
+	ServiceName  string
+	ActivityName string
+	Actions      []string
+	IsRegional   bool
+
+	// The IAM actions that are only needed when counts are broken down by region
+	BreakdownActions []string
+
+	// Is the total the number of unique names across all regions (rather than
+	// the sum of the counts of each region)?
+	Unique bool
+
+	// Should errors always be recorded (rather than possibly ending the program)?
+	NonFatal bool
+}
+
+// Name returns the name of the counter.
+func (ci CounterInfo) Name() string { return ci.CounterName }
+
+// Column returns the column that holds the count in the results.
+func (ci CounterInfo) Column() string { return ci.ColumnName }
+
+// Service returns the AWS service that is inspected.
+func (ci CounterInfo) Service() string { return ci.ServiceName }
+
+// Activity returns what is being counted.
+func (ci CounterInfo) Activity() string { return ci.ActivityName }
+
+// IAMActions returns the IAM actions that the counter needs (including those only
+// needed when counts are broken down by region, if they are).
+func (ci CounterInfo) IAMActions(byRegion bool) []string {
+	if byRegion {
+		return append(append([]string{}, ci.Actions...), ci.BreakdownActions...)
+	}
+
+	return ci.Actions
+}
+
+// Regional returns whether the counter is invoked once for each region.
+func (ci CounterInfo) Regional() bool { return ci.IsRegional }
+
+// Counters that embed CounterInfo expose it to the runner
+func (ci CounterInfo) info() CounterInfo { return ci }
+
+// The interface used by the runner to get the CounterInfo of a counter
+type counterInfoProvider interface {
+	info() CounterInfo
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Registry
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// AccountColumns are the columns that identify the account (and region) of each
+// row of results. They precede the columns of the counters.
+var AccountColumns = []string{"Account ID", "Timestamp", "Region"}
+
+// ScopeColumn is the column that tells the rows of a breakdown by region apart:
+// it is only written with --breakdown region, following the AccountColumns.
+const ScopeColumn = "Scope"
+
+// The scopes of the rows of a breakdown: the row of each region and the row of
+// the totals of the account
+const (
+	ScopeRegion = "region"
+	ScopeTotal  = "total"
+)
+
+// BaseIAMActions are the IAM actions needed regardless of the selected counters.
+var BaseIAMActions = []string{"ec2:DescribeRegions"}
+
+// Counters is the registry of all counters, in the order in which they are run
+// (and their columns appear in the results).
+var Counters = []Counter{
+	EC2Counter,
+	EC2K8Counter,
+	SpotCounter,
+	EBSCounter,
+	ContainerCounter,
+	LambdaCounter,
+	RDSCounter,
+	LightsailCounter,
+	S3Counter,
+	EKSCounter,
+}
+
+// CounterNames returns the names of all registered counters.
+func CounterNames() []string {
+	var names []string
+	for _, counter := range Counters {
+		names = append(names, counter.Name())
+	}
+
+	return names
+}
+
+// SelectCounters returns the registered counters (in registry order) that are
+// named by the only list (or all counters, if it is empty) and that are not
+// named by the skip list. The returned list of problems describes each name
+// that is not registered.
+func SelectCounters(only []string, skip []string) ([]Counter, []string) {
+	// Check that all of the names are known
+	var problems []string
+	for _, name := range append(append([]string{}, only...), skip...) {
+		if !Contains(CounterNames(), name) {
+			problems = append(problems, fmt.Sprintf("'%s' is not a valid counter name (expected one of %s).", name, strings.Join(CounterNames(), ", ")))
+		}
+	}
+
+	// Select the counters
+	var selected []Counter
+	for _, counter := range Counters {
+		if (len(only) == 0 || Contains(only, counter.Name())) && !Contains(skip, counter.Name()) {
+			selected = append(selected, counter)
+		}
+	}
+
+	return selected, problems
+}
+
+// ResultColumns returns the names of all columns of the results produced by
+// the supplied counters (broken down by region, or not).
+func ResultColumns(counters []Counter, byRegion bool) []string {
+	columns := append([]string{}, AccountColumns...)
+	if byRegion {
+		columns = append(columns, ScopeColumn)
+	}
+	for _, counter := range counters {
+		columns = append(columns, counter.Column())
+	}
+
+	return columns
+}
+
+// CounterServiceID returns the ID of the AWS service inspected by the supplied
+// counter (e.g., "ec2"). This is the prefix of its IAM actions.
+func CounterServiceID(counter Counter) string {
+	actions := counter.IAMActions(false)
+	if len(actions) == 0 {
+		return ""
+	}
+
+	serviceID, _, _ := strings.Cut(actions[0], ":")
+
+	return serviceID
+}
+
+// AvailableCounters returns the supplied counters whose service is available in
+// the supplied partition.
+func AvailableCounters(counters []Counter, partitionID string) []Counter {
+	var available []Counter
+	for _, counter := range counters {
+		if IsServiceAvailable(partitionID, CounterServiceID(counter)) {
+			available = append(available, counter)
+		}
+	}
+
+	return available
+}
+
+// IAMActions returns the sorted list of unique IAM actions needed to run the
+// supplied counters (when counts are broken down by region, or not).
+func IAMActions(counters []Counter, byRegion bool) []string {
+	actionMap := make(map[string]bool)
+	for _, action := range BaseIAMActions {
+		actionMap[action] = true
+	}
+	for _, counter := range counters {
+		for _, action := range counter.IAMActions(byRegion) {
+			actionMap[action] = true
+		}
+	}
+
+	// Sort the actions
+	var actions []string
+	for action := range actionMap {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	return actions
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Runner
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// RunCounter counts the resources of the supplied counter, either in each of the
+// regions of the run (at most rc.Concurrency at a time) or, for global counters,
+// once for all regions. This method gives status back to the user via the
+// ActivityMonitor of the supplied context.
+func RunCounter(counter Counter, ctx *CountContext) CountResult {
+	am := ctx.Monitor
+
+	// What are the options of this counter?
+	var info CounterInfo
+	if provider, ok := counter.(counterInfoProvider); ok {
+		info = provider.info()
+	}
+
+	// Indicate activity
+	am.StartAction("Retrieving %s counts", counter.Activity())
+
+	// Is the service available in the partition of the account? If not, there is
+	// nothing to count.
+	if !IsServiceAvailable(ctx.Partition, CounterServiceID(counter)) {
+		am.EndAction("SKIPPED (%s is not available in %s)", counter.Service(), ctx.Partition)
+		return CountResult{}
+	}
+
+	// Was the run interrupted (or did it time out)? If so, nothing is counted.
+	if err := ctx.RequestContext().Err(); err != nil {
+		am.EndAction("CANCELED")
+		am.RecordError(NewCounterError(counter.Service(), "", err))
+
+		return CountResult{Incomplete: true, IncompleteRegions: map[string]bool{"": true}}
+	}
+
+	// The EC2 instances of each region are shared by the counters of the account
+	if ctx.ec2Scans == nil {
+		ctx.ec2Scans = &sync.Map{}
+	}
+
+	// Is this a global counter?
+	if !counter.Regional() {
+		return endGlobalCount(counter, ctx, info)
+	}
+
+	// Which regions should be examined?
+	var regionNames []string
+	if lister, ok := counter.(RegionLister); ok {
+		var err error
+		if regionNames, err = lister.RegionNames(ctx); err != nil {
+			// This affects every region, so the error is not associated with a single region
+			return endCount(am, 0, []error{NewCounterError(counter.Service(), "", err)}, info)
+		}
+	} else {
+		regionNames = ctx.RegionNames()
+	}
+
+	// Count the resources of each region (possibly concurrently), giving up on
+	// a region when its time runs out
+	regionResults := ScanRegions(regionNames, ctx.Run.Concurrency, func(regionName string) RegionResult {
+		regionCtx, cancel := ctx.Run.RegionContext()
+		defer cancel()
+
+		return counter.Count(ctx.WithContext(regionCtx), regionName)
+	})
+
+	// Merge the results
+	var errs []error
+	uniqueNames := make(map[string]bool)
+	counts := make(map[string]int, len(regionNames))
+	for ix, result := range regionResults {
+		counts[regionNames[ix]] = result.Count
+		for _, name := range result.Names {
+			uniqueNames[name] = true
+		}
+		for _, err := range result.Errs {
+			errs = append(errs, NewCounterError(counter.Service(), regionNames[ix], err))
+		}
+		recordInventory(ctx, counter, regionNames[ix], result.Inventory)
+	}
+
+	// What is the total? The same name may be found in several regions.
+	total := SumCounts(counts)
+	if info.Unique {
+		total = len(uniqueNames)
+	}
+
+	// Indicate end of activity
+	result := endCount(am, total, errs, info)
+	result.ByRegion = counts
+
+	return result
+}
+
+// End the count of a global counter
+func endGlobalCount(counter Counter, ctx *CountContext, info CounterInfo) CountResult {
+	am := ctx.Monitor
+
+	// Count the resources of all regions
+	regionResult := counter.Count(ctx, "")
+	recordInventory(ctx, counter, "", regionResult.Inventory)
+
+	// Did we fail?
+	if len(regionResult.Errs) > 0 {
+		var errs []error
+		for _, err := range regionResult.Errs {
+			errs = append(errs, NewCounterError(counter.Service(), "", err))
+		}
+
+		result := endCount(am, regionResult.Count, errs, info)
+		result.ByRegion = regionResult.ByRegion
+
+		return result
+	}
+
+	// Should we "qualify" our count? It is for all regions, even if only some were selected.
+	var qualify string
+	if !ctx.Run.EveryRegion() && regionResult.Count > 0 {
+		qualify = "*"
+	}
+
+	// Indicate end of activity
+	am.EndAction("OK (%d%s)", color.Bold(regionResult.Count), qualify)
+
+	return CountResult{Count: regionResult.Count, ByRegion: regionResult.ByRegion}
+}
+
+// Add the supplied items (inspected by the counter in the named region) to the
+// inventory of the run, if any
+func recordInventory(ctx *CountContext, counter Counter, regionName string, items []InventoryItem) {
+	// Are we keeping an inventory?
+	if ctx.Run.Inventory == nil {
+		return
+	}
+
+	// Identify where each item was found
+	for _, item := range items {
+		item.Account = ctx.AccountID
+		item.Timestamp = ctx.Timestamp
+		item.Service = counter.Service()
+		if item.Region == "" {
+			item.Region = regionName
+		}
+		ctx.Run.Inventory.Add(item)
+	}
+}
+
+// End the current action (as EndCount does). Errors of non-fatal counters are
+// always recorded, so they never end the program.
+func endCount(am ActivityMonitor, count int, errs []error, info CounterInfo) CountResult {
+	// Are errors of this counter fatal?
+	if !info.NonFatal || len(errs) == 0 {
+		return EndCount(am, count, errs)
+	}
+
+	// Report the partial count, followed by each error
+	am.EndAction("INCOMPLETE (%d)", color.Bold(count))
+	for _, err := range errs {
+		am.RecordError(err)
+	}
+
+	return CountResult{Count: count, Incomplete: true, IncompleteRegions: IncompleteRegions(errs)}
+}
@@ -0,0 +1,289 @@
+/******************************************************************************
+Cloud Resource Counter
+File: counters_test.go
+
+Summary: The Unit Test for counters.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Fake Counter
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// This counter returns pregenerated results for each region. A region without
+// a result simulates an error.
+type fakeCounter struct {
+	CounterInfo
+	Results map[string]RegionResult
+}
+
+// Examine the regions with results (and one without)
+func (fc fakeCounter) RegionNames(ctx *CountContext) ([]string, error) {
+	return []string{"us-east-1", "us-east-2", "us-west-2"}, nil
+}
+
+// Return the pregenerated result for the region
+func (fc fakeCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	result, ok := fc.Results[regionName]
+	if !ok {
+		return NewRegionResult(0, errors.New("boom"))
+	}
+
+	return result
+}
+
+// Get the names of the supplied counters
+func namesOf(counters []Counter) []string {
+	var names []string
+	for _, counter := range counters {
+		names = append(names, counter.Name())
+	}
+
+	return names
+}
+
+func TestSelectCounters(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		Only             []string
+		Skip             []string
+		ExpectedNames    []string
+		ExpectedProblems int
+	}{
+		{
+			ExpectedNames: CounterNames(),
+		},
+		{
+			Only:          []string{"s3", "lambda", "ec2"},
+			ExpectedNames: []string{"ec2", "lambda", "s3"},
+		},
+		{
+			Skip:          []string{"containers", "lightsail", "ec2-k8", "spot", "ebs", "rds", "eks"},
+			ExpectedNames: []string{"ec2", "lambda", "s3"},
+		},
+		{
+			Only:          []string{"ec2", "lambda"},
+			Skip:          []string{"lambda"},
+			ExpectedNames: []string{"ec2"},
+		},
+		{
+			Only:             []string{"ec2", "dynamodb"},
+			Skip:             []string{"glacier"},
+			ExpectedNames:    []string{"ec2"},
+			ExpectedProblems: 2,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Select the counters
+		counters, problems := SelectCounters(c.Only, c.Skip)
+
+		// Does it match?
+		if !reflect.DeepEqual(namesOf(counters), c.ExpectedNames) {
+			t.Errorf("Unexpected counters: expected %v, actual %v", c.ExpectedNames, namesOf(counters))
+		} else if len(problems) != c.ExpectedProblems {
+			t.Errorf("Unexpected problems: expected %d, actual %v", c.ExpectedProblems, problems)
+		}
+	}
+}
+
+func TestResultColumns(t *testing.T) {
+	// Select a couple of counters
+	counters, _ := SelectCounters([]string{"s3", "ec2"}, nil)
+
+	// Do we have the expected columns?
+	expected := []string{"Account ID", "Timestamp", "Region", "# of EC2 Instances", "# of S3 Buckets"}
+	if actual := ResultColumns(counters, false); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected columns: expected %v, actual %v", expected, actual)
+	}
+
+	// A breakdown by region adds the scope of each row
+	expected = []string{"Account ID", "Timestamp", "Region", "Scope", "# of EC2 Instances", "# of S3 Buckets"}
+	if actual := ResultColumns(counters, true); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected columns of a breakdown: expected %v, actual %v", expected, actual)
+	}
+}
+
+func TestRunCounter(t *testing.T) {
+	// Each region finds some images (and one region fails)
+	results := map[string]RegionResult{
+		"us-east-1": {Count: 2, Names: []string{"nginx", "redis"}},
+		"us-east-2": {Count: 1, Names: []string{"nginx"}},
+	}
+
+	// Construct our test cases...
+	cases := []struct {
+		Info               CounterInfo
+		ContinueOnError    bool
+		ExpectedCount      int
+		ExpectFatal        bool
+		ExpectedIncomplete []string
+	}{
+		{
+			Info:          CounterInfo{ServiceName: "Fake", IsRegional: true},
+			ExpectedCount: 3,
+			ExpectFatal:   true,
+		},
+		{
+			Info:          CounterInfo{ServiceName: "Fake", IsRegional: true, Unique: true},
+			ExpectedCount: 2,
+			ExpectFatal:   true,
+		},
+		{
+			Info:          CounterInfo{ServiceName: "Fake", IsRegional: true, NonFatal: true},
+			ExpectedCount: 3,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Run the counter
+		counter := fakeCounter{CounterInfo: c.Info, Results: results}
+		actual := RunCounter(counter, &CountContext{Monitor: mon, Run: &RunContext{AllRegions: true, Concurrency: 2}})
+
+		// Does it match? The failed region is always reported.
+		if actual.Count != c.ExpectedCount {
+			t.Errorf("Unexpected count: expected %d, actual %d", c.ExpectedCount, actual.Count)
+		} else if !actual.Incomplete || !actual.ForRegion("us-west-2").Incomplete || actual.ForRegion("us-east-1").Incomplete {
+			t.Errorf("Unexpected incomplete regions: %v", actual.IncompleteRegions)
+		} else if actual.ForRegion("us-east-1").Count != 2 {
+			t.Errorf("Unexpected count for us-east-1: expected %d, actual %d", 2, actual.ForRegion("us-east-1").Count)
+		} else if !strings.Contains(mon.ErrorMessage, "Fake in us-west-2") {
+			t.Errorf("Unexpected error message: %s", mon.ErrorMessage)
+		}
+
+		// Was the error sent to CheckError (which may end the program)?
+		fatal := false
+		for _, msg := range mon.Messages {
+			if strings.HasPrefix(msg, "Error: ") {
+				fatal = true
+			}
+		}
+		if fatal != c.ExpectFatal {
+			t.Errorf("Unexpected handling of the error: expected fatal=%v, actual %v", c.ExpectFatal, fatal)
+		}
+	}
+}
+
+func TestRunCounterUnavailableService(t *testing.T) {
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Run a counter whose service is not available in GovCloud. No service is
+	// needed, as it should not be invoked.
+	actual := RunCounter(LightsailCounter, &CountContext{Monitor: mon, Run: &RunContext{AllRegions: true}, Partition: PartitionGovCloud})
+
+	// Was it skipped (without an error)?
+	if actual.Count != 0 || actual.Incomplete {
+		t.Errorf("Unexpected result: %+v", actual)
+	} else if mon.ErrorOccured {
+		t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+	} else if !strings.Contains(strings.Join(mon.Messages, ""), "SKIPPED") {
+		t.Errorf("Expected the counter to be skipped, but it was not: %v", mon.Messages)
+	}
+}
+
+// This counter never finishes counting us-west-2 (until its time runs out)
+type slowCounter struct {
+	fakeCounter
+}
+
+// Return the pregenerated result for the region (waiting for the context of
+// us-west-2 to end)
+func (sc slowCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	if regionName == "us-west-2" {
+		<-ctx.RequestContext().Done()
+		return NewRegionResult(0, ctx.RequestContext().Err())
+	}
+
+	return sc.fakeCounter.Count(ctx, regionName)
+}
+
+func TestRunCounterRegionTimeout(t *testing.T) {
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Give up on the slow region
+	counter := slowCounter{fakeCounter{
+		CounterInfo: CounterInfo{ServiceName: "Fake", ActivityName: "fake thing", IsRegional: true, NonFatal: true},
+		Results:     map[string]RegionResult{"us-east-1": {Count: 2}, "us-east-2": {Count: 3}},
+	}}
+	actual := RunCounter(counter, &CountContext{Monitor: mon, Run: &RunContext{Concurrency: 3, RegionTimeout: 20 * time.Millisecond}})
+
+	// Were the other regions counted?
+	if actual.Count != 5 || !actual.Incomplete {
+		t.Errorf("Unexpected result: %+v", actual)
+	} else if !reflect.DeepEqual(actual.IncompleteRegions, map[string]bool{"us-west-2": true}) {
+		t.Errorf("Expected only us-west-2 to be incomplete, not %v", actual.IncompleteRegions)
+	}
+}
+
+func TestRunCounterCanceled(t *testing.T) {
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Run a counter after the run was cancelled. No service is needed, as it
+	// should not be invoked.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	actual := RunCounter(EC2Counter, &CountContext{Monitor: mon, Run: &RunContext{Context: ctx}})
+
+	// Was it cancelled (with an error)?
+	if actual.Count != 0 || !actual.Incomplete {
+		t.Errorf("Unexpected result: %+v", actual)
+	} else if !mon.ErrorOccured || !strings.Contains(strings.Join(mon.Messages, ""), "CANCELED") {
+		t.Errorf("Expected the counter to be cancelled, but it was not: %v", mon.Messages)
+	}
+}
+
+func TestRegisteredCounters(t *testing.T) {
+	// Read the README (which documents the minimal IAM policy)
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatalf("Unexpected error while reading README: %v", err)
+	}
+
+	// Check each registered counter
+	names := make(map[string]bool)
+	for _, counter := range Counters {
+		// Are the names unique?
+		if names[counter.Name()] {
+			t.Errorf("Duplicate counter name: %s", counter.Name())
+		}
+		names[counter.Name()] = true
+
+		// Does it describe itself?
+		if counter.Column() == "" || counter.Service() == "" || counter.Activity() == "" || len(counter.IAMActions(false)) == 0 {
+			t.Errorf("Counter %s is not fully described", counter.Name())
+		}
+
+		// Is its service known (so that its availability in each partition can be checked)?
+		if !Contains(EndpointServiceNames, CounterServiceID(counter)) {
+			t.Errorf("Counter %s has an unknown service: %s", counter.Name(), CounterServiceID(counter))
+		}
+	}
+
+	// Is every IAM action in the documented policy?
+	for _, action := range IAMActions(Counters, true) {
+		if !strings.Contains(string(readme), `"`+action+`"`) {
+			t.Errorf("IAM action %s is missing from the README", action)
+		}
+	}
+}
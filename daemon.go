@@ -0,0 +1,153 @@
+/******************************************************************************
+Cloud Resource Counter
+File: daemon.go
+
+Summary: The daemon subcommand, which counts resources on a cron-like schedule
+         (reusing its AWS sessions) and rotates its output files by date. The
+         loop of scheduled runs is shared with the serve subcommand.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RunDaemon runs the daemon subcommand with the supplied arguments (those of the
+// tool, along with --schedule, --run-now and --rotate). It counts resources on
+// the schedule until it receives SIGINT or SIGTERM. Errors are recorded (and
+// counted after each run) rather than ending the daemon.
+func RunDaemon(args []string, monitor *TerminalActivityMonitor) {
+	// Process all command line arguments
+	settings := &CommandLineSettings{subcommand: SubcommandDaemon}
+	cleanupFn := settings.Process(args, monitor)
+	defer cleanupFn()
+
+	// Show command line settings
+	settings.Display(monitor)
+
+	// Count on our schedule
+	runScheduled(settings, monitor, settings.schedule, settings.runNow, nil)
+}
+
+// RotatedFileName returns the name of the output file for the supplied time: the
+// date (for daily rotation) or the month (for monthly rotation) is added before
+// the extension of the base name (e.g., resources-2024-05-01.csv). Without
+// rotation, it is the base name.
+func RotatedFileName(baseFileName string, rotate string, t time.Time) string {
+	var layout string
+	switch rotate {
+	case RotateDaily:
+		layout = "2006-01-02"
+	case RotateMonthly:
+		layout = "2006-01"
+	default:
+		return baseFileName
+	}
+
+	ext := filepath.Ext(baseFileName)
+
+	return strings.TrimSuffix(baseFileName, ext) + "-" + t.Format(layout) + ext
+}
+
+// runScheduled counts resources on the supplied schedule (starting at once, if
+// requested) until it receives SIGINT or SIGTERM, which ends the current run
+// (keeping its partial results); a second signal ends the tool at once. The
+// sessions of each profile are reused (and refreshed) across runs. After each
+// run, its metrics are published (if a function is supplied) and written to the
+// Prometheus textfile (if any). A run that is still going when the next one is
+// due causes the latter to be skipped.
+func runScheduled(settings *CommandLineSettings, monitor *TerminalActivityMonitor, schedule Schedule, runNow bool, publish func(*RunMetrics)) {
+	// Keep counting when errors occur
+	settings.continueOnError = true
+	monitor.ContinueOnError = true
+
+	// Stop (ending the current run) when we are interrupted or terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// When is the first run?
+	sessions := NewSessionCache(settings)
+	next := time.Now()
+	if !runNow {
+		next = schedule.Next(next)
+		monitor.Message("\nThe first run starts at %s.\n", next.Format(time.RFC3339))
+	}
+
+	// Count on our schedule...
+	for waitUntil(ctx, next) {
+		// Move on to the output file of this day (or month)
+		if !settings.rotateOutputFile(time.Now(), monitor) {
+			break
+		}
+
+		started := time.Now()
+		run := countRun(ctx, settings, monitor, sessions)
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Publish (and write) the metrics of this run
+		violations := checkRules(settings, run, monitor)
+		metrics := run.Metrics(settings, violations)
+		if publish != nil {
+			publish(metrics)
+		}
+		if settings.prometheusTextfile != "" {
+			monitor.StartAction("Writing Prometheus metrics")
+			monitor.CheckError(WritePrometheusTextfile(settings.prometheusTextfile, metrics))
+			monitor.EndAction("OK")
+		}
+
+		// Prepare for the next run: its rows are appended to the output file and
+		// inventory (if any) and its growth is measured since this run (only)
+		settings.appendToOutput = true
+		settings.appendToInventory = true
+		settings.previousRuns = metrics.Rows
+		monitor.ClearErrors()
+
+		// ...until we are stopped. The runs missed while counting are skipped.
+		if next = schedule.Next(started); next.Before(time.Now()) {
+			next = schedule.Next(time.Now())
+		}
+		monitor.Message("\nCompleted in %v with %d error(s). The next run starts at %s.\n",
+			run.Duration.Round(time.Second), len(run.Errors), next.Format(time.RFC3339))
+	}
+
+	monitor.Message("\nStopped.\n")
+}
+
+// countRun collects the counts of a single run, which ends when the supplied
+// context is done or when it times out (with --timeout).
+func countRun(ctx context.Context, settings *CommandLineSettings, monitor *TerminalActivityMonitor, sessions *SessionCache) *CountRun {
+	if settings.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.timeout)
+		defer cancel()
+	}
+
+	return countAll(ctx, settings, monitor, sessions)
+}
+
+// Wait until the supplied time. It returns false if the context is done first.
+func waitUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
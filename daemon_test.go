@@ -0,0 +1,82 @@
+/******************************************************************************
+Cloud Resource Counter
+File: daemon_test.go
+
+Summary: The Unit Test for daemon.
+******************************************************************************/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestRotatedFileName(t *testing.T) {
+	now := time.Date(2024, time.May, 3, 14, 7, 30, 0, time.Local)
+
+	// Create our test cases
+	cases := []struct {
+		FileName         string
+		Rotate           string
+		ExpectedFileName string
+	}{
+		{"resources.csv", "", "resources.csv"},
+		{"resources.csv", RotateDaily, "resources-2024-05-03.csv"},
+		{"out/resources.ndjson", RotateMonthly, "out/resources-2024-05.ndjson"},
+		{"counts", RotateDaily, "counts-2024-05-03"},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		if actual := RotatedFileName(c.FileName, c.Rotate, now); actual != c.ExpectedFileName {
+			t.Errorf("Unexpected name for %s rotated %s: expected %s, actual %s", c.FileName, c.Rotate, c.ExpectedFileName, actual)
+		}
+	}
+}
+
+func TestRotateOutputFile(t *testing.T) {
+	baseFileName := filepath.Join(t.TempDir(), "resources.csv")
+	settings := &CommandLineSettings{
+		format:             FormatCSV,
+		rotate:             RotateDaily,
+		baseOutputFileName: baseFileName,
+		appendToOutput:     true,
+	}
+	mon := &mock.ActivityMonitorImpl{}
+
+	// The first day opens a new file...
+	day := time.Date(2024, time.May, 3, 0, 0, 0, 0, time.Local)
+	if !settings.rotateOutputFile(day, mon) || settings.outputFileName != RotatedFileName(baseFileName, RotateDaily, day) {
+		t.Fatalf("Unexpected output file for %v: %s (%v)", day, settings.outputFileName, mon.Messages)
+	}
+	firstFile := settings.outputFile
+	if settings.appendToOutput {
+		t.Errorf("Expected a new file to be written from the start")
+	}
+
+	// ...which is kept for the rest of the day
+	if !settings.rotateOutputFile(day.Add(23*time.Hour), mon) || settings.outputFile != firstFile {
+		t.Errorf("Expected the output file to be kept for the rest of the day")
+	}
+
+	// The next day starts another file
+	if !settings.rotateOutputFile(day.AddDate(0, 0, 1), mon) || settings.outputFile == firstFile {
+		t.Errorf("Expected another output file for the next day")
+	}
+	settings.outputFile.Close()
+
+	// Both files exist
+	for _, d := range []time.Time{day, day.AddDate(0, 0, 1)} {
+		if _, err := os.Stat(RotatedFileName(baseFileName, RotateDaily, d)); err != nil {
+			t.Errorf("Expected the output file of %v to exist: %v", d, err)
+		}
+	}
+	if mon.ErrorOccured {
+		t.Errorf("Unexpected error: %s", mon.ErrorMessage)
+	}
+}
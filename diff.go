@@ -0,0 +1,369 @@
+/******************************************************************************
+Cloud Resource Counter
+File: diff.go
+
+Summary: The diff subcommand, which compares the counts of two runs stored in
+         an output file (for each account and region).
+******************************************************************************/
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The formats of the report of the diff subcommand
+const (
+	DiffFormatText = "text"
+	DiffFormatCSV  = "csv"
+)
+
+// The status of a column that is not found in both runs
+const (
+	ColumnAdded   = "added"
+	ColumnRemoved = "removed"
+)
+
+// ColumnDelta is the change in a single column between two runs. The Status is
+// ColumnAdded (or ColumnRemoved) if the column is missing from the earlier (or
+// later) run, such as when the runs used different versions of the tool.
+type ColumnDelta struct {
+	Column string
+	Before CountResult
+	After  CountResult
+	Status string
+}
+
+// Change returns the difference between the counts of the two runs.
+func (cd ColumnDelta) Change() int {
+	return cd.After.Count - cd.Before.Count
+}
+
+// PercentChange returns the change as a percentage of the earlier count. It is
+// not known (false) if the earlier count is zero or if the column is missing
+// from either run.
+func (cd ColumnDelta) PercentChange() (float64, bool) {
+	if cd.Status != "" || cd.Before.Count == 0 {
+		return 0, false
+	}
+
+	return float64(cd.Change()) * 100 / float64(cd.Before.Count), true
+}
+
+// HistoryDiff is the comparison of two runs of the same account and region.
+type HistoryDiff struct {
+	AccountID string
+	Region    string
+	Before    HistoryRow
+	After     HistoryRow
+	Deltas    []ColumnDelta
+}
+
+// DiffHistory compares two runs of each account and region found in the supplied
+// rows. The later run is the latest one at (or before) the "to" time; the earlier
+// run is the latest one at (or before) the "from" time. If the "to" time is zero,
+// the latest run is used. If the "from" time is zero, the latest run before the
+// later one is used. Rows with the same timestamp belong to the same run, so they
+// are never compared. Accounts and regions without two such runs are left out.
+func DiffHistory(rows []HistoryRow, from time.Time, to time.Time) []HistoryDiff {
+	var diffs []HistoryDiff
+	for _, group := range GroupHistory(rows) {
+		// Find the later run...
+		after := len(group) - 1
+		if !to.IsZero() {
+			after = latestRun(group, to)
+		}
+
+		if after < 0 {
+			continue
+		}
+
+		// ...and the earlier one
+		var before int
+		if from.IsZero() {
+			before = latestRun(group, group[after].Timestamp.Add(-time.Nanosecond))
+		} else {
+			before = latestRun(group, from)
+		}
+
+		// Are there two different runs to compare?
+		if before < 0 || !group[before].Timestamp.Before(group[after].Timestamp) {
+			continue
+		}
+
+		diffs = append(diffs, HistoryDiff{
+			AccountID: group[after].AccountID,
+			Region:    group[after].Region,
+			Before:    group[before],
+			After:     group[after],
+			Deltas:    diffColumns(group[before], group[after]),
+		})
+	}
+
+	return diffs
+}
+
+// GroupHistory groups the supplied rows by account and region (in the order in
+// which each is first found). The rows of each region of a breakdown are kept
+// apart from the totals, even if they have the same region (e.g., when a single
+// region is examined). The rows of each group are sorted by timestamp.
+func GroupHistory(rows []HistoryRow) [][]HistoryRow {
+	type groupKey struct {
+		accountID, region string
+		breakdown         bool
+	}
+	var keys []groupKey
+	groups := make(map[groupKey][]HistoryRow)
+	for _, row := range rows {
+		key := groupKey{row.AccountID, row.Region, row.Scope == ScopeRegion}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], row)
+	}
+
+	var grouped [][]HistoryRow
+	for _, key := range keys {
+		group := groups[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Timestamp.Before(group[j].Timestamp)
+		})
+		grouped = append(grouped, group)
+	}
+
+	return grouped
+}
+
+// Find the index of the latest of the supplied (sorted) rows at or before the
+// supplied time (or -1, if there is none)
+func latestRun(rows []HistoryRow, at time.Time) int {
+	latest := -1
+	for ix, row := range rows {
+		if !row.Timestamp.After(at) {
+			latest = ix
+		}
+	}
+
+	return latest
+}
+
+// Compare the columns of two runs. The columns of the later run come first (in
+// its order), followed by those that were removed.
+func diffColumns(before HistoryRow, after HistoryRow) []ColumnDelta {
+	var deltas []ColumnDelta
+	for _, column := range after.Columns {
+		delta := ColumnDelta{Column: column, After: after.Counts[column]}
+		if count, ok := before.Counts[column]; ok {
+			delta.Before = count
+		} else {
+			delta.Status = ColumnAdded
+		}
+		deltas = append(deltas, delta)
+	}
+	for _, column := range before.Columns {
+		if _, ok := after.Counts[column]; !ok {
+			deltas = append(deltas, ColumnDelta{Column: column, Before: before.Counts[column], Status: ColumnRemoved})
+		}
+	}
+
+	return deltas
+}
+
+// ParseDiffTime parses a time supplied to the diff subcommand: either a timestamp
+// (as stored in the output file) or a date, which stands for the end of that day
+// (UTC).
+func ParseDiffTime(value string) (time.Time, error) {
+	if timestamp, err := time.Parse(time.RFC3339, value); err == nil {
+		return timestamp, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' is not a timestamp (e.g., 2024-05-01T12:00:00Z) or a date (e.g., 2024-05-01)", value)
+	}
+
+	return date.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// RunDiff runs the diff subcommand with the supplied arguments, writing its report
+// to the supplied io.Writer. The output file to read is the only positional
+// argument (resources.csv, if omitted).
+func RunDiff(args []string, w io.Writer, am ActivityMonitor) {
+	var fromTime, toTime, accountID, regionName, format string
+
+	// Define a new FlagSet
+	flagSet := flag.NewFlagSet(os.Args[0]+" diff", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s diff [options] [output-file]\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+
+	// Define and parse the command line arguments...
+	flagSet.StringVar(&fromTime, "from", "", "Compare the latest run at (or before) this `time` (a timestamp or a date). Defaults to the run before the later one.")
+	flagSet.StringVar(&toTime, "to", "", "Compare with the latest run at (or before) this `time` (a timestamp or a date). Defaults to the latest run.")
+	flagSet.StringVar(&accountID, "account", "", "Only compare the runs of the account with this `ID`.")
+	flagSet.StringVar(&regionName, "region", "", "Only compare the rows of this `region` (e.g., ALL_REGIONS or us-east-1).")
+	flagSet.StringVar(&format, "format", DiffFormatText, fmt.Sprintf("The `format` of the report (%s or %s).", DiffFormatText, DiffFormatCSV))
+	flagSet.Parse(args)
+
+	// Which output file should we read?
+	fileName := "resources.csv"
+	if flagSet.NArg() > 0 {
+		fileName = flagSet.Arg(0)
+	}
+
+	// Check our arguments
+	var problems []string
+	var from, to time.Time
+	var err error
+	if fromTime != "" {
+		if from, err = ParseDiffTime(fromTime); err != nil {
+			problems = append(problems, "--from: "+err.Error())
+		}
+	}
+	if toTime != "" {
+		if to, err = ParseDiffTime(toTime); err != nil {
+			problems = append(problems, "--to: "+err.Error())
+		}
+	}
+	if format != DiffFormatText && format != DiffFormatCSV {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid format (expected %s or %s).", format, DiffFormatText, DiffFormatCSV))
+	}
+	if flagSet.NArg() > 1 {
+		problems = append(problems, "Only one output file can be compared.")
+	}
+	if len(problems) > 0 {
+		am.ActionError("Error: %s", strings.Join(problems, "\n"))
+		return
+	}
+
+	// Read the runs
+	rows, err := ReadHistoryFile(fileName)
+	if err != nil {
+		am.ActionError("Error: Unable to read %s: %v", fileName, err)
+		return
+	}
+
+	// Keep the selected account and region
+	var selected []HistoryRow
+	for _, row := range rows {
+		if (accountID == "" || row.AccountID == accountID) && (regionName == "" || row.Region == regionName) {
+			selected = append(selected, row)
+		}
+	}
+
+	// Compare them
+	diffs := DiffHistory(selected, from, to)
+	if len(diffs) == 0 {
+		am.Message("There are no two runs of the same account and region to compare in %s.\n", fileName)
+		return
+	}
+
+	if format == DiffFormatCSV {
+		err = writeDiffCSV(w, diffs)
+	} else {
+		err = writeDiffText(w, diffs)
+	}
+	am.CheckError(err)
+}
+
+// Format a count for the report. Incomplete counts are marked with an asterisk.
+func formatDiffCount(count CountResult, missing bool) string {
+	switch {
+	case missing:
+		return "-"
+	case count.Incomplete:
+		return fmt.Sprintf("%d*", count.Count)
+	default:
+		return fmt.Sprintf("%d", count.Count)
+	}
+}
+
+// Format the change of a column for the report: its absolute change and its
+// percentage change (if known)
+func formatDiffChange(delta ColumnDelta) (string, string) {
+	if delta.Status != "" {
+		return "", ""
+	}
+
+	percent := "n/a"
+	if pct, ok := delta.PercentChange(); ok {
+		percent = fmt.Sprintf("%+.1f%%", pct)
+	}
+
+	return fmt.Sprintf("%+d", delta.Change()), percent
+}
+
+// Write a table for each comparison
+func writeDiffText(w io.Writer, diffs []HistoryDiff) error {
+	var incomplete bool
+	for ix, diff := range diffs {
+		if ix > 0 {
+			fmt.Fprintln(w)
+		}
+
+		// Which runs are compared?
+		fmt.Fprintf(w, "Account %s, region %s: %s -> %s\n", diff.AccountID, diff.Region,
+			diff.Before.Timestamp.Format(time.RFC3339), diff.After.Timestamp.Format(time.RFC3339))
+		if diff.Before.ToolVersion != diff.After.ToolVersion {
+			fmt.Fprintf(w, "Tool version: %s -> %s\n", diff.Before.ToolVersion, diff.After.ToolVersion)
+		}
+
+		// Show the change of each column
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "Column\tBefore\tAfter\tChange\tChange %")
+		for _, delta := range diff.Deltas {
+			change, percent := formatDiffChange(delta)
+			if delta.Status != "" {
+				change = delta.Status
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", delta.Column,
+				formatDiffCount(delta.Before, delta.Status == ColumnAdded),
+				formatDiffCount(delta.After, delta.Status == ColumnRemoved),
+				change, percent)
+			incomplete = incomplete || delta.Before.Incomplete || delta.After.Incomplete
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// Explain our asterisks
+	if incomplete {
+		fmt.Fprintln(w, "\n* The count is incomplete (some resources could not be counted).")
+	}
+
+	return nil
+}
+
+// Write a row for each column of each comparison
+func writeDiffCSV(w io.Writer, diffs []HistoryDiff) error {
+	rows := [][]string{{"Account ID", "Region", "From", "To", "Column", "Before", "After", "Change", "Change %", "Status"}}
+	for _, diff := range diffs {
+		for _, delta := range diff.Deltas {
+			// Leave out the counts that are missing
+			var before, after string
+			if delta.Status != ColumnAdded {
+				before = delta.Before.String()
+			}
+			if delta.Status != ColumnRemoved {
+				after = delta.After.String()
+			}
+
+			change, percent := formatDiffChange(delta)
+			rows = append(rows, []string{diff.AccountID, diff.Region,
+				diff.Before.Timestamp.Format(time.RFC3339), diff.After.Timestamp.Format(time.RFC3339),
+				delta.Column, before, after, change, percent, delta.Status})
+		}
+	}
+
+	return csv.NewWriter(w).WriteAll(rows)
+}
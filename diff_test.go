@@ -0,0 +1,322 @@
+/******************************************************************************
+Cloud Resource Counter
+File: diff_test.go
+
+Summary: The Unit Test for diff.
+******************************************************************************/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+// Create a row of a past run with the supplied counts
+func historyRow(accountID string, timestamp string, region string, counts map[string]int) HistoryRow {
+	row := HistoryRow{AccountID: accountID, Region: region, Counts: make(map[string]CountResult)}
+	row.Timestamp, _ = time.Parse(time.RFC3339, timestamp)
+	for _, key := range []string{"ec2_instances", "s3_buckets", "lambda_functions"} {
+		if count, ok := counts[key]; ok {
+			row.Columns = append(row.Columns, key)
+			row.Counts[key] = CountResult{Count: count}
+		}
+	}
+
+	return row
+}
+
+func TestDiffHistory(t *testing.T) {
+	// Three runs of one account (out of order) and one run of another
+	rows := []HistoryRow{
+		historyRow("111122223333", "2024-05-02T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 12, "s3_buckets": 3}),
+		historyRow("111122223333", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10, "s3_buckets": 3}),
+		historyRow("444455556666", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 1}),
+		historyRow("111122223333", "2024-05-03T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 9, "lambda_functions": 4}),
+	}
+
+	// Create our test cases
+	cases := []struct {
+		From            string
+		To              string
+		ExpectedDiffs   int
+		ExpectedBefore  int
+		ExpectedAfter   int
+		ExpectedDeltas  []string
+		ExpectedChanges []int
+	}{
+		{
+			// The latest two runs
+			ExpectedDiffs:   1,
+			ExpectedBefore:  2,
+			ExpectedAfter:   3,
+			ExpectedDeltas:  []string{"ec2_instances", "lambda_functions:added", "s3_buckets:removed"},
+			ExpectedChanges: []int{-3, 4, -3},
+		},
+		{
+			// The run before the 2nd
+			To:              "2024-05-02T23:00:00Z",
+			ExpectedDiffs:   1,
+			ExpectedBefore:  1,
+			ExpectedAfter:   2,
+			ExpectedDeltas:  []string{"ec2_instances", "s3_buckets"},
+			ExpectedChanges: []int{2, 0},
+		},
+		{
+			// The 1st and the latest runs
+			From:            "2024-05-01T12:00:00Z",
+			ExpectedDiffs:   1,
+			ExpectedBefore:  1,
+			ExpectedAfter:   3,
+			ExpectedDeltas:  []string{"ec2_instances", "lambda_functions:added", "s3_buckets:removed"},
+			ExpectedChanges: []int{-1, 4, -3},
+		},
+		{
+			// Nothing before the 1st run
+			From: "2024-04-30T00:00:00Z",
+		},
+		{
+			// The "from" run is not earlier than the "to" run
+			From: "2024-05-03T12:00:00Z",
+			To:   "2024-05-02T12:00:00Z",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		var from, to time.Time
+		if c.From != "" {
+			from, _ = time.Parse(time.RFC3339, c.From)
+		}
+		if c.To != "" {
+			to, _ = time.Parse(time.RFC3339, c.To)
+		}
+
+		diffs := DiffHistory(rows, from, to)
+		if len(diffs) != c.ExpectedDiffs {
+			t.Errorf("%s-%s: Unexpected number of diffs: expected %d, actual %d", c.From, c.To, c.ExpectedDiffs, len(diffs))
+			continue
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+
+		// Were the expected runs compared?
+		diff := diffs[0]
+		if diff.AccountID != "111122223333" || diff.Before.Timestamp.Day() != c.ExpectedBefore || diff.After.Timestamp.Day() != c.ExpectedAfter {
+			t.Errorf("%s-%s: Unexpected runs compared: %s, %v -> %v", c.From, c.To, diff.AccountID, diff.Before.Timestamp, diff.After.Timestamp)
+		}
+
+		// Were the expected columns compared?
+		var deltas []string
+		var changes []int
+		for _, delta := range diff.Deltas {
+			name := delta.Column
+			if delta.Status != "" {
+				name += ":" + delta.Status
+			}
+			deltas = append(deltas, name)
+			changes = append(changes, delta.Change())
+		}
+		if strings.Join(deltas, ",") != strings.Join(c.ExpectedDeltas, ",") {
+			t.Errorf("%s-%s: Unexpected deltas: expected %v, actual %v", c.From, c.To, c.ExpectedDeltas, deltas)
+		}
+		for ix := range changes {
+			if ix < len(c.ExpectedChanges) && changes[ix] != c.ExpectedChanges[ix] {
+				t.Errorf("%s-%s: Unexpected change of %s: expected %d, actual %d", c.From, c.To, deltas[ix], c.ExpectedChanges[ix], changes[ix])
+			}
+		}
+	}
+}
+
+func TestDiffHistoryBreakdown(t *testing.T) {
+	// Two runs broken down by a single region (whose rows have the same account,
+	// region and timestamp as the totals), each counted twice (e.g., by two
+	// profiles)
+	var rows []HistoryRow
+	for _, run := range []struct {
+		Timestamp string
+		Count     int
+	}{{"2024-05-01T12:00:00Z", 3}, {"2024-05-02T12:00:00Z", 10}} {
+		for _, scope := range []string{ScopeRegion, ScopeTotal, ScopeRegion, ScopeTotal} {
+			row := historyRow("111122223333", run.Timestamp, "us-east-1", map[string]int{"ec2_instances": run.Count})
+			row.Scope = scope
+			rows = append(rows, row)
+		}
+	}
+
+	// The region and the totals are each compared across the two runs
+	diffs := DiffHistory(rows, time.Time{}, time.Time{})
+	if len(diffs) != 2 {
+		t.Fatalf("Unexpected number of diffs: expected 2, actual %d", len(diffs))
+	}
+	for _, diff := range diffs {
+		if diff.Before.Timestamp.Day() != 1 || diff.After.Timestamp.Day() != 2 || diff.Before.Scope != diff.After.Scope {
+			t.Errorf("Unexpected runs compared: %v (%s) -> %v (%s)", diff.Before.Timestamp, diff.Before.Scope, diff.After.Timestamp, diff.After.Scope)
+		} else if len(diff.Deltas) != 1 || diff.Deltas[0].Before.Count != 3 || diff.Deltas[0].After.Count != 10 {
+			t.Errorf("Unexpected deltas: %+v", diff.Deltas)
+		}
+	}
+}
+
+func TestColumnDeltaPercentChange(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Delta         ColumnDelta
+		Expected      float64
+		ExpectedKnown bool
+	}{
+		{
+			Delta:         ColumnDelta{Before: CountResult{Count: 8}, After: CountResult{Count: 10}},
+			Expected:      25,
+			ExpectedKnown: true,
+		},
+		{
+			Delta:         ColumnDelta{Before: CountResult{Count: 4}, After: CountResult{Count: 1}},
+			Expected:      -75,
+			ExpectedKnown: true,
+		},
+		{
+			Delta: ColumnDelta{After: CountResult{Count: 3}},
+		},
+		{
+			Delta: ColumnDelta{Before: CountResult{Count: 3}, Status: ColumnRemoved},
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		actual, known := c.Delta.PercentChange()
+		if known != c.ExpectedKnown || actual != c.Expected {
+			t.Errorf("Unexpected percentage change for %+v: expected %v (%v), actual %v (%v)", c.Delta, c.Expected, c.ExpectedKnown, actual, known)
+		}
+	}
+}
+
+func TestParseDiffTime(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Value       string
+		Expected    string
+		ExpectError bool
+	}{
+		{
+			Value:    "2024-05-01T12:00:00Z",
+			Expected: "2024-05-01T12:00:00Z",
+		},
+		{
+			Value:    "2024-05-01",
+			Expected: "2024-05-01T23:59:59Z",
+		},
+		{
+			Value:       "yesterday",
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		actual, err := ParseDiffTime(c.Value)
+		if c.ExpectError {
+			if err == nil {
+				t.Errorf("Expected an error parsing '%s'", c.Value)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", c.Value, err)
+		} else if formatted := actual.Format(time.RFC3339); formatted != c.Expected {
+			t.Errorf("Unexpected time parsing '%s': expected %s, actual %s", c.Value, c.Expected, formatted)
+		}
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	// Write an output file holding two runs
+	fileName := filepath.Join(t.TempDir(), "resources.csv")
+	if err := os.WriteFile(fileName, []byte(historyCSV), 0644); err != nil {
+		t.Fatalf("Unexpected error while writing %s: %v", fileName, err)
+	}
+
+	// Construct our test cases...
+	cases := []struct {
+		Args              []string
+		ExpectError       bool
+		ExpectedStrings   []string
+		UnexpectedStrings []string
+	}{
+		{
+			Args: []string{fileName},
+			ExpectedStrings: []string{
+				"Account 111122223333, region ALL_REGIONS: 2024-05-01T12:00:00Z -> 2024-05-02T12:00:00Z",
+				"ec2_instances     10      12*    +2      +20.0%\n",
+				"lambda_functions  -       5      added",
+				"s3_buckets        3       3      +0      +0.0%\n",
+				"* The count is incomplete",
+			},
+			UnexpectedStrings: []string{"Tool version"},
+		},
+		{
+			Args: []string{"--format", "csv", fileName},
+			ExpectedStrings: []string{
+				"Account ID,Region,From,To,Column,Before,After,Change,Change %,Status\n",
+				"111122223333,ALL_REGIONS,2024-05-01T12:00:00Z,2024-05-02T12:00:00Z,ec2_instances,10,12 (incomplete),+2,+20.0%,\n",
+				"111122223333,ALL_REGIONS,2024-05-01T12:00:00Z,2024-05-02T12:00:00Z,lambda_functions,,5,,,added\n",
+			},
+		},
+		{
+			Args:              []string{"--account", "444455556666", fileName},
+			UnexpectedStrings: []string{"Account"},
+		},
+		{
+			Args:        []string{"--from", "last week", fileName},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--format", "xml", fileName},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{filepath.Join(t.TempDir(), "missing.csv")},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a Builder to hold the report
+		builder := strings.Builder{}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Compare the runs
+		RunDiff(c.Args, &builder, mon)
+
+		// Did we expect an error?
+		if c.ExpectError {
+			if !mon.ErrorOccured {
+				t.Errorf("Expected an error to occur for %v, but it did not... :^(", c.Args)
+			}
+			continue
+		} else if mon.ErrorOccured {
+			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+			continue
+		}
+
+		// Are the expected strings present (and the unexpected ones absent)?
+		for _, expected := range c.ExpectedStrings {
+			if !strings.Contains(builder.String(), expected) {
+				t.Errorf("Expected report for %v to contain %q, but it did not:\n%s", c.Args, expected, builder.String())
+			}
+		}
+		for _, unexpected := range c.UnexpectedStrings {
+			if strings.Contains(builder.String(), unexpected) {
+				t.Errorf("Expected report for %v not to contain %q, but it did", c.Args, unexpected)
+			}
+		}
+	}
+}
@@ -8,39 +8,37 @@ Summary: Count the number of EBS Volumes
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
-	color "github.com/logrusorgru/aurora"
 )
 
-// EBSVolumes returns a count of all EBS volumes in the current region (if allRegions
-// is false) or in all regions associated with this account (if allRegions is true).
-func EBSVolumes(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving EBS volume counts")
-
-	// Should we get the counts for all regions?
-	instanceCount := 0
-	if allRegions {
-		// Get the list of all enabled regions for this account
-		regionsSlice := GetEC2Regions(sf.GetEC2InstanceService(""), am)
+// EBSVolumes returns a count of all EBS volumes in the current region (if rc.AllRegions
+// is false) or in all regions associated with this account (if rc.AllRegions is true).
+func EBSVolumes(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(EBSCounter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-		// Loop through all of the regions
-		for _, regionName := range regionsSlice {
-			// Get the EBS Volume counts for a specific region
-			instanceCount += ebsVolumesForSingleRegion(sf.GetEC2InstanceService(regionName), am)
-		}
-	} else {
-		// Get the EBS Volume counts for the region selected by this session
-		instanceCount = ebsVolumesForSingleRegion(sf.GetEC2InstanceService(""), am)
-	}
+// ebsCounter counts the EBS volumes of a region.
+type ebsCounter struct {
+	CounterInfo
+}
 
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(instanceCount))
+// EBSCounter is the registered Counter for EBS volumes.
+var EBSCounter = ebsCounter{CounterInfo{
+	CounterName:  "ebs",
+	ColumnName:   "# of EBS Volumes",
+	ServiceName:  "EBS",
+	ActivityName: "EBS volume",
+	Actions:      []string{"ec2:DescribeVolumes"},
+	IsRegional:   true,
+}}
 
-	return instanceCount
+// Count the EBS volumes of the supplied region
+func (ebsCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	return NewInventoryResult(ebsVolumesForSingleRegion(ctx.RequestContext(), ctx.ServiceFactory.GetEC2InstanceService(regionName), ctx.Monitor))
 }
 
-func ebsVolumesForSingleRegion(ec2is *EC2InstanceService, am ActivityMonitor) int {
+func ebsVolumesForSingleRegion(c aws.Context, ec2is *EC2InstanceService, am ActivityMonitor) ([]InventoryItem, error) {
 	// Indicate activity
 	am.Message(".")
 
@@ -48,21 +46,23 @@ func ebsVolumesForSingleRegion(ec2is *EC2InstanceService, am ActivityMonitor) in
 	input := &ec2.DescribeVolumesInput{}
 
 	// Invoke our service
-	instanceCount := 0
-	err := ec2is.InspectVolumes(input, func(page *ec2.DescribeVolumesOutput, lastPage bool) bool {
+	var items []InventoryItem
+	err := ec2is.InspectVolumes(c, input, func(page *ec2.DescribeVolumesOutput, lastPage bool) bool {
 		// Loop through each Volume
 		for _, volume := range page.Volumes {
+			id := aws.StringValue(volume.VolumeId)
+			state := aws.StringValue(volume.State)
+
 			// Do we have a non-nil, non-empty Attachments array?
 			if volume.Attachments != nil && len(volume.Attachments) > 0 {
-				instanceCount++
+				items = append(items, CountedItem(id, state, "attached volume"))
+			} else {
+				items = append(items, ExcludedItem(id, state, "unattached volume"))
 			}
 		}
 
 		return true
 	})
 
-	// Check for error
-	am.CheckError(err)
-
-	return instanceCount
+	return items, err
 }
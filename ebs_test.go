@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/expel-io/aws-resource-counter/mock"
@@ -134,8 +135,8 @@ type fakeEBSService struct {
 	DRResponse  *ec2.DescribeRegionsOutput
 }
 
-// Simulate the DescribeRegions function
-func (fake *fakeEBSService) DescribeRegions(input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
+// Simulate the DescribeRegionsWithContext function
+func (fake *fakeEBSService) DescribeRegionsWithContext(ctx aws.Context, input *ec2.DescribeRegionsInput, _ ...request.Option) (*ec2.DescribeRegionsOutput, error) {
 	// If the supplied response is nil, then simulate an error
 	if fake.DRResponse == nil {
 		return nil, errors.New("DescribeRegions encountered an unexpected error: 6789")
@@ -144,9 +145,9 @@ func (fake *fakeEBSService) DescribeRegions(input *ec2.DescribeRegionsInput) (*e
 	return fake.DRResponse, nil
 }
 
-// Simulate the DescribeVolumesPages function
-func (fake *fakeEBSService) DescribeVolumesPages(input *ec2.DescribeVolumesInput,
-	fn func(*ec2.DescribeVolumesOutput, bool) bool) error {
+// Simulate the DescribeVolumesPagesWithContext function
+func (fake *fakeEBSService) DescribeVolumesPagesWithContext(ctx aws.Context, input *ec2.DescribeVolumesInput,
+	fn func(*ec2.DescribeVolumesOutput, bool) bool, _ ...request.Option) error {
 	// If the supplied response is nil, then simulate an error
 	if fake.DVOResponse == nil {
 		return errors.New("DescribeVolumes encountered an unexpected error: 1234")
@@ -201,6 +202,16 @@ func (fsf fakeEBSServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeEBSServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeEBSServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // Basic implementation
 func (fsf fakeEBSServiceFactory) GetEC2InstanceService(regionName string) *EC2InstanceService {
 	// If the caller failed to specify a region, then use what is associated with our factory
@@ -291,18 +302,20 @@ func TestEBSVolumes(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our EBSVolumes function
-		actualCount := EBSVolumes(sf, mon, c.AllRegions)
+		actualCount := EBSVolumes(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: EBSVolumes returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: EBSVolumes returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
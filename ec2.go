@@ -7,79 +7,56 @@ Summary: Provides a count of all (non-spot) EC2 instances.
 
 package main
 
-import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
-
-	color "github.com/logrusorgru/aurora"
-)
-
 // EC2Counts retrieves the count of all EC2 instances either for all
-// regions (allRegions is true) or the region associated with the
+// regions (rc.AllRegions is true) or the region associated with the
 // session. This method gives status back to the user via the supplied
 // ActivityMonitor instance.
-func EC2Counts(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving EC2 counts")
+func EC2Counts(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(EC2Counter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-	// Should we get the counts for all regions?
-	instanceCount := 0
-	if allRegions {
-		// Get the list of all enabled regions for this account
-		regionsSlice := GetEC2Regions(sf.GetEC2InstanceService(""), am)
+// ec2Counter counts the running (non-spot) EC2 instances of a region.
+type ec2Counter struct {
+	CounterInfo
+}
 
-		// Loop through all of the regions
-		for _, regionName := range regionsSlice {
-			// Get the EC2 counts for a specific region
-			instanceCount += ec2CountForSingleRegion(sf.GetEC2InstanceService(regionName), am)
-		}
-	} else {
-		// Get the EC2 counts for the region selected by this session
-		instanceCount = ec2CountForSingleRegion(sf.GetEC2InstanceService(""), am)
-	}
+// EC2Counter is the registered Counter for running (non-spot) EC2 instances.
+var EC2Counter = ec2Counter{CounterInfo{
+	CounterName:  "ec2",
+	ColumnName:   "# of EC2 Instances",
+	ServiceName:  "EC2",
+	ActivityName: "EC2",
+	Actions:      []string{"ec2:DescribeInstances"},
+	IsRegional:   true,
+}}
+
+// Count the running (non-spot) EC2 instances of the supplied region
+func (ec2Counter) Count(ctx *CountContext, regionName string) RegionResult {
+	// Indicate activity
+	ctx.Monitor.Message(".")
 
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(instanceCount))
+	// Get the running instances of the region (described once for all EC2 counters)
+	instances, err := ctx.EC2Instances(regionName)
 
-	return instanceCount
+	return NewInventoryResult(ec2InstanceItems(instances), err)
 }
 
-// Get the EC2 Instance count for a single region
-func ec2CountForSingleRegion(ec2is *EC2InstanceService, am ActivityMonitor) int {
-	// Indicate activity
-	am.Message(".")
-
-	// Construct our input to find only RUNNING EC2 instances
-	input := &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
-			{
-				Name: aws.String("instance-state-name"),
-				Values: []*string{
-					aws.String("running"),
-				},
-			},
-		},
+// Note which of the running EC2 instances are counted
+func ec2InstanceItems(instances []EC2Instance) []InventoryItem {
+	var items []InventoryItem
+	for _, instance := range instances {
+		items = append(items, ec2InstanceItem(instance))
 	}
 
-	// Invoke our service
-	instanceCount := 0
-	err := ec2is.InspectInstances(input, func(dio *ec2.DescribeInstancesOutput, lastPage bool) bool {
-		// Loop through each reservation, instance
-		for _, reservation := range dio.Reservations {
-			for _, instance := range reservation.Instances {
-				// Is this a valid instance? Spot instances have an InstanceLifecycle of "spot".
-				// Similarly, Scheduled instances have an InstanceLifecycle of "scheduled".
-				if instance.InstanceLifecycle == nil {
-					instanceCount++
-				}
-			}
-		}
-
-		return true
-	})
+	return items
+}
 
-	// Check for error
-	am.CheckError(err)
+// Decide whether a running EC2 instance is counted
+func ec2InstanceItem(instance EC2Instance) InventoryItem {
+	// Is this a valid instance? Spot and Scheduled instances are not.
+	if instance.Lifecycle == LifecycleOnDemand {
+		return CountedItem(instance.ID, instance.State, "running instance")
+	}
 
-	return instanceCount
+	return ExcludedItem(instance.ID, instance.State, instance.Lifecycle+" lifecycle")
 }
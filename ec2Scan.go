@@ -0,0 +1,128 @@
+/******************************************************************************
+Cloud Resource Counter
+File: ec2Scan.go
+
+Summary: Describes the running EC2 instances of a region in a single pass, which
+         is shared by the counters that classify them (EC2, Spot and EC2 K8).
+******************************************************************************/
+
+package main
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// The lifecycles of an EC2 instance
+const (
+	LifecycleOnDemand  = "on-demand"
+	LifecycleSpot      = "spot"
+	LifecycleScheduled = "scheduled"
+)
+
+// The tag that marks an EC2 instance as a node of an EKS cluster
+const eksClusterTagKey = "aws:eks:cluster-name"
+
+// EC2Instance is the classification of a running EC2 instance. EKSNode is set
+// if the instance is tagged as a node of an EKS cluster (named by EKSCluster).
+type EC2Instance struct {
+	ID           string
+	State        string
+	Lifecycle    string
+	EKSNode      bool
+	EKSCluster   string
+	Platform     string
+	InstanceType string
+}
+
+// The running EC2 instances of a region, described (at most) once
+type ec2RegionScan struct {
+	once      sync.Once
+	instances []EC2Instance
+	err       error
+}
+
+// EC2Instances returns the running EC2 instances of the supplied region. They
+// are described once per account and shared by every counter that needs them
+// (unless the counter is run outside of RunCounter).
+func (ctx *CountContext) EC2Instances(regionName string) ([]EC2Instance, error) {
+	if ctx.ec2Scans == nil {
+		return describeEC2Instances(ctx.RequestContext(), ctx.ServiceFactory.GetEC2InstanceService(regionName))
+	}
+
+	value, _ := ctx.ec2Scans.LoadOrStore(regionName, &ec2RegionScan{})
+	scan := value.(*ec2RegionScan)
+	scan.once.Do(func() {
+		scan.instances, scan.err = describeEC2Instances(ctx.RequestContext(), ctx.ServiceFactory.GetEC2InstanceService(regionName))
+	})
+
+	return scan.instances, scan.err
+}
+
+// Describe (and classify) the running EC2 instances of a single region
+func describeEC2Instances(c aws.Context, ec2is *EC2InstanceService) ([]EC2Instance, error) {
+	// Construct our input to find only RUNNING EC2 instances
+	input := &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name: aws.String("instance-state-name"),
+				Values: []*string{
+					aws.String("running"),
+				},
+			},
+		},
+	}
+
+	// Invoke our service
+	var instances []EC2Instance
+	err := ec2is.InspectInstances(c, input, func(dio *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		// Loop through each reservation, instance
+		for _, reservation := range dio.Reservations {
+			for _, instance := range reservation.Instances {
+				instances = append(instances, classifyEC2Instance(instance))
+			}
+		}
+
+		return true
+	})
+
+	return instances, err
+}
+
+// Classify an EC2 instance
+func classifyEC2Instance(instance *ec2.Instance) EC2Instance {
+	classified := EC2Instance{
+		ID:           aws.StringValue(instance.InstanceId),
+		State:        ec2InstanceState(instance),
+		Lifecycle:    LifecycleOnDemand,
+		Platform:     aws.StringValue(instance.PlatformDetails),
+		InstanceType: aws.StringValue(instance.InstanceType),
+	}
+
+	// Spot instances have an InstanceLifecycle of "spot". Similarly, Scheduled
+	// instances have an InstanceLifecycle of "scheduled".
+	if instance.InstanceLifecycle != nil {
+		classified.Lifecycle = *instance.InstanceLifecycle
+	}
+
+	// Does it belong to an EKS cluster?
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == eksClusterTagKey {
+			classified.EKSNode = true
+			classified.EKSCluster = aws.StringValue(tag.Value)
+		}
+	}
+
+	return classified
+}
+
+// Get the name of the state of an EC2 instance (if known)
+func ec2InstanceState(instance *ec2.Instance) string {
+	if instance.State == nil {
+		return ""
+	}
+
+	return aws.StringValue(instance.State.Name)
+}
@@ -0,0 +1,106 @@
+/******************************************************************************
+Cloud Resource Counter
+File: ec2Scan_test.go
+
+Summary: The Unit Test for ec2Scan.
+******************************************************************************/
+
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+// A fake service factory that counts the EC2 services requested for each region
+type countingEC2ServiceFactory struct {
+	fakeEC2ServiceFactory
+	mu       *sync.Mutex
+	requests map[string]int
+}
+
+// Count the request before returning the EC2 service
+func (csf countingEC2ServiceFactory) GetEC2InstanceService(regionName string) *EC2InstanceService {
+	csf.mu.Lock()
+	csf.requests[regionName]++
+	csf.mu.Unlock()
+
+	return csf.fakeEC2ServiceFactory.GetEC2InstanceService(regionName)
+}
+
+func TestSharedEC2Scan(t *testing.T) {
+	// Create our fake service factory
+	sf := countingEC2ServiceFactory{
+		fakeEC2ServiceFactory: fakeEC2ServiceFactory{DRResponse: ec2Regions},
+		mu:                    &sync.Mutex{},
+		requests:              make(map[string]int),
+	}
+
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Run the EC2, Spot and EC2 K8 counters for the same account
+	ctx := &CountContext{ServiceFactory: sf, Monitor: mon, Run: &RunContext{AllRegions: true, Concurrency: 2}}
+	expected := map[string]int{"ec2": 9, "spot": 1, "ec2-k8": 1}
+	for _, counter := range []Counter{EC2Counter, SpotCounter, EC2K8Counter} {
+		if actual := RunCounter(counter, ctx); actual.Count != expected[counter.Name()] {
+			t.Errorf("Unexpected count of %s: expected %d, actual %d", counter.Name(), expected[counter.Name()], actual.Count)
+		}
+	}
+	if mon.ErrorOccured {
+		t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+	}
+
+	// Were the regions resolved once, and the instances of each region described once?
+	for _, regionName := range []string{"", "us-east-1", "us-east-2", "af-south-1"} {
+		if sf.requests[regionName] != 1 {
+			t.Errorf("Expected a single EC2 service for region '%s', but %d were requested", regionName, sf.requests[regionName])
+		}
+	}
+}
+
+func TestClassifyEC2Instance(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		Instance *ec2.Instance
+		Expected EC2Instance
+	}{
+		{
+			Instance: &ec2.Instance{
+				InstanceId:      aws.String("i-1"),
+				State:           &ec2.InstanceState{Name: aws.String("running")},
+				InstanceType:    aws.String("t3.micro"),
+				PlatformDetails: aws.String("Linux/UNIX"),
+			},
+			Expected: EC2Instance{ID: "i-1", State: "running", Lifecycle: LifecycleOnDemand, Platform: "Linux/UNIX", InstanceType: "t3.micro"},
+		},
+		{
+			Instance: &ec2.Instance{
+				InstanceId:        aws.String("i-2"),
+				InstanceLifecycle: aws.String("spot"),
+				Tags:              []*ec2.Tag{{Key: aws.String("aws:eks:cluster-name"), Value: aws.String("prod")}},
+			},
+			Expected: EC2Instance{ID: "i-2", Lifecycle: LifecycleSpot, EKSNode: true, EKSCluster: "prod"},
+		},
+		{
+			Instance: &ec2.Instance{
+				InstanceId:        aws.String("i-3"),
+				InstanceLifecycle: aws.String("scheduled"),
+				Tags:              []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("nightly")}},
+			},
+			Expected: EC2Instance{ID: "i-3", Lifecycle: LifecycleScheduled},
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		if actual := classifyEC2Instance(c.Instance); actual != c.Expected {
+			t.Errorf("Unexpected classification: expected %+v, actual %+v", c.Expected, actual)
+		}
+	}
+}
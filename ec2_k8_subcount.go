@@ -1,85 +1,51 @@
 /******************************************************************************
 Cloud Resource Counter
-File: spot.go
+File: ec2_k8_subcount.go
 
-Summary: Provides a count of all Spot EC2 instances.
+Summary: Provides a count of all EC2 instances that belong to an EKS cluster.
 ******************************************************************************/
 
 package main
 
-import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	color "github.com/logrusorgru/aurora"
-)
-
-// SpotInstances retrieves the count of all EC2 spot instances
-// either for all regions (allRegions is true) or the region
-// associated with the session.
+// EC2K8SubInstances retrieves the count of all EC2 instances that belong
+// to an EKS cluster either for all regions (rc.AllRegions is true) or the
+// region associated with the session.
 // This method gives status back to the user via the supplied
 // ActivityMonitor instance.
-func EC2K8SubInstances(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving EC2 K8 related VMs Sub-instance counts")
-
-	// Should we get the counts for all regions?
-	instanceCount := 0
-	if allRegions {
-		// Get the list of all enabled regions for this account
-		regionsSlice := GetEC2Regions(sf.GetEC2InstanceService(""), am)
-
-		// Loop through all of the regions
-		for _, regionName := range regionsSlice {
-			// Get the EC2 counts for a specific region
-			instanceCount += ec2K8SubInstancesForSingleRegion(sf.GetEC2InstanceService(regionName), am)
-		}
-	} else {
-		// Get the EC2 counts for the region selected by this session
-		instanceCount = ec2K8SubInstancesForSingleRegion(sf.GetEC2InstanceService(""), am)
-	}
-
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(instanceCount))
+func EC2K8SubInstances(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(EC2K8Counter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-	return instanceCount
+// ec2K8Counter counts the running EC2 instances that belong to an EKS cluster of a region.
+type ec2K8Counter struct {
+	CounterInfo
 }
 
-func ec2K8SubInstancesForSingleRegion(ec2is *EC2InstanceService, am ActivityMonitor) int {
+// EC2K8Counter is the registered Counter for running EC2 instances that belong to an EKS cluster.
+var EC2K8Counter = ec2K8Counter{CounterInfo{
+	CounterName:  "ec2-k8",
+	ColumnName:   "# of EC2 K8 related VMs Sub-instances",
+	ServiceName:  "EC2 K8",
+	ActivityName: "EC2 K8 related VMs Sub-instance",
+	Actions:      []string{"ec2:DescribeInstances"},
+	IsRegional:   true,
+}}
+
+// Count the running EC2 instances that belong to an EKS cluster of the supplied region
+func (ec2K8Counter) Count(ctx *CountContext, regionName string) RegionResult {
 	// Indicate activity
-	am.Message(".")
+	ctx.Monitor.Message(".")
 
-	// Construct our input to find ONLY RUNNING EC2 instances that also have the "aws:eks:cluster-name" tag
-	input := &ec2.DescribeInstancesInput{
-		Filters: []*ec2.Filter{
-			{
-				Name: aws.String("tag-key"),
-				Values: []*string{
-					aws.String("aws:eks:cluster-name"),
-				},
-			},
-			{
-				Name: aws.String("instance-state-name"),
-				Values: []*string{
-					aws.String("running"),
-				},
-			},
-		},
-	}
+	// Get the running instances of the region (described once for all EC2 counters)
+	instances, err := ctx.EC2Instances(regionName)
 
-	// Invoke our service
-	instanceCount := 0
-	err := ec2is.InspectInstances(input, func(dio *ec2.DescribeInstancesOutput, lastPage bool) bool {
-		// Loop through each reservation
-		for _, reservation := range dio.Reservations {
-			// We assume that the AWS Service has properly filtered the list of returned instances
-			instanceCount += len(reservation.Instances)
+	// Keep those with the "aws:eks:cluster-name" tag
+	var items []InventoryItem
+	for _, instance := range instances {
+		if instance.EKSNode {
+			items = append(items, CountedItem(instance.ID, instance.State, "EKS node instance"))
 		}
+	}
 
-		return true
-	})
-
-	// Check for error
-	am.CheckError(err)
-
-	return instanceCount
+	return NewInventoryResult(items, err)
 }
@@ -55,18 +55,20 @@ func TestEC2K8SubInstances(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our EC K8 Subcount Instances function
-		actualCount := EC2K8SubInstances(sf, mon, c.AllRegions)
+		actualCount := EC2K8SubInstances(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: EC K8 SubcountInstances returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: EC K8 SubcountInstances returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
@@ -15,6 +15,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 
@@ -193,8 +194,8 @@ type fakeEC2Service struct {
 	DRResponse  *ec2.DescribeRegionsOutput
 }
 
-// Simulate the DescribeRegions function
-func (fake *fakeEC2Service) DescribeRegions(input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
+// Simulate the DescribeRegionsWithContext function
+func (fake *fakeEC2Service) DescribeRegionsWithContext(ctx aws.Context, input *ec2.DescribeRegionsInput, _ ...request.Option) (*ec2.DescribeRegionsOutput, error) {
 	// If the supplied response is nil, then simulate an error
 	if fake.DRResponse == nil {
 		return nil, errors.New("DescribeRegions encountered an unexpected error: 6789")
@@ -364,8 +365,8 @@ func applyDescribeInstancesInputFiltering(input *ec2.DescribeInstancesInput, out
 	return filteredOutput
 }
 
-// Simulate the DescribeInstancePages function
-func (fake *fakeEC2Service) DescribeInstancesPages(input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
+// Simulate the DescribeInstancePagesWithContext function
+func (fake *fakeEC2Service) DescribeInstancesPagesWithContext(ctx aws.Context, input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool, _ ...request.Option) error {
 	// If the supplied response is nil, then simulate an error
 	if fake.DIPResponse == nil {
 		return errors.New("DescribeInstancePages encountered an unexpected error: 1234")
@@ -415,6 +416,16 @@ func (fsf fakeEC2ServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeEC2ServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeEC2ServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // Implement a way to return EC2 Regions and instances found in each
 func (fsf fakeEC2ServiceFactory) GetEC2InstanceService(regionName string) *EC2InstanceService {
 	// If the caller failed to specify a region, then use what is associated with our factory
@@ -505,18 +516,20 @@ func TestEC2Counts(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our EC2 Counter function
-		actualCount := EC2Counts(sf, mon, c.AllRegions)
+		actualCount := EC2Counts(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: EC2Counts returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: EC2Counts returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
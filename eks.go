@@ -12,45 +12,45 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/eks"
-	color "github.com/logrusorgru/aurora"
 )
 
 // EKSNodes retrieves the count of all EKS Nodes either for all
-// regions (allRegions is true) or the region associated with the
+// regions (rc.AllRegions is true) or the region associated with the
 // session. This method gives status back to the user via the supplied
 // ActivityMonitor instance.
-func EKSNodes(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	nodeCount := 0
-
-	errs := make([]error, 0)
-
-	// Indicate activity
-	am.StartAction("Retrieving EKS Node counts")
-
-	// Create a new instance of the EKS service
-	regionsSlice := []string{""}
-	if allRegions {
-		regionsSlice = GetEC2Regions(sf.GetEC2InstanceService(""), am)
-	}
-
-	for _, regionName := range regionsSlice {
-		count, eksErrs := eksCountForSingleRegion(regionName, sf, am)
-		errs = append(errs, eksErrs...)
-		nodeCount += count
-	}
-
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(nodeCount))
+//
+// Unlike other counters, errors encountered while counting EKS nodes
+// never end the program: they are recorded and the count is marked
+// as incomplete.
+func EKSNodes(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(EKSCounter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-	// Print list of errors that happened while retrieving node counts
-	for _, err := range errs {
-		am.SubResourceError(err.Error())
-	}
+// eksCounter counts the EKS nodes of a region.
+type eksCounter struct {
+	CounterInfo
+}
 
-	return nodeCount
+// EKSCounter is the registered Counter for EKS nodes. Its errors are never fatal.
+var EKSCounter = eksCounter{CounterInfo{
+	CounterName:  "eks",
+	ColumnName:   "# of EKS Nodes",
+	ServiceName:  "EKS",
+	ActivityName: "EKS Node",
+	Actions:      []string{"eks:ListClusters", "eks:ListNodegroups", "eks:DescribeNodegroup"},
+	IsRegional:   true,
+	NonFatal:     true,
+}}
+
+// Count the EKS nodes of the supplied region
+func (eksCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	count, items, errs := eksCountForSingleRegion(ctx.RequestContext(), regionName, ctx.ServiceFactory, ctx.Monitor)
+	return RegionResult{Count: count, Errs: errs, Inventory: items}
 }
 
-func eksCountForSingleRegion(region string, sf ServiceFactory, am ActivityMonitor) (int, []error) {
+// Count the desired nodes of every nodegroup of the region. Each nodegroup is
+// an item of the inventory (standing for its desired nodes).
+func eksCountForSingleRegion(c aws.Context, region string, sf ServiceFactory, am ActivityMonitor) (int, []InventoryItem, []error) {
 	errs := make([]error, 0)
 
 	// Indicate activity
@@ -63,29 +63,32 @@ func eksCountForSingleRegion(region string, sf ServiceFactory, am ActivityMonito
 	clusterInput := &eks.ListClustersInput{}
 
 	nodeCount := 0
-	err := eksSvc.ListClusters(clusterInput, func(clusterList *eks.ListClustersOutput, _ bool) bool {
+	var items []InventoryItem
+	err := eksSvc.ListClusters(c, clusterInput, func(clusterList *eks.ListClustersOutput, _ bool) bool {
 		// Loop through each cluster list
 		for _, cluster := range clusterList.Clusters {
-			count, err := countNodes(eksSvc, cluster)
+			count, clusterItems, err := countNodes(c, eksSvc, cluster)
 			errs = append(errs, err...)
 			nodeCount += count
+			items = append(items, clusterItems...)
 		}
 		return true
 	})
 
 	if err != nil {
-		errs = append(errs, fmt.Errorf("unable to list clusters for region %s (%s)", region, err))
+		errs = append(errs, fmt.Errorf("unable to list clusters (%s)", err))
 	}
 
-	return nodeCount, errs
+	return nodeCount, items, errs
 }
 
-func countNodes(eksSvc *EKSService, cluster *string) (int, []error) {
+func countNodes(c aws.Context, eksSvc *EKSService, cluster *string) (int, []InventoryItem, []error) {
 	nodeCount := 0
+	var items []InventoryItem
 	errs := make([]error, 0)
 	nodeGroupsInput := &eks.ListNodegroupsInput{ClusterName: aws.String(*cluster)}
 
-	err := eksSvc.ListNodeGroups(nodeGroupsInput, func(nodeGroupList *eks.ListNodegroupsOutput, _ bool) bool {
+	err := eksSvc.ListNodeGroups(c, nodeGroupsInput, func(nodeGroupList *eks.ListNodegroupsOutput, _ bool) bool {
 		// Loop through each nodegroup
 		for _, nodeGroup := range nodeGroupList.Nodegroups {
 			describeNodeGroupInput := &eks.DescribeNodegroupInput{
@@ -94,14 +97,16 @@ func countNodes(eksSvc *EKSService, cluster *string) (int, []error) {
 			}
 
 			// Retrieve nodegroup info
-			nodeGroupInfo, err := eksSvc.DescribeNodegroups(describeNodeGroupInput)
+			nodeGroupInfo, err := eksSvc.DescribeNodegroups(c, describeNodeGroupInput)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("unable to describe %s nodegroup (%s)", *nodeGroup, err))
 				return true
 			}
 
 			// Add the node count for the nodepool
-			nodeCount += int(*nodeGroupInfo.Nodegroup.ScalingConfig.DesiredSize)
+			desiredSize := int(*nodeGroupInfo.Nodegroup.ScalingConfig.DesiredSize)
+			nodeCount += desiredSize
+			items = append(items, nodeGroupItem(*cluster+"/"+*nodeGroup, aws.StringValue(nodeGroupInfo.Nodegroup.Status), desiredSize))
 		}
 		return true
 	})
@@ -110,5 +115,14 @@ func countNodes(eksSvc *EKSService, cluster *string) (int, []error) {
 		errs = append(errs, fmt.Errorf("unable to list nodegroups for %s cluster (%s)", *cluster, err))
 	}
 
-	return nodeCount, errs
+	return nodeCount, items, errs
+}
+
+// Note whether a nodegroup (CLUSTER/NODEGROUP) has any desired nodes
+func nodeGroupItem(id string, status string, desiredSize int) InventoryItem {
+	if desiredSize > 0 {
+		return CountedItem(id, status, fmt.Sprintf("%d desired node(s)", desiredSize))
+	}
+
+	return ExcludedItem(id, status, "no desired nodes")
 }
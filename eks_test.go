@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/eks"
 	"github.com/aws/aws-sdk-go/service/eks/eksiface"
 	"github.com/expel-io/aws-resource-counter/mock"
@@ -64,7 +65,7 @@ type fakeEKService struct {
 	LNGResponse []*eks.ListNodegroupsOutput
 }
 
-func (feks *fakeEKService) DescribeNodegroup(input *eks.DescribeNodegroupInput) (*eks.DescribeNodegroupOutput, error) {
+func (feks *fakeEKService) DescribeNodegroupWithContext(ctx aws.Context, input *eks.DescribeNodegroupInput, _ ...request.Option) (*eks.DescribeNodegroupOutput, error) {
 	// If there was no supplied response, then simulate a possible error
 	if feks.DNGResponse == nil {
 		return nil, errors.New("ListClusters returns an unexpected error: 2345")
@@ -73,9 +74,9 @@ func (feks *fakeEKService) DescribeNodegroup(input *eks.DescribeNodegroupInput)
 	return feks.DNGResponse, nil
 }
 
-// Simulate the ListClustersPages function
-func (feks *fakeEKService) ListClustersPages(input *eks.ListClustersInput,
-	fn func(*eks.ListClustersOutput, bool) bool) error {
+// Simulate the ListClustersPagesWithContext function
+func (feks *fakeEKService) ListClustersPagesWithContext(ctx aws.Context, input *eks.ListClustersInput,
+	fn func(*eks.ListClustersOutput, bool) bool, _ ...request.Option) error {
 	// If the supplied response is nil, then simulate an error
 	if feks.LCResponse == nil {
 		return errors.New("ListClustersPages encountered an unexpected error: 1234")
@@ -95,9 +96,9 @@ func (feks *fakeEKService) ListClustersPages(input *eks.ListClustersInput,
 	return nil
 }
 
-// Simulate the ListNodegroupsPages function
-func (feks *fakeEKService) ListNodegroupsPages(input *eks.ListNodegroupsInput,
-	fn func(*eks.ListNodegroupsOutput, bool) bool) error {
+// Simulate the ListNodegroupsPagesWithContext function
+func (feks *fakeEKService) ListNodegroupsPagesWithContext(ctx aws.Context, input *eks.ListNodegroupsInput,
+	fn func(*eks.ListNodegroupsOutput, bool) bool, _ ...request.Option) error {
 	// If the supplied response is nil, then simulate an error
 	if feks.LNGResponse == nil {
 		return errors.New("ListNodeGroups encountered an unexpected error: 1234")
@@ -142,6 +143,16 @@ func (fsf fakeEKSServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeEKSServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeEKSServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // Don't need to implement
 func (fsf fakeEKSServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
 	return nil
@@ -232,18 +243,20 @@ func TestEKSNodes(t *testing.T) {
 
 		t.Run(fmt.Sprintf("testing %s", c.name), func(t *testing.T) {
 			// Invoke our EKS Function
-			actualCount := EKSNodes(sf, mon, false)
+			actualCount := EKSNodes(sf, mon, &RunContext{})
 
 			// Did we expect an error?
 			if c.ExpectErrorNodegroupList || c.ExpectErrorClusterList || c.ExpectErrorDescribeNodegroup {
 				// Did it fail to arrive?
 				if !mon.ErrorOccured {
 					t.Error("Expected an error to occur, but it did not... :^(")
+				} else if !actualCount.Incomplete {
+					t.Error("Expected the count to be marked incomplete, but it was not")
 				}
 			} else if mon.ErrorOccured {
 				t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-			} else if actualCount != c.ExpectedCount {
-				t.Errorf("Error: Nodes returned %d; expected %d", actualCount, c.ExpectedCount)
+			} else if actualCount.Count != c.ExpectedCount {
+				t.Errorf("Error: Nodes returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 			} else if mon.ProgramExited {
 				t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 			}
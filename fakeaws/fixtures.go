@@ -0,0 +1,141 @@
+/******************************************************************************
+Cloud Resource Counter
+File: fixtures.go
+
+Summary: The fixture data served by the fake AWS server.
+******************************************************************************/
+
+package fakeaws
+
+import (
+	"fmt"
+	"time"
+)
+
+// Fixtures describes the resources of the fake AWS account (or accounts). The
+// resources of regional services are keyed by the name of their region.
+type Fixtures struct {
+	// The ID of the account of the caller. Defaults to DefaultAccountID.
+	AccountID string
+
+	// The partition of every ARN (e.g., "aws-us-gov"). Defaults to "aws".
+	Partition string
+
+	// The member accounts of the organization
+	Accounts []Account
+
+	// The regions returned by EC2's DescribeRegions
+	Regions []Region
+
+	// Regional resources
+	Instances          map[string][]Instance
+	Volumes            map[string][]Volume
+	DBInstances        map[string][]DBInstance
+	Functions          map[string][]Function
+	TaskDefinitions    map[string][]TaskDefinition
+	Clusters           map[string][]Cluster
+	LightsailInstances map[string][]LightsailInstance
+
+	// The regions returned by Lightsail's GetRegions
+	LightsailRegions []string
+
+	// S3 buckets (of all regions)
+	Buckets []Bucket
+
+	// The maximum number of items in each page of results (or 0 to return all
+	// items in a single page). A small size exercises pagination.
+	PageSize int
+
+	// The actions (e.g., "ec2:DescribeVolumes") that are denied. An action can
+	// be denied in a single region by appending "@" and the region's name
+	// (e.g., "ec2:DescribeVolumes@us-east-2").
+	Denied map[string]bool
+
+	// The number of times that each EC2 action (e.g., "ec2:DescribeInstances",
+	// optionally followed by "@" and the region's name) is throttled before it
+	// succeeds.
+	Throttled map[string]int
+
+	// How long each action (e.g., "ec2:DescribeInstances", optionally followed by
+	// "@" and the region's name) takes to respond. A delayed request ends early
+	// if its client gives up on it.
+	Delayed map[string]time.Duration
+}
+
+// Account is a member account of the organization.
+type Account struct {
+	ID     string
+	Name   string
+	Status string
+}
+
+// Region is an EC2 region.
+type Region struct {
+	Name        string
+	OptInStatus string
+}
+
+// Instance is an EC2 instance. The Lifecycle is empty (on-demand), "spot" or
+// "scheduled".
+type Instance struct {
+	ID        string
+	State     string
+	Lifecycle string
+	Tags      map[string]string
+}
+
+// Volume is an EBS volume.
+type Volume struct {
+	ID       string
+	State    string
+	Attached bool
+}
+
+// DBInstance is an RDS instance.
+type DBInstance struct {
+	ID     string
+	Status string
+}
+
+// Function is a Lambda function.
+type Function struct {
+	Name string
+}
+
+// TaskDefinition is an ECS task definition, along with the images of its
+// containers.
+type TaskDefinition struct {
+	Family   string
+	Revision int
+	Images   []string
+}
+
+// Cluster is an EKS cluster.
+type Cluster struct {
+	Name       string
+	NodeGroups []NodeGroup
+}
+
+// NodeGroup is a node group of an EKS cluster.
+type NodeGroup struct {
+	Name        string
+	DesiredSize int
+}
+
+// LightsailInstance is a Lightsail instance.
+type LightsailInstance struct {
+	Name  string
+	State string
+}
+
+// Bucket is an S3 bucket in the named region.
+type Bucket struct {
+	Name   string
+	Region string
+}
+
+// Construct the ARN of a resource of the supplied account (in the partition of
+// the fixtures)
+func (s *Server) arn(service string, region string, accountID string, resource string) string {
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s", s.Fixtures.Partition, service, region, accountID, resource)
+}
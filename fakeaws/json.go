@@ -0,0 +1,315 @@
+/******************************************************************************
+Cloud Resource Counter
+File: json.go
+
+Summary: The services of the fake AWS server that use the JSON protocol (ECS,
+         Lightsail and Organizations) or the REST-JSON protocol (Lambda and EKS).
+******************************************************************************/
+
+package fakeaws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The content types of the JSON protocols
+const (
+	jsonContentType     = "application/x-amz-json-1.1"
+	restJSONContentType = "application/json"
+)
+
+// Write a JSON protocol error
+func writeJSONError(c *call, status int, code string, message string) {
+	writeJSON(c, jsonContentType, status, map[string]string{"__type": code, "message": message})
+}
+
+// Write a REST-JSON protocol error
+func writeRESTJSONError(c *call, status int, code string, message string) {
+	c.w.Header().Set("X-Amzn-Errortype", code)
+	writeJSON(c, restJSONContentType, status, map[string]string{"message": message})
+}
+
+// Decode the body of a JSON protocol request and determine its operation (from
+// the X-Amz-Target header)
+func (s *Server) beginJSON(c *call, input interface{}) bool {
+	// The target is SERVICE_VERSION.OPERATION
+	target := c.r.Header.Get("X-Amz-Target")
+	operation := target[strings.LastIndex(target, ".")+1:]
+
+	// Decode the input (ignoring any error, as every field is optional)
+	json.NewDecoder(c.r.Body).Decode(input)
+
+	return s.begin(c, operation)
+}
+
+// The input of a paginated JSON protocol request
+type jsonPageInput struct {
+	NextToken  string `json:"nextToken"`
+	MaxResults int    `json:"maxResults"`
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// ECS
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Serve a request to ECS
+func (s *Server) serveECS(c *call) {
+	var input struct {
+		jsonPageInput
+		TaskDefinition string `json:"taskDefinition"`
+	}
+
+	// Is the operation denied?
+	if s.beginJSON(c, &input) {
+		writeJSONError(c, http.StatusBadRequest, "AccessDeniedException", deniedMessage(c))
+		return
+	}
+
+	// Get the ARN of each task definition
+	definitions := s.Fixtures.TaskDefinitions[c.region]
+	arns := make([]string, len(definitions))
+	for ix, definition := range definitions {
+		arns[ix] = s.arn("ecs", c.region, s.accountID(c), fmt.Sprintf("task-definition/%s:%d", definition.Family, definition.Revision))
+	}
+
+	// Which operation?
+	switch c.operation {
+	case "ListTaskDefinitions":
+		start, end, next := s.page(len(arns), input.NextToken, input.MaxResults)
+		response := map[string]interface{}{"taskDefinitionArns": arns[start:end]}
+		if next != "" {
+			response["nextToken"] = next
+		}
+		writeJSON(c, jsonContentType, http.StatusOK, response)
+	case "DescribeTaskDefinition":
+		// Find the task definition
+		for ix, definition := range definitions {
+			if arns[ix] != input.TaskDefinition {
+				continue
+			}
+
+			// Describe its containers
+			var containers []map[string]string
+			for jx, image := range definition.Images {
+				containers = append(containers, map[string]string{"name": fmt.Sprintf("container-%d", jx), "image": image})
+			}
+			writeJSON(c, jsonContentType, http.StatusOK, map[string]interface{}{
+				"taskDefinition": map[string]interface{}{
+					"taskDefinitionArn":    arns[ix],
+					"family":               definition.Family,
+					"revision":             definition.Revision,
+					"containerDefinitions": containers,
+				},
+			})
+			return
+		}
+		writeJSONError(c, http.StatusBadRequest, "ClientException", "Unable to describe task definition.")
+	default:
+		writeJSONError(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("fakeaws: unsupported ECS action '%s'", c.operation))
+	}
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Lightsail
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Serve a request to Lightsail
+func (s *Server) serveLightsail(c *call) {
+	var input struct{}
+
+	// Is the operation denied?
+	if s.beginJSON(c, &input) {
+		writeJSONError(c, http.StatusBadRequest, "AccessDeniedException", deniedMessage(c))
+		return
+	}
+
+	// Which operation?
+	switch c.operation {
+	case "GetRegions":
+		var regions []map[string]string
+		for _, name := range s.Fixtures.LightsailRegions {
+			regions = append(regions, map[string]string{"name": name})
+		}
+		writeJSON(c, jsonContentType, http.StatusOK, map[string]interface{}{"regions": regions})
+	case "GetInstances":
+		var instances []map[string]interface{}
+		for _, instance := range s.Fixtures.LightsailInstances[c.region] {
+			instances = append(instances, map[string]interface{}{
+				"name":  instance.Name,
+				"arn":   s.arn("lightsail", c.region, s.accountID(c), "Instance/"+instance.Name),
+				"state": map[string]string{"name": instance.State},
+			})
+		}
+		writeJSON(c, jsonContentType, http.StatusOK, map[string]interface{}{"instances": instances})
+	default:
+		writeJSONError(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("fakeaws: unsupported Lightsail action '%s'", c.operation))
+	}
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Organizations
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Serve a request to Organizations
+func (s *Server) serveOrganizations(c *call) {
+	var input struct {
+		NextToken  string `json:"NextToken"`
+		MaxResults int    `json:"MaxResults"`
+	}
+
+	// Is the operation denied?
+	if s.beginJSON(c, &input) {
+		writeJSONError(c, http.StatusBadRequest, "AccessDeniedException", deniedMessage(c))
+		return
+	}
+
+	// Which operation?
+	switch c.operation {
+	case "ListAccounts":
+		accounts := s.Fixtures.Accounts
+		start, end, next := s.page(len(accounts), input.NextToken, input.MaxResults)
+		var list []map[string]string
+		for _, account := range accounts[start:end] {
+			list = append(list, map[string]string{
+				"Id":     account.ID,
+				"Name":   account.Name,
+				"Status": account.Status,
+				"Arn":    s.arn("organizations", "", s.Fixtures.AccountID, "account/o-fakeaws/"+account.ID),
+			})
+		}
+		response := map[string]interface{}{"Accounts": list}
+		if next != "" {
+			response["NextToken"] = next
+		}
+		writeJSON(c, jsonContentType, http.StatusOK, response)
+	default:
+		writeJSONError(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("fakeaws: unsupported Organizations action '%s'", c.operation))
+	}
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Lambda
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Serve a request to Lambda
+func (s *Server) serveLambda(c *call) {
+	// Which operation?
+	var operation string
+	if c.r.Method == http.MethodGet && strings.HasSuffix(c.r.URL.Path, "/functions/") {
+		operation = "ListFunctions"
+	}
+
+	// Is the operation denied?
+	if s.begin(c, operation) {
+		writeRESTJSONError(c, http.StatusForbidden, "AccessDeniedException", deniedMessage(c))
+		return
+	}
+
+	switch c.operation {
+	case "ListFunctions":
+		functions := s.Fixtures.Functions[c.region]
+		max, _ := strconv.Atoi(c.r.URL.Query().Get("MaxItems"))
+		start, end, next := s.page(len(functions), c.r.URL.Query().Get("Marker"), max)
+		var list []map[string]string
+		for _, function := range functions[start:end] {
+			list = append(list, map[string]string{
+				"FunctionName": function.Name,
+				"FunctionArn":  s.arn("lambda", c.region, s.accountID(c), "function:"+function.Name),
+				"State":        "Active",
+			})
+		}
+		response := map[string]interface{}{"Functions": list}
+		if next != "" {
+			response["NextMarker"] = next
+		}
+		writeJSON(c, restJSONContentType, http.StatusOK, response)
+	default:
+		writeRESTJSONError(c, http.StatusNotFound, "UnknownOperationException", fmt.Sprintf("fakeaws: unsupported Lambda request %s %s", c.r.Method, c.r.URL.Path))
+	}
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// EKS
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Serve a request to EKS
+func (s *Server) serveEKS(c *call) {
+	// Which operation? The path is /clusters[/NAME/node-groups[/NODEGROUP]]
+	parts := strings.Split(strings.Trim(c.r.URL.Path, "/"), "/")
+	var operation string
+	switch {
+	case len(parts) == 1 && parts[0] == "clusters":
+		operation = "ListClusters"
+	case len(parts) == 3 && parts[0] == "clusters" && parts[2] == "node-groups":
+		operation = "ListNodegroups"
+	case len(parts) == 4 && parts[0] == "clusters" && parts[2] == "node-groups":
+		operation = "DescribeNodegroup"
+	}
+
+	// Is the operation denied?
+	if s.begin(c, operation) {
+		writeRESTJSONError(c, http.StatusForbidden, "AccessDeniedException", deniedMessage(c))
+		return
+	}
+
+	// Find the cluster (and node group) named by the path
+	clusters := s.Fixtures.Clusters[c.region]
+	var cluster *Cluster
+	var nodeGroup *NodeGroup
+	for ix := range clusters {
+		if len(parts) > 1 && clusters[ix].Name == parts[1] {
+			cluster = &clusters[ix]
+		}
+	}
+	for ix := 0; cluster != nil && ix < len(cluster.NodeGroups); ix++ {
+		if len(parts) > 3 && cluster.NodeGroups[ix].Name == parts[3] {
+			nodeGroup = &cluster.NodeGroups[ix]
+		}
+	}
+
+	// Get our pagination parameters
+	max, _ := strconv.Atoi(c.r.URL.Query().Get("maxResults"))
+	token := c.r.URL.Query().Get("nextToken")
+
+	switch {
+	case c.operation == "ListClusters":
+		start, end, next := s.page(len(clusters), token, max)
+		names := []string{}
+		for _, cluster := range clusters[start:end] {
+			names = append(names, cluster.Name)
+		}
+		writeEKSPage(c, "clusters", names, next)
+	case cluster == nil || (c.operation == "DescribeNodegroup" && nodeGroup == nil):
+		writeRESTJSONError(c, http.StatusNotFound, "ResourceNotFoundException", fmt.Sprintf("No cluster or node group found for %s", c.r.URL.Path))
+	case c.operation == "ListNodegroups":
+		start, end, next := s.page(len(cluster.NodeGroups), token, max)
+		names := []string{}
+		for _, nodeGroup := range cluster.NodeGroups[start:end] {
+			names = append(names, nodeGroup.Name)
+		}
+		writeEKSPage(c, "nodegroups", names, next)
+	case c.operation == "DescribeNodegroup":
+		writeJSON(c, restJSONContentType, http.StatusOK, map[string]interface{}{
+			"nodegroup": map[string]interface{}{
+				"nodegroupName": nodeGroup.Name,
+				"clusterName":   cluster.Name,
+				"scalingConfig": map[string]int{"desiredSize": nodeGroup.DesiredSize},
+			},
+		})
+	default:
+		writeRESTJSONError(c, http.StatusNotFound, "UnknownOperationException", fmt.Sprintf("fakeaws: unsupported EKS request %s %s", c.r.Method, c.r.URL.Path))
+	}
+}
+
+// Write a page of names returned by EKS
+func writeEKSPage(c *call, key string, names []string, next string) {
+	response := map[string]interface{}{key: names}
+	if next != "" {
+		response["nextToken"] = next
+	}
+	writeJSON(c, restJSONContentType, http.StatusOK, response)
+}
@@ -0,0 +1,373 @@
+/******************************************************************************
+Cloud Resource Counter
+File: query.go
+
+Summary: The services of the fake AWS server that use the (EC2) query protocol:
+         EC2, RDS and STS.
+******************************************************************************/
+
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The request ID of every response
+const requestID = "01234567-89ab-cdef-0123-456789abcdef"
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Errors
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// The error response of EC2
+type ec2ErrorResponse struct {
+	XMLName   xml.Name `xml:"Response"`
+	Code      string   `xml:"Errors>Error>Code"`
+	Message   string   `xml:"Errors>Error>Message"`
+	RequestID string   `xml:"RequestID"`
+}
+
+// The error response of the query protocol
+type queryErrorResponse struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// Write an EC2 error
+func writeEC2Error(c *call, status int, code string, message string) {
+	writeXML(c, status, ec2ErrorResponse{Code: code, Message: message, RequestID: requestID})
+}
+
+// Write a query protocol error
+func writeQueryError(c *call, status int, code string, message string) {
+	writeXML(c, status, queryErrorResponse{Type: "Sender", Code: code, Message: message, RequestID: requestID})
+}
+
+// Construct the message of an access denied error
+func deniedMessage(c *call) string {
+	return fmt.Sprintf("You are not authorized to perform: %s:%s", c.service, c.operation)
+}
+
+// Get the integer value of a form parameter (or 0)
+func formInt(r *http.Request, name string) int {
+	value, _ := strconv.Atoi(r.Form.Get(name))
+	return value
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// EC2
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+type ec2Region struct {
+	RegionName  string `xml:"regionName"`
+	Endpoint    string `xml:"regionEndpoint"`
+	OptInStatus string `xml:"optInStatus"`
+}
+
+type describeRegionsResponse struct {
+	XMLName   xml.Name    `xml:"DescribeRegionsResponse"`
+	RequestID string      `xml:"requestId"`
+	Regions   []ec2Region `xml:"regionInfo>item"`
+}
+
+type ec2Tag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+type ec2Instance struct {
+	InstanceID string   `xml:"instanceId"`
+	State      string   `xml:"instanceState>name"`
+	Lifecycle  string   `xml:"instanceLifecycle,omitempty"`
+	Tags       []ec2Tag `xml:"tagSet>item"`
+}
+
+type ec2Reservation struct {
+	ReservationID string        `xml:"reservationId"`
+	Instances     []ec2Instance `xml:"instancesSet>item"`
+}
+
+type describeInstancesResponse struct {
+	XMLName      xml.Name         `xml:"DescribeInstancesResponse"`
+	RequestID    string           `xml:"requestId"`
+	Reservations []ec2Reservation `xml:"reservationSet>item"`
+	NextToken    string           `xml:"nextToken,omitempty"`
+}
+
+type ec2Attachment struct {
+	InstanceID string `xml:"instanceId"`
+	State      string `xml:"status"`
+}
+
+type ec2Volume struct {
+	VolumeID    string          `xml:"volumeId"`
+	State       string          `xml:"status"`
+	Attachments []ec2Attachment `xml:"attachmentSet>item"`
+}
+
+type describeVolumesResponse struct {
+	XMLName   xml.Name    `xml:"DescribeVolumesResponse"`
+	RequestID string      `xml:"requestId"`
+	Volumes   []ec2Volume `xml:"volumeSet>item"`
+	NextToken string      `xml:"nextToken,omitempty"`
+}
+
+// Serve a request to EC2
+func (s *Server) serveEC2(c *call) {
+	c.r.ParseForm()
+
+	// Is the operation denied?
+	if s.begin(c, c.r.Form.Get("Action")) {
+		writeEC2Error(c, http.StatusForbidden, "UnauthorizedOperation", deniedMessage(c))
+		return
+	}
+
+	// Is the operation throttled?
+	if s.throttle(c) {
+		writeEC2Error(c, http.StatusServiceUnavailable, "RequestLimitExceeded", "Request limit exceeded.")
+		return
+	}
+
+	// Is this a dry run? If so, the caller is allowed to call the operation.
+	if c.r.Form.Get("DryRun") == "true" {
+		writeEC2Error(c, http.StatusPreconditionFailed, "DryRunOperation", "Request would have succeeded, but DryRun flag is set.")
+		return
+	}
+
+	// Which operation?
+	filters := ec2Filters(c.r)
+	switch c.operation {
+	case "DescribeRegions":
+		response := describeRegionsResponse{RequestID: requestID}
+		for _, region := range s.Fixtures.Regions {
+			if matches(filters, "opt-in-status", region.OptInStatus) {
+				response.Regions = append(response.Regions, ec2Region{
+					RegionName:  region.Name,
+					Endpoint:    fmt.Sprintf("ec2.%s.amazonaws.com", region.Name),
+					OptInStatus: region.OptInStatus,
+				})
+			}
+		}
+		writeXML(c, http.StatusOK, response)
+	case "DescribeInstances":
+		// Find the instances that satisfy the filters
+		var instances []Instance
+		for _, instance := range s.Fixtures.Instances[c.region] {
+			if instanceMatches(filters, instance) {
+				instances = append(instances, instance)
+			}
+		}
+
+		// Return a page of them (one reservation per instance)
+		start, end, next := s.page(len(instances), c.r.Form.Get("NextToken"), formInt(c.r, "MaxResults"))
+		response := describeInstancesResponse{RequestID: requestID, NextToken: next}
+		for ix, instance := range instances[start:end] {
+			reservation := ec2Reservation{ReservationID: fmt.Sprintf("r-%d", start+ix)}
+			reservation.Instances = append(reservation.Instances, ec2Instance{
+				InstanceID: instance.ID,
+				State:      instance.State,
+				Lifecycle:  instance.Lifecycle,
+				Tags:       ec2Tags(instance.Tags),
+			})
+			response.Reservations = append(response.Reservations, reservation)
+		}
+		writeXML(c, http.StatusOK, response)
+	case "DescribeVolumes":
+		// Return a page of the volumes
+		volumes := s.Fixtures.Volumes[c.region]
+		start, end, next := s.page(len(volumes), c.r.Form.Get("NextToken"), formInt(c.r, "MaxResults"))
+		response := describeVolumesResponse{RequestID: requestID, NextToken: next}
+		for _, volume := range volumes[start:end] {
+			ev := ec2Volume{VolumeID: volume.ID, State: volume.State}
+			if volume.Attached {
+				ev.Attachments = []ec2Attachment{{InstanceID: "i-attached", State: "attached"}}
+			}
+			response.Volumes = append(response.Volumes, ev)
+		}
+		writeXML(c, http.StatusOK, response)
+	default:
+		writeEC2Error(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("fakeaws: unsupported EC2 action '%s'", c.operation))
+	}
+}
+
+// Get the filters of an EC2 request (e.g., Filter.1.Name and Filter.1.Value.1)
+func ec2Filters(r *http.Request) map[string][]string {
+	filters := make(map[string][]string)
+	for n := 1; r.Form.Get(fmt.Sprintf("Filter.%d.Name", n)) != ""; n++ {
+		name := r.Form.Get(fmt.Sprintf("Filter.%d.Name", n))
+		for m := 1; r.Form.Get(fmt.Sprintf("Filter.%d.Value.%d", n, m)) != ""; m++ {
+			filters[name] = append(filters[name], r.Form.Get(fmt.Sprintf("Filter.%d.Value.%d", n, m)))
+		}
+	}
+
+	return filters
+}
+
+// Determine whether a value satisfies the named filter (if supplied)
+func matches(filters map[string][]string, name string, value string) bool {
+	values, ok := filters[name]
+	if !ok {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determine whether an instance satisfies the supported filters
+func instanceMatches(filters map[string][]string, instance Instance) bool {
+	// Does it have one of the tags?
+	if keys, ok := filters["tag-key"]; ok {
+		found := false
+		for _, key := range keys {
+			if _, ok := instance.Tags[key]; ok {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return matches(filters, "instance-state-name", instance.State) &&
+		matches(filters, "instance-lifecycle", instance.Lifecycle)
+}
+
+// Convert a map of tags into a list
+func ec2Tags(tags map[string]string) []ec2Tag {
+	var list []ec2Tag
+	for key, value := range tags {
+		list = append(list, ec2Tag{Key: key, Value: value})
+	}
+
+	return list
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// RDS
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+type rdsInstance struct {
+	Identifier string `xml:"DBInstanceIdentifier"`
+	Status     string `xml:"DBInstanceStatus"`
+	ARN        string `xml:"DBInstanceArn"`
+}
+
+type describeDBInstancesResponse struct {
+	XMLName     xml.Name      `xml:"DescribeDBInstancesResponse"`
+	DBInstances []rdsInstance `xml:"DescribeDBInstancesResult>DBInstances>DBInstance"`
+	Marker      string        `xml:"DescribeDBInstancesResult>Marker,omitempty"`
+	RequestID   string        `xml:"ResponseMetadata>RequestId"`
+}
+
+// Serve a request to RDS
+func (s *Server) serveRDS(c *call) {
+	c.r.ParseForm()
+
+	// Is the operation denied?
+	if s.begin(c, c.r.Form.Get("Action")) {
+		writeQueryError(c, http.StatusForbidden, "AccessDenied", deniedMessage(c))
+		return
+	}
+
+	// Which operation?
+	switch c.operation {
+	case "DescribeDBInstances":
+		// Return a page of the instances
+		instances := s.Fixtures.DBInstances[c.region]
+		start, end, next := s.page(len(instances), c.r.Form.Get("Marker"), formInt(c.r, "MaxRecords"))
+		response := describeDBInstancesResponse{Marker: next, RequestID: requestID}
+		for _, instance := range instances[start:end] {
+			response.DBInstances = append(response.DBInstances, rdsInstance{
+				Identifier: instance.ID,
+				Status:     instance.Status,
+				ARN:        s.arn("rds", c.region, s.accountID(c), "db:"+instance.ID),
+			})
+		}
+		writeXML(c, http.StatusOK, response)
+	default:
+		writeQueryError(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("fakeaws: unsupported RDS action '%s'", c.operation))
+	}
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// STS
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+type getCallerIdentityResponse struct {
+	XMLName   xml.Name `xml:"GetCallerIdentityResponse"`
+	ARN       string   `xml:"GetCallerIdentityResult>Arn"`
+	UserID    string   `xml:"GetCallerIdentityResult>UserId"`
+	Account   string   `xml:"GetCallerIdentityResult>Account"`
+	RequestID string   `xml:"ResponseMetadata>RequestId"`
+}
+
+type assumeRoleResponse struct {
+	XMLName         xml.Name `xml:"AssumeRoleResponse"`
+	AccessKeyID     string   `xml:"AssumeRoleResult>Credentials>AccessKeyId"`
+	SecretAccessKey string   `xml:"AssumeRoleResult>Credentials>SecretAccessKey"`
+	SessionToken    string   `xml:"AssumeRoleResult>Credentials>SessionToken"`
+	Expiration      string   `xml:"AssumeRoleResult>Credentials>Expiration"`
+	AssumedRoleARN  string   `xml:"AssumeRoleResult>AssumedRoleUser>Arn"`
+	AssumedRoleID   string   `xml:"AssumeRoleResult>AssumedRoleUser>AssumedRoleId"`
+	RequestID       string   `xml:"ResponseMetadata>RequestId"`
+}
+
+// Serve a request to STS
+func (s *Server) serveSTS(c *call) {
+	c.r.ParseForm()
+
+	// Is the operation denied?
+	if s.begin(c, c.r.Form.Get("Action")) {
+		writeQueryError(c, http.StatusForbidden, "AccessDenied", deniedMessage(c))
+		return
+	}
+
+	// Which operation?
+	switch c.operation {
+	case "GetCallerIdentity":
+		// Is the caller using the credentials of an assumed role?
+		accountID := s.accountID(c)
+		callerARN := s.arn("iam", "", accountID, "user/fakeaws")
+		if strings.HasPrefix(c.accessKey, assumedKeyPrefix) {
+			callerARN = s.arn("sts", "", accountID, "assumed-role/fakeaws/session")
+		}
+		writeXML(c, http.StatusOK, getCallerIdentityResponse{
+			ARN:       callerARN,
+			UserID:    "AIDAFAKEAWS",
+			Account:   accountID,
+			RequestID: requestID,
+		})
+	case "AssumeRole":
+		// Which account does the role belong to? (arn:PARTITION:iam::ACCOUNT:role/NAME)
+		roleARN := c.r.Form.Get("RoleArn")
+		parts := strings.Split(roleARN, ":")
+		if len(parts) != 6 {
+			writeQueryError(c, http.StatusBadRequest, "ValidationError", fmt.Sprintf("invalid role ARN '%s'", roleARN))
+			return
+		}
+		writeXML(c, http.StatusOK, assumeRoleResponse{
+			AccessKeyID:     assumedKeyPrefix + parts[4],
+			SecretAccessKey: "fakeaws",
+			SessionToken:    "fakeaws",
+			Expiration:      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			AssumedRoleARN:  s.arn("sts", "", parts[4], fmt.Sprintf("assumed-role/%s/%s", strings.TrimPrefix(parts[5], "role/"), c.r.Form.Get("RoleSessionName"))),
+			AssumedRoleID:   "AROAFAKEAWS:" + c.r.Form.Get("RoleSessionName"),
+			RequestID:       requestID,
+		})
+	default:
+		writeQueryError(c, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("fakeaws: unsupported STS action '%s'", c.operation))
+	}
+}
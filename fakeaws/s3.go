@@ -0,0 +1,92 @@
+/******************************************************************************
+Cloud Resource Counter
+File: s3.go
+
+Summary: The S3 service of the fake AWS server (REST-XML with path-style
+         addressing).
+******************************************************************************/
+
+package fakeaws
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The error response of S3
+type s3ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	OwnerID string     `xml:"Owner>ID"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Value   string   `xml:",chardata"`
+}
+
+// Write an S3 error
+func writeS3Error(c *call, status int, code string, message string) {
+	writeXML(c, status, s3ErrorResponse{Code: code, Message: message, RequestID: requestID})
+}
+
+// Serve a request to S3. The path is / (to list buckets) or /BUCKET?location
+// (to get the location of a bucket).
+func (s *Server) serveS3(c *call) {
+	// Which operation?
+	bucketName := strings.Trim(c.r.URL.Path, "/")
+	var operation string
+	switch {
+	case c.r.Method == http.MethodGet && bucketName == "":
+		operation = "ListBuckets"
+	case c.r.Method == http.MethodGet && c.r.URL.Query().Has("location"):
+		operation = "GetBucketLocation"
+	}
+
+	// Is the operation denied?
+	if s.begin(c, operation) {
+		writeS3Error(c, http.StatusForbidden, "AccessDenied", deniedMessage(c))
+		return
+	}
+
+	switch c.operation {
+	case "ListBuckets":
+		response := listAllMyBucketsResult{OwnerID: "fakeaws"}
+		for _, bucket := range s.Fixtures.Buckets {
+			response.Buckets = append(response.Buckets, s3Bucket{Name: bucket.Name, CreationDate: "2020-01-01T00:00:00.000Z"})
+		}
+		writeXML(c, http.StatusOK, response)
+	case "GetBucketLocation":
+		// Find the bucket
+		for _, bucket := range s.Fixtures.Buckets {
+			if bucket.Name != bucketName {
+				continue
+			}
+
+			// The location of buckets in us-east-1 is empty
+			location := bucket.Region
+			if location == "us-east-1" {
+				location = ""
+			}
+			writeXML(c, http.StatusOK, locationConstraint{Value: location})
+			return
+		}
+		writeS3Error(c, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	default:
+		writeS3Error(c, http.StatusNotImplemented, "NotImplemented", fmt.Sprintf("fakeaws: unsupported S3 request %s %s", c.r.Method, c.r.URL.Path))
+	}
+}
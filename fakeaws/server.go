@@ -0,0 +1,261 @@
+/******************************************************************************
+Cloud Resource Counter
+File: server.go
+
+Summary: An in-process HTTP server which stands in for AWS in end-to-end tests.
+         It speaks enough of the query, JSON and REST protocols of the services
+         used by the tool to serve fixture data.
+******************************************************************************/
+
+package fakeaws
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The ID of the account used when the fixtures do not supply one
+const DefaultAccountID = "123456789012"
+
+// The prefix of the access keys of the temporary credentials returned by
+// AssumeRole. It is followed by the ID of the role's account.
+const assumedKeyPrefix = "ASIAFAKE"
+
+// Request describes a single request served by a Server.
+type Request struct {
+	Service   string
+	Operation string
+	Region    string
+}
+
+// Server is an in-process HTTP server which serves the supplied fixtures in
+// response to AWS API requests. Point an AWS session at its URL (as its
+// endpoint) to use it.
+type Server struct {
+	*httptest.Server
+	Fixtures Fixtures
+
+	// Serializes access to our list of requests
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewServer starts a Server which serves the supplied fixtures. The caller
+// must Close it.
+func NewServer(fixtures Fixtures) *Server {
+	// Supply a default account (and partition)
+	if fixtures.AccountID == "" {
+		fixtures.AccountID = DefaultAccountID
+	}
+	if fixtures.Partition == "" {
+		fixtures.Partition = "aws"
+	}
+
+	server := &Server{Fixtures: fixtures}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+
+	return server
+}
+
+// Requests returns the requests served so far (in order).
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// Count returns the number of requests served so far for the supplied
+// service and operation.
+func (s *Server) Count(service string, operation string) int {
+	count := 0
+	for _, request := range s.Requests() {
+		if request.Service == service && request.Operation == operation {
+			count++
+		}
+	}
+
+	return count
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Dispatching
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// The context of a single request
+type call struct {
+	w         http.ResponseWriter
+	r         *http.Request
+	service   string
+	region    string
+	accessKey string
+	operation string
+}
+
+// Serve a single request
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Which service (and region) is the request signed for?
+	c := &call{w: w, r: r}
+	c.accessKey, c.region, c.service = credentialScope(r.Header.Get("Authorization"))
+
+	// Dispatch the request by the protocol of its service
+	switch c.service {
+	case "ec2":
+		s.serveEC2(c)
+	case "rds":
+		s.serveRDS(c)
+	case "sts":
+		s.serveSTS(c)
+	case "ecs":
+		s.serveECS(c)
+	case "lightsail":
+		s.serveLightsail(c)
+	case "organizations":
+		s.serveOrganizations(c)
+	case "lambda":
+		s.serveLambda(c)
+	case "eks":
+		s.serveEKS(c)
+	case "s3":
+		s.serveS3(c)
+	default:
+		http.Error(w, fmt.Sprintf("fakeaws: unsupported service '%s'", c.service), http.StatusNotImplemented)
+	}
+}
+
+// Extract the access key, region and service from the credential scope of a
+// Signature Version 4 Authorization header
+func credentialScope(authorization string) (string, string, string) {
+	// Find the credential
+	const prefix = "Credential="
+	start := strings.Index(authorization, prefix)
+	if start < 0 {
+		return "", "", ""
+	}
+	credential := authorization[start+len(prefix):]
+	if end := strings.Index(credential, ","); end >= 0 {
+		credential = credential[:end]
+	}
+
+	// The credential is ACCESS-KEY/DATE/REGION/SERVICE/aws4_request
+	parts := strings.Split(credential, "/")
+	if len(parts) < 4 {
+		return "", "", ""
+	}
+
+	return parts[0], parts[2], parts[3]
+}
+
+// Record the operation of the supplied call and determine whether it should be
+// denied (according to the fixtures)
+func (s *Server) begin(c *call, operation string) bool {
+	c.operation = operation
+
+	// Record the request
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Service: c.service, Operation: operation, Region: c.region})
+	s.mu.Unlock()
+
+	// Is it delayed (in all regions or just this one)?
+	action := c.service + ":" + operation
+	if delay := s.delay(action, c.region); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-c.r.Context().Done():
+		}
+	}
+
+	// Is it denied (in all regions or just this one)?
+	return s.Fixtures.Denied[action] || s.Fixtures.Denied[action+"@"+c.region]
+}
+
+// How long the supplied action takes to respond in the supplied region
+func (s *Server) delay(action string, regionName string) time.Duration {
+	if delay, ok := s.Fixtures.Delayed[action+"@"+regionName]; ok {
+		return delay
+	}
+
+	return s.Fixtures.Delayed[action]
+}
+
+// Determine whether the operation of the supplied call should be throttled
+// (according to the fixtures). Each throttled call uses up one of its throttles.
+func (s *Server) throttle(c *call) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Is it throttled (in all regions or just this one)?
+	action := c.service + ":" + c.operation
+	for _, key := range []string{action + "@" + c.region, action} {
+		if s.Fixtures.Throttled[key] > 0 {
+			s.Fixtures.Throttled[key]--
+			return true
+		}
+	}
+
+	return false
+}
+
+// The ID of the account of the caller
+func (s *Server) accountID(c *call) string {
+	if strings.HasPrefix(c.accessKey, assumedKeyPrefix) {
+		return strings.TrimPrefix(c.accessKey, assumedKeyPrefix)
+	}
+
+	return s.Fixtures.AccountID
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Responses
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Write an XML document
+func writeXML(c *call, status int, v interface{}) {
+	c.w.Header().Set("Content-Type", "text/xml")
+	c.w.WriteHeader(status)
+	c.w.Write([]byte(xml.Header))
+	xml.NewEncoder(c.w).Encode(v)
+}
+
+// Write a JSON document
+func writeJSON(c *call, contentType string, status int, v interface{}) {
+	c.w.Header().Set("Content-Type", contentType)
+	c.w.WriteHeader(status)
+	json.NewEncoder(c.w).Encode(v)
+}
+
+// Get the items of a page of results. The token is the index of the first item
+// of the page (or empty for the first page) and the returned token is that of the
+// next page (or empty for the last page). The page holds at most the supplied
+// maximum number of items (if positive) or the fixture's page size (if positive).
+func (s *Server) page(count int, token string, max int) (int, int, string) {
+	// Where does the page start?
+	start, _ := strconv.Atoi(token)
+	if start < 0 || start > count {
+		start = count
+	}
+
+	// How big is the page?
+	size := count - start
+	if s.Fixtures.PageSize > 0 && s.Fixtures.PageSize < size {
+		size = s.Fixtures.PageSize
+	}
+	if max > 0 && max < size {
+		size = max
+	}
+
+	// Is there another page?
+	end := start + size
+	if end < count {
+		return start, end, strconv.Itoa(end)
+	}
+
+	return start, end, ""
+}
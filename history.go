@@ -0,0 +1,221 @@
+/******************************************************************************
+Cloud Resource Counter
+File: history.go
+
+Summary: Reads the rows of past runs back from an output file (CSV, JSON or
+         NDJSON), so that runs can be compared.
+******************************************************************************/
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+	"unicode"
+)
+
+// HistoryRow is a row of the results of a past run: the account and region that
+// it describes, when it was collected and its counts (keyed by column key, e.g.,
+// "ec2_instances"). The Columns list the keys of the counts in the order in which
+// they were written. The Scope is only known for a breakdown by region (e.g.,
+// ScopeRegion). The ToolVersion is only known for JSON and NDJSON files.
+type HistoryRow struct {
+	AccountID   string
+	Timestamp   time.Time
+	Region      string
+	Scope       string
+	ToolVersion string
+	Columns     []string
+	Counts      map[string]CountResult
+}
+
+// ReadHistoryFile reads the rows of every run stored in the named output file.
+func ReadHistoryFile(fileName string) ([]HistoryRow, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadHistory(file)
+}
+
+// ReadHistory reads the rows of every run stored in the supplied output file. Its
+// format (CSV, JSON or NDJSON) is detected from its contents.
+func ReadHistory(r io.Reader) ([]HistoryRow, error) {
+	// Skip any leading white space
+	reader := bufio.NewReader(r)
+	var first rune
+	for {
+		char, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(char) {
+			first = char
+			reader.UnreadRune()
+			break
+		}
+	}
+
+	// Which format is it? This is told by its first character.
+	switch first {
+	case '[':
+		return readJSONHistory(reader)
+	case '{':
+		return readNDJSONHistory(reader)
+	default:
+		return readCSVHistory(reader)
+	}
+}
+
+// Read the rows of a CSV file. A file that was appended to by several versions
+// of the tool may hold several header rows, each of which applies to the rows
+// that follow it.
+func readCSVHistory(r io.Reader) ([]HistoryRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var rows []HistoryRow
+	var header []string
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Is this a header?
+		if record[0] == AccountColumns[0] {
+			header = record
+			continue
+		} else if header == nil {
+			return nil, fmt.Errorf("line %d: expected a header row", line)
+		}
+
+		// Collect the counts of the row
+		row := HistoryRow{Counts: make(map[string]CountResult)}
+		for ix, value := range record {
+			if ix >= len(header) {
+				return nil, fmt.Errorf("line %d: more values than columns", line)
+			}
+
+			// Is it one of the columns that identify the row?
+			switch header[ix] {
+			case AccountColumns[0]:
+				row.AccountID = value
+			case AccountColumns[1]:
+				if row.Timestamp, err = time.Parse(time.RFC3339, value); err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+			case AccountColumns[2]:
+				row.Region = value
+			case ScopeColumn:
+				row.Scope = value
+			default:
+				// Was this column left empty?
+				if value == "" {
+					continue
+				}
+
+				count, err := ParseCount(value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				key := ColumnKey(header[ix])
+				row.Columns = append(row.Columns, key)
+				row.Counts[key] = count
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// The parts of a JSON (or NDJSON) record that describe a run
+type historyRecord struct {
+	AccountID   string         `json:"account_id"`
+	Timestamp   string         `json:"timestamp"`
+	Region      string         `json:"region"`
+	Scope       string         `json:"scope"`
+	ToolVersion string         `json:"tool_version"`
+	Counts      map[string]int `json:"counts"`
+	Incomplete  []string       `json:"incomplete"`
+}
+
+// Read the rows of a JSON file (an array of records)
+func readJSONHistory(r io.Reader) ([]HistoryRow, error) {
+	var records []historyRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	return historyRows(records)
+}
+
+// Read the rows of an NDJSON file (a record on each line)
+func readNDJSONHistory(r io.Reader) ([]HistoryRow, error) {
+	var records []historyRecord
+	decoder := json.NewDecoder(r)
+	for {
+		var record historyRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return historyRows(records)
+}
+
+// Convert the supplied JSON records into rows. Their counts are sorted by key.
+func historyRows(records []historyRecord) ([]HistoryRow, error) {
+	var rows []HistoryRow
+	for ix, record := range records {
+		timestamp, err := time.Parse(time.RFC3339, record.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", ix+1, err)
+		}
+
+		row := HistoryRow{
+			AccountID:   record.AccountID,
+			Timestamp:   timestamp,
+			Region:      record.Region,
+			Scope:       record.Scope,
+			ToolVersion: record.ToolVersion,
+			Counts:      make(map[string]CountResult),
+		}
+		for key, count := range record.Counts {
+			row.Columns = append(row.Columns, key)
+			row.Counts[key] = CountResult{Count: count, Incomplete: Contains(record.Incomplete, key)}
+		}
+		sort.Strings(row.Columns)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// TotalsRows returns the rows that hold the totals of each account, leaving out
+// the row of each region (those whose scope is ScopeRegion, with --breakdown
+// region).
+func TotalsRows(rows []HistoryRow) []HistoryRow {
+	var totals []HistoryRow
+	for _, row := range rows {
+		if row.Scope != ScopeRegion {
+			totals = append(totals, row)
+		}
+	}
+
+	return totals
+}
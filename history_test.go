@@ -0,0 +1,144 @@
+/******************************************************************************
+Cloud Resource Counter
+File: history_test.go
+
+Summary: The Unit Test for history.
+******************************************************************************/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A CSV file appended to by two versions of the tool (the second one added a
+// column)
+const historyCSV = `Account ID,Timestamp,Region,# of EC2 Instances,# of S3 Buckets
+111122223333,2024-05-01T12:00:00Z,ALL_REGIONS,10,3
+Account ID,Timestamp,Region,# of EC2 Instances,# of S3 Buckets,# of Lambda Functions
+111122223333,2024-05-02T12:00:00Z,ALL_REGIONS,12 (incomplete),3,5
+`
+
+// The same runs, as JSON records
+const historyJSON = `[
+  {"account_id": "111122223333", "timestamp": "2024-05-01T12:00:00Z", "region": "ALL_REGIONS", "tool_version": "1.0.0", "counts": {"s3_buckets": 3, "ec2_instances": 10}},
+  {"account_id": "111122223333", "timestamp": "2024-05-02T12:00:00Z", "region": "ALL_REGIONS", "tool_version": "1.1.0", "counts": {"s3_buckets": 3, "ec2_instances": 12, "lambda_functions": 5}, "incomplete": ["ec2_instances"]}
+]`
+
+func TestReadHistory(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Name                string
+		Contents            string
+		ExpectError         bool
+		ExpectedRows        int
+		ExpectedColumns     []string
+		ExpectedToolVersion string
+	}{
+		{
+			Name:            "CSV",
+			Contents:        historyCSV,
+			ExpectedRows:    2,
+			ExpectedColumns: []string{"ec2_instances", "s3_buckets", "lambda_functions"},
+		},
+		{
+			Name:                "JSON",
+			Contents:            "\n" + historyJSON,
+			ExpectedRows:        2,
+			ExpectedColumns:     []string{"ec2_instances", "lambda_functions", "s3_buckets"},
+			ExpectedToolVersion: "1.1.0",
+		},
+		{
+			Name:                "NDJSON",
+			Contents:            strings.Join(strings.Split(strings.Trim(historyJSON, "[]\n"), ",\n"), "\n"),
+			ExpectedRows:        2,
+			ExpectedColumns:     []string{"ec2_instances", "lambda_functions", "s3_buckets"},
+			ExpectedToolVersion: "1.1.0",
+		},
+		{
+			Name: "Empty",
+		},
+		{
+			Name:        "No header",
+			Contents:    "111122223333,2024-05-01T12:00:00Z,ALL_REGIONS,10\n",
+			ExpectError: true,
+		},
+		{
+			Name:        "Bad count",
+			Contents:    "Account ID,Timestamp,Region,# of EC2 Instances\n111122223333,2024-05-01T12:00:00Z,ALL_REGIONS,many\n",
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		rows, err := ReadHistory(strings.NewReader(c.Contents))
+		if c.ExpectError {
+			if err == nil {
+				t.Errorf("%s: Expected an error, but there was none", c.Name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: Unexpected error: %v", c.Name, err)
+			continue
+		}
+
+		// Did we get the expected rows?
+		if len(rows) != c.ExpectedRows {
+			t.Errorf("%s: Unexpected number of rows: expected %d, actual %d", c.Name, c.ExpectedRows, len(rows))
+			continue
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		// Check the latest row
+		latest := rows[len(rows)-1]
+		if latest.AccountID != "111122223333" || latest.Region != "ALL_REGIONS" || latest.Timestamp.Day() != 2 {
+			t.Errorf("%s: Unexpected row: %+v", c.Name, latest)
+		}
+		if !reflect.DeepEqual(latest.Columns, c.ExpectedColumns) {
+			t.Errorf("%s: Unexpected columns: expected %v, actual %v", c.Name, c.ExpectedColumns, latest.Columns)
+		}
+		if latest.ToolVersion != c.ExpectedToolVersion {
+			t.Errorf("%s: Unexpected tool version: expected %s, actual %s", c.Name, c.ExpectedToolVersion, latest.ToolVersion)
+		}
+		if count := latest.Counts["ec2_instances"]; count.Count != 12 || !count.Incomplete {
+			t.Errorf("%s: Unexpected EC2 count: %v", c.Name, count)
+		}
+		if count := latest.Counts["s3_buckets"]; count.Count != 3 || count.Incomplete {
+			t.Errorf("%s: Unexpected S3 count: %v", c.Name, count)
+		}
+	}
+}
+
+func TestTotalsRows(t *testing.T) {
+	// A breakdown of one account (two regions and its totals), appended to a file
+	// holding the totals of the same account counted twice at once (e.g., by two
+	// profiles) and of an account that could not be identified
+	contents := `Account ID,Timestamp,Region,# of EC2 Instances
+111122223333,2024-05-01T12:00:00Z,ALL_REGIONS,10
+111122223333,2024-05-01T12:00:00Z,ALL_REGIONS,10
+,2024-05-01T12:00:00Z,ALL_REGIONS,0
+Account ID,Timestamp,Region,Scope,# of EC2 Instances
+111122223333,2024-05-02T12:00:00Z,us-east-1,region,6
+111122223333,2024-05-02T12:00:00Z,us-west-2,region,6
+111122223333,2024-05-02T12:00:00Z,ALL_REGIONS,total,12
+`
+	rows, err := ReadHistory(strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Only the rows of each region are left out
+	var actual []string
+	for _, row := range TotalsRows(rows) {
+		actual = append(actual, row.AccountID+"/"+row.Region+"/"+row.Scope)
+	}
+	expected := []string{"111122223333/ALL_REGIONS/", "111122223333/ALL_REGIONS/", "/ALL_REGIONS/", "111122223333/ALL_REGIONS/total"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected totals rows: expected %v, actual %v", expected, actual)
+	}
+}
@@ -0,0 +1,178 @@
+/******************************************************************************
+Cloud Resource Counter
+File: iamPolicy.go
+
+Summary: The iam-policy subcommand, which generates the IAM policies needed by
+         the selected counters.
+******************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The documents that can be generated by the iam-policy subcommand
+const (
+	PolicyDocumentPermissions = "permissions"
+	PolicyDocumentManagement  = "management"
+	PolicyDocumentTrust       = "trust"
+)
+
+// The placeholder used in a trust policy when the management account is unknown
+const managementAccountPlaceholder = "MANAGEMENT-ACCOUNT-ID"
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement is a single statement of an IAM policy document.
+type PolicyStatement struct {
+	Sid       string            `json:"Sid"`
+	Effect    string            `json:"Effect"`
+	Principal map[string]string `json:"Principal,omitempty"`
+	Action    interface{}       `json:"Action"`
+	Resource  string            `json:"Resource,omitempty"`
+}
+
+// PermissionsPolicy returns the policy that allows the supplied counters to
+// count resources (broken down by region, or not).
+func PermissionsPolicy(counters []Counter, byRegion bool) PolicyDocument {
+	return PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []PolicyStatement{
+			{
+				Sid:      "cloudresourcecounterpermissions",
+				Effect:   "Allow",
+				Action:   IAMActions(counters, byRegion),
+				Resource: "*",
+			},
+		},
+	}
+}
+
+// ManagementPolicy returns the policy of the management account of an organization
+// (in the supplied partition): in addition to counting its own resources, it lists
+// the member accounts and assumes the named role in each of them.
+func ManagementPolicy(counters []Counter, byRegion bool, partitionID string, roleName string) PolicyDocument {
+	policy := PermissionsPolicy(counters, byRegion)
+	policy.Statement = append(policy.Statement,
+		PolicyStatement{
+			Sid:      "cloudresourcecounterorganization",
+			Effect:   "Allow",
+			Action:   []string{"organizations:ListAccounts"},
+			Resource: "*",
+		},
+		PolicyStatement{
+			Sid:      "cloudresourcecounterassumerole",
+			Effect:   "Allow",
+			Action:   []string{"sts:AssumeRole"},
+			Resource: OrganizationRoleARN(partitionID, "*", roleName),
+		},
+	)
+
+	return policy
+}
+
+// TrustPolicy returns the trust policy of the role in each member account, which
+// allows the management account (of the supplied partition) to assume it.
+func TrustPolicy(partitionID string, managementAccountID string) PolicyDocument {
+	return PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []PolicyStatement{
+			{
+				Sid:    "cloudresourcecountertrust",
+				Effect: "Allow",
+				Principal: map[string]string{
+					"AWS": PartitionARN(partitionID, "iam", "", managementAccountID, "root"),
+				},
+				Action: "sts:AssumeRole",
+			},
+		},
+	}
+}
+
+// FormatPolicy formats the supplied policy document as indented JSON.
+func FormatPolicy(policy PolicyDocument) string {
+	contents, _ := json.MarshalIndent(policy, "", "    ")
+
+	return string(contents) + "\n"
+}
+
+// RunIAMPolicy implements the iam-policy subcommand. It writes the generated
+// policy document(s) to the supplied Writer.
+//
+// Usage of aws-resource-counter iam-policy
+//   --only CL:               Only include the counters in the comma separated list CL
+//   --skip CL:               Do not include the counters in the comma separated list CL
+//   --organization:          Also generate the policies for an organization-wide sweep
+//   --role-name RN:          The name of the role in each member account
+//   --management-account ID: The ID of the management account (in the trust policy)
+//   --document DOC:          Only generate DOC (permissions, management or trust)
+//   --partition P:           The partition of the ARNs (aws, aws-us-gov or aws-cn)
+//   --breakdown region:      Include the actions needed to break down the counts by region
+//
+func RunIAMPolicy(args []string, w io.Writer, am ActivityMonitor) {
+	var onlyList, skipList, roleName, managementAccountID, document, partitionID, breakdown string
+	var organization bool
+
+	// Define a new FlagSet
+	flagSet := flag.NewFlagSet(os.Args[0]+" iam-policy", flag.ExitOnError)
+
+	// Define and parse the command line arguments...
+	flagSet.StringVar(&onlyList, "only", "", "Only include the counters in a comma separated `list` of counter names.")
+	flagSet.StringVar(&skipList, "skip", "", "Do not include the counters in a comma separated `list` of counter names.")
+	flagSet.BoolVar(&organization, "organization", false, "Also generate the policies needed for --organization. (default false)")
+	flagSet.StringVar(&roleName, "role-name", DefaultOrganizationRoleName, "The name of the `role` assumed in each member account.")
+	flagSet.StringVar(&managementAccountID, "management-account", managementAccountPlaceholder, "The `ID` of the organization's management account (trusted by the role in each member account).")
+	flagSet.StringVar(&document, "document", "", "Only generate one `document`: permissions, management or trust.")
+	flagSet.StringVar(&partitionID, "partition", PartitionAWS, fmt.Sprintf("The `partition` of the accounts (%s).", strings.Join(Partitions, ", ")))
+	flagSet.StringVar(&breakdown, "breakdown", "", "Include the actions needed to break down the counts. Use `region` for the actions of --breakdown region.")
+	flagSet.Parse(args)
+
+	// Select our counters
+	counters, problems := SelectCounters(splitList(onlyList), splitList(skipList))
+	if !Contains(Partitions, partitionID) {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid partition (expected one of %s).", partitionID, strings.Join(Partitions, ", ")))
+	}
+	if breakdown != "" && breakdown != BreakdownRegion {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid breakdown (expected %s).", breakdown, BreakdownRegion))
+	}
+	byRegion := breakdown == BreakdownRegion
+
+	// Leave out the counters whose service is not available in the partition
+	counters = AvailableCounters(counters, partitionID)
+	if len(problems) > 0 {
+		am.ActionError("Error: %s", strings.Join(problems, "\n"))
+		return
+	}
+
+	// Which documents are we generating?
+	switch {
+	case document == PolicyDocumentPermissions || (document == "" && !organization):
+		// The policy of the account (or role) that counts resources
+		fmt.Fprint(w, FormatPolicy(PermissionsPolicy(counters, byRegion)))
+	case document == PolicyDocumentManagement:
+		fmt.Fprint(w, FormatPolicy(ManagementPolicy(counters, byRegion, partitionID, roleName)))
+	case document == PolicyDocumentTrust:
+		fmt.Fprint(w, FormatPolicy(TrustPolicy(partitionID, managementAccountID)))
+	case document == "":
+		// Describe each of the documents of an organization-wide sweep
+		am.Message("Permissions policy of the '%s' role in each member account:\n", roleName)
+		fmt.Fprint(w, FormatPolicy(PermissionsPolicy(counters, byRegion)))
+		am.Message("\nTrust policy of the '%s' role in each member account:\n", roleName)
+		fmt.Fprint(w, FormatPolicy(TrustPolicy(partitionID, managementAccountID)))
+		am.Message("\nPermissions policy of the management account:\n")
+		fmt.Fprint(w, FormatPolicy(ManagementPolicy(counters, byRegion, partitionID, roleName)))
+	default:
+		am.ActionError("Error: '%s' is not a valid document (expected %s, %s or %s).", document,
+			PolicyDocumentPermissions, PolicyDocumentManagement, PolicyDocumentTrust)
+	}
+}
@@ -0,0 +1,148 @@
+/******************************************************************************
+Cloud Resource Counter
+File: iamPolicy_test.go
+
+Summary: The Unit Test for iamPolicy.
+******************************************************************************/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestRunIAMPolicy(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		Args              []string
+		ExpectError       bool
+		ExpectedDocuments int
+		ExpectedStrings   []string
+		UnexpectedStrings []string
+	}{
+		{
+			ExpectedDocuments: 1,
+			ExpectedStrings:   []string{`"ec2:DescribeRegions"`, `"ecs:DescribeTaskDefinition"`, `"s3:ListAllMyBuckets"`},
+			UnexpectedStrings: []string{"sts:AssumeRole"},
+		},
+		{
+			Args:              []string{"--only", "lambda,s3"},
+			ExpectedDocuments: 1,
+			ExpectedStrings:   []string{`"ec2:DescribeRegions"`, `"lambda:ListFunctions"`, `"s3:ListAllMyBuckets"`},
+			UnexpectedStrings: []string{"ecs:", "eks:", "rds:"},
+		},
+		{
+			// The location of each bucket is only needed with a breakdown
+			Args:              []string{"--only", "s3"},
+			ExpectedDocuments: 1,
+			ExpectedStrings:   []string{`"s3:ListAllMyBuckets"`},
+			UnexpectedStrings: []string{"s3:GetBucketLocation"},
+		},
+		{
+			Args:              []string{"--only", "s3", "--breakdown", "region"},
+			ExpectedDocuments: 1,
+			ExpectedStrings:   []string{`"s3:ListAllMyBuckets"`, `"s3:GetBucketLocation"`},
+		},
+		{
+			Args:        []string{"--breakdown", "service"},
+			ExpectError: true,
+		},
+		{
+			Args:              []string{"--organization", "--role-name", "Counter", "--management-account", "111122223333"},
+			ExpectedDocuments: 3,
+			ExpectedStrings:   []string{"organizations:ListAccounts", "arn:aws:iam::*:role/Counter", "arn:aws:iam::111122223333:root"},
+		},
+		{
+			Args:              []string{"--document", "trust"},
+			ExpectedDocuments: 1,
+			ExpectedStrings:   []string{"arn:aws:iam::MANAGEMENT-ACCOUNT-ID:root"},
+			UnexpectedStrings: []string{"ec2:"},
+		},
+		{
+			Args:              []string{"--partition", "aws-us-gov", "--organization", "--role-name", "Counter", "--management-account", "111122223333"},
+			ExpectedDocuments: 3,
+			ExpectedStrings:   []string{"arn:aws-us-gov:iam::*:role/Counter", "arn:aws-us-gov:iam::111122223333:root", `"ec2:DescribeInstances"`},
+			UnexpectedStrings: []string{"arn:aws:", "lightsail:"},
+		},
+		{
+			Args:        []string{"--partition", "aws-iso"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--document", "everything"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--skip", "dynamodb"},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a Builder to hold the generated policies
+		builder := strings.Builder{}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Generate the policies
+		RunIAMPolicy(c.Args, &builder, mon)
+
+		// Did we expect an error?
+		if c.ExpectError {
+			if !mon.ErrorOccured {
+				t.Errorf("Expected an error to occur for %v, but it did not... :^(", c.Args)
+			}
+			continue
+		} else if mon.ErrorOccured {
+			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+			continue
+		}
+
+		// Is each document valid JSON?
+		decoder := json.NewDecoder(strings.NewReader(builder.String()))
+		documents := 0
+		for decoder.More() {
+			var policy PolicyDocument
+			if err := decoder.Decode(&policy); err != nil {
+				t.Errorf("Unexpected error while decoding policy: %v", err)
+				break
+			}
+			documents++
+		}
+		if documents != c.ExpectedDocuments {
+			t.Errorf("Unexpected number of documents for %v: expected %d, actual %d", c.Args, c.ExpectedDocuments, documents)
+		}
+
+		// Are the expected strings present (and the unexpected ones absent)?
+		for _, expected := range c.ExpectedStrings {
+			if !strings.Contains(builder.String(), expected) {
+				t.Errorf("Expected policy for %v to contain %s, but it did not", c.Args, expected)
+			}
+		}
+		for _, unexpected := range c.UnexpectedStrings {
+			if strings.Contains(builder.String(), unexpected) {
+				t.Errorf("Expected policy for %v not to contain %s, but it did", c.Args, unexpected)
+			}
+		}
+	}
+}
+
+func TestReadmePolicy(t *testing.T) {
+	// Read the README
+	readme, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatalf("Unexpected error while reading README: %v", err)
+	}
+
+	// Does it contain the generated policy for all counters?
+	if !strings.Contains(string(readme), FormatPolicy(PermissionsPolicy(Counters, true))) {
+		t.Errorf("The Minimal IAM Policy in the README does not match the output of the iam-policy subcommand")
+	}
+}
@@ -0,0 +1,159 @@
+/******************************************************************************
+Cloud Resource Counter
+File: inventory.go
+
+Summary: The inventory of resources (--inventory), which records each resource
+         inspected by a counter and whether (and why) it was counted.
+******************************************************************************/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InventoryColumns are the columns of an inventory written as CSV.
+var InventoryColumns = []string{"Account ID", "Timestamp", "Region", "Service", "Resource ID", "State", "Counted", "Reason"}
+
+// InventoryItem describes a single resource inspected by a counter: whether it
+// was counted and the reason why (or why not). The timestamp is that of the row
+// of results of its account, which tells the runs of an inventory apart.
+type InventoryItem struct {
+	Account   string `json:"account"`
+	Timestamp string `json:"timestamp"`
+	Region    string `json:"region"`
+	Service   string `json:"service"`
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Counted   bool   `json:"counted"`
+	Reason    string `json:"reason"`
+}
+
+// CountedItem constructs an InventoryItem for a resource that was counted.
+func CountedItem(id string, state string, reason string) InventoryItem {
+	return InventoryItem{ID: id, State: state, Counted: true, Reason: reason}
+}
+
+// ExcludedItem constructs an InventoryItem for a resource that was not counted.
+func ExcludedItem(id string, state string, reason string) InventoryItem {
+	return InventoryItem{ID: id, State: state, Reason: reason}
+}
+
+// CountedItems returns the number of supplied items that were counted.
+func CountedItems(items []InventoryItem) int {
+	count := 0
+	for _, item := range items {
+		if item.Counted {
+			count++
+		}
+	}
+
+	return count
+}
+
+// NewInventoryResult constructs a RegionResult from the items inspected in a
+// region and a (possibly nil) error. The count is the number of items that were
+// counted, so the count and the inventory always agree.
+func NewInventoryResult(items []InventoryItem, err error) RegionResult {
+	result := NewRegionResult(CountedItems(items), err)
+	result.Inventory = items
+
+	return result
+}
+
+// InventoryFormat returns the format of the named inventory file: CSV if its
+// extension is ".csv" or NDJSON otherwise.
+func InventoryFormat(fileName string) string {
+	if strings.EqualFold(filepath.Ext(fileName), ".csv") {
+		return FormatCSV
+	}
+
+	return FormatNDJSON
+}
+
+// Inventory collects the items of every counter (across all accounts) and saves
+// them to the associated Writer in the requested format (CSV or NDJSON). The CSV
+// header is only written if StoreHeaders is true (i.e., not when appending to the
+// inventory of an earlier run). It is safe to use from multiple goroutines.
+type Inventory struct {
+	Writer       io.Writer
+	Format       string
+	StoreHeaders bool
+
+	// Serializes access to our items
+	mu    sync.Mutex
+	items []InventoryItem
+}
+
+// Add stores the supplied items in the inventory.
+func (inv *Inventory) Add(items ...InventoryItem) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.items = append(inv.items, items...)
+}
+
+// Items returns the items stored so far.
+func (inv *Inventory) Items() []InventoryItem {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	return append([]InventoryItem(nil), inv.items...)
+}
+
+// Save writes all of the items to the associated Writer. This method gives status
+// back to the user via the supplied ActivityMonitor instance.
+func (inv *Inventory) Save(am ActivityMonitor) {
+	// If we don't have a Writer, then get out now...
+	if NilInterface(inv.Writer) {
+		return
+	}
+
+	// Indicate activity
+	am.StartAction("Writing inventory to file")
+
+	// Write all of the items at once in the requested format
+	var err error
+	if inv.Format == FormatCSV {
+		err = inv.saveCSV()
+	} else {
+		err = inv.saveNDJSON()
+	}
+
+	// Check for Error
+	am.CheckError(err)
+
+	// Indicate success
+	am.EndAction("OK (%d resources)", len(inv.Items()))
+}
+
+// Write the items as CSV (with a header, if requested)
+func (inv *Inventory) saveCSV() error {
+	var rows [][]string
+	if inv.StoreHeaders {
+		rows = append(rows, InventoryColumns)
+	}
+	for _, item := range inv.Items() {
+		rows = append(rows, []string{item.Account, item.Timestamp, item.Region, item.Service, item.ID, item.State, strconv.FormatBool(item.Counted), item.Reason})
+	}
+
+	return csv.NewWriter(inv.Writer).WriteAll(rows)
+}
+
+// Write each item as a JSON document on a line of its own
+func (inv *Inventory) saveNDJSON() error {
+	encoder := json.NewEncoder(inv.Writer)
+	for _, item := range inv.Items() {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+/******************************************************************************
+Cloud Resource Counter
+File: inventory_test.go
+
+Summary: The Unit Test for inventory.
+******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestInventorySave(t *testing.T) {
+	// The items of our inventory
+	items := []InventoryItem{
+		{Account: "123456789012", Timestamp: "2024-05-01T12:00:00Z", Region: "us-east-1", Service: "EC2", ID: "i-0001", State: "running", Counted: true, Reason: "running instance"},
+		{Account: "123456789012", Timestamp: "2024-05-01T12:00:00Z", Region: "us-east-1", Service: "EC2", ID: "i-0002", State: "running", Reason: "spot lifecycle"},
+	}
+
+	// Construct our test cases...
+	cases := []struct {
+		Format       string
+		StoreHeaders bool
+		Expected     string
+	}{
+		{
+			Format:       FormatCSV,
+			StoreHeaders: true,
+			Expected: "Account ID,Timestamp,Region,Service,Resource ID,State,Counted,Reason\n" +
+				"123456789012,2024-05-01T12:00:00Z,us-east-1,EC2,i-0001,running,true,running instance\n" +
+				"123456789012,2024-05-01T12:00:00Z,us-east-1,EC2,i-0002,running,false,spot lifecycle\n",
+		},
+		{
+			// Appending to the inventory of an earlier run
+			Format: FormatCSV,
+			Expected: "123456789012,2024-05-01T12:00:00Z,us-east-1,EC2,i-0001,running,true,running instance\n" +
+				"123456789012,2024-05-01T12:00:00Z,us-east-1,EC2,i-0002,running,false,spot lifecycle\n",
+		},
+		{
+			Format: FormatNDJSON,
+			Expected: `{"account":"123456789012","timestamp":"2024-05-01T12:00:00Z","region":"us-east-1","service":"EC2","id":"i-0001","state":"running","counted":true,"reason":"running instance"}` + "\n" +
+				`{"account":"123456789012","timestamp":"2024-05-01T12:00:00Z","region":"us-east-1","service":"EC2","id":"i-0002","state":"running","counted":false,"reason":"spot lifecycle"}` + "\n",
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Construct our inventory
+		var buffer bytes.Buffer
+		inventory := &Inventory{Writer: &buffer, Format: c.Format, StoreHeaders: c.StoreHeaders}
+		inventory.Add(items...)
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Save the inventory
+		inventory.Save(mon)
+
+		// Does it match?
+		if mon.ErrorOccured {
+			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+		} else if buffer.String() != c.Expected {
+			t.Errorf("Unexpected %s inventory:\nexpected:\n%s\nactual:\n%s", c.Format, c.Expected, buffer.String())
+		}
+	}
+}
+
+func TestInventoryFormat(t *testing.T) {
+	cases := map[string]string{
+		"inventory.csv":    FormatCSV,
+		"INVENTORY.CSV":    FormatCSV,
+		"inventory.ndjson": FormatNDJSON,
+		"inventory":        FormatNDJSON,
+	}
+
+	for fileName, expected := range cases {
+		if actual := InventoryFormat(fileName); actual != expected {
+			t.Errorf("Unexpected format of %s: expected %s, actual %s", fileName, expected, actual)
+		}
+	}
+}
+
+// The inventory of a counter should always agree with its count
+func TestEC2Inventory(t *testing.T) {
+	// Create our fake service factory
+	sf := fakeEC2ServiceFactory{
+		RegionName: "us-east-1",
+		DRResponse: ec2Regions,
+	}
+
+	// Create a mock activity monitor
+	mon := &mock.ActivityMonitorImpl{}
+
+	// Count the instances of all regions, keeping an inventory
+	rc := &RunContext{AllRegions: true, Inventory: &Inventory{}}
+	result := RunCounter(EC2Counter, &CountContext{ServiceFactory: sf, Monitor: mon, Run: rc, AccountID: "123456789012"})
+	items := rc.Inventory.Items()
+
+	// Does the inventory agree with the count?
+	if mon.ErrorOccured {
+		t.Fatalf("Unexpected error occurred: %s", mon.ErrorMessage)
+	} else if CountedItems(items) != result.Count {
+		t.Errorf("Inventory does not agree with count: %d counted items, count of %d", CountedItems(items), result.Count)
+	}
+
+	// Are the excluded items explained? Are the items attributed to the account and region?
+	excluded := make(map[string]int)
+	for _, item := range items {
+		if !item.Counted {
+			excluded[item.Reason]++
+		}
+		if item.Account != "123456789012" || item.Service != "EC2" || item.Region == "" {
+			t.Errorf("Unexpected attribution of item: %+v", item)
+		}
+	}
+	if excluded["spot lifecycle"] != 1 || excluded["scheduled lifecycle"] != 0 {
+		t.Errorf("Unexpected excluded items: %v", excluded)
+	}
+}
+
+// Every counter records the resources that make up its count
+func TestCounterInventories(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		Counter         Counter
+		ServiceFactory  ServiceFactory
+		ByRegion        bool
+		ExpectedItems   int
+		ExpectedCounted int
+		ExpectedRegion  string
+	}{
+		{
+			// Every bucket is counted (in the region where it resides)
+			Counter:         S3Counter,
+			ServiceFactory:  fakeS3ServiceFactory{LBResponse: fakeS3BucketsSlice, GBLResponse: fakeS3BucketLocations},
+			ByRegion:        true,
+			ExpectedItems:   8,
+			ExpectedCounted: 8,
+			ExpectedRegion:  "us-west-2",
+		},
+		{
+			// Each nodegroup stands for its desired nodes (2 nodegroups of 3 clusters)
+			Counter:         EKSCounter,
+			ServiceFactory:  fakeEKSServiceFactory{LCResponse: fakeEKSClustersSlice, DNGResponse: fakeEKSDescribeNodeGroup, LNGResponse: fakeEKSNodeGroupSlice},
+			ExpectedItems:   6,
+			ExpectedCounted: 6,
+		},
+		{
+			// Each unique image of the region is counted
+			Counter:         ContainerCounter,
+			ServiceFactory:  fakeCntrServiceFactory{RegionName: "us-east-1", DRResponse: ec2Regions},
+			ExpectedItems:   3,
+			ExpectedCounted: 3,
+		},
+		{
+			Counter:         EC2K8Counter,
+			ServiceFactory:  fakeEC2ServiceFactory{RegionName: "us-east-1", DRResponse: ec2Regions},
+			ExpectedItems:   1,
+			ExpectedCounted: 1,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Count the resources, keeping an inventory
+		mon := &mock.ActivityMonitorImpl{}
+		rc := &RunContext{ByRegion: c.ByRegion, AllRegions: c.ByRegion, Inventory: &Inventory{}}
+		RunCounter(c.Counter, &CountContext{ServiceFactory: c.ServiceFactory, Monitor: mon, Run: rc, AccountID: "123456789012"})
+		items := rc.Inventory.Items()
+
+		// Does the inventory match?
+		if mon.ErrorOccured {
+			t.Errorf("%s: Unexpected error occurred: %s", c.Counter.Name(), mon.ErrorMessage)
+		} else if len(items) != c.ExpectedItems || CountedItems(items) != c.ExpectedCounted {
+			t.Errorf("%s: Unexpected inventory: expected %d items (%d counted), actual %d (%d counted)",
+				c.Counter.Name(), c.ExpectedItems, c.ExpectedCounted, len(items), CountedItems(items))
+		} else if c.ExpectedRegion != "" && !Contains(inventoryRegions(items), c.ExpectedRegion) {
+			t.Errorf("%s: Expected an item in %s: %+v", c.Counter.Name(), c.ExpectedRegion, items)
+		}
+	}
+}
+
+// Get the region of each item
+func inventoryRegions(items []InventoryItem) []string {
+	var regions []string
+	for _, item := range items {
+		regions = append(regions, item.Region)
+	}
+
+	return regions
+}
@@ -8,42 +8,39 @@ Summary: Provides a count of all Lambda functions.
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/lambda"
-
-	color "github.com/logrusorgru/aurora"
 )
 
 // LambdaFunctions retrieves the count of all lambda function
-// either for all regions (allRegions is true) or the region
+// either for all regions (rc.AllRegions is true) or the region
 // associated with the session.  This method gives status back
 // to the user via the supplied ActivityMonitor instance.
-func LambdaFunctions(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving Lambda function counts")
-
-	// Should we get the counts for all regions?
-	instanceCount := 0
-	if allRegions {
-		// Get the list of all enabled regions for this account
-		regionsSlice := GetEC2Regions(sf.GetEC2InstanceService(""), am)
-
-		// Loop through all of the regions
-		for _, regionName := range regionsSlice {
-			// Get the Lambda counts for a specific region
-			instanceCount += lambdaFunctionsForSingleRegion(sf.GetLambdaService(regionName), am)
-		}
-	} else {
-		// Get the Lambda counts for the region selected by this session
-		instanceCount = lambdaFunctionsForSingleRegion(sf.GetLambdaService(""), am)
-	}
+func LambdaFunctions(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(LambdaCounter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(instanceCount))
+// lambdaCounter counts the Lambda functions of a region.
+type lambdaCounter struct {
+	CounterInfo
+}
 
-	return instanceCount
+// LambdaCounter is the registered Counter for Lambda functions.
+var LambdaCounter = lambdaCounter{CounterInfo{
+	CounterName:  "lambda",
+	ColumnName:   "# of Lambda Functions",
+	ServiceName:  "Lambda",
+	ActivityName: "Lambda function",
+	Actions:      []string{"lambda:ListFunctions"},
+	IsRegional:   true,
+}}
+
+// Count the Lambda functions of the supplied region
+func (lambdaCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	return NewInventoryResult(lambdaFunctionsForSingleRegion(ctx.RequestContext(), ctx.ServiceFactory.GetLambdaService(regionName), ctx.Monitor))
 }
 
-func lambdaFunctionsForSingleRegion(ls *LambdaService, am ActivityMonitor) int {
+func lambdaFunctionsForSingleRegion(c aws.Context, ls *LambdaService, am ActivityMonitor) ([]InventoryItem, error) {
 	// Construct our input to find all Lambda instances
 	input := &lambda.ListFunctionsInput{}
 
@@ -51,15 +48,14 @@ func lambdaFunctionsForSingleRegion(ls *LambdaService, am ActivityMonitor) int {
 	am.Message(".")
 
 	// Invoke our service
-	functionCounts := 0
-	err := ls.ListFunctions(input, func(page *lambda.ListFunctionsOutput, lastPage bool) bool {
-		functionCounts += len(page.Functions)
+	var items []InventoryItem
+	err := ls.ListFunctions(c, input, func(page *lambda.ListFunctionsOutput, lastPage bool) bool {
+		for _, function := range page.Functions {
+			items = append(items, CountedItem(aws.StringValue(function.FunctionArn), aws.StringValue(function.State), "function"))
+		}
 
 		return true
 	})
 
-	// Check for error
-	am.CheckError(err)
-
-	return functionCounts
+	return items, err
 }
@@ -11,6 +11,8 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/lambda"
 	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
@@ -84,8 +86,8 @@ type fakeLambdaService struct {
 	LFOResponse []*lambda.ListFunctionsOutput
 }
 
-// Simulate the ListFunctionsPages function
-func (fake *fakeLambdaService) ListFunctionsPages(input *lambda.ListFunctionsInput, fn func(*lambda.ListFunctionsOutput, bool) bool) error {
+// Simulate the ListFunctionsPagesWithContext function
+func (fake *fakeLambdaService) ListFunctionsPagesWithContext(ctx aws.Context, input *lambda.ListFunctionsInput, fn func(*lambda.ListFunctionsOutput, bool) bool, _ ...request.Option) error {
 	// If the supplied response is nil, then simulate an error
 	if fake.LFOResponse == nil {
 		return errors.New("ListFunctionsPages encountered an unexpected error: 1234")
@@ -140,6 +142,16 @@ func (fsf fakeLambdaServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeLambdaServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeLambdaServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // This implementation of GetEC2InstanceService is limited to supporting DescribeRegions API
 // only.
 func (fsf fakeLambdaServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
@@ -234,18 +246,20 @@ func TestLambdaFunctions(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our Lambda Functions function
-		actualCount := LambdaFunctions(sf, mon, c.AllRegions)
+		actualCount := LambdaFunctions(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: LambdaFunctions returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: LambdaFunctions returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
@@ -8,60 +8,67 @@ Summary: Counts the number of Lightsail instances.
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/lightsail"
-	color "github.com/logrusorgru/aurora"
 )
 
 // LightsailInstances returns a count of Lightsail instances in the current region
-// (allRegions = false) or for all regions (allRegions = true)
-func LightsailInstances(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving Lightsail instance counts")
+// (rc.AllRegions = false) or for all regions (rc.AllRegions = true)
+func LightsailInstances(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(LightsailCounter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
+// lightsailCounter counts the running Lightsail instances of a region.
+type lightsailCounter struct {
+	CounterInfo
+}
+
+// LightsailCounter is the registered Counter for running Lightsail instances.
+var LightsailCounter = lightsailCounter{CounterInfo{
+	CounterName:  "lightsail",
+	ColumnName:   "# of Lightsail Instances",
+	ServiceName:  "Lightsail",
+	ActivityName: "Lightsail instance",
+	Actions:      []string{"lightsail:GetRegions", "lightsail:GetInstances"},
+	IsRegional:   true,
+}}
+
+// RegionNames returns the Lightsail regions that should be examined: all of the
+// selected ones (rc.AllRegions is true) or just the region associated with the session.
+func (lightsailCounter) RegionNames(ctx *CountContext) ([]string, error) {
 	// Input for the list of regions...
 	input := &lightsail.GetRegionsInput{}
 
 	// Get the list of all enabled regions for this account
 	// Note that this call fails if the default region associated with this
 	// account is not in the supported list. Must use something supported,
-	// like US-EAST-1.
-	response, err := sf.GetLightsailService(DefaultRegion).GetRegions(input)
+	// like the bootstrap region of the partition (e.g., US-EAST-1).
+	response, err := ctx.ServiceFactory.GetLightsailService(BootstrapRegion(ctx.Partition)).GetRegions(ctx.RequestContext(), input)
 
 	// If error, then get out now!
-	if am.CheckError(err) {
-		return 0
+	if err != nil {
+		return nil, err
 	}
 
-	// Should we get the counts for all regions?
-	instanceCount := 0
-	if allRegions {
-		// Loop through all of the regions
-		for _, region := range response.Regions {
-			// Get the Lightsail instances counts for a specific region
-			instanceCount += lightsailInstancesForSingleRegion(sf.GetLightsailService(*region.Name), am)
-		}
-	} else {
-		// Is the current region supported by Lightsail?
-		var validLightsailRegion bool
-		for _, region := range response.Regions {
-			if sf.GetCurrentRegion() == *region.Name {
-				validLightsailRegion = true
-			}
-		}
-
-		if validLightsailRegion {
-			// Get the Lightsail instances counts for the region selected by this session
-			instanceCount = lightsailInstancesForSingleRegion(sf.GetLightsailService(""), am)
+	// Collect the names of the Lightsail regions that we should inspect
+	var regionNames []string
+	for _, region := range response.Regions {
+		// Should we get the counts for all (selected) regions? If not, is this the
+		// current region?
+		if ctx.Run.AllRegions && ctx.Run.IsRegionSelected(*region.Name) || !ctx.Run.AllRegions && ctx.ServiceFactory.GetCurrentRegion() == *region.Name {
+			regionNames = append(regionNames, *region.Name)
 		}
 	}
 
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(instanceCount))
+	return regionNames, nil
+}
 
-	return instanceCount
+// Count the running Lightsail instances of the supplied region
+func (lightsailCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	return NewInventoryResult(lightsailInstancesForSingleRegion(ctx.RequestContext(), ctx.ServiceFactory.GetLightsailService(regionName), ctx.Monitor))
 }
 
-func lightsailInstancesForSingleRegion(lss *LightsailService, am ActivityMonitor) int {
+func lightsailInstancesForSingleRegion(c aws.Context, lss *LightsailService, am ActivityMonitor) ([]InventoryItem, error) {
 	// Construct our input to find all Lightsail instances
 	input := &lightsail.GetInstancesInput{}
 
@@ -69,21 +76,29 @@ func lightsailInstancesForSingleRegion(lss *LightsailService, am ActivityMonitor
 	am.Message(".")
 
 	// Invoke our service
-	response, err := lss.InspectInstances(input)
+	response, err := lss.InspectInstances(c, input)
 
 	// Check for error
-	if am.CheckError(err) {
-		return 0
+	if err != nil {
+		return nil, err
 	}
 
 	// Loop through the instances...
-	var instanceCount int
+	var items []InventoryItem
 	for _, inst := range response.Instances {
+		id := aws.StringValue(inst.Arn)
+		var state string
+		if inst.State != nil {
+			state = aws.StringValue(inst.State.Name)
+		}
+
 		// Is the instance running?
 		if inst.State != nil && inst.State.Name != nil && *inst.State.Name == "running" {
-			instanceCount++
+			items = append(items, CountedItem(id, state, "running instance"))
+		} else {
+			items = append(items, ExcludedItem(id, state, "not running"))
 		}
 	}
 
-	return instanceCount
+	return items, nil
 }
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/lightsail"
 	"github.com/aws/aws-sdk-go/service/lightsail/lightsailiface"
 	"github.com/expel-io/aws-resource-counter/mock"
@@ -95,8 +96,8 @@ type fakeLightsailService struct {
 	GIOResponse *lightsail.GetInstancesOutput
 }
 
-// GetRegions fakes the standard Lightsail API of the same name.
-func (fake *fakeLightsailService) GetRegions(input *lightsail.GetRegionsInput) (*lightsail.GetRegionsOutput, error) {
+// GetRegionsWithContext fakes the standard Lightsail API of the same name.
+func (fake *fakeLightsailService) GetRegionsWithContext(ctx aws.Context, input *lightsail.GetRegionsInput, _ ...request.Option) (*lightsail.GetRegionsOutput, error) {
 	// If the pre-canned regions response is nil, then simulate the API returning an error
 	if fake.GRResponse == nil {
 		return nil, errors.New("GetRegions encountered an unexpected error: 7531")
@@ -105,8 +106,8 @@ func (fake *fakeLightsailService) GetRegions(input *lightsail.GetRegionsInput) (
 	return fake.GRResponse, nil
 }
 
-// GetInstances fakes the standard Lightsail API of the same name.
-func (fake *fakeLightsailService) GetInstances(input *lightsail.GetInstancesInput) (*lightsail.GetInstancesOutput, error) {
+// GetInstancesWithContext fakes the standard Lightsail API of the same name.
+func (fake *fakeLightsailService) GetInstancesWithContext(ctx aws.Context, input *lightsail.GetInstancesInput, _ ...request.Option) (*lightsail.GetInstancesOutput, error) {
 	// If the supplied response is nil, then simulate an error
 	if fake.GIOResponse == nil {
 		return nil, errors.New("GetInstance encountered an unexpected error: 02468")
@@ -138,6 +139,16 @@ func (fsf fakeLightsailServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeLightsailServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeLightsailServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // Don't need to implement
 func (fsf fakeLightsailServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
 	return nil
@@ -237,18 +248,20 @@ func TestLightsailInstances(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our LightsailInstances function
-		actualCount := LightsailInstances(sf, mon, c.AllRegions)
+		actualCount := LightsailInstances(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: LightsailInstances returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: LightsailInstances returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
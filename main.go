@@ -8,7 +8,12 @@ Summary: Top-level entry point for the tool. Provides main() function.
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 	"time"
 )
 
@@ -23,6 +28,10 @@ var version string = "?.?.?"
 // default variable specified by Goreleaser's ldflags settings.
 var date string = "<<never built>>"
 
+// ExitCodeIncomplete is the exit code of the tool when it ran to completion
+// (with --continue-on-error) but some counts are incomplete due to errors.
+const ExitCodeIncomplete = 3
+
 // The cloud resource counter utility known as "aws-resource-counter" inspects
 // a cloud deployment (for now, only Amazon Web Services) to assess the number of
 // distinct computing resources. The result is a CSV file that describes the counts
@@ -42,40 +51,150 @@ func main() {
 		ExitFn: os.Exit,
 	}
 
+	// Are we running a subcommand?
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "iam-policy":
+			RunIAMPolicy(os.Args[2:], os.Stdout, monitor)
+			return
+		case "diff":
+			RunDiff(os.Args[2:], os.Stdout, monitor)
+			return
+		case "check":
+			RunCheck(os.Args[2:], monitor)
+			return
+		case SubcommandServe:
+			RunServe(os.Args[2:], monitor)
+			return
+		case SubcommandDaemon:
+			RunDaemon(os.Args[2:], monitor)
+			return
+		case "query":
+			RunQuery(os.Args[2:], os.Stdout, monitor)
+			return
+		}
+	}
+
 	// Process all command line arguments
 	settings := &CommandLineSettings{}
 	cleanupFn := settings.Process(os.Args[1:], monitor)
 	defer cleanupFn()
 
+	// Should errors be recorded rather than ending the run?
+	monitor.ContinueOnError = settings.continueOnError
+
+	// Show command line settings
+	settings.Display(monitor)
+
+	// Stop counting (but keep the partial results) when we are interrupted (e.g.,
+	// by Ctrl-C) or when the run times out. A second interrupt ends the tool at once.
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-sigCtx.Done()
+		stop()
+	}()
+
 	/* =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
-	 * Establish a valid AWS Session via our AWS Service Factory
+	 * Collect counts of all resources (and save them)
 	 * =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-= */
+	run := countRun(sigCtx, settings, monitor, NewSessionCache(settings))
 
-	// Create an AWS Service Factory
-	serviceFactory := &AWSServiceFactory{
-		ProfileName: settings.profileName,
-		RegionName:  settings.regionName,
-		TraceWriter: settings.traceFile,
-		UseSSO:      settings.useSSO,
-	}
-	serviceFactory.Init()
+	// Did the preflight check fail?
+	if run.PreflightFailures > 0 && !settings.continueOnError {
+		// Close our files (deferred functions are not run on exit)
+		cleanupFn()
+		monitor.ActionError("Error: The preflight check failed for %d action(s). Grant them or use --skip to deselect the counters that need them.", run.PreflightFailures)
 
-	// Show command line settings
-	settings.Display(monitor)
+		return
+	}
 
 	/* =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
-	 * Collect counts of all resources
+	 * Report on the run
 	 * =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-= */
 
-	// Show activity
-	monitor.Message("\nActivity\n")
+	// Were any of our rules broken?
+	violations := checkRules(settings, run, monitor)
+
+	// Export our counts to Prometheus (if requested)
+	if settings.prometheusTextfile != "" {
+		monitor.StartAction("Writing Prometheus metrics")
+		monitor.CheckError(WritePrometheusTextfile(settings.prometheusTextfile, run.Metrics(settings, violations)))
+		monitor.EndAction("OK")
+	}
+
+	// Were any counts incomplete?
+	if errs := monitor.Errors(); len(errs) > 0 {
+		// List the errors (once more) in one place
+		monitor.Message("\nThe following errors were encountered; counts marked \"incomplete\" do not include them:\n")
+		for _, err := range errs {
+			monitor.Message(" o %s\n", err.Error())
+		}
+
+		// Indicate partial success
+		monitor.Message("\nCompleted with %d error(s).\n", len(errs))
+
+		// Close our files (deferred functions are not run on exit). A broken rule
+		// outranks the incomplete counts.
+		cleanupFn()
+		if len(violations) > 0 {
+			monitor.Exit(ExitCodeViolations)
+		} else {
+			monitor.Exit(ExitCodeIncomplete)
+		}
+
+		return
+	}
+
+	// Were any of our rules broken?
+	if len(violations) > 0 {
+		cleanupFn()
+		monitor.Exit(ExitCodeViolations)
+
+		return
+	}
+
+	// Indicate success
+	monitor.Message("\nSuccess.\n")
+}
+
+// CountRun describes a single pass of counting (of every selected counter, in
+// every selected account) and how it went.
+type CountRun struct {
+	Results    *Results
+	Throttling *ThrottleControl
+
+	// The errors recorded during the run
+	Errors []*CounterError
+
+	// When the run started and how long it took
+	Started  time.Time
+	Duration time.Duration
+
+	// The number of actions whose preflight check failed (if checked). When
+	// errors end the run, no counting was done.
+	PreflightFailures int
+}
+
+// countAll collects the counts of all resources in every account selected by
+// the settings and saves them to the output file (and inventory), using the
+// sessions of the supplied cache. The run stops early (keeping its partial
+// results) when the supplied context is done.
+func countAll(runCtx context.Context, settings *CommandLineSettings, monitor *TerminalActivityMonitor, sessions *SessionCache) *CountRun {
+	// Which errors were recorded before this run?
+	priorErrors := len(monitor.Errors())
+
+	// Renew the sessions used by earlier runs (if any)
+	sessions.Refresh(runCtx, monitor)
 
 	// Construct a new results data structure
-	results := Results{
+	run := &CountRun{Started: time.Now()}
+	run.Results = &Results{
 		StoreHeaders: !settings.appendToOutput,
 		Writer:       settings.outputFile,
+		Format:       settings.format,
 	}
-	results.Init()
+	run.Results.Init()
 
 	// Get the display name of the selected region
 	var displayRegion string
@@ -85,34 +204,397 @@ func main() {
 		displayRegion = settings.regionName
 	}
 
-	// Create a new row of data
-	results.NewRow()
-	results.Append("Account ID", GetAccountID(serviceFactory.GetAccountIDService(), monitor))
-	results.Append("Timestamp", time.Now().Format(time.RFC3339))
-	results.Append("Region", displayRegion)
-	results.Append("# of EC2 Instances", EC2Counts(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of EC2 K8 related VMs Sub-instances", EC2K8SubInstances(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of Spot Instances", SpotInstances(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of EBS Volumes", EBSVolumes(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of Unique Containers", UniqueContainerImages(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of Lambda Functions", LambdaFunctions(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of RDS Instances", RDSInstances(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of Lightsail Instances", LightsailInstances(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of S3 Buckets", S3Buckets(serviceFactory, monitor, settings.allRegions))
-	results.Append("# of EKS Nodes", EKSNodes(serviceFactory, monitor, settings.allRegions))
+	// Construct the settings shared by all of our counters
+	rc := &RunContext{
+		AllRegions:     settings.allRegions,
+		Regions:        settings.regions,
+		ExcludeRegions: settings.excludeRegions,
+		Concurrency:    settings.concurrency,
+		ByRegion:       settings.breakdown == BreakdownRegion,
+		Counters:       settings.counters,
+		Partition:      settings.partition,
+		Context:        runCtx,
+		RegionTimeout:  settings.regionTimeout,
+	}
 
-	/* =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
-	 * Construct CSV Output
-	 * =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-= */
+	// Are we keeping an inventory of each resource?
+	if settings.inventoryFileName != "" {
+		rc.Inventory = &Inventory{
+			Writer:       settings.inventoryFile,
+			Format:       InventoryFormat(settings.inventoryFileName),
+			StoreHeaders: !settings.appendToInventory,
+		}
+	}
+
+	// The retries (and rate) of the requests of every session are controlled by
+	// our cache
+	run.Throttling = sessions.Throttling
+
+	// Should we check our permissions before counting?
+	if settings.preflight {
+		if run.PreflightFailures = preflightProfiles(settings, monitor, rc, sessions); run.PreflightFailures > 0 {
+			// Should we count anyway?
+			if !settings.continueOnError {
+				return run
+			}
+
+			monitor.Message("\nThe preflight check failed for %d action(s); counting anyway.\n", run.PreflightFailures)
+		}
+	}
+
+	// Show activity
+	monitor.Message("\nActivity\n")
+
+	// Loop through each of our profiles
+	profileNames := settings.ProfileNames()
+	for _, profileName := range profileNames {
+		// Were we interrupted?
+		if rc.Interrupted() {
+			break
+		}
 
-	// Save our results to a CSV file
-	results.Save(monitor)
+		// Are there several profiles?
+		if len(profileNames) > 1 {
+			monitor.Message("\nProfile %s\n", profileName)
+		}
+
+		// Establish a valid AWS Session via an AWS Service Factory (unless its
+		// credentials could not be refreshed)
+		serviceFactory := sessions.Factory(profileName, settings)
+		if serviceFactory == nil {
+			continue
+		}
+
+		// Collect the counts for the account(s) reached from this profile
+		countProfile(serviceFactory, settings, monitor, rc, displayRegion, run.Results)
+	}
+
+	// Were we interrupted (or did we time out)? The results so far are still saved,
+	// but the run is incomplete.
+	if rc.Interrupted() {
+		reportInterruption(rc, settings, monitor)
+	}
+
+	// Save our results to the output file
+	run.Results.Save(monitor)
+
+	// Save our inventory (if any)
+	if rc.Inventory != nil {
+		rc.Inventory.Save(monitor)
+	}
 
 	// Do we need to "explain" our S3 count?
-	if !settings.allRegions {
+	if !rc.EveryRegion() && settings.counterSelected("s3") {
 		monitor.Message("\n*S3 counts cannot be computed on a per-region basis. This count is for ALL REGIONS.\n")
 	}
 
-	// Indicate success
-	monitor.Message("\nSuccess.\n")
+	// Were any requests retried (or throttled)?
+	reportThrottling(run.Throttling, monitor)
+
+	run.Errors = monitor.Errors()[priorErrors:]
+	run.Duration = time.Since(run.Started)
+
+	// Save the run to our history store (if any)
+	if settings.store != nil {
+		saveToStore(settings.store, run, monitor)
+	}
+
+	return run
+}
+
+// saveToStore saves the counts (and errors) of the supplied run to the store.
+func saveToStore(store *Store, run *CountRun, am ActivityMonitor) {
+	am.StartAction("Saving to store")
+	rows, err := run.Results.History()
+	if am.CheckError(err) {
+		return
+	}
+
+	runID, err := store.SaveRun(rows, run.Errors, run.Started, run.Duration)
+	if am.CheckError(err) {
+		return
+	}
+	am.EndAction("OK (run %d)", runID)
+}
+
+// newServiceFactory establishes a valid AWS Session for the named profile via an
+// AWS Service Factory.
+func newServiceFactory(profileName string, settings *CommandLineSettings, throttling *ThrottleControl) *AWSServiceFactory {
+	serviceFactory := &AWSServiceFactory{
+		ProfileName:      profileName,
+		RegionName:       settings.regionName,
+		TraceWriter:      settings.traceFile,
+		UseSSO:           settings.useSSO,
+		RecordDir:        settings.recordDir,
+		ReplayDir:        settings.replayDir,
+		EndpointURL:      settings.endpointURL,
+		ServiceEndpoints: settings.serviceEndpoints,
+		S3PathStyle:      settings.s3PathStyle,
+		Partition:        settings.partition,
+		Throttling:       throttling,
+	}
+	serviceFactory.Init()
+
+	return serviceFactory
+}
+
+// preflightProfiles checks the permissions of the caller of each profile (or of
+// each role, with --assume-roles) before any counting starts. With --organization,
+// only the caller of each profile (in the management account) is checked. It
+// returns the number of actions whose check failed.
+func preflightProfiles(settings *CommandLineSettings, monitor *TerminalActivityMonitor, rc *RunContext, sessions *SessionCache) int {
+	monitor.Message("\nPreflight\n")
+
+	// Loop through each of our profiles
+	failed := 0
+	profileNames := settings.ProfileNames()
+	for _, profileName := range profileNames {
+		// Are there several profiles?
+		if len(profileNames) > 1 {
+			monitor.Message("\nProfile %s\n", profileName)
+		}
+		serviceFactory := sessions.Factory(profileName, settings)
+		if serviceFactory == nil {
+			continue
+		}
+
+		// Are we assuming roles?
+		if len(settings.roleARNs) == 0 {
+			failed += len(FailedChecks(Preflight(&CountContext{ServiceFactory: serviceFactory, Monitor: monitor, Run: rc, Partition: rc.Partition})))
+			continue
+		}
+
+		// Check each of the roles
+		for _, roleARN := range settings.roleARNs {
+			monitor.Message("\nRole %s\n", roleARN)
+			failed += len(FailedChecks(Preflight(&CountContext{ServiceFactory: serviceFactory.AssumeRole(roleARN), Monitor: monitor, Run: rc, Partition: rc.Partition})))
+		}
+	}
+
+	return failed
+}
+
+// countProfile collects the counts of all resources for the accounts that can be
+// reached from the supplied ServiceFactory: each member account of the organization
+// (with --organization), the account of each role (with --assume-roles) or simply
+// the account associated with the factory's session.
+func countProfile(serviceFactory *AWSServiceFactory, settings *CommandLineSettings, monitor *TerminalActivityMonitor, rc *RunContext, displayRegion string, results *Results) {
+	switch {
+	case settings.organization:
+		// Which account (and partition) are we running from? It does not need a role
+		// to be assumed.
+		callerAccountID, partitionID := GetAccountIdentity(rc.RequestContext(), serviceFactory.GetAccountIDService(), monitor)
+		if rc.Partition != "" {
+			partitionID = rc.Partition
+		}
+
+		// Get the list of all active member accounts
+		accounts := OrganizationAccounts(rc.RequestContext(), serviceFactory.GetOrganizationService(), monitor)
+
+		// Loop through all of the accounts
+		for _, account := range accounts {
+			// Were we interrupted?
+			if rc.Interrupted() {
+				return
+			}
+
+			monitor.Message("\nAccount %s (%s)\n", account.ID, account.Name)
+
+			// Construct a service factory for this account
+			accountFactory := serviceFactory
+			if account.ID != callerAccountID {
+				accountFactory = serviceFactory.AssumeRole(OrganizationRoleARN(partitionID, account.ID, settings.roleName))
+			}
+
+			// Collect the counts for this account
+			countAccount(accountFactory, monitor, rc, displayRegion, results)
+		}
+	case len(settings.roleARNs) > 0:
+		// Loop through all of the roles
+		for _, roleARN := range settings.roleARNs {
+			// Were we interrupted?
+			if rc.Interrupted() {
+				return
+			}
+
+			monitor.Message("\nRole %s\n", roleARN)
+
+			// Collect the counts for the account of this role
+			countAccount(serviceFactory.AssumeRole(roleARN), monitor, rc, displayRegion, results)
+		}
+	default:
+		// Collect the counts for the account associated with our session
+		countAccount(serviceFactory, monitor, rc, displayRegion, results)
+	}
+}
+
+// accountCounts holds the counts collected for a single account, in column order,
+// along with the regions that were examined.
+type accountCounts struct {
+	AccountID string
+	Timestamp string
+	Regions   []RegionInfo
+	Columns   []string
+	Counts    []CountResult
+}
+
+// countAccount collects the counts of all resources for the account associated
+// with the supplied ServiceFactory and stores them in the results, along with
+// the regions that were scanned and the errors that were recorded while counting
+// them. If counts are broken down by region, a row is stored for each region
+// before the row holding the totals. No row is stored for an account that could
+// not be identified.
+func countAccount(sf ServiceFactory, monitor *TerminalActivityMonitor, rc *RunContext, displayRegion string, results *Results) {
+	// Which errors were recorded before this account?
+	priorErrors := len(monitor.Errors())
+
+	// Collect the counts (unless the account could not be identified)
+	counts := countResources(sf, monitor, rc)
+	if counts == nil {
+		return
+	}
+
+	// How were the counts collected?
+	errs := monitor.Errors()[priorErrors:]
+
+	// Should we store a row for each region?
+	if rc.ByRegion {
+		for _, region := range counts.Regions {
+			regionName := region.Name
+			appendRow(results, counts, regionName, ScopeRegion, func(cr CountResult) CountResult {
+				return cr.ForRegion(regionName)
+			})
+			results.SetRowMetadata([]RegionInfo{region}, errorsForRegion(errs, regionName))
+		}
+	}
+
+	// Were only some of the regions selected? If so, list the regions that were
+	// scanned in place of ALL_REGIONS.
+	if rc.AllRegions && !rc.EveryRegion() {
+		displayRegion = strings.Join(RegionInfoNames(counts.Regions), " ")
+	}
+
+	// Store the totals (marked as such, if there is a breakdown)
+	var scope string
+	if rc.ByRegion {
+		scope = ScopeTotal
+	}
+	appendRow(results, counts, displayRegion, scope, func(cr CountResult) CountResult {
+		return cr
+	})
+	results.SetRowMetadata(counts.Regions, errs)
+}
+
+// countResources collects the counts of all resources for the account associated
+// with the supplied ServiceFactory. If the account cannot be identified (e.g., as
+// its role could not be assumed), an error is recorded and nil is returned.
+func countResources(sf ServiceFactory, am ActivityMonitor, rc *RunContext) *accountCounts {
+	// Identify the account (and its partition, unless it was supplied)
+	accountID, partitionID := GetAccountIdentity(rc.RequestContext(), sf.GetAccountIDService(), am)
+	if accountID == "" {
+		am.RecordError(errors.New("the account could not be identified, so its resources were not counted"))
+		return nil
+	}
+	if rc.Partition != "" {
+		partitionID = rc.Partition
+	}
+	counts := &accountCounts{
+		AccountID: accountID,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	// Resolve the regions of the account once, so that every counter examines the
+	// same regions
+	ctx := &CountContext{ServiceFactory: sf, Monitor: am, Run: rc, AccountID: accountID, Timestamp: counts.Timestamp, Partition: partitionID}
+	ctx.Regions = rc.ResolveRegions(sf, am)
+	counts.Regions = ctx.Regions
+
+	// Collect the count of each selected counter
+	for _, counter := range rc.Counters {
+		counts.add(counter.Column(), RunCounter(counter, ctx))
+	}
+
+	return counts
+}
+
+// add records the count for the supplied column
+func (ac *accountCounts) add(columnName string, count CountResult) {
+	ac.Columns = append(ac.Columns, columnName)
+	ac.Counts = append(ac.Counts, count)
+}
+
+// appendRow stores a new row of results for the supplied account. The scope (if
+// any) tells the rows of a breakdown apart. Each count is passed through the
+// supplied function (e.g., to select the count of a region).
+func appendRow(results *Results, counts *accountCounts, regionName string, scope string, fn func(CountResult) CountResult) {
+	results.NewRow()
+	results.Append(AccountColumns[0], counts.AccountID)
+	results.Append(AccountColumns[1], counts.Timestamp)
+	results.Append(AccountColumns[2], regionName)
+	if scope != "" {
+		results.Append(ScopeColumn, scope)
+	}
+	for ix, columnName := range counts.Columns {
+		results.Append(columnName, fn(counts.Counts[ix]))
+	}
+}
+
+// errorsForRegion returns the errors that affect the supplied region: those that
+// occurred in the region and those that are not associated with any region.
+func errorsForRegion(errs []*CounterError, regionName string) []*CounterError {
+	var regionErrs []*CounterError
+	for _, err := range errs {
+		if err.Region == regionName || err.Region == "" {
+			regionErrs = append(regionErrs, err)
+		}
+	}
+
+	return regionErrs
+}
+
+// reportThrottling lists the retries and throttling errors of each service whose
+// requests were retried or throttled.
+func reportThrottling(throttling *ThrottleControl, am ActivityMonitor) {
+	stats := throttling.Stats()
+	if len(stats) == 0 {
+		return
+	}
+
+	am.Message("\nSome AWS requests were retried (or throttled):\n")
+	for _, serviceStats := range stats {
+		am.Message(" o %s: %d retries, %d throttling errors\n", serviceStats.Service, serviceStats.Retries, serviceStats.Throttles)
+	}
+}
+
+// checkRules checks the counts of the supplied run against the rules of the rules
+// file (if any), measuring growth since the previous runs in the output file. Only
+// the totals of each account are checked (not each region of a breakdown). The
+// rules that were broken are listed and returned.
+func checkRules(settings *CommandLineSettings, run *CountRun, am ActivityMonitor) []RuleViolation {
+	if len(settings.rules) == 0 {
+		return nil
+	}
+
+	rows, err := run.Results.History()
+	if am.CheckError(err) {
+		return nil
+	}
+
+	violations := CheckRules(settings.rules, TotalsRows(rows), settings.previousRuns)
+	ReportViolations(violations, am)
+
+	return violations
+}
+
+// reportInterruption records that the run was interrupted (or timed out) before
+// it completed, so that it ends as incomplete. Accounts that were not reached are
+// missing from the results.
+func reportInterruption(rc *RunContext, settings *CommandLineSettings, am ActivityMonitor) {
+	if rc.RequestContext().Err() == context.DeadlineExceeded {
+		am.Message("\nThe run timed out after %v; saving the partial results.\n", settings.timeout)
+		am.RecordError(fmt.Errorf("the run timed out after %v", settings.timeout))
+	} else {
+		am.Message("\nThe run was interrupted; saving the partial results.\n")
+		am.RecordError(fmt.Errorf("the run was interrupted"))
+	}
 }
@@ -0,0 +1,746 @@
+/******************************************************************************
+Cloud Resource Counter
+File: main_test.go
+
+Summary: End-to-end tests which run the whole tool (as a child process) against
+         a fake AWS server.
+******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/expel-io/aws-resource-counter/fakeaws"
+)
+
+// When this environment variable is set, the test binary runs main() (with the
+// arguments that follow "--") rather than the tests.
+const endToEndEnvVar = "AWS_RESOURCE_COUNTER_E2E"
+
+func TestMain(m *testing.M) {
+	// Are we the child process of an end-to-end test?
+	if os.Getenv(endToEndEnvVar) == "1" {
+		// Keep the arguments that follow "--"
+		for ix, arg := range os.Args {
+			if arg == "--" {
+				os.Args = append([]string{os.Args[0]}, os.Args[ix+1:]...)
+				break
+			}
+		}
+
+		// Run the tool
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// The fixtures served to the end-to-end tests
+var endToEndFixtures = fakeaws.Fixtures{
+	Regions: []fakeaws.Region{
+		{Name: "us-east-1", OptInStatus: "opt-in-not-required"},
+		{Name: "us-west-2", OptInStatus: "opt-in-not-required"},
+		{Name: "ap-east-1", OptInStatus: "not-opted-in"},
+	},
+	Instances: map[string][]fakeaws.Instance{
+		"us-east-1": {
+			{ID: "i-00000001", State: "running"},
+			{ID: "i-00000002", State: "running", Lifecycle: "spot"},
+			{ID: "i-00000003", State: "stopped"},
+			{ID: "i-00000004", State: "running", Tags: map[string]string{"aws:eks:cluster-name": "prod"}},
+		},
+		"us-west-2": {
+			{ID: "i-00000005", State: "running"},
+		},
+		"ap-east-1": {
+			{ID: "i-00000006", State: "running"},
+		},
+	},
+	Volumes: map[string][]fakeaws.Volume{
+		"us-east-1": {
+			{ID: "vol-00000001", State: "in-use", Attached: true},
+			{ID: "vol-00000002", State: "available"},
+		},
+		"us-west-2": {
+			{ID: "vol-00000003", State: "in-use", Attached: true},
+		},
+	},
+	DBInstances: map[string][]fakeaws.DBInstance{
+		"us-east-1": {
+			{ID: "db-1", Status: "available"},
+			{ID: "db-2", Status: "stopped"},
+		},
+	},
+	Functions: map[string][]fakeaws.Function{
+		"us-east-1": {{Name: "alpha"}, {Name: "beta"}},
+		"us-west-2": {{Name: "gamma"}},
+	},
+	TaskDefinitions: map[string][]fakeaws.TaskDefinition{
+		"us-east-1": {
+			{Family: "web", Revision: 1, Images: []string{"nginx:1.25", "envoy:1.28"}},
+			{Family: "web", Revision: 2, Images: []string{"nginx:1.25"}},
+		},
+		"us-west-2": {
+			{Family: "batch", Revision: 1, Images: []string{"nginx:1.25", "worker:3"}},
+		},
+	},
+	Clusters: map[string][]fakeaws.Cluster{
+		"us-east-1": {
+			{Name: "prod", NodeGroups: []fakeaws.NodeGroup{{Name: "general", DesiredSize: 3}, {Name: "gpu", DesiredSize: 2}}},
+		},
+	},
+	LightsailRegions: []string{"us-east-1", "us-west-2"},
+	LightsailInstances: map[string][]fakeaws.LightsailInstance{
+		"us-west-2": {
+			{Name: "blog", State: "running"},
+			{Name: "old-blog", State: "stopped"},
+		},
+	},
+	Buckets: []fakeaws.Bucket{
+		{Name: "logs", Region: "us-east-1"},
+		{Name: "assets", Region: "us-west-2"},
+	},
+}
+
+// The counts expected from the end-to-end fixtures (across all regions)
+var endToEndCounts = map[string]float64{
+	"ec2_instances":                    3,
+	"spot_instances":                   1,
+	"ebs_volumes":                      2,
+	"unique_containers":                3,
+	"lambda_functions":                 3,
+	"rds_instances":                    1,
+	"lightsail_instances":              1,
+	"s3_buckets":                       2,
+	"eks_nodes":                        5,
+	"ec2_k8_related_vms_sub_instances": 1,
+}
+
+// Run the tool (as a child process of the test binary) against the supplied
+// server, writing the results as JSON. The records of the results are returned
+// along with the exit code and the output of the tool.
+func runEndToEnd(t *testing.T, server *fakeaws.Server, args ...string) ([]map[string]interface{}, int, string) {
+	t.Helper()
+
+	return startEndToEnd(t, server, args...).wait(t)
+}
+
+// An end-to-end run of the tool (as a child process of the test binary)
+type endToEndRun struct {
+	cmd            *exec.Cmd
+	output         bytes.Buffer
+	outputFileName string
+}
+
+// Start the tool against the supplied server, writing the results as JSON
+func startEndToEnd(t *testing.T, server *fakeaws.Server, args ...string) *endToEndRun {
+	t.Helper()
+
+	// Where are the results written?
+	tempDir := t.TempDir()
+	run := &endToEndRun{outputFileName: filepath.Join(tempDir, "resources.json")}
+
+	// Is a subcommand (e.g., serve) being run? It must come first.
+	var subcommand []string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		subcommand, args = args[:1], args[1:]
+	}
+
+	// Construct the command (without access to any real AWS credentials)
+	args = append([]string{"--endpoint-url", server.URL, "--s3-path-style", "--format", "json", "--output-file", run.outputFileName}, args...)
+	run.cmd = exec.Command(os.Args[0], append(append([]string{"-test.run=^$", "--"}, subcommand...), args...)...)
+	run.cmd.Env = []string{
+		endToEndEnvVar + "=1",
+		"HOME=" + tempDir,
+		"AWS_ACCESS_KEY_ID=AKIAFAKEAWS",
+		"AWS_SECRET_ACCESS_KEY=fakeaws",
+		"AWS_SHARED_CREDENTIALS_FILE=" + filepath.Join(tempDir, "credentials"),
+		"AWS_CONFIG_FILE=" + filepath.Join(tempDir, "config"),
+		"AWS_EC2_METADATA_DISABLED=true",
+	}
+	run.cmd.Stdout = &run.output
+	run.cmd.Stderr = &run.output
+
+	// Start it
+	if err := run.cmd.Start(); err != nil {
+		t.Fatalf("Unable to run the tool: %v", err)
+	}
+
+	return run
+}
+
+// Wait for the tool to end. The records of the results are returned along with
+// the exit code and the output of the tool.
+func (run *endToEndRun) wait(t *testing.T) ([]map[string]interface{}, int, string) {
+	t.Helper()
+
+	// Wait for it
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if err := run.cmd.Wait(); errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("Unable to run the tool: %v", err)
+	}
+
+	// Read the results (if any were written)
+	var records []map[string]interface{}
+	if contents, err := os.ReadFile(run.outputFileName); err == nil && len(contents) > 0 {
+		if err = json.Unmarshal(contents, &records); err != nil {
+			t.Fatalf("Unable to parse the results: %v\n%s", err, run.output.String())
+		}
+	}
+
+	return records, exitCode, run.output.String()
+}
+
+// Get the counts of a record of the results
+func recordCounts(record map[string]interface{}) map[string]interface{} {
+	counts, _ := record["counts"].(map[string]interface{})
+	return counts
+}
+
+func TestEndToEnd(t *testing.T) {
+	// Start a server with small pages of results
+	fixtures := endToEndFixtures
+	fixtures.PageSize = 1
+	server := fakeaws.NewServer(fixtures)
+	defer server.Close()
+
+	// Count everything
+	records, exitCode, output := runEndToEnd(t, server)
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	} else if len(records) != 1 {
+		t.Fatalf("Expected a single record, found %d:\n%s", len(records), output)
+	}
+
+	// Check the account...
+	record := records[0]
+	if record["account_id"] != fakeaws.DefaultAccountID {
+		t.Errorf("Unexpected account ID: %v", record["account_id"])
+	}
+
+	// ...and the counts
+	counts := recordCounts(record)
+	for key, expected := range endToEndCounts {
+		if counts[key] != expected {
+			t.Errorf("Unexpected %s: expected %v, actual %v", key, expected, counts[key])
+		}
+	}
+
+	// Were the results paginated? (the two volumes of us-east-1 take two pages)
+	if count := server.Count("ec2", "DescribeVolumes"); count != 3 {
+		t.Errorf("Expected 3 pages of volumes, but %d were requested", count)
+	}
+
+	// The running instances of each region were described in a single pass, which
+	// was shared by the EC2, Spot and EC2 K8 counters (the three running instances
+	// of us-east-1 take three pages)
+	if count := server.Count("ec2", "DescribeInstances"); count != 4 {
+		t.Errorf("Expected 4 pages of instances, but %d were requested", count)
+	}
+
+	// The regions were resolved once (and recorded with their opt-in status)
+	if count := server.Count("ec2", "DescribeRegions"); count != 1 {
+		t.Errorf("Expected the regions to be described once, but they were described %d times", count)
+	}
+	if statuses, _ := record["region_opt_in_status"].(map[string]interface{}); len(statuses) != 2 || statuses["us-west-2"] != "opt-in-not-required" {
+		t.Errorf("Unexpected opt-in status of the regions: %v", record["region_opt_in_status"])
+	}
+
+	// Regions which are not opted in are never examined
+	for _, request := range server.Requests() {
+		if request.Region == "ap-east-1" {
+			t.Errorf("Unexpected request to %s in region %s", request.Operation, request.Region)
+		}
+	}
+}
+
+func TestEndToEndAssumeRoles(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Count the resources of two accounts (in a single region)
+	records, exitCode, output := runEndToEnd(t, server,
+		"--region", "us-west-2",
+		"--only", "ec2,lambda",
+		"--assume-roles", "arn:aws:iam::111111111111:role/Counter,arn:aws:iam::222222222222:role/Counter")
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	} else if len(records) != 2 {
+		t.Fatalf("Expected two records, found %d:\n%s", len(records), output)
+	}
+
+	// Is there a record for each account?
+	for ix, accountID := range []string{"111111111111", "222222222222"} {
+		if records[ix]["account_id"] != accountID {
+			t.Errorf("Unexpected account ID of record %d: %v", ix, records[ix]["account_id"])
+		} else if counts := recordCounts(records[ix]); counts["ec2_instances"] != float64(1) || counts["lambda_functions"] != float64(1) {
+			t.Errorf("Unexpected counts of record %d: %v", ix, counts)
+		}
+	}
+
+	// Was each role assumed?
+	if count := server.Count("sts", "AssumeRole"); count != 2 {
+		t.Errorf("Expected 2 roles to be assumed, but %d were", count)
+	}
+}
+
+func TestEndToEndContinueOnError(t *testing.T) {
+	// Deny access to the volumes of a single region
+	fixtures := endToEndFixtures
+	fixtures.Denied = map[string]bool{"ec2:DescribeVolumes@us-west-2": true}
+	server := fakeaws.NewServer(fixtures)
+	defer server.Close()
+
+	// Count the volumes (recording the error)
+	records, exitCode, output := runEndToEnd(t, server, "--only", "ebs", "--continue-on-error")
+	if exitCode != ExitCodeIncomplete {
+		t.Fatalf("Expected exit code %d, not %d:\n%s", ExitCodeIncomplete, exitCode, output)
+	} else if len(records) != 1 {
+		t.Fatalf("Expected a single record, found %d:\n%s", len(records), output)
+	}
+
+	// Only the volumes of us-east-1 were counted
+	if count := recordCounts(records[0])["ebs_volumes"]; count != float64(1) {
+		t.Errorf("Unexpected count of volumes: %v", count)
+	}
+
+	// Without --continue-on-error, the tool fails
+	_, exitCode, output = runEndToEnd(t, server, "--only", "ebs")
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1, not %d:\n%s", exitCode, output)
+	}
+}
+
+func TestEndToEndUnidentifiedAccount(t *testing.T) {
+	// Deny the identity of the caller
+	fixtures := endToEndFixtures
+	fixtures.Denied = map[string]bool{"sts:GetCallerIdentity": true}
+	server := fakeaws.NewServer(fixtures)
+	defer server.Close()
+
+	// The account is neither counted nor written (without an account ID)
+	records, exitCode, output := runEndToEnd(t, server, "--only", "ec2", "--continue-on-error")
+	if exitCode != ExitCodeIncomplete {
+		t.Fatalf("Expected exit code %d, not %d:\n%s", ExitCodeIncomplete, exitCode, output)
+	}
+	if len(records) != 0 || !strings.Contains(output, "the account could not be identified") {
+		t.Errorf("Expected no records for the account, found %d:\n%s", len(records), output)
+	}
+	if count := server.Count("ec2", "DescribeInstances"); count != 0 {
+		t.Errorf("Expected no instances to be described, but %d requests were made", count)
+	}
+}
+
+func TestEndToEndServiceEndpoints(t *testing.T) {
+	// Start a stand-in for AWS that knows of a region unknown to AWS...
+	server := fakeaws.NewServer(fakeaws.Fixtures{
+		Instances: map[string][]fakeaws.Instance{
+			"local-1": {{ID: "i-00000001", State: "running"}, {ID: "i-00000002", State: "running"}},
+		},
+	})
+	defer server.Close()
+
+	// ...and another for S3
+	s3Server := fakeaws.NewServer(fakeaws.Fixtures{Buckets: endToEndFixtures.Buckets})
+	defer s3Server.Close()
+
+	// The region is rejected unless it is not validated
+	_, exitCode, output := runEndToEnd(t, server, "--only", "ec2,s3", "--region", "local-1")
+	if exitCode != 1 || !strings.Contains(output, "local-1") {
+		t.Errorf("Expected the region to be rejected, but got exit code %d:\n%s", exitCode, output)
+	}
+
+	// Count the instances and buckets
+	records, exitCode, output := runEndToEnd(t, server,
+		"--only", "ec2,s3",
+		"--region", "local-1",
+		"--no-region-validation",
+		"--service-endpoints", "s3="+s3Server.URL)
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	} else if len(records) != 1 {
+		t.Fatalf("Expected a single record, found %d:\n%s", len(records), output)
+	}
+	if counts := recordCounts(records[0]); counts["ec2_instances"] != float64(2) || counts["s3_buckets"] != float64(2) {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+
+	// Was each request sent to the right server?
+	if server.Count("s3", "ListBuckets") != 0 || s3Server.Count("s3", "ListBuckets") != 1 {
+		t.Errorf("Expected the buckets to be listed by the S3 server only")
+	} else if s3Server.Count("ec2", "DescribeInstances") != 0 {
+		t.Errorf("Expected the instances to be described by the other server only")
+	}
+}
+
+func TestEndToEndBreakdown(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Count the buckets of each region
+	records, exitCode, output := runEndToEnd(t, server, "--only", "s3", "--breakdown", "region")
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	}
+
+	// Is there a row for each region (with the bucket located there), followed by the totals?
+	expected := []struct {
+		Region string
+		Scope  string
+		Count  float64
+	}{
+		{"us-east-1", ScopeRegion, 1},
+		{"us-west-2", ScopeRegion, 1},
+		{"ALL_REGIONS", ScopeTotal, 2},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, found %d:\n%s", len(expected), len(records), output)
+	}
+	for ix, e := range expected {
+		if records[ix]["region"] != e.Region || records[ix]["scope"] != e.Scope || recordCounts(records[ix])["s3_buckets"] != e.Count {
+			t.Errorf("Unexpected record %d: expected %s (%s) with %v buckets, actual %v", ix, e.Region, e.Scope, e.Count, records[ix])
+		}
+	}
+}
+
+func TestEndToEndRegions(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Count the instances of every region except those of the US West
+	records, exitCode, output := runEndToEnd(t, server, "--only", "ec2,lightsail", "--exclude-regions", "us-west-*")
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	} else if len(records) != 1 {
+		t.Fatalf("Expected a single record, found %d:\n%s", len(records), output)
+	}
+
+	// Does the record list the region that was scanned (with its counts)?
+	if records[0]["region"] != "us-east-1" {
+		t.Errorf("Unexpected region: %v", records[0]["region"])
+	}
+	if counts := recordCounts(records[0]); counts["ec2_instances"] != float64(2) || counts["lightsail_instances"] != float64(0) {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+
+	// The excluded region was never examined
+	for _, request := range server.Requests() {
+		if request.Region == "us-west-2" {
+			t.Errorf("Unexpected request to %s in region %s", request.Operation, request.Region)
+		}
+	}
+}
+
+func TestEndToEndThrottling(t *testing.T) {
+	// Throttle the first requests for the instances of a region
+	fixtures := endToEndFixtures
+	fixtures.Throttled = map[string]int{"ec2:DescribeInstances@us-west-2": 2}
+	server := fakeaws.NewServer(fixtures)
+	defer server.Close()
+
+	// Count the instances (retrying quickly)
+	records, exitCode, output := runEndToEnd(t, server, "--only", "ec2", "--max-backoff", "10ms")
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	} else if len(records) != 1 {
+		t.Fatalf("Expected a single record, found %d:\n%s", len(records), output)
+	}
+
+	// Were the throttled requests retried (and reported)?
+	if count := recordCounts(records[0])["ec2_instances"]; count != float64(3) {
+		t.Errorf("Unexpected count of instances: %v", count)
+	}
+	if !strings.Contains(output, "ec2: 2 retries, 2 throttling errors") {
+		t.Errorf("Expected the retries to be reported:\n%s", output)
+	}
+
+	// Without retries, the run fails
+	fixtures.Throttled = map[string]int{"ec2:DescribeInstances@us-west-2": 1}
+	server = fakeaws.NewServer(fixtures)
+	defer server.Close()
+	_, exitCode, output = runEndToEnd(t, server, "--only", "ec2", "--max-attempts", "1")
+	if exitCode != 1 || !strings.Contains(output, "RequestLimitExceeded") {
+		t.Errorf("Expected the run to fail, but got exit code %d:\n%s", exitCode, output)
+	}
+}
+
+func TestEndToEndTimeouts(t *testing.T) {
+	// The instances of one region take far too long to describe
+	fixtures := endToEndFixtures
+	fixtures.Delayed = map[string]time.Duration{"ec2:DescribeInstances@us-west-2": time.Minute}
+	server := fakeaws.NewServer(fixtures)
+	defer server.Close()
+
+	// Give up on the slow region (without --continue-on-error)
+	records, exitCode, output := runEndToEnd(t, server, "--only", "ec2,lambda", "--region-timeout", "500ms")
+	if exitCode != ExitCodeIncomplete {
+		t.Fatalf("Expected exit code %d, not %d:\n%s", ExitCodeIncomplete, exitCode, output)
+	} else if len(records) != 1 {
+		t.Fatalf("Expected a single record, found %d:\n%s", len(records), output)
+	}
+
+	// Only the instances of us-east-1 were counted (and the count is marked as
+	// incomplete), but the other counters were unaffected
+	counts := recordCounts(records[0])
+	if counts["ec2_instances"] != float64(2) || counts["lambda_functions"] != float64(3) {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	if incomplete, _ := records[0]["incomplete"].([]interface{}); len(incomplete) != 1 || incomplete[0] != "ec2_instances" {
+		t.Errorf("Expected only the count of instances to be incomplete: %v", records[0]["incomplete"])
+	}
+
+	// Stop the whole run when it times out, keeping the partial results
+	records, exitCode, output = runEndToEnd(t, server, "--only", "ec2,lambda", "--timeout", "500ms")
+	if exitCode != ExitCodeIncomplete {
+		t.Fatalf("Expected exit code %d, not %d:\n%s", ExitCodeIncomplete, exitCode, output)
+	} else if len(records) != 1 || !strings.Contains(output, "timed out") {
+		t.Fatalf("Expected a single (partial) record, found %d:\n%s", len(records), output)
+	}
+	if incomplete, _ := records[0]["incomplete"].([]interface{}); len(incomplete) != 2 {
+		t.Errorf("Expected both counts to be incomplete: %v", records[0]["incomplete"])
+	}
+}
+
+func TestEndToEndInterrupt(t *testing.T) {
+	// The instances of one region take far too long to describe
+	fixtures := endToEndFixtures
+	fixtures.Delayed = map[string]time.Duration{"ec2:DescribeInstances@us-west-2": time.Minute}
+	server := fakeaws.NewServer(fixtures)
+	defer server.Close()
+
+	// Interrupt the tool while it waits for the slow region
+	run := startEndToEnd(t, server, "--only", "ec2,lambda")
+	for deadline := time.Now().Add(10 * time.Second); server.Count("ec2", "DescribeInstances") < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			run.cmd.Process.Kill()
+			t.Fatalf("The tool never described the instances:\n%s", run.output.String())
+		}
+	}
+	if err := run.cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("Unable to interrupt the tool: %v", err)
+	}
+
+	// The partial results were saved (and marked as incomplete)
+	records, exitCode, output := run.wait(t)
+	if exitCode != ExitCodeIncomplete {
+		t.Fatalf("Expected exit code %d, not %d:\n%s", ExitCodeIncomplete, exitCode, output)
+	} else if len(records) != 1 || !strings.Contains(output, "interrupted") {
+		t.Fatalf("Expected a single (partial) record, found %d:\n%s", len(records), output)
+	}
+	if incomplete, _ := records[0]["incomplete"].([]interface{}); len(incomplete) != 2 {
+		t.Errorf("Expected both counts to be incomplete: %v", records[0]["incomplete"])
+	}
+}
+
+func TestEndToEndRules(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Write the rules, along with a previous run (with fewer instances)
+	tempDir := t.TempDir()
+	rulesFileName := filepath.Join(tempDir, "rules.yaml")
+	rules := "rules:\n  - lightsail == 0\n  - ec2 growth < 100%\n  - '\"# of S3 Buckets\" <= 10'\n"
+	if err := os.WriteFile(rulesFileName, []byte(rules), 0644); err != nil {
+		t.Fatalf("Unable to write the rules: %v", err)
+	}
+	previousFileName := filepath.Join(tempDir, "previous.ndjson")
+	previous := `{"account_id": "` + fakeaws.DefaultAccountID + `", "timestamp": "2024-05-01T12:00:00Z", "region": "ALL_REGIONS", "counts": {"ec2_instances": 1}}` + "\n"
+	if err := os.WriteFile(previousFileName, []byte(previous), 0644); err != nil {
+		t.Fatalf("Unable to write the previous run: %v", err)
+	}
+
+	// The rules that are kept do not change the exit code
+	_, exitCode, output := runEndToEnd(t, server, "--only", "s3", "--rules", rulesFileName)
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	}
+
+	// Count the instances (and compare them with the previous run)
+	_, exitCode, output = runEndToEnd(t, server, "--only", "ec2,lightsail,s3", "--rules", rulesFileName,
+		"--format", "ndjson", "--output-file", previousFileName)
+	if exitCode != ExitCodeViolations {
+		t.Fatalf("Expected exit code %d, not %d:\n%s", ExitCodeViolations, exitCode, output)
+	}
+	for _, expected := range []string{"lightsail_instances is 1, breaking rule lightsail == 0", "ec2_instances grew from 1 to 3 (+200.0%)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected the output to contain %q:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "s3_buckets") {
+		t.Errorf("Unexpected violation of the S3 rule:\n%s", output)
+	}
+}
+
+func TestEndToEndPrometheus(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Write the counts to a textfile
+	textfile := filepath.Join(t.TempDir(), "counts.prom")
+	_, exitCode, output := runEndToEnd(t, server, "--only", "ec2,lambda", "--prometheus-textfile", textfile)
+	if exitCode != 0 {
+		t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+	}
+	contents, err := os.ReadFile(textfile)
+	if err != nil {
+		t.Fatalf("Unable to read the textfile: %v", err)
+	}
+	for _, expected := range []string{
+		`aws_resource_counter_resources{account_id="` + fakeaws.DefaultAccountID + `",region="ALL_REGIONS",resource="ec2_instances"} 3`,
+		`aws_resource_counter_resources{account_id="` + fakeaws.DefaultAccountID + `",region="ALL_REGIONS",resource="lambda_functions"} 3`,
+		`aws_resource_counter_errors{service="Lambda"} 0`,
+		"aws_resource_counter_scrape_duration_seconds ",
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected the textfile to contain %q:\n%s", expected, contents)
+		}
+	}
+}
+
+func TestEndToEndServe(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find a free port: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	// Serve the metrics (appending each run to an NDJSON file)
+	run := startEndToEnd(t, server, "serve", "--listen", address, "--interval", "1h", "--only", "s3",
+		"--format", "ndjson", "--output-file", filepath.Join(t.TempDir(), "resources.ndjson"))
+
+	// Wait for the first run to be served
+	var metrics string
+	for deadline := time.Now().Add(10 * time.Second); !strings.Contains(metrics, "aws_resource_counter_resources{"); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			run.cmd.Process.Kill()
+			t.Fatalf("The metrics were never served:\n%s", run.output.String())
+		}
+		if response, err := http.Get("http://" + address + "/metrics"); err == nil {
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			metrics = string(body)
+		}
+	}
+	if expected := `resource="s3_buckets"} 2`; !strings.Contains(metrics, expected) {
+		t.Errorf("Expected the metrics to contain %q:\n%s", expected, metrics)
+	}
+
+	// Stop the server
+	if err := run.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("Unable to stop the server: %v", err)
+	}
+	_, exitCode, output := run.wait(t)
+	if exitCode != 0 || !strings.Contains(output, "Stopped.") {
+		t.Errorf("Expected the server to stop cleanly, but got exit code %d:\n%s", exitCode, output)
+	}
+}
+
+func TestEndToEndDaemon(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Count on a short schedule (appending each run to an NDJSON file of the day
+	// and to an inventory)
+	tempDir := t.TempDir()
+	outputFileName := filepath.Join(tempDir, "resources.ndjson")
+	inventoryFileName := filepath.Join(tempDir, "inventory.csv")
+	run := startEndToEnd(t, server, "daemon", "--schedule", "@every 100ms", "--rotate", "daily", "--only", "s3",
+		"--format", "ndjson", "--output-file", outputFileName, "--inventory", inventoryFileName)
+
+	// Wait for two runs to be written (with the same sessions)
+	rotatedFileName := RotatedFileName(outputFileName, RotateDaily, time.Now())
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if contents, err := os.ReadFile(rotatedFileName); err == nil && strings.Count(string(contents), "\n") >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			run.cmd.Process.Kill()
+			t.Fatalf("Two runs were never written to %s:\n%s", rotatedFileName, run.output.String())
+		}
+	}
+
+	// Stop the daemon
+	if err := run.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("Unable to stop the daemon: %v", err)
+	}
+	_, exitCode, output := run.wait(t)
+	if exitCode != 0 || !strings.Contains(output, "Stopped.") {
+		t.Errorf("Expected the daemon to stop cleanly, but got exit code %d:\n%s", exitCode, output)
+	}
+
+	// The inventory holds the buckets of every run, under a single header
+	contents, err := os.ReadFile(inventoryFileName)
+	if err != nil {
+		t.Fatalf("Unable to read the inventory: %v", err)
+	}
+	if header := strings.Join(InventoryColumns, ","); strings.Count(string(contents), header) != 1 || strings.Count(string(contents), ",S3,") < 4 {
+		t.Errorf("Expected the inventory to hold two runs under a single header:\n%s", contents)
+	}
+
+	// Each item has the timestamp of the row of results of its run
+	results, err := os.ReadFile(rotatedFileName)
+	if err != nil {
+		t.Fatalf("Unable to read the results: %v", err)
+	}
+	items, err := csv.NewReader(bytes.NewReader(contents)).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to parse the inventory: %v", err)
+	}
+	for _, item := range items[1:] {
+		if item[1] == "" || !strings.Contains(string(results), `"timestamp":"`+item[1]+`"`) {
+			t.Errorf("Expected the timestamp of %v to be that of a row of results:\n%s", item, results)
+		}
+	}
+}
+
+func TestEndToEndStore(t *testing.T) {
+	server := fakeaws.NewServer(endToEndFixtures)
+	defer server.Close()
+
+	// Save two runs to a store
+	spec := "sqlite:" + filepath.Join(t.TempDir(), "resources.db")
+	for ix := 0; ix < 2; ix++ {
+		if _, exitCode, output := runEndToEnd(t, server, "--only", "ec2,s3", "--store", spec); exitCode != 0 {
+			t.Fatalf("Unexpected exit code %d:\n%s", exitCode, output)
+		}
+	}
+
+	// Were both runs saved (with the latest counts)?
+	store, err := OpenStore(spec)
+	if err != nil {
+		t.Fatalf("Unable to open %s: %v", spec, err)
+	}
+	defer store.Close()
+	var runs int
+	if err = store.db.QueryRow("SELECT COUNT(*) FROM runs").Scan(&runs); err != nil || runs != 2 {
+		t.Errorf("Expected two runs in the store, found %d (%v)", runs, err)
+	}
+	counts, err := store.LatestCounts("", "")
+	expected := fakeaws.DefaultAccountID + "/ALL_REGIONS/ec2_instances=3 " + fakeaws.DefaultAccountID + "/ALL_REGIONS/s3_buckets=2"
+	if actual := storedCountsString(counts); err != nil || actual != expected {
+		t.Errorf("Unexpected counts in the store (%v):\nexpected %s\nactual   %s", err, expected, actual)
+	}
+}
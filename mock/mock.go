@@ -9,11 +9,12 @@ package mock
 
 import (
 	"fmt"
+	"sync"
 )
 
 // ActivityMonitorImpl is a mock of the ActionMonitor interface.
 // It essentially records which activity has taken place (started,
-// errored, ended).
+// errored, ended). It is safe to use from multiple goroutines.
 //
 type ActivityMonitorImpl struct {
 	ActionStarted bool
@@ -23,15 +24,23 @@ type ActivityMonitorImpl struct {
 	ProgramExited bool
 	ExitCode      int
 	Messages      []string
+
+	mu sync.Mutex
 }
 
 // Message does nothing
 func (m *ActivityMonitorImpl) Message(format string, v ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Messages = append(m.Messages, fmt.Sprintf(format, v...))
 }
 
 // StartAction records that an action was started.
 func (m *ActivityMonitorImpl) StartAction(format string, v ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Messages = append(m.Messages, fmt.Sprintf(format, v...))
 	m.ActionStarted = true
 }
@@ -41,10 +50,12 @@ func (m *ActivityMonitorImpl) CheckError(err error) bool {
 	// Did we encounter an error?
 	if err != nil {
 		// Record the error message
+		m.mu.Lock()
 		m.ErrorMessage = err.Error()
+		m.mu.Unlock()
 
 		// Redirect to the ActionError method
-		m.ActionError("Error: %s", m.ErrorMessage)
+		m.ActionError("Error: %s", err.Error())
 
 		return true
 	}
@@ -52,26 +63,48 @@ func (m *ActivityMonitorImpl) CheckError(err error) bool {
 	return false
 }
 
+// RecordError records an error without exiting.
+func (m *ActivityMonitorImpl) RecordError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Messages = append(m.Messages, err.Error())
+	m.ErrorMessage = err.Error()
+	m.ErrorOccured = true
+}
+
 // ActionError is what what would be called if we encounter an error.
 func (m *ActivityMonitorImpl) ActionError(format string, v ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Messages = append(m.Messages, fmt.Sprintf(format, v...))
 	m.ErrorOccured = true
 }
 
 // SubResourceError is called if we encounter an error in EKS.
 func (m *ActivityMonitorImpl) SubResourceError(format string, v ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Messages = append(m.Messages, fmt.Sprintf(format, v...))
 	m.ErrorOccured = true
 }
 
 // EndAction records that an action was ended.
 func (m *ActivityMonitorImpl) EndAction(format string, v ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Messages = append(m.Messages, fmt.Sprintf(format, v...))
 	m.ActionEnded = true
 }
 
 // Exit records that the program wishes to exit
 func (m *ActivityMonitorImpl) Exit(resultStatus int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.ProgramExited = true
 	m.ExitCode = resultStatus
 }
@@ -0,0 +1,79 @@
+/******************************************************************************
+Cloud Resource Counter
+File: organization.go
+
+Summary: Retrieve the list of member accounts of an AWS Organization.
+******************************************************************************/
+
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	color "github.com/logrusorgru/aurora"
+)
+
+// DefaultOrganizationRoleName is the name of the role that AWS Organizations
+// creates in every member account that it creates.
+const DefaultOrganizationRoleName = "OrganizationAccountAccessRole"
+
+// OrganizationAccount describes a single member account of an AWS Organization.
+type OrganizationAccount struct {
+	ID   string
+	Name string
+}
+
+// OrganizationAccounts returns the list of ACTIVE member accounts of the AWS
+// Organization associated with the supplied OrganizationService. Suspended
+// accounts (and those being closed) are skipped. This method gives status back
+// to the user via the supplied ActivityMonitor instance.
+func OrganizationAccounts(ctx aws.Context, ors *OrganizationService, am ActivityMonitor) []OrganizationAccount {
+	// Indicate activity
+	am.StartAction("Retrieving Organization accounts")
+
+	// Construct our input to find all accounts
+	input := &organizations.ListAccountsInput{}
+
+	// Invoke our service
+	var accounts []OrganizationAccount
+	err := ors.ListAccounts(ctx, input, func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+		// Loop through each account
+		for _, account := range page.Accounts {
+			// Is the account active?
+			if account.Status != nil && *account.Status == organizations.AccountStatusActive {
+				accounts = append(accounts, OrganizationAccount{
+					ID:   *account.Id,
+					Name: *account.Name,
+				})
+			}
+		}
+
+		return true
+	})
+
+	// Check for error
+	if am.CheckError(err) {
+		return nil
+	}
+
+	// Indicate end of activity
+	am.EndAction("OK (%d)", color.Bold(len(accounts)))
+
+	return accounts
+}
+
+// OrganizationRoleARN constructs the ARN of the named role in the supplied
+// member account (of the supplied partition).
+func OrganizationRoleARN(partitionID string, accountID string, roleName string) string {
+	return PartitionARN(partitionID, "iam", "", accountID, "role/"+roleName)
+}
+
+// IsValidRoleARN returns whether the supplied string is the ARN of an IAM role.
+func IsValidRoleARN(roleARN string) bool {
+	parsed, err := arn.Parse(roleARN)
+
+	return err == nil && parsed.Service == "iam" && parsed.AccountID != "" && strings.HasPrefix(parsed.Resource, "role/")
+}
@@ -0,0 +1,181 @@
+/******************************************************************************
+Cloud Resource Counter
+File: organization_test.go
+
+Summary: The Unit Test for organization.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Fake Organization Data
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// Two pages of accounts: 3 ACTIVE, 1 SUSPENDED and 1 PENDING_CLOSURE
+var fakeOrganizationAccounts = []*organizations.ListAccountsOutput{
+	{
+		Accounts: []*organizations.Account{
+			{
+				Id:     aws.String("111111111111"),
+				Name:   aws.String("management"),
+				Status: aws.String("ACTIVE"),
+			},
+			{
+				Id:     aws.String("222222222222"),
+				Name:   aws.String("production"),
+				Status: aws.String("ACTIVE"),
+			},
+			{
+				Id:     aws.String("333333333333"),
+				Name:   aws.String("retired"),
+				Status: aws.String("SUSPENDED"),
+			},
+		},
+	},
+	{
+		Accounts: []*organizations.Account{
+			{
+				Id:     aws.String("444444444444"),
+				Name:   aws.String("sandbox"),
+				Status: aws.String("ACTIVE"),
+			},
+			{
+				Id:     aws.String("555555555555"),
+				Name:   aws.String("closing"),
+				Status: aws.String("PENDING_CLOSURE"),
+			},
+		},
+	},
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Fake Organizations Service
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+// To use this struct, the caller must supply a ListAccountsOutput slice. If it
+// is missing, it will trigger the mock function to simulate an error.
+type fakeOrganizationsService struct {
+	organizationsiface.OrganizationsAPI
+	LAResponse []*organizations.ListAccountsOutput
+}
+
+// Simulate the ListAccountsPagesWithContext function
+func (fake *fakeOrganizationsService) ListAccountsPagesWithContext(ctx aws.Context, input *organizations.ListAccountsInput,
+	fn func(*organizations.ListAccountsOutput, bool) bool, _ ...request.Option) error {
+	// If the supplied response is nil, then simulate an error
+	if fake.LAResponse == nil {
+		return errors.New("ListAccountsPages encountered an unexpected error: 4567")
+	}
+
+	// Loop through the slice, invoking the supplied function
+	for index, output := range fake.LAResponse {
+		// Are we looking at the last "page" of our output?
+		lastPage := index == len(fake.LAResponse)-1
+
+		// Shall we exit our loop?
+		if cont := fn(output, lastPage); !cont {
+			break
+		}
+	}
+
+	return nil
+}
+
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+// Unit Test for OrganizationAccounts
+// =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
+
+func TestOrganizationAccounts(t *testing.T) {
+	// Describe all of our test cases: 1 failure and 1 success
+	cases := []struct {
+		LAResponse  []*organizations.ListAccountsOutput
+		ExpectedIDs []string
+		ExpectError bool
+	}{
+		{
+			LAResponse:  fakeOrganizationAccounts,
+			ExpectedIDs: []string{"111111111111", "222222222222", "444444444444"},
+		}, {
+			ExpectError: true,
+		},
+	}
+
+	// Loop through each test case
+	for _, c := range cases {
+		// Create an OrganizationService with a fake client
+		svc := &OrganizationService{
+			Client: &fakeOrganizationsService{
+				LAResponse: c.LAResponse,
+			},
+		}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Get the list of accounts
+		accounts := OrganizationAccounts(context.Background(), svc, mon)
+
+		// Did we expect an error?
+		if c.ExpectError {
+			// Did it fail to arrive?
+			if !mon.ErrorOccured {
+				t.Error("Expected an error to occur, but it did not... :^(")
+			}
+		} else if mon.ErrorOccured {
+			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+		} else if len(accounts) != len(c.ExpectedIDs) {
+			t.Errorf("Error: OrganizationAccounts returned %d accounts; expected %d", len(accounts), len(c.ExpectedIDs))
+		} else {
+			// Do the account IDs match?
+			for ix, account := range accounts {
+				if account.ID != c.ExpectedIDs[ix] {
+					t.Errorf("Unexpected account ID at %d: expected %s, actual %s", ix, c.ExpectedIDs[ix], account.ID)
+				}
+			}
+		}
+	}
+}
+
+func TestOrganizationRoleARN(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		PartitionID string
+		Expected    string
+	}{
+		{
+			PartitionID: PartitionAWS,
+			Expected:    "arn:aws:iam::222222222222:role/OrganizationAccountAccessRole",
+		},
+		{
+			Expected: "arn:aws:iam::222222222222:role/OrganizationAccountAccessRole",
+		},
+		{
+			PartitionID: PartitionGovCloud,
+			Expected:    "arn:aws-us-gov:iam::222222222222:role/OrganizationAccountAccessRole",
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Construct the role ARN
+		actual := OrganizationRoleARN(c.PartitionID, "222222222222", DefaultOrganizationRoleName)
+
+		// Does it match?
+		if actual != c.Expected {
+			t.Errorf("Unexpected role ARN: expected %s, actual %s", c.Expected, actual)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/******************************************************************************
+Cloud Resource Counter
+File: partition.go
+
+Summary: Support for the AWS partitions (commercial, GovCloud and China): their
+         regions, their bootstrap regions and the services available in each.
+******************************************************************************/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// The supported partitions
+const (
+	PartitionAWS      = "aws"
+	PartitionGovCloud = "aws-us-gov"
+	PartitionChina    = "aws-cn"
+)
+
+// Partitions are the IDs of the supported partitions (as used by --partition).
+var Partitions = []string{PartitionAWS, PartitionGovCloud, PartitionChina}
+
+// The region of each partition used to make the first calls of a session, when
+// no region is supplied by the user (or the profile)
+var bootstrapRegions = map[string]string{
+	PartitionAWS:      DefaultRegion,
+	PartitionGovCloud: "us-gov-west-1",
+	PartitionChina:    "cn-north-1",
+}
+
+// BootstrapRegion returns the region used to make the first calls of a session
+// in the supplied partition. An empty (or unknown) partition is treated as the
+// commercial partition.
+func BootstrapRegion(partitionID string) string {
+	if regionName, ok := bootstrapRegions[partitionID]; ok {
+		return regionName
+	}
+
+	return DefaultRegion
+}
+
+// Get the endpoint model of the supplied (supported) partition
+func lookupPartition(partitionID string) (endpoints.Partition, bool) {
+	for _, partition := range endpoints.DefaultPartitions() {
+		if partition.ID() == partitionID && Contains(Partitions, partitionID) {
+			return partition, true
+		}
+	}
+
+	return endpoints.Partition{}, false
+}
+
+// IsValidRegionName returns whether the supplied region name is a region of the
+// supplied partition or, if the partition is empty, of any supported partition.
+func IsValidRegionName(partitionID string, regionName string) bool {
+	// Which partitions should we look in?
+	partitionIDs := Partitions
+	if partitionID != "" {
+		partitionIDs = []string{partitionID}
+	}
+
+	// Loop through the partitions...
+	for _, id := range partitionIDs {
+		partition, ok := lookupPartition(id)
+		if !ok {
+			continue
+		}
+
+		// Does the region belong to it?
+		if _, ok := partition.Regions()[regionName]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PartitionOfRegion returns the ID of the supported partition that holds the
+// supplied region (or an empty string if it is unknown).
+func PartitionOfRegion(regionName string) string {
+	for _, partitionID := range Partitions {
+		if IsValidRegionName(partitionID, regionName) {
+			return partitionID
+		}
+	}
+
+	return ""
+}
+
+// PartitionOfARN returns the partition of the supplied ARN (e.g., the ARN of the
+// caller's identity).
+func PartitionOfARN(resourceARN string) (string, error) {
+	parsed, err := arn.Parse(resourceARN)
+	if err != nil {
+		return "", err
+	}
+
+	return parsed.Partition, nil
+}
+
+// IsServiceAvailable returns whether the supplied service (e.g., "lightsail") is
+// available in the supplied partition. Every service is assumed to be available
+// in an empty (or unknown) partition.
+func IsServiceAvailable(partitionID string, serviceID string) bool {
+	partition, ok := lookupPartition(partitionID)
+	if !ok {
+		return true
+	}
+
+	_, ok = partition.Services()[serviceID]
+
+	return ok
+}
+
+// PartitionARN constructs an ARN in the supplied partition (or the commercial
+// partition, if it is empty).
+func PartitionARN(partitionID string, service string, region string, accountID string, resource string) string {
+	if partitionID == "" {
+		partitionID = PartitionAWS
+	}
+
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s", partitionID, service, region, accountID, resource)
+}
@@ -0,0 +1,111 @@
+/******************************************************************************
+Cloud Resource Counter
+File: partition_test.go
+
+Summary: The Unit Test for partition.
+******************************************************************************/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestIsValidRegionName(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		PartitionID string
+		RegionName  string
+		Expected    bool
+	}{
+		{RegionName: "us-east-1", Expected: true},
+		{RegionName: "us-gov-west-1", Expected: true},
+		{RegionName: "cn-northwest-1", Expected: true},
+		{RegionName: "abc-def"},
+		{PartitionID: PartitionAWS, RegionName: "eu-west-1", Expected: true},
+		{PartitionID: PartitionAWS, RegionName: "us-gov-east-1"},
+		{PartitionID: PartitionGovCloud, RegionName: "us-gov-east-1", Expected: true},
+		{PartitionID: PartitionGovCloud, RegionName: "us-east-1"},
+		{PartitionID: PartitionChina, RegionName: "cn-north-1", Expected: true},
+		{PartitionID: "aws-iso", RegionName: "us-iso-east-1"},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		if actual := IsValidRegionName(c.PartitionID, c.RegionName); actual != c.Expected {
+			t.Errorf("Unexpected validity of %s in partition '%s': expected %v, actual %v", c.RegionName, c.PartitionID, c.Expected, actual)
+		}
+	}
+}
+
+func TestPartitionOfRegion(t *testing.T) {
+	// Construct our test cases...
+	cases := map[string]string{
+		"us-west-2":     PartitionAWS,
+		"us-gov-west-1": PartitionGovCloud,
+		"cn-north-1":    PartitionChina,
+		"local-1":       "",
+	}
+
+	// Loop through the cases...
+	for regionName, expected := range cases {
+		// Is the partition (and its bootstrap region) as expected?
+		if actual := PartitionOfRegion(regionName); actual != expected {
+			t.Errorf("Unexpected partition of %s: expected '%s', actual '%s'", regionName, expected, actual)
+		} else if expected != "" && PartitionOfRegion(BootstrapRegion(expected)) != expected {
+			t.Errorf("The bootstrap region of %s (%s) is in another partition", expected, BootstrapRegion(expected))
+		}
+	}
+
+	// An unknown partition is bootstrapped in the default region
+	if actual := BootstrapRegion(""); actual != DefaultRegion {
+		t.Errorf("Unexpected bootstrap region: expected %s, actual %s", DefaultRegion, actual)
+	}
+}
+
+func TestPartitionOfARN(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		ARN         string
+		Expected    string
+		ExpectError bool
+	}{
+		{ARN: "arn:aws:iam::123456789012:user/counter", Expected: PartitionAWS},
+		{ARN: "arn:aws-us-gov:sts::123456789012:assumed-role/Counter/session", Expected: PartitionGovCloud},
+		{ARN: "arn:aws-cn:iam::123456789012:root", Expected: PartitionChina},
+		{ARN: "not-an-arn", ExpectError: true},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		actual, err := PartitionOfARN(c.ARN)
+		if c.ExpectError != (err != nil) {
+			t.Errorf("Unexpected error for %s: %v", c.ARN, err)
+		} else if actual != c.Expected {
+			t.Errorf("Unexpected partition of %s: expected '%s', actual '%s'", c.ARN, c.Expected, actual)
+		}
+	}
+}
+
+func TestIsServiceAvailable(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		PartitionID string
+		ServiceID   string
+		Expected    bool
+	}{
+		{PartitionID: PartitionAWS, ServiceID: "lightsail", Expected: true},
+		{PartitionID: PartitionGovCloud, ServiceID: "lightsail"},
+		{PartitionID: PartitionChina, ServiceID: "lightsail"},
+		{PartitionID: PartitionGovCloud, ServiceID: "eks", Expected: true},
+		{PartitionID: PartitionChina, ServiceID: "s3", Expected: true},
+		{ServiceID: "lightsail", Expected: true},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		if actual := IsServiceAvailable(c.PartitionID, c.ServiceID); actual != c.Expected {
+			t.Errorf("Unexpected availability of %s in partition '%s': expected %v, actual %v", c.ServiceID, c.PartitionID, c.Expected, actual)
+		}
+	}
+}
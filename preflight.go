@@ -0,0 +1,349 @@
+/******************************************************************************
+Cloud Resource Counter
+File: preflight.go
+
+Summary: Checks that the caller is allowed to call every action needed by the
+         selected counters (--preflight), before any counting starts.
+******************************************************************************/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lightsail"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/s3"
+	color "github.com/logrusorgru/aurora"
+)
+
+// The results of checking a single action
+const (
+	PreflightPass    = "PASS"
+	PreflightFail    = "FAIL"
+	PreflightUnknown = "UNKNOWN"
+)
+
+// The methods used to check an action
+const (
+	PreflightSimulation = "simulation"
+	PreflightProbe      = "probe"
+)
+
+// PreflightCheck is the result of checking whether the caller is allowed to
+// call a single action.
+type PreflightCheck struct {
+	Action string
+	Result string
+	Method string
+	Detail string
+}
+
+// Error codes which indicate that the caller is not allowed to call an action
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"AuthorizationError":    true,
+	"UnauthorizedOperation": true,
+}
+
+// Error codes which indicate that the caller was allowed to call an action, even
+// though the call itself did not succeed (e.g., an EC2 "dry run" or a probe for a
+// resource that does not exist)
+var allowedCodes = map[string]bool{
+	"ClientException":           true,
+	"DryRunOperation":           true,
+	"NotFoundException":         true,
+	"ResourceNotFoundException": true,
+}
+
+// The name of the (non-existent) resource used by probes that need one
+const probeResourceName = "cloud-resource-counter-preflight"
+
+// The action that identifies the caller (which every caller is allowed to call)
+const callerIdentityAction = "sts:GetCallerIdentity"
+
+// actionProbes holds a cheap call for each action that can be probed. Each probe
+// is invoked with the context of its request and the name of a region. The
+// actions that cannot be probed without knowing the name of an existing resource
+// are missing (and reported as UNKNOWN).
+var actionProbes = map[string]func(ctx aws.Context, sf ServiceFactory, regionName string) error{
+	"ec2:DescribeRegions": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		_, err := sf.GetEC2InstanceService(regionName).GetRegions(ctx, &ec2.DescribeRegionsInput{DryRun: aws.Bool(true)})
+		return err
+	},
+	"ec2:DescribeInstances": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetEC2InstanceService(regionName).InspectInstances(ctx, &ec2.DescribeInstancesInput{DryRun: aws.Bool(true)},
+			func(*ec2.DescribeInstancesOutput, bool) bool { return false })
+	},
+	"ec2:DescribeVolumes": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetEC2InstanceService(regionName).InspectVolumes(ctx, &ec2.DescribeVolumesInput{DryRun: aws.Bool(true)},
+			func(*ec2.DescribeVolumesOutput, bool) bool { return false })
+	},
+	"ecs:ListTaskDefinitions": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetContainerService(regionName).ListTaskDefinitions(ctx, &ecs.ListTaskDefinitionsInput{MaxResults: aws.Int64(1)},
+			func(*ecs.ListTaskDefinitionsOutput, bool) bool { return false })
+	},
+	"ecs:DescribeTaskDefinition": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		_, err := sf.GetContainerService(regionName).InspectTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(probeResourceName),
+		})
+		return err
+	},
+	"eks:ListClusters": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetEKSService(regionName).ListClusters(ctx, &eks.ListClustersInput{MaxResults: aws.Int64(1)},
+			func(*eks.ListClustersOutput, bool) bool { return false })
+	},
+	"eks:ListNodegroups": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetEKSService(regionName).ListNodeGroups(ctx, &eks.ListNodegroupsInput{ClusterName: aws.String(probeResourceName)},
+			func(*eks.ListNodegroupsOutput, bool) bool { return false })
+	},
+	"eks:DescribeNodegroup": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		_, err := sf.GetEKSService(regionName).DescribeNodegroups(ctx, &eks.DescribeNodegroupInput{
+			ClusterName:   aws.String(probeResourceName),
+			NodegroupName: aws.String(probeResourceName),
+		})
+		return err
+	},
+	"lambda:ListFunctions": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetLambdaService(regionName).ListFunctions(ctx, &lambda.ListFunctionsInput{MaxItems: aws.Int64(1)},
+			func(*lambda.ListFunctionsOutput, bool) bool { return false })
+	},
+	"lightsail:GetRegions": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		_, err := sf.GetLightsailService(regionName).GetRegions(ctx, &lightsail.GetRegionsInput{})
+		return err
+	},
+	"lightsail:GetInstances": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		_, err := sf.GetLightsailService(regionName).InspectInstances(ctx, &lightsail.GetInstancesInput{})
+		return err
+	},
+	"rds:DescribeDBInstances": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		return sf.GetRDSInstanceService(regionName).InspectInstances(ctx, &rds.DescribeDBInstancesInput{MaxRecords: aws.Int64(20)},
+			func(*rds.DescribeDBInstancesOutput, bool) bool { return false })
+	},
+	"s3:ListAllMyBuckets": func(ctx aws.Context, sf ServiceFactory, regionName string) error {
+		_, err := sf.GetS3Service().ListBuckets(ctx, &s3.ListBucketsInput{})
+		return err
+	},
+}
+
+// Preflight checks whether the caller of the supplied context's ServiceFactory is
+// allowed to call every action needed by the counters of the run. The caller is
+// identified via its AccountIDService and the actions are checked by simulating
+// the caller's policies. If the simulation is not possible (e.g., the caller is
+// not allowed to call iam:SimulatePrincipalPolicy), each action is instead checked
+// by a cheap probe call to its service. The result of each check is displayed as
+// a table via the ActivityMonitor of the supplied context. If the caller cannot
+// be identified, no action is checked and a single failed check is returned.
+func Preflight(ctx *CountContext) []PreflightCheck {
+	am := ctx.Monitor
+
+	// Who is the caller?
+	am.StartAction("Retrieving caller identity")
+	callerARN, err := ctx.ServiceFactory.GetAccountIDService().CallerARN(ctx.RequestContext())
+	if am.CheckError(err) {
+		return []PreflightCheck{{Action: callerIdentityAction, Result: PreflightFail, Detail: errorSummary(err)}}
+	}
+	am.EndAction("OK (%s)", color.Bold(callerARN))
+
+	// Which partition is the caller in (unless it was supplied)?
+	partitionID := ctx.Partition
+	if partitionID == "" {
+		partitionID, _ = PartitionOfARN(callerARN)
+	}
+
+	// Which actions are needed? Counters whose service is not available in the
+	// partition are skipped, so their actions are not needed.
+	actions := IAMActions(AvailableCounters(ctx.Run.Counters, partitionID), ctx.Run.ByRegion)
+
+	// Simulate the caller's policies
+	am.StartAction("Simulating %d actions", len(actions))
+	checks, err := simulateActions(ctx.RequestContext(), ctx.ServiceFactory.GetIAMService(), callerARN, actions)
+	if err == nil {
+		am.EndAction("OK")
+	} else {
+		// Fall back to probing each service
+		am.EndAction("UNAVAILABLE (%s)", errorSummary(err))
+		am.StartAction("Probing %d actions", len(actions))
+		checks = probeActions(ctx.RequestContext(), ctx.ServiceFactory, ctx.ServiceFactory.GetCurrentRegion(), actions)
+		am.EndAction("OK")
+	}
+
+	// Show the results
+	displayChecks(am, checks)
+
+	return checks
+}
+
+// FailedChecks returns the checks that did not pass.
+func FailedChecks(checks []PreflightCheck) []PreflightCheck {
+	var failed []PreflightCheck
+	for _, check := range checks {
+		if check.Result == PreflightFail {
+			failed = append(failed, check)
+		}
+	}
+
+	return failed
+}
+
+// PrincipalARN returns the ARN of the IAM principal whose policies apply to the
+// supplied caller ARN (as returned by GetCallerIdentity). The ARN of an assumed
+// role session is converted into the ARN of its role. An error is returned for
+// callers whose policies cannot be simulated (e.g., the root user).
+func PrincipalARN(callerARN string) (string, error) {
+	// Parse the ARN
+	parsed, err := arn.Parse(callerARN)
+	if err != nil {
+		return "", err
+	}
+
+	// What kind of caller is this?
+	switch {
+	case parsed.Service == "iam" && strings.HasPrefix(parsed.Resource, "user/"):
+		return callerARN, nil
+	case parsed.Service == "iam" && strings.HasPrefix(parsed.Resource, "role/"):
+		return callerARN, nil
+	case parsed.Service == "sts" && strings.HasPrefix(parsed.Resource, "assumed-role/"):
+		// The resource is "assumed-role/ROLE-NAME/SESSION-NAME"
+		parts := strings.Split(parsed.Resource, "/")
+		parsed.Service = "iam"
+		parsed.Resource = "role/" + parts[1]
+		return parsed.String(), nil
+	default:
+		return "", fmt.Errorf("the policies of %s cannot be simulated", callerARN)
+	}
+}
+
+// Check the supplied actions by simulating the policies of the caller
+func simulateActions(ctx aws.Context, iams *IAMService, callerARN string, actions []string) ([]PreflightCheck, error) {
+	// Whose policies are simulated?
+	principalARN, err := PrincipalARN(callerARN)
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct our input
+	input := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalARN),
+		ActionNames:     aws.StringSlice(actions),
+	}
+
+	// Collect the decision of each action
+	decisions := make(map[string]string)
+	err = iams.SimulatePrincipalPolicy(ctx, input, func(spr *iam.SimulatePolicyResponse, lastPage bool) bool {
+		for _, result := range spr.EvaluationResults {
+			decisions[aws.StringValue(result.EvalActionName)] = aws.StringValue(result.EvalDecision)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct a check for each action
+	var checks []PreflightCheck
+	for _, action := range actions {
+		check := PreflightCheck{Action: action, Method: PreflightSimulation, Detail: decisions[action]}
+		switch decisions[action] {
+		case iam.PolicyEvaluationDecisionTypeAllowed:
+			check.Result = PreflightPass
+		case "":
+			check.Result = PreflightUnknown
+			check.Detail = "not simulated"
+		default:
+			check.Result = PreflightFail
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// Check the supplied actions by probing their services in the named region
+func probeActions(ctx aws.Context, sf ServiceFactory, regionName string, actions []string) []PreflightCheck {
+	var checks []PreflightCheck
+	for _, action := range actions {
+		check := PreflightCheck{Action: action, Method: PreflightProbe}
+
+		// Can this action be probed?
+		probe, ok := actionProbes[action]
+		if !ok {
+			check.Result = PreflightUnknown
+			check.Detail = "cannot be probed"
+			checks = append(checks, check)
+			continue
+		}
+
+		// Invoke the probe and inspect the error (if any)
+		err := probe(ctx, sf, regionName)
+		var aerr awserr.Error
+		switch {
+		case err == nil:
+			check.Result = PreflightPass
+			check.Detail = "allowed"
+		case errors.As(err, &aerr) && allowedCodes[aerr.Code()]:
+			check.Result = PreflightPass
+			check.Detail = "allowed"
+		case errors.As(err, &aerr) && accessDeniedCodes[aerr.Code()]:
+			check.Result = PreflightFail
+			check.Detail = aerr.Code()
+		default:
+			check.Result = PreflightUnknown
+			check.Detail = errorSummary(err)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// Summarize an error on a single line (AWS errors are summarized by their code)
+func errorSummary(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+
+	return strings.Split(err.Error(), "\n")[0]
+}
+
+// Display a table of the supplied checks
+func displayChecks(am ActivityMonitor, checks []PreflightCheck) {
+	// How wide is the action column?
+	width := len("Action")
+	for _, check := range checks {
+		if len(check.Action) > width {
+			width = len(check.Action)
+		}
+	}
+
+	// Display the table
+	am.Message("\n   %-*s  %-7s  %-10s  %s\n", width, "Action", "Result", "Method", "Detail")
+	for _, check := range checks {
+		// Pad the result before coloring it
+		result := fmt.Sprintf("%-7s", check.Result)
+		var coloredResult color.Value
+		switch check.Result {
+		case PreflightPass:
+			coloredResult = color.Green(result)
+		case PreflightFail:
+			coloredResult = color.Red(result)
+		default:
+			coloredResult = color.Yellow(result)
+		}
+
+		am.Message("   %-*s  %s  %-10s  %s\n", width, check.Action, coloredResult, check.Method, check.Detail)
+	}
+}
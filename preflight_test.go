@@ -0,0 +1,371 @@
+/******************************************************************************
+Cloud Resource Counter
+File: preflight_test.go
+
+Summary: The Unit Test for preflight.
+******************************************************************************/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+// This type "stands in" for the real IAM service. It returns the supplied
+// decision for each action or, if SimulateErrorCode is set, an error.
+type fakePreflightIAMService struct {
+	iamiface.IAMAPI
+	Decisions         map[string]string
+	SimulateErrorCode string
+}
+
+// This fake SimulatePrincipalPolicyPagesWithContext returns one page holding the decision of
+// each action that has one
+func (fiam *fakePreflightIAMService) SimulatePrincipalPolicyPagesWithContext(ctx aws.Context, input *iam.SimulatePrincipalPolicyInput,
+	fn func(*iam.SimulatePolicyResponse, bool) bool, _ ...request.Option) error {
+	// Should we fail?
+	if fiam.SimulateErrorCode != "" {
+		return awserr.New(fiam.SimulateErrorCode, "simulation failed", nil)
+	}
+
+	// Construct the page of results
+	var results []*iam.EvaluationResult
+	for _, action := range input.ActionNames {
+		if decision, ok := fiam.Decisions[*action]; ok {
+			results = append(results, &iam.EvaluationResult{
+				EvalActionName: action,
+				EvalDecision:   aws.String(decision),
+			})
+		}
+	}
+	fn(&iam.SimulatePolicyResponse{EvaluationResults: results}, true)
+
+	return nil
+}
+
+// This type "stands in" for the real EC2 and S3 services. Each probe fails with
+// the error code supplied for its action (or succeeds, if there is none).
+type fakePreflightService struct {
+	ec2iface.EC2API
+	s3iface.S3API
+	ErrorCodes map[string]string
+}
+
+// Return the error of the supplied action (if any)
+func (fps *fakePreflightService) err(action string) error {
+	if code, ok := fps.ErrorCodes[action]; ok {
+		return awserr.New(code, "probe failed", nil)
+	}
+
+	return nil
+}
+
+func (fps *fakePreflightService) DescribeRegionsWithContext(aws.Context, *ec2.DescribeRegionsInput, ...request.Option) (*ec2.DescribeRegionsOutput, error) {
+	return &ec2.DescribeRegionsOutput{}, fps.err("ec2:DescribeRegions")
+}
+
+func (fps *fakePreflightService) DescribeInstancesPagesWithContext(ctx aws.Context, input *ec2.DescribeInstancesInput,
+	fn func(*ec2.DescribeInstancesOutput, bool) bool, _ ...request.Option) error {
+	return fps.err("ec2:DescribeInstances")
+}
+
+func (fps *fakePreflightService) DescribeVolumesPagesWithContext(ctx aws.Context, input *ec2.DescribeVolumesInput,
+	fn func(*ec2.DescribeVolumesOutput, bool) bool, _ ...request.Option) error {
+	return fps.err("ec2:DescribeVolumes")
+}
+
+func (fps *fakePreflightService) ListBucketsWithContext(aws.Context, *s3.ListBucketsInput, ...request.Option) (*s3.ListBucketsOutput, error) {
+	return &s3.ListBucketsOutput{}, fps.err("s3:ListAllMyBuckets")
+}
+
+// This structure simulates the AWS Service Factory by storing some pregenerated
+// responses (that would come from AWS)
+type fakePreflightServiceFactory struct {
+	CallerARN string
+	IAM       *fakePreflightIAMService
+	Service   *fakePreflightService
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) Init() {}
+
+// Return our current region
+func (fsf fakePreflightServiceFactory) GetCurrentRegion() string {
+	return "us-east-1"
+}
+
+// Return a fake STS service which identifies the caller (or fails, if there is
+// no caller)
+func (fsf fakePreflightServiceFactory) GetAccountIDService() *AccountIDService {
+	if fsf.CallerARN == "" {
+		return &AccountIDService{Client: &fakeSecurityTokenService{}}
+	}
+
+	return &AccountIDService{
+		Client: &fakeSecurityTokenService{
+			Resp: &sts.GetCallerIdentityOutput{
+				Account: aws.String("123456789012"),
+				Arn:     aws.String(fsf.CallerARN),
+			},
+		},
+	}
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Return our fake IAM service
+func (fsf fakePreflightServiceFactory) GetIAMService() *IAMService {
+	return &IAMService{Client: fsf.IAM}
+}
+
+// Return our fake EC2 service
+func (fsf fakePreflightServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
+	return &EC2InstanceService{Client: fsf.Service}
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) GetRDSInstanceService(string) *RDSInstanceService {
+	return nil
+}
+
+// Return our fake S3 service
+func (fsf fakePreflightServiceFactory) GetS3Service() *S3Service {
+	return &S3Service{Client: fsf.Service}
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) GetLambdaService(string) *LambdaService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) GetContainerService(string) *ContainerService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) GetLightsailService(string) *LightsailService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakePreflightServiceFactory) GetEKSService(string) *EKSService {
+	return nil
+}
+
+func TestPrincipalARN(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		CallerARN   string
+		Expected    string
+		ExpectError bool
+	}{
+		{
+			CallerARN: "arn:aws:iam::123456789012:user/counter",
+			Expected:  "arn:aws:iam::123456789012:user/counter",
+		},
+		{
+			CallerARN: "arn:aws:sts::123456789012:assumed-role/Counter/session-1",
+			Expected:  "arn:aws:iam::123456789012:role/Counter",
+		},
+		{
+			CallerARN: "arn:aws-us-gov:sts::123456789012:assumed-role/Counter/session-1",
+			Expected:  "arn:aws-us-gov:iam::123456789012:role/Counter",
+		},
+		{
+			CallerARN:   "arn:aws:iam::123456789012:root",
+			ExpectError: true,
+		},
+		{
+			CallerARN:   "not-an-arn",
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		actual, err := PrincipalARN(c.CallerARN)
+		if c.ExpectError {
+			if err == nil {
+				t.Errorf("Expected an error for %s, but got %s", c.CallerARN, actual)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error for %s: %v", c.CallerARN, err)
+		} else if actual != c.Expected {
+			t.Errorf("Unexpected principal for %s: expected %s, actual %s", c.CallerARN, c.Expected, actual)
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	// The counters of our run need the following actions:
+	//  ec2:DescribeInstances, ec2:DescribeRegions, ec2:DescribeVolumes,
+	//  s3:GetBucketLocation (with the breakdown) and s3:ListAllMyBuckets
+	rc := &RunContext{Counters: []Counter{EC2Counter, EBSCounter, S3Counter}, ByRegion: true}
+
+	// Construct our test cases...
+	cases := []struct {
+		Name              string
+		CallerARN         string
+		Decisions         map[string]string
+		SimulateErrorCode string
+		ErrorCodes        map[string]string
+		ExpectedResults   []string
+		ExpectedMethod    string
+	}{
+		{
+			Name:      "simulation",
+			CallerARN: "arn:aws:sts::123456789012:assumed-role/Counter/session-1",
+			Decisions: map[string]string{
+				"ec2:DescribeInstances": "allowed",
+				"ec2:DescribeRegions":   "allowed",
+				"ec2:DescribeVolumes":   "implicitDeny",
+				"s3:GetBucketLocation":  "allowed",
+			},
+			ExpectedResults: []string{PreflightPass, PreflightPass, PreflightFail, PreflightPass, PreflightUnknown},
+			ExpectedMethod:  PreflightSimulation,
+		},
+		{
+			Name:              "simulation denied",
+			CallerARN:         "arn:aws:iam::123456789012:user/counter",
+			SimulateErrorCode: "AccessDenied",
+			ErrorCodes: map[string]string{
+				"ec2:DescribeInstances": "DryRunOperation",
+				"ec2:DescribeRegions":   "DryRunOperation",
+				"ec2:DescribeVolumes":   "UnauthorizedOperation",
+				"s3:ListAllMyBuckets":   "AccessDenied",
+			},
+			ExpectedResults: []string{PreflightPass, PreflightPass, PreflightFail, PreflightUnknown, PreflightFail},
+			ExpectedMethod:  PreflightProbe,
+		},
+		{
+			Name:      "root user",
+			CallerARN: "arn:aws:iam::123456789012:root",
+			ErrorCodes: map[string]string{
+				"ec2:DescribeInstances": "DryRunOperation",
+				"ec2:DescribeRegions":   "DryRunOperation",
+				"ec2:DescribeVolumes":   "DryRunOperation",
+				"s3:ListAllMyBuckets":   "RequestTimeout",
+			},
+			ExpectedResults: []string{PreflightPass, PreflightPass, PreflightPass, PreflightUnknown, PreflightUnknown},
+			ExpectedMethod:  PreflightProbe,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create our fake service factory
+		sf := fakePreflightServiceFactory{
+			CallerARN: c.CallerARN,
+			IAM:       &fakePreflightIAMService{Decisions: c.Decisions, SimulateErrorCode: c.SimulateErrorCode},
+			Service:   &fakePreflightService{ErrorCodes: c.ErrorCodes},
+		}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Check our permissions
+		checks := Preflight(&CountContext{ServiceFactory: sf, Monitor: mon, Run: rc})
+
+		// Collect the actions, results and methods
+		var actions, results []string
+		for _, check := range checks {
+			actions = append(actions, check.Action)
+			results = append(results, check.Result)
+			if check.Method != c.ExpectedMethod {
+				t.Errorf("%s: Unexpected method for %s: expected %s, actual %s", c.Name, check.Action, c.ExpectedMethod, check.Method)
+			}
+		}
+
+		// Does it match?
+		if mon.ErrorOccured {
+			t.Errorf("%s: Unexpected error occurred: %s", c.Name, mon.ErrorMessage)
+		} else if !reflect.DeepEqual(actions, IAMActions(rc.Counters, true)) {
+			t.Errorf("%s: Unexpected actions: expected %v, actual %v", c.Name, IAMActions(rc.Counters, true), actions)
+		} else if !reflect.DeepEqual(results, c.ExpectedResults) {
+			t.Errorf("%s: Unexpected results: expected %v, actual %v", c.Name, c.ExpectedResults, results)
+		} else if !strings.Contains(strings.Join(mon.Messages, ""), "ec2:DescribeVolumes") {
+			t.Errorf("%s: Expected the table of results to be displayed: %v", c.Name, mon.Messages)
+		}
+	}
+}
+
+func TestPreflightBreakdownActions(t *testing.T) {
+	// Only a breakdown by region needs the location of each bucket
+	for _, byRegion := range []bool{false, true} {
+		sf := fakePreflightServiceFactory{
+			CallerARN: "arn:aws:iam::123456789012:user/counter",
+			IAM:       &fakePreflightIAMService{Decisions: map[string]string{"s3:ListAllMyBuckets": "allowed", "s3:GetBucketLocation": "allowed"}},
+			Service:   &fakePreflightService{},
+		}
+		mon := &mock.ActivityMonitorImpl{}
+		checks := Preflight(&CountContext{ServiceFactory: sf, Monitor: mon, Run: &RunContext{Counters: []Counter{S3Counter}, ByRegion: byRegion}})
+
+		var checked bool
+		for _, check := range checks {
+			checked = checked || check.Action == "s3:GetBucketLocation"
+		}
+		if checked != byRegion {
+			t.Errorf("Unexpected check of s3:GetBucketLocation (by region: %v): %+v", byRegion, checks)
+		}
+	}
+}
+
+func TestPreflightCallerError(t *testing.T) {
+	// A caller that cannot be identified (while continuing on errors)
+	sf := fakePreflightServiceFactory{IAM: &fakePreflightIAMService{}, Service: &fakePreflightService{}}
+	mon := &mock.ActivityMonitorImpl{}
+
+	// The error is reported and no action is checked
+	checks := Preflight(&CountContext{ServiceFactory: sf, Monitor: mon, Run: &RunContext{Counters: []Counter{EC2Counter}}})
+	if !mon.ErrorOccured {
+		t.Error("Expected an error to occur, but it did not... :^(")
+	}
+	if len(checks) != 1 || checks[0].Action != callerIdentityAction || checks[0].Result != PreflightFail {
+		t.Errorf("Expected a single failed check, got %+v", checks)
+	}
+	if messages := strings.Join(mon.Messages, ""); strings.Contains(messages, "OK") || strings.Contains(messages, "Simulating") {
+		t.Errorf("Expected nothing to be checked after the error: %v", mon.Messages)
+	}
+}
+
+func TestFailedChecks(t *testing.T) {
+	checks := []PreflightCheck{
+		{Action: "ec2:DescribeInstances", Result: PreflightPass},
+		{Action: "ec2:DescribeVolumes", Result: PreflightFail},
+		{Action: "s3:GetBucketLocation", Result: PreflightUnknown},
+	}
+
+	// Only the failure should be returned
+	if failed := FailedChecks(checks); len(failed) != 1 || failed[0].Action != "ec2:DescribeVolumes" {
+		t.Errorf("Unexpected failed checks: %v", failed)
+	}
+}
+
+// Every action that can be probed should be needed by a registered counter
+func TestActionProbes(t *testing.T) {
+	actions := IAMActions(Counters, true)
+	for action := range actionProbes {
+		if !Contains(actions, action) {
+			t.Errorf("The probe of %s is not needed by any counter", action)
+		}
+	}
+}
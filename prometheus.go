@@ -0,0 +1,203 @@
+/******************************************************************************
+Cloud Resource Counter
+File: prometheus.go
+
+Summary: Exports the counts of a run as Prometheus metrics, either to a file for
+         the textfile collector of node_exporter or over HTTP (see serve.go).
+******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The prefix of the names of all of our metrics
+const metricPrefix = "aws_resource_counter_"
+
+// RunMetrics are the metrics of a single run: the counts of each row of results,
+// the errors recorded for each service and how long the run took.
+type RunMetrics struct {
+	Rows     []HistoryRow
+	Errors   []*CounterError
+	Services []string
+	Started  time.Time
+	Duration time.Duration
+
+	// The number of rules that were checked (if any) and the number of violations
+	Rules      int
+	Violations int
+}
+
+// Metrics returns the metrics of the run. The services of the selected counters
+// are always listed, so that their error counts are exported even when zero.
+func (run *CountRun) Metrics(settings *CommandLineSettings, violations []RuleViolation) *RunMetrics {
+	rows, _ := run.Results.History()
+
+	var services []string
+	for _, counter := range settings.counters {
+		services = append(services, counter.Service())
+	}
+
+	return &RunMetrics{
+		Rows:       rows,
+		Errors:     run.Errors,
+		Services:   services,
+		Started:    run.Started,
+		Duration:   run.Duration,
+		Rules:      len(settings.rules),
+		Violations: len(violations),
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (rm *RunMetrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	// The counts (and whether they are complete) of each row
+	samples := rm.countSamples()
+	writeMetricHeader(&buf, "resources", "The number of resources counted in an account and region.")
+	for _, sample := range samples {
+		writeMetric(&buf, "resources", sample.labels, float64(sample.count.Count))
+	}
+	writeMetricHeader(&buf, "resources_incomplete", "Whether the count of resources is incomplete (1), as some of them could not be inspected, or not (0).")
+	for _, sample := range samples {
+		incomplete := 0.0
+		if sample.count.Incomplete {
+			incomplete = 1
+		}
+		writeMetric(&buf, "resources_incomplete", sample.labels, incomplete)
+	}
+
+	// The errors of each service
+	errorCounts := make(map[string]int)
+	for _, service := range rm.Services {
+		errorCounts[service] = 0
+	}
+	for _, err := range rm.Errors {
+		errorCounts[err.Service]++
+	}
+	var services []string
+	for service := range errorCounts {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	writeMetricHeader(&buf, "errors", "The number of errors recorded for an AWS service during the last run.")
+	for _, service := range services {
+		writeMetric(&buf, "errors", []string{"service", service}, float64(errorCounts[service]))
+	}
+
+	// How the run went
+	writeMetricHeader(&buf, "scrape_duration_seconds", "How long the last run took to count every resource.")
+	writeMetric(&buf, "scrape_duration_seconds", nil, rm.Duration.Seconds())
+	writeMetricHeader(&buf, "last_run_timestamp_seconds", "When the last run started, in seconds since the epoch.")
+	writeMetric(&buf, "last_run_timestamp_seconds", nil, float64(rm.Started.Unix()))
+	if rm.Rules > 0 {
+		writeMetricHeader(&buf, "rule_violations", "The number of rules broken by the counts of the last run.")
+		writeMetric(&buf, "rule_violations", nil, float64(rm.Violations))
+	}
+
+	return buf.WriteTo(w)
+}
+
+// WritePrometheusTextfile writes the supplied metrics to the named file, for the
+// textfile collector of node_exporter. The file is written under another name and
+// then renamed, so that the collector never reads a partial file.
+func WritePrometheusTextfile(fileName string, rm *RunMetrics) error {
+	file, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	// Write the metrics
+	if _, err = rm.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	// Make the file readable by the collector and move it into place
+	if err = os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), fileName)
+}
+
+// A count of a column of a row, with its labels
+type countSample struct {
+	labels []string
+	count  CountResult
+}
+
+// Get the count of each column of each row. A series must be unique, so if the
+// same account is counted twice (e.g., by two profiles), its later count is used.
+func (rm *RunMetrics) countSamples() []countSample {
+	var samples []countSample
+	seen := make(map[string]int)
+	for _, row := range rm.Rows {
+		for _, column := range row.Columns {
+			labels := rowLabels(row, column)
+			key := strings.Join(labels, "\x00")
+			if ix, found := seen[key]; found {
+				samples[ix].count = row.Counts[column]
+				continue
+			}
+			seen[key] = len(samples)
+			samples = append(samples, countSample{labels: labels, count: row.Counts[column]})
+		}
+	}
+
+	return samples
+}
+
+// The labels of the count of a column of a row (as name/value pairs). The rows
+// of each region of a breakdown are labeled with their scope, so that they never
+// clash with the totals of the account (e.g., when a single region is examined).
+func rowLabels(row HistoryRow, column string) []string {
+	labels := []string{"account_id", row.AccountID, "region", row.Region, "resource", column}
+	if row.Scope == ScopeRegion {
+		labels = append(labels, "scope", row.Scope)
+	}
+
+	return labels
+}
+
+// Write the HELP and TYPE lines of a gauge
+func writeMetricHeader(w io.Writer, name string, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %s%s gauge\n", metricPrefix, name)
+}
+
+// Write a sample of a metric with the supplied labels (as name/value pairs)
+func writeMetric(w io.Writer, name string, labels []string, value float64) {
+	var pairs []string
+	for ix := 0; ix+1 < len(labels); ix += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[ix], escapeLabelValue(labels[ix+1])))
+	}
+
+	if len(pairs) > 0 {
+		fmt.Fprintf(w, "%s%s{%s} %s\n", metricPrefix, name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'f', -1, 64))
+	} else {
+		fmt.Fprintf(w, "%s%s %s\n", metricPrefix, name, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+}
+
+// Escapes the characters that are not allowed in a label value
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Escape a label value for the text exposition format
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
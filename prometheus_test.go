@@ -0,0 +1,155 @@
+/******************************************************************************
+Cloud Resource Counter
+File: prometheus_test.go
+
+Summary: The Unit Test for prometheus.
+******************************************************************************/
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The metrics of a run of two accounts (one of whose counts is incomplete)
+func testRunMetrics() *RunMetrics {
+	rows := []HistoryRow{
+		historyRow("111122223333", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10, "s3_buckets": 3}),
+		historyRow("444455556666", "2024-05-01T12:00:00Z", `us-"east"-1`, map[string]int{"ec2_instances": 1}),
+	}
+	rows[1].Counts["ec2_instances"] = CountResult{Count: 1, Incomplete: true}
+
+	started, _ := time.Parse(time.RFC3339, "2024-05-01T12:00:00Z")
+
+	return &RunMetrics{
+		Rows:     rows,
+		Errors:   []*CounterError{NewCounterError("EC2", "us-east-1", errors.New("access denied"))},
+		Services: []string{"EC2", "S3"},
+		Started:  started,
+		Duration: 1500 * time.Millisecond,
+	}
+}
+
+func TestRunMetricsWriteTo(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Rules             int
+		Violations        int
+		ExpectedLines     []string
+		UnexpectedStrings []string
+	}{
+		{
+			ExpectedLines: []string{
+				"# TYPE aws_resource_counter_resources gauge",
+				`aws_resource_counter_resources{account_id="111122223333",region="ALL_REGIONS",resource="ec2_instances"} 10`,
+				`aws_resource_counter_resources{account_id="444455556666",region="us-\"east\"-1",resource="ec2_instances"} 1`,
+				`aws_resource_counter_resources_incomplete{account_id="111122223333",region="ALL_REGIONS",resource="s3_buckets"} 0`,
+				`aws_resource_counter_resources_incomplete{account_id="444455556666",region="us-\"east\"-1",resource="ec2_instances"} 1`,
+				`aws_resource_counter_errors{service="EC2"} 1`,
+				`aws_resource_counter_errors{service="S3"} 0`,
+				"aws_resource_counter_scrape_duration_seconds 1.5",
+				"aws_resource_counter_last_run_timestamp_seconds 1714564800",
+			},
+			UnexpectedStrings: []string{"rule_violations"},
+		},
+		{
+			Rules:         2,
+			Violations:    1,
+			ExpectedLines: []string{"aws_resource_counter_rule_violations 1"},
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		metrics := testRunMetrics()
+		metrics.Rules = c.Rules
+		metrics.Violations = c.Violations
+
+		var builder strings.Builder
+		if _, err := metrics.WriteTo(&builder); err != nil {
+			t.Errorf("Unexpected error writing the metrics: %v", err)
+			continue
+		}
+
+		// Are the expected lines present (and the unexpected strings absent)?
+		lines := strings.Split(builder.String(), "\n")
+		for _, expected := range c.ExpectedLines {
+			if !Contains(lines, expected) {
+				t.Errorf("Expected the metrics to contain the line %s:\n%s", expected, builder.String())
+			}
+		}
+		for _, unexpected := range c.UnexpectedStrings {
+			if strings.Contains(builder.String(), unexpected) {
+				t.Errorf("Expected the metrics not to contain %s:\n%s", unexpected, builder.String())
+			}
+		}
+	}
+}
+
+func TestRunMetricsBreakdown(t *testing.T) {
+	// A breakdown of a single region, whose row has the same account and region
+	// as the totals, and the totals of the same account counted by another profile
+	region := historyRow("111122223333", "2024-05-01T12:00:00Z", "us-east-1", map[string]int{"ec2_instances": 3})
+	region.Scope = ScopeRegion
+	totals := historyRow("111122223333", "2024-05-01T12:00:00Z", "us-east-1", map[string]int{"ec2_instances": 3})
+	totals.Scope = ScopeTotal
+	again := historyRow("111122223333", "2024-05-01T12:00:00Z", "us-east-1", map[string]int{"ec2_instances": 4})
+	metrics := &RunMetrics{Rows: []HistoryRow{region, totals, again}}
+
+	var builder strings.Builder
+	if _, err := metrics.WriteTo(&builder); err != nil {
+		t.Fatalf("Unexpected error writing the metrics: %v", err)
+	}
+
+	// Is each series written once (with the later count of the account)?
+	expected := []string{
+		`aws_resource_counter_resources{account_id="111122223333",region="us-east-1",resource="ec2_instances",scope="region"} 3`,
+		`aws_resource_counter_resources{account_id="111122223333",region="us-east-1",resource="ec2_instances"} 4`,
+		`aws_resource_counter_resources_incomplete{account_id="111122223333",region="us-east-1",resource="ec2_instances",scope="region"} 0`,
+		`aws_resource_counter_resources_incomplete{account_id="111122223333",region="us-east-1",resource="ec2_instances"} 0`,
+	}
+	var actual []string
+	for _, line := range strings.Split(builder.String(), "\n") {
+		if strings.HasPrefix(line, "aws_resource_counter_resources") {
+			actual = append(actual, line)
+		}
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected series:\nexpected:\n%s\nactual:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestWritePrometheusTextfile(t *testing.T) {
+	// Write the metrics (twice, replacing the file)
+	tempDir := t.TempDir()
+	fileName := filepath.Join(tempDir, "counts.prom")
+	for ix := 0; ix < 2; ix++ {
+		if err := WritePrometheusTextfile(fileName, testRunMetrics()); err != nil {
+			t.Fatalf("Unexpected error writing %s: %v", fileName, err)
+		}
+	}
+
+	// Was the file written?
+	contents, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Unexpected error reading %s: %v", fileName, err)
+	}
+	if strings.Count(string(contents), "# TYPE aws_resource_counter_resources gauge") != 1 {
+		t.Errorf("Unexpected contents of %s:\n%s", fileName, contents)
+	}
+
+	// Were the temporary files removed?
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 1 {
+		t.Errorf("Expected a single file in %s, found %d", tempDir, len(entries))
+	}
+
+	// Is a missing folder reported?
+	if err := WritePrometheusTextfile(filepath.Join(tempDir, "missing", "counts.prom"), testRunMetrics()); err == nil {
+		t.Errorf("Expected an error writing to a missing folder")
+	}
+}
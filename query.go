@@ -0,0 +1,149 @@
+/******************************************************************************
+Cloud Resource Counter
+File: query.go
+
+Summary: The query subcommand, which reports on the counts kept in a history
+         store (e.g., the latest count of each account).
+******************************************************************************/
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The reports of the query subcommand
+const (
+	QueryLatest = "latest"
+	QueryMax    = "max"
+)
+
+// The default number of days examined by the max report
+const DefaultQueryDays = 90
+
+// RunQuery runs the query subcommand with the supplied arguments, writing the
+// report to the supplied Writer. The reports are:
+//
+//	latest: the latest count of each resource in each account and region
+//	max:    the largest count of each resource in each account and region over
+//	        the last --days days
+//
+// The report is written as a table (text) or as CSV.
+func RunQuery(args []string, w io.Writer, am ActivityMonitor) {
+	var storeSpec, accountID, resource, format string
+	var days int
+
+	// Define a new FlagSet
+	flagSet := flag.NewFlagSet(os.Args[0]+" query", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s query [options] %s|%s\n", os.Args[0], QueryLatest, QueryMax)
+		flagSet.PrintDefaults()
+	}
+
+	// Define and parse the command line arguments...
+	flagSet.StringVar(&storeSpec, "store", "", "The history `store` to query (e.g., sqlite:resources.db).")
+	flagSet.StringVar(&accountID, "account", "", "Only report the counts of the account with this `ID`.")
+	flagSet.StringVar(&resource, "resource", "", "Only report the counts of this `resource` (e.g., ec2_instances).")
+	flagSet.IntVar(&days, "days", DefaultQueryDays, "The `number` of days examined by the max report.")
+	flagSet.StringVar(&format, "format", DiffFormatText, fmt.Sprintf("The `format` of the report (%s or %s).", DiffFormatText, DiffFormatCSV))
+	flagSet.Parse(args)
+
+	// Check our arguments
+	var problems []string
+	if storeSpec == "" {
+		problems = append(problems, "Specify the store to query with --store (e.g., sqlite:resources.db).")
+	} else if _, _, err := ParseStoreSpec(storeSpec); err != nil {
+		problems = append(problems, err.Error()+".")
+	}
+	report := flagSet.Arg(0)
+	if flagSet.NArg() != 1 || (report != QueryLatest && report != QueryMax) {
+		problems = append(problems, fmt.Sprintf("Specify a single report (%s or %s).", QueryLatest, QueryMax))
+	}
+	if days < 1 {
+		problems = append(problems, fmt.Sprintf("--days must be at least 1 (not %d).", days))
+	}
+	if format != DiffFormatText && format != DiffFormatCSV {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid format (expected %s or %s).", format, DiffFormatText, DiffFormatCSV))
+	}
+	if len(problems) > 0 {
+		am.ActionError("Error: %s", strings.Join(problems, "\n"))
+		return
+	}
+
+	// Open the store (it must exist)
+	_, path, _ := ParseStoreSpec(storeSpec)
+	if !FileExists(path) {
+		am.ActionError("Error: The store %s does not exist.", storeSpec)
+		return
+	}
+	store, err := OpenStore(storeSpec)
+	if err != nil {
+		am.ActionError("Error: Unable to open the store %s: %v", storeSpec, err)
+		return
+	}
+	defer store.Close()
+
+	// Run the report
+	var counts []StoredCount
+	countHeading := "Count"
+	if report == QueryMax {
+		counts, err = store.MaxCounts(time.Now().AddDate(0, 0, -days), accountID, resource)
+		countHeading = "Max"
+	} else {
+		counts, err = store.LatestCounts(accountID, resource)
+	}
+	if am.CheckError(err) {
+		return
+	}
+	if len(counts) == 0 {
+		am.Message("There are no counts to report in %s.\n", storeSpec)
+		return
+	}
+
+	if format == DiffFormatCSV {
+		err = writeQueryCSV(w, counts, countHeading)
+	} else {
+		err = writeQueryText(w, counts, countHeading)
+	}
+	am.CheckError(err)
+}
+
+// Write the counts as a table. Incomplete counts are marked with an asterisk.
+func writeQueryText(w io.Writer, counts []StoredCount, countHeading string) error {
+	var incomplete bool
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Account ID\tRegion\tScope\tResource\t%s\tCounted At\n", countHeading)
+	for _, count := range counts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", count.AccountID, count.Region, count.Scope, count.Resource,
+			formatDiffCount(count.Count, false), count.CountedAt.Format(time.RFC3339))
+		incomplete = incomplete || count.Count.Incomplete
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// Explain our asterisks
+	if incomplete {
+		fmt.Fprintln(w, "\n* The count is incomplete (some resources could not be counted).")
+	}
+
+	return nil
+}
+
+// Write a row for each count
+func writeQueryCSV(w io.Writer, counts []StoredCount, countHeading string) error {
+	rows := [][]string{{"Account ID", "Region", "Scope", "Resource", countHeading, "Incomplete", "Counted At"}}
+	for _, count := range counts {
+		rows = append(rows, []string{count.AccountID, count.Region, count.Scope, count.Resource,
+			fmt.Sprintf("%d", count.Count.Count), fmt.Sprintf("%v", count.Count.Incomplete), count.CountedAt.Format(time.RFC3339)})
+	}
+
+	return csv.NewWriter(w).WriteAll(rows)
+}
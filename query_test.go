@@ -0,0 +1,81 @@
+/******************************************************************************
+Cloud Resource Counter
+File: query_test.go
+
+Summary: The Unit Test for query.
+******************************************************************************/
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestRunQuery(t *testing.T) {
+	store := testStore(t)
+	store.Close()
+
+	// Create our test cases
+	cases := []struct {
+		Args          []string
+		ExpectError   bool
+		ExpectedLines []string
+	}{
+		{
+			Args: []string{"--store", store.Spec, "latest"},
+			ExpectedLines: []string{
+				"Account ID    Region       Scope  Resource          Count  Counted At",
+				"111122223333  ALL_REGIONS  total  ec2_instances     10*    2024-05-02T12:00:00Z",
+				"111122223333  ALL_REGIONS  total  s3_buckets        4      2024-05-01T12:00:00Z",
+				"444455556666  ALL_REGIONS  total  ec2_instances     1      2024-01-01T12:00:00Z",
+				"* The count is incomplete (some resources could not be counted).",
+			},
+		},
+		{
+			Args: []string{"--store", store.Spec, "--account", "111122223333", "--resource", "ec2_instances", "--days", "100000", "--format", "csv", "max"},
+			ExpectedLines: []string{
+				"Account ID,Region,Scope,Resource,Max,Incomplete,Counted At",
+				"111122223333,ALL_REGIONS,total,ec2_instances,50,false,2024-01-01T12:00:00Z",
+			},
+		},
+		{
+			Args:        []string{"latest"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--store", store.Spec, "largest"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--store", store.Spec, "--days", "0", "max"},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--store", "sqlite:" + filepath.Join(t.TempDir(), "missing.db"), "latest"},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		var builder strings.Builder
+		mon := &mock.ActivityMonitorImpl{}
+		RunQuery(c.Args, &builder, mon)
+
+		// Did we get the expected report?
+		if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured for %v: expected %v, actual %v (%s)", c.Args, c.ExpectError, mon.ErrorOccured, mon.ErrorMessage)
+			continue
+		}
+		lines := strings.Split(builder.String(), "\n")
+		for _, expected := range c.ExpectedLines {
+			if !Contains(lines, expected) {
+				t.Errorf("Expected the report for %v to contain the line %q:\n%s", c.Args, expected, builder.String())
+			}
+		}
+	}
+}
@@ -8,41 +8,38 @@ Summary: Provides a count of all RDS instances.
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/rds"
-
-	color "github.com/logrusorgru/aurora"
 )
 
 // RDSInstances retrieves the count of all RDS Instances either for all regions
-// (allRegions is true) or the region associated with the session. This method
+// (rc.AllRegions is true) or the region associated with the session. This method
 // gives status back to the user via the supplied ActivityMonitor instance.
-func RDSInstances(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
-	// Indicate activity
-	am.StartAction("Retrieving RDS instance counts")
-
-	// Should we get the counts for all regions?
-	instanceCount := 0
-	if allRegions {
-		// Get the list of all enabled regions for this account
-		regionsSlice := GetEC2Regions(sf.GetEC2InstanceService(""), am)
+func RDSInstances(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(RDSCounter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
 
-		// Loop through all of the regions
-		for _, regionName := range regionsSlice {
-			// Get the RDS instance counts for a specific region
-			instanceCount += rdsInstancesForSingleRegion(sf.GetRDSInstanceService(regionName), am)
-		}
-	} else {
-		// Get the RDS instance counts for the region selected by this session
-		instanceCount = rdsInstancesForSingleRegion(sf.GetRDSInstanceService(""), am)
-	}
+// rdsCounter counts the RDS instances of a region.
+type rdsCounter struct {
+	CounterInfo
+}
 
-	// Indicate end of activity
-	am.EndAction("OK (%d)", color.Bold(instanceCount))
+// RDSCounter is the registered Counter for RDS instances.
+var RDSCounter = rdsCounter{CounterInfo{
+	CounterName:  "rds",
+	ColumnName:   "# of RDS Instances",
+	ServiceName:  "RDS",
+	ActivityName: "RDS instance",
+	Actions:      []string{"rds:DescribeDBInstances"},
+	IsRegional:   true,
+}}
 
-	return instanceCount
+// Count the RDS instances of the supplied region
+func (rdsCounter) Count(ctx *CountContext, regionName string) RegionResult {
+	return NewInventoryResult(rdsInstancesForSingleRegion(ctx.RequestContext(), ctx.ServiceFactory.GetRDSInstanceService(regionName), ctx.Monitor))
 }
 
-func rdsInstancesForSingleRegion(rdsis *RDSInstanceService, am ActivityMonitor) int {
+func rdsInstancesForSingleRegion(c aws.Context, rdsis *RDSInstanceService, am ActivityMonitor) ([]InventoryItem, error) {
 	// Construct our input to find all RDS instances
 	input := &rds.DescribeDBInstancesInput{}
 
@@ -50,20 +47,22 @@ func rdsInstancesForSingleRegion(rdsis *RDSInstanceService, am ActivityMonitor)
 	am.Message(".")
 
 	// Invoke our service
-	instanceCount := 0
-	err := rdsis.InspectInstances(input, func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+	var items []InventoryItem
+	err := rdsis.InspectInstances(c, input, func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
 		// Loop through the DB Instances...
 		for _, dbi := range page.DBInstances {
+			id := aws.StringValue(dbi.DBInstanceArn)
+			status := aws.StringValue(dbi.DBInstanceStatus)
+
 			if dbi.DBInstanceStatus != nil && *dbi.DBInstanceStatus == "available" {
-				instanceCount++
+				items = append(items, CountedItem(id, status, "available instance"))
+			} else {
+				items = append(items, ExcludedItem(id, status, "not available"))
 			}
 		}
 
 		return true
 	})
 
-	// Check for error
-	am.CheckError(err)
-
-	return instanceCount
+	return items, err
 }
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 
 	"github.com/aws/aws-sdk-go/service/rds"
@@ -101,8 +102,8 @@ type fakeRDSService struct {
 	DDBIResponse []*rds.DescribeDBInstancesOutput
 }
 
-// Simulate the DescribeDBInstancesPages function
-func (fake *fakeRDSService) DescribeDBInstancesPages(input *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool) error {
+// Simulate the DescribeDBInstancesPagesWithContext function
+func (fake *fakeRDSService) DescribeDBInstancesPagesWithContext(ctx aws.Context, input *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool, _ ...request.Option) error {
 	// If the supplied response is nil, then simulate an error
 	if fake.DDBIResponse == nil {
 		return errors.New("DescribeDBInstancesPages encountered an unexpected error: 1234")
@@ -157,6 +158,16 @@ func (fsf fakeRDSServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeRDSServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeRDSServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // This implementation of GetEC2InstanceService is limited to supporting DescribeRegions API
 // only.
 func (fsf fakeRDSServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
@@ -252,18 +263,20 @@ func TestRDSInstances(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our RDS Counter function
-		actualCount := RDSInstances(sf, mon, c.AllRegions)
+		actualCount := RDSInstances(sf, mon, &RunContext{AllRegions: c.AllRegions, Concurrency: 2})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: RDSInstances returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: RDSInstances returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
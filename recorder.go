@@ -0,0 +1,186 @@
+/******************************************************************************
+Cloud Resource Counter
+File: recorder.go
+
+Summary: Records the responses to every AWS API request (--record) and serves
+         them back in place of AWS (--replay), so that counts can be derived
+         again without credentials or network access.
+******************************************************************************/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/corehandlers"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// The names of our session handlers
+const (
+	recordHandlerName = "cloudresourcecounter.RecordHandler"
+	replayHandlerName = "cloudresourcecounter.ReplayHandler"
+)
+
+// ErrCodeReplayNotFound is the code of the error returned when replaying a
+// request that was not recorded.
+const ErrCodeReplayNotFound = "ReplayNotFound"
+
+// Operations that obtain credentials. They are not recorded, as their inputs
+// differ on each run (e.g., the session name of an assumed role) and they are
+// not needed when replaying.
+var unrecordedOperations = map[string]bool{
+	"AssumeRole":         true,
+	"GetRoleCredentials": true,
+}
+
+// RecordedExchange is a single AWS API request and its response, as stored in a
+// file of a recording.
+type RecordedExchange struct {
+	Scope      string          `json:"scope"`
+	Service    string          `json:"service"`
+	Operation  string          `json:"operation"`
+	Region     string          `json:"region"`
+	Params     json.RawMessage `json:"params"`
+	StatusCode int             `json:"status_code"`
+	Header     http.Header     `json:"header"`
+	Body       string          `json:"body"`
+}
+
+// RecordSession adds a handler to the supplied session which writes each request
+// (and its response) to a file in the supplied folder. The scope distinguishes
+// identical requests made with different identities (e.g., profiles or roles).
+// If the session already has a recording handler, it is replaced.
+func RecordSession(sess *session.Session, dirName string, scope string) {
+	handler := request.NamedHandler{Name: recordHandlerName, Fn: func(r *request.Request) {
+		// Did we receive a response worth recording?
+		if r.HTTPResponse == nil || r.Error != nil || unrecordedOperations[r.Operation.Name] {
+			return
+		}
+
+		// Read the body of the response, leaving a copy for the SDK to unmarshal
+		var body []byte
+		if r.HTTPResponse.Body != nil {
+			var err error
+			if body, err = io.ReadAll(r.HTTPResponse.Body); err != nil {
+				r.Error = err
+				return
+			}
+			r.HTTPResponse.Body.Close()
+			r.HTTPResponse.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		// Construct our exchange
+		exchange, err := newRecordedExchange(r, scope)
+		if err != nil {
+			r.Error = err
+			return
+		}
+		exchange.StatusCode = r.HTTPResponse.StatusCode
+		exchange.Header = r.HTTPResponse.Header
+		exchange.Body = string(body)
+
+		// Write it
+		r.Error = writeRecordedExchange(dirName, exchange)
+	}}
+
+	// Run it after the request is sent
+	if !sess.Handlers.Send.SwapNamed(handler) {
+		sess.Handlers.Send.PushBackNamed(handler)
+	}
+}
+
+// ReplaySession replaces the handler of the supplied session that sends each
+// request to AWS with one that serves the response recorded in the supplied
+// folder (with the same scope). A request that was not recorded fails with an
+// error whose code is ErrCodeReplayNotFound.
+func ReplaySession(sess *session.Session, dirName string, scope string) {
+	handler := request.NamedHandler{Name: replayHandlerName, Fn: func(r *request.Request) {
+		// Which exchange are we looking for?
+		exchange, err := newRecordedExchange(r, scope)
+		if err != nil {
+			r.Error = err
+			return
+		}
+
+		// Read it
+		contents, err := os.ReadFile(exchangeFileName(dirName, exchange))
+		if err == nil {
+			err = json.Unmarshal(contents, exchange)
+		}
+		if err != nil {
+			r.Error = awserr.New(ErrCodeReplayNotFound,
+				fmt.Sprintf("no recorded response for %s %s in %s", exchange.Service, exchange.Operation, exchange.Region), err)
+			r.Retryable = aws.Bool(false)
+			return
+		}
+
+		// Serve the recorded response
+		r.HTTPResponse = &http.Response{
+			StatusCode: exchange.StatusCode,
+			Status:     http.StatusText(exchange.StatusCode),
+			Header:     exchange.Header,
+			Body:       io.NopCloser(bytes.NewReader([]byte(exchange.Body))),
+		}
+	}}
+
+	// Take the place of the handler which sends the request
+	if !sess.Handlers.Send.SwapNamed(handler) {
+		sess.Handlers.Send.Swap(corehandlers.SendHandler.Name, handler)
+	}
+}
+
+// Construct an exchange that identifies the supplied request
+func newRecordedExchange(r *request.Request, scope string) (*RecordedExchange, error) {
+	params, err := json.Marshal(r.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordedExchange{
+		Scope:     scope,
+		Service:   r.ClientInfo.ServiceName,
+		Operation: r.Operation.Name,
+		Region:    aws.StringValue(r.Config.Region),
+		Params:    params,
+	}, nil
+}
+
+// Get the name of the file that holds the supplied exchange. Pages of results are
+// requested with different parameters, so each page is stored in its own file.
+func exchangeFileName(dirName string, exchange *RecordedExchange) string {
+	// Hash everything that identifies the request
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n%s\n%s", exchange.Scope, exchange.Service, exchange.Operation, exchange.Region, exchange.Params)
+	sum := hex.EncodeToString(hash.Sum(nil))[:16]
+
+	return filepath.Join(dirName, exchange.Service, fmt.Sprintf("%s-%s.json", exchange.Operation, sum))
+}
+
+// Write the supplied exchange to its file
+func writeRecordedExchange(dirName string, exchange *RecordedExchange) error {
+	// Make sure that the folder exists
+	fileName := exchangeFileName(dirName, exchange)
+	if err := os.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+		return err
+	}
+
+	// Encode and write the exchange
+	contents, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, contents, 0666)
+}
@@ -0,0 +1,146 @@
+/******************************************************************************
+Cloud Resource Counter
+File: recorder_test.go
+
+Summary: The Unit Test for recorder.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// The response of STS to GetCallerIdentity
+const fakeCallerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/counter</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata>
+    <RequestId>01234567-89ab-cdef-0123-456789abcdef</RequestId>
+  </ResponseMetadata>
+</GetCallerIdentityResponse>`
+
+// Construct a session whose requests are sent to the supplied endpoint
+func newTestSession(endpoint string) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(endpoint),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	// Start a server that stands in for STS
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(fakeCallerIdentityResponse))
+	}))
+	endpoint := server.URL
+	dirName := t.TempDir()
+
+	// Record a request
+	recordSession := newTestSession(endpoint)
+	RecordSession(recordSession, dirName, "default")
+	accountID, err := (&AccountIDService{Client: sts.New(recordSession)}).Account(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error while recording: %v", err)
+	} else if accountID != "123456789012" {
+		t.Fatalf("Unexpected account while recording: %s", accountID)
+	}
+
+	// Was it recorded?
+	files, _ := filepath.Glob(filepath.Join(dirName, "sts", "GetCallerIdentity-*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one recorded exchange, found %v", files)
+	}
+
+	// Stop the server: it must not be needed to replay the request
+	server.Close()
+
+	// Replay the request
+	replaySession := newTestSession(endpoint)
+	ReplaySession(replaySession, dirName, "default")
+	callerARN, err := (&AccountIDService{Client: sts.New(replaySession)}).CallerARN(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error while replaying: %v", err)
+	} else if callerARN != "arn:aws:iam::123456789012:user/counter" {
+		t.Errorf("Unexpected caller while replaying: %s", callerARN)
+	} else if requests != 1 {
+		t.Errorf("Expected a single request to be sent to the server, not %d", requests)
+	}
+
+	// The same request in another scope was not recorded
+	otherSession := newTestSession(endpoint)
+	ReplaySession(otherSession, dirName, "default/arn:aws:iam::444455556666:role/Counter")
+	_, err = (&AccountIDService{Client: sts.New(otherSession)}).Account(context.Background())
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != ErrCodeReplayNotFound {
+		t.Errorf("Expected a %s error, but got %v", ErrCodeReplayNotFound, err)
+	}
+}
+
+func TestRecordErrorResponse(t *testing.T) {
+	// Start a server that denies access
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>Not allowed</Message></Error><RequestId>1</RequestId></ErrorResponse>`))
+	}))
+	defer server.Close()
+	dirName := t.TempDir()
+
+	// Record the failed request
+	recordSession := newTestSession(server.URL)
+	RecordSession(recordSession, dirName, "default")
+	_, recordErr := (&AccountIDService{Client: sts.New(recordSession)}).Account(context.Background())
+
+	// Replay it: the same error should be returned
+	replaySession := newTestSession("http://127.0.0.1:1")
+	ReplaySession(replaySession, dirName, "default")
+	_, replayErr := (&AccountIDService{Client: sts.New(replaySession)}).Account(context.Background())
+
+	// Do they match?
+	var recordAErr, replayAErr awserr.Error
+	if !errors.As(recordErr, &recordAErr) || !errors.As(replayErr, &replayAErr) {
+		t.Fatalf("Expected AWS errors, got %v and %v", recordErr, replayErr)
+	} else if recordAErr.Code() != "AccessDenied" || replayAErr.Code() != recordAErr.Code() {
+		t.Errorf("Unexpected errors: recorded %s, replayed %s", recordAErr.Code(), replayAErr.Code())
+	}
+}
+
+func TestRecordingFactory(t *testing.T) {
+	// A replaying factory needs neither credentials nor a recording folder with contents
+	dirName := t.TempDir()
+	sf := &AWSServiceFactory{RegionName: "us-west-2", ReplayDir: dirName}
+	sf.Init()
+
+	// Requests fail as they were not recorded (rather than for lack of credentials)
+	_, err := sf.GetAccountIDService().Account(context.Background())
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != ErrCodeReplayNotFound {
+		t.Errorf("Expected a %s error, but got %v", ErrCodeReplayNotFound, err)
+	}
+
+	// So do the requests of an assumed role
+	_, err = sf.AssumeRole("arn:aws:iam::444455556666:role/Counter").GetAccountIDService().Account(context.Background())
+	if !errors.As(err, &aerr) || aerr.Code() != ErrCodeReplayNotFound {
+		t.Errorf("Expected a %s error for the role, but got %v", ErrCodeReplayNotFound, err)
+	}
+}
@@ -0,0 +1,115 @@
+/******************************************************************************
+Cloud Resource Counter
+File: regions.go
+
+Summary: Selection of the regions to examine (--regions and --exclude-regions),
+         using region names or glob patterns (e.g., "ap-*").
+******************************************************************************/
+
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// RegionInfo describes a region that is examined: its name and its opt-in status
+// (e.g., "opted-in"), if known.
+type RegionInfo struct {
+	Name        string
+	OptInStatus string
+}
+
+// RegionInfoNames returns the names of the supplied regions (in order).
+func RegionInfoNames(regions []RegionInfo) []string {
+	var regionNames []string
+	for _, region := range regions {
+		regionNames = append(regionNames, region.Name)
+	}
+
+	return regionNames
+}
+
+// IsRegionPattern returns whether the supplied string is a glob pattern (e.g.,
+// "eu-*") rather than a single region name.
+func IsRegionPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// MatchesRegion returns whether the supplied region name matches any of the
+// supplied region names or glob patterns.
+func MatchesRegion(patterns []string, regionName string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, regionName); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsValidRegionPattern returns whether the supplied region name or glob pattern
+// selects at least one region of the supplied partition or, if the partition
+// is empty, of any supported partition.
+func IsValidRegionPattern(partitionID string, pattern string) bool {
+	// Is this a single region name?
+	if !IsRegionPattern(pattern) {
+		return IsValidRegionName(partitionID, pattern)
+	}
+
+	// Is it a well formed pattern?
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false
+	}
+
+	// Does it match any of the known regions?
+	for _, regionName := range KnownRegionNames(partitionID) {
+		if MatchesRegion([]string{pattern}, regionName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// KnownRegionNames returns the sorted names of the regions of the supplied
+// partition or, if the partition is empty, of every supported partition.
+func KnownRegionNames(partitionID string) []string {
+	// Which partitions should we look in?
+	partitionIDs := Partitions
+	if partitionID != "" {
+		partitionIDs = []string{partitionID}
+	}
+
+	// Collect the regions of each partition
+	var regionNames []string
+	for _, id := range partitionIDs {
+		if partition, ok := lookupPartition(id); ok {
+			for regionName := range partition.Regions() {
+				regionNames = append(regionNames, regionName)
+			}
+		}
+	}
+	sort.Strings(regionNames)
+
+	return regionNames
+}
+
+// SelectRegions returns the supplied region names (in order) that match one of
+// the included names or patterns (or all of them, if none are included) and
+// none of the excluded names or patterns.
+func SelectRegions(regionNames []string, included []string, excluded []string) []string {
+	var selected []string
+	for _, regionName := range regionNames {
+		if len(included) > 0 && !MatchesRegion(included, regionName) {
+			continue
+		}
+		if MatchesRegion(excluded, regionName) {
+			continue
+		}
+		selected = append(selected, regionName)
+	}
+
+	return selected
+}
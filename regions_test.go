@@ -0,0 +1,79 @@
+/******************************************************************************
+Cloud Resource Counter
+File: regions_test.go
+
+Summary: The Unit Test for regions.
+******************************************************************************/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsValidRegionPattern(t *testing.T) {
+	// Construct our test cases...
+	cases := []struct {
+		PartitionID string
+		Pattern     string
+		Expected    bool
+	}{
+		{Pattern: "us-east-1", Expected: true},
+		{Pattern: "ap-*", Expected: true},
+		{Pattern: "us-gov-*", Expected: true},
+		{Pattern: "eu-west-?", Expected: true},
+		{Pattern: "abc-def"},
+		{Pattern: "xx-*"},
+		{Pattern: "us-[east-1"},
+		{PartitionID: PartitionGovCloud, Pattern: "us-gov-*", Expected: true},
+		{PartitionID: PartitionGovCloud, Pattern: "ap-*"},
+		{PartitionID: PartitionChina, Pattern: "cn-north-1", Expected: true},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		if actual := IsValidRegionPattern(c.PartitionID, c.Pattern); actual != c.Expected {
+			t.Errorf("Unexpected validity of %s in partition '%s': expected %v, actual %v", c.Pattern, c.PartitionID, c.Expected, actual)
+		}
+	}
+}
+
+func TestSelectRegions(t *testing.T) {
+	// The regions enabled for an account
+	regionNames := []string{"us-east-1", "us-west-2", "eu-west-1", "ap-south-1", "ap-northeast-1"}
+
+	// Construct our test cases...
+	cases := []struct {
+		Included []string
+		Excluded []string
+		Expected []string
+	}{
+		{
+			Expected: regionNames,
+		},
+		{
+			Included: []string{"us-east-1", "eu-west-1", "ca-central-1"},
+			Expected: []string{"us-east-1", "eu-west-1"},
+		},
+		{
+			Excluded: []string{"ap-*"},
+			Expected: []string{"us-east-1", "us-west-2", "eu-west-1"},
+		},
+		{
+			Included: []string{"us-*", "ap-*"},
+			Excluded: []string{"ap-northeast-1", "us-west-?"},
+			Expected: []string{"us-east-1", "ap-south-1"},
+		},
+		{
+			Excluded: []string{"*"},
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		if actual := SelectRegions(regionNames, c.Included, c.Excluded); !reflect.DeepEqual(actual, c.Expected) {
+			t.Errorf("Unexpected regions for %v less %v: expected %v, actual %v", c.Included, c.Excluded, c.Expected, actual)
+		}
+	}
+}
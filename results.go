@@ -3,23 +3,42 @@ Cloud Resource Counter
 File: results.go
 
 Summary: Collects results (in the form of column names and column values) and
-         writes to a CSV file
+         writes to a CSV, JSON or NDJSON file
 ******************************************************************************/
 
 package main
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"regexp"
+	"strings"
 )
 
+// The supported output formats
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// OutputFormats is the list of supported output formats.
+var OutputFormats = []string{FormatCSV, FormatJSON, FormatNDJSON}
+
 // Results is a struct that collects rows of data and writes them to the supplied
-// file in CSV format.
+// file in CSV format (the default), JSON format (an array of objects) or NDJSON
+// format (one object per line).
 type Results struct {
 	Rows         [][]string
 	StoreHeaders bool
 	Writer       io.Writer
+	Format       string
+
+	// The JSON representation of each row (which retains native types)
+	records []map[string]interface{}
 }
 
 // Init performs one-time initialization on the results struct.
@@ -27,24 +46,91 @@ func (r *Results) Init() {
 	// Are storing column names in our rows?
 	if r.StoreHeaders {
 		// Create a new row to hold them
-		r.NewRow()
+		r.Rows = append(r.Rows, []string{})
 	}
 }
 
 // NewRow creates a new row to receive results
 func (r *Results) NewRow() {
 	r.Rows = append(r.Rows, []string{})
+	r.records = append(r.records, map[string]interface{}{
+		"tool_version": version,
+		"counts":       map[string]int{},
+	})
 }
 
-// Append the supplied column name and row value into our struct.
+// Append the supplied column name and row value into our struct. Column names
+// are only recorded while the first row of values is being built.
 func (r *Results) Append(columnName string, rowValue interface{}) {
-	// Are we storing column names?
-	if r.StoreHeaders {
+	// Are we storing column names (and is this the first row of values)?
+	if r.StoreHeaders && len(r.Rows) == 2 {
 		r.Rows[0] = append(r.Rows[0], columnName)
 	}
 
 	// Append our value to the last row
 	r.Rows[len(r.Rows)-1] = append(r.Rows[len(r.Rows)-1], fmt.Sprintf("%v", rowValue))
+
+	// Add our value to the last JSON record. Counts are kept together.
+	record := r.records[len(r.records)-1]
+	key := ColumnKey(columnName)
+	if count, ok := rowValue.(CountResult); ok {
+		record["counts"].(map[string]int)[key] = count.Count
+
+		// Is this count incomplete?
+		if count.Incomplete {
+			incomplete, _ := record["incomplete"].([]string)
+			record["incomplete"] = append(incomplete, key)
+		}
+	} else {
+		record[key] = rowValue
+	}
+}
+
+// SetRowMetadata records information about how the last row was collected: the
+// regions that were scanned (and the opt-in status of each, if known) and the
+// errors that were encountered. This is only saved in the JSON and NDJSON formats.
+func (r *Results) SetRowMetadata(regions []RegionInfo, errs []*CounterError) {
+	// Make sure that empty lists are written as empty arrays
+	regionsScanned := []string{}
+	optInStatuses := map[string]string{}
+	for _, region := range regions {
+		regionsScanned = append(regionsScanned, region.Name)
+		if region.OptInStatus != "" {
+			optInStatuses[region.Name] = region.OptInStatus
+		}
+	}
+	if errs == nil {
+		errs = []*CounterError{}
+	}
+
+	record := r.records[len(r.records)-1]
+	record["regions_scanned"] = regionsScanned
+	record["region_opt_in_status"] = optInStatuses
+	record["errors"] = errs
+}
+
+// History returns the rows of results collected so far, in the form in which
+// they are read back from an output file (e.g., to check them against rules).
+func (r *Results) History() ([]HistoryRow, error) {
+	var records []historyRecord
+	for _, record := range r.records {
+		accountID, _ := record["account_id"].(string)
+		timestamp, _ := record["timestamp"].(string)
+		region, _ := record["region"].(string)
+		scope, _ := record["scope"].(string)
+		incomplete, _ := record["incomplete"].([]string)
+		records = append(records, historyRecord{
+			AccountID:   accountID,
+			Timestamp:   timestamp,
+			Region:      region,
+			Scope:       scope,
+			ToolVersion: version,
+			Counts:      record["counts"].(map[string]int),
+			Incomplete:  incomplete,
+		})
+	}
+
+	return historyRows(records)
 }
 
 // Save the generated results to the supplied file
@@ -57,11 +143,16 @@ func (r *Results) Save(am ActivityMonitor) {
 	// Indicate activity
 	am.StartAction("Writing to file")
 
-	// Get the CSV Writer
-	writer := csv.NewWriter(r.Writer)
-
-	// Write all of the contents at once
-	err := writer.WriteAll(r.Rows)
+	// Write all of the contents at once in the requested format
+	var err error
+	switch r.Format {
+	case FormatJSON:
+		err = r.saveJSON()
+	case FormatNDJSON:
+		err = r.saveNDJSON()
+	default:
+		err = csv.NewWriter(r.Writer).WriteAll(r.Rows)
+	}
 
 	// Check for Error
 	am.CheckError(err)
@@ -69,3 +160,64 @@ func (r *Results) Save(am ActivityMonitor) {
 	// Indicate success
 	am.EndAction("OK")
 }
+
+// Write all of the records as a single JSON array
+func (r *Results) saveJSON() error {
+	// Make sure that an empty set of results is written as an empty array
+	records := r.records
+	if records == nil {
+		records = []map[string]interface{}{}
+	}
+
+	// Encode the records
+	encoder := json.NewEncoder(r.Writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(records)
+}
+
+// Write each record as a JSON object on a line of its own
+func (r *Results) saveNDJSON() error {
+	encoder := json.NewEncoder(r.Writer)
+	for _, record := range r.records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches runs of characters that are not allowed in a column key
+var nonKeyChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ColumnKey converts a column name (e.g., "# of EC2 Instances") into the
+// snake_case key used in JSON output (e.g., "ec2_instances").
+func ColumnKey(columnName string) string {
+	// Remove the "# of" prefix used by counts
+	key := strings.TrimPrefix(columnName, "# of ")
+
+	// Replace anything other than letters and numbers with underscores
+	key = nonKeyChars.ReplaceAllString(strings.ToLower(key), "_")
+
+	return strings.Trim(key, "_")
+}
+
+// ReadCSVHeader returns the column names stored in the first row of the supplied
+// CSV file. If the file is empty, the result is nil.
+func ReadCSVHeader(fileName string) ([]string, error) {
+	// Open the file
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Read the first row
+	header, err := csv.NewReader(file).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	return header, err
+}
@@ -10,6 +10,7 @@ package main
 
 import (
 	"encoding/csv"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -169,3 +170,184 @@ func TestResultsNoSave(t *testing.T) {
 		t.Errorf("Encountered an error during Results.Save: %s", mon.ErrorMessage)
 	}
 }
+
+func TestResultsMultipleRows(t *testing.T) {
+	// Create a Builder to hold our generated results
+	builder := strings.Builder{}
+
+	// Create an instance of Results
+	results := Results{
+		StoreHeaders: true,
+		Writer:       &builder,
+	}
+	results.Init()
+
+	// Add two rows of values (as would be done for two accounts)...
+	for _, account := range []string{"111", "222"} {
+		results.NewRow()
+		results.Append("Account ID", account)
+		results.Append("col2", 123)
+	}
+
+	// Create our mock activity monitor
+	mon := mock.ActivityMonitorImpl{}
+
+	// Save to our mock Writer
+	results.Save(&mon)
+
+	// Verify that the headers are only stored once
+	expected := "Account ID,col2\n111,123\n222,123\n"
+	if mon.ErrorOccured {
+		t.Errorf("Encountered an error during Results.Save: %s", mon.ErrorMessage)
+	} else if builder.String() != expected {
+		t.Errorf("Unexpected CSV contents: expected %q, actual %q", expected, builder.String())
+	}
+}
+
+func TestResultsJSON(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Format   string
+		Expected string
+	}{
+		{
+			Format: FormatNDJSON,
+			Expected: `{"account_id":"111","counts":{"ec2_instances":5,"s3_buckets":2},"errors":[],"region":"us-east-1","region_opt_in_status":{"us-east-1":"opt-in-not-required"},"regions_scanned":["us-east-1"],"timestamp":"now","tool_version":"?.?.?"}` + "\n" +
+				`{"account_id":"222","counts":{"ec2_instances":5,"s3_buckets":2},"errors":[{"service":"EC2","region":"us-east-1","code":"","message":"boom"}],"incomplete":["ec2_instances"],"region":"us-east-1","region_opt_in_status":{"us-east-1":"opt-in-not-required"},"regions_scanned":["us-east-1"],"timestamp":"now","tool_version":"?.?.?"}` + "\n",
+		},
+		{
+			Format: FormatJSON,
+			Expected: `[
+  {
+    "account_id": "111",
+    "counts": {
+      "ec2_instances": 5,
+      "s3_buckets": 2
+    },
+    "errors": [],
+    "region": "us-east-1",
+    "region_opt_in_status": {
+      "us-east-1": "opt-in-not-required"
+    },
+    "regions_scanned": [
+      "us-east-1"
+    ],
+    "timestamp": "now",
+    "tool_version": "?.?.?"
+  },
+  {
+    "account_id": "222",
+    "counts": {
+      "ec2_instances": 5,
+      "s3_buckets": 2
+    },
+    "errors": [
+      {
+        "service": "EC2",
+        "region": "us-east-1",
+        "code": "",
+        "message": "boom"
+      }
+    ],
+    "incomplete": [
+      "ec2_instances"
+    ],
+    "region": "us-east-1",
+    "region_opt_in_status": {
+      "us-east-1": "opt-in-not-required"
+    },
+    "regions_scanned": [
+      "us-east-1"
+    ],
+    "timestamp": "now",
+    "tool_version": "?.?.?"
+  }
+]
+`,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		// Create a Builder to hold our generated results
+		builder := strings.Builder{}
+
+		// Create an instance of Results
+		results := Results{
+			StoreHeaders: true,
+			Writer:       &builder,
+			Format:       c.Format,
+		}
+		results.Init()
+
+		// Add two rows of values: the second one is incomplete
+		for _, account := range []string{"111", "222"} {
+			var errs []*CounterError
+			if account == "222" {
+				errs = append(errs, NewCounterError("EC2", "us-east-1", errors.New("boom")))
+			}
+
+			results.NewRow()
+			results.Append("Account ID", account)
+			results.Append("Timestamp", "now")
+			results.Append("Region", "us-east-1")
+			results.Append("# of EC2 Instances", CountResult{Count: 5, Incomplete: len(errs) > 0})
+			results.Append("# of S3 Buckets", CountResult{Count: 2})
+			results.SetRowMetadata([]RegionInfo{{Name: "us-east-1", OptInStatus: "opt-in-not-required"}}, errs)
+		}
+
+		// Create our mock activity monitor
+		mon := mock.ActivityMonitorImpl{}
+
+		// Save to our mock Writer
+		results.Save(&mon)
+
+		// Does it match?
+		if mon.ErrorOccured {
+			t.Errorf("Encountered an error during Results.Save: %s", mon.ErrorMessage)
+		} else if builder.String() != c.Expected {
+			t.Errorf("Unexpected %s contents: expected %s, actual %s", c.Format, c.Expected, builder.String())
+		}
+	}
+}
+
+func TestResultsJSONEmpty(t *testing.T) {
+	// Create a Builder to hold our generated results
+	builder := strings.Builder{}
+
+	// Create an instance of Results without any rows
+	results := Results{
+		Writer: &builder,
+		Format: FormatJSON,
+	}
+	results.Init()
+
+	// Create our mock activity monitor
+	mon := mock.ActivityMonitorImpl{}
+
+	// Save to our mock Writer
+	results.Save(&mon)
+
+	// Did we get an empty array?
+	if builder.String() != "[]\n" {
+		t.Errorf("Unexpected JSON contents: expected %q, actual %q", "[]\n", builder.String())
+	}
+}
+
+func TestColumnKey(t *testing.T) {
+	// Create our test cases
+	cases := map[string]string{
+		"Account ID":                            "account_id",
+		"Timestamp":                             "timestamp",
+		"# of EC2 Instances":                    "ec2_instances",
+		"# of EC2 K8 related VMs Sub-instances": "ec2_k8_related_vms_sub_instances",
+		"# of Unique Containers":                "unique_containers",
+	}
+
+	// Loop through the test cases
+	for columnName, expected := range cases {
+		if actual := ColumnKey(columnName); actual != expected {
+			t.Errorf("Unexpected key for %q: expected %s, actual %s", columnName, expected, actual)
+		}
+	}
+}
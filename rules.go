@@ -0,0 +1,345 @@
+/******************************************************************************
+Cloud Resource Counter
+File: rules.go
+
+Summary: Threshold rules (read from a YAML rules file) that are checked against
+         the counts of a run, such as "# of Lightsail Instances" == 0 or
+         ec2 growth < 20%.
+******************************************************************************/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ExitCodeViolations is the exit code of the tool when the counts break one (or
+// more) of the rules of the rules file.
+const ExitCodeViolations = 4
+
+// The operators that compare a count (or its growth) with the limit of a rule
+var ruleOperators = map[string]func(float64, float64) bool{
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+}
+
+// Matches a rule: a column (a quoted column name, a column key or a counter name),
+// an optional "growth", an operator and a limit (a percentage for growth only)
+var rulePattern = regexp.MustCompile(`^\s*("[^"]+"|[A-Za-z0-9_-]+)\s+(?:(growth)\s+)?(==|!=|<=|>=|<|>)\s*(-?[0-9]+(?:\.[0-9]+)?)(%?)\s*$`)
+
+// Rule is a threshold on a column of the results. Without Growth, the count of
+// the column is compared with the Limit (e.g., lightsail_instances == 0). With
+// Growth, the change of the count since the previous run of the same account and
+// region is compared instead: as a percentage of the previous count if Percent
+// is set (e.g., ec2_instances growth < 20%) or as a number of resources if not.
+type Rule struct {
+	Text     string
+	Column   string
+	Growth   bool
+	Percent  bool
+	Operator string
+	Limit    float64
+}
+
+// ParseRule parses the text of a rule. The column can be named by its name in
+// the CSV file (in double quotes), by its key in the JSON file or by the name of
+// its counter (e.g., "# of EC2 Instances", ec2_instances or EC2), in any case.
+func ParseRule(text string) (Rule, error) {
+	// Does it look like a rule?
+	match := rulePattern.FindStringSubmatch(text)
+	if match == nil {
+		return Rule{}, fmt.Errorf("'%s' is not a valid rule (expected, e.g., '\"# of EC2 Instances\" <= 100' or 'ec2 growth < 20%%')", text)
+	}
+
+	rule := Rule{
+		Text:     strings.TrimSpace(text),
+		Growth:   match[2] != "",
+		Percent:  match[5] != "",
+		Operator: match[3],
+	}
+	rule.Limit, _ = strconv.ParseFloat(match[4], 64)
+
+	// Which column is it?
+	column, ok := ruleColumn(match[1])
+	if !ok {
+		return Rule{}, fmt.Errorf("'%s': %s is not a known column or counter name", text, match[1])
+	}
+	rule.Column = column
+
+	// A percentage only makes sense for growth
+	if rule.Percent && !rule.Growth {
+		return Rule{}, fmt.Errorf("'%s': a percentage can only be used with growth", text)
+	}
+
+	return rule, nil
+}
+
+// Find the key of the column named by a rule (ignoring case)
+func ruleColumn(name string) (string, bool) {
+	for _, counter := range Counters {
+		key := ColumnKey(counter.Column())
+		if strings.EqualFold(name, `"`+counter.Column()+`"`) || strings.EqualFold(name, key) || strings.EqualFold(name, counter.Name()) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// Check returns a description of how the supplied row breaks the rule (or an
+// empty string, if it does not). Growth is measured since the supplied previous
+// row, if any. A rule is not checked if its column is missing from either row,
+// or if its growth is a percentage and the previous count is zero. A rule that
+// seems to be kept by an incomplete count cannot be confirmed, so it is reported
+// as well (unconfirmed is true).
+func (r Rule) Check(row HistoryRow, previous *HistoryRow) (description string, unconfirmed bool) {
+	// Was this column counted?
+	count, ok := row.Counts[r.Column]
+	if !ok {
+		return "", false
+	}
+	incomplete := count.Incomplete
+
+	// What value is checked?
+	var value float64
+	if r.Growth {
+		// Was this column counted in the previous run?
+		if previous == nil {
+			return "", false
+		}
+		prior, ok := previous.Counts[r.Column]
+		if !ok {
+			return "", false
+		}
+		incomplete = incomplete || prior.Incomplete
+
+		delta := ColumnDelta{Column: r.Column, Before: prior, After: count}
+		value = float64(delta.Change())
+		if r.Percent {
+			if value, ok = delta.PercentChange(); !ok {
+				return "", false
+			}
+			description = fmt.Sprintf("%s grew from %v to %v (%+.1f%%)", r.Column, prior, count, value)
+		} else {
+			description = fmt.Sprintf("%s grew from %v to %v (%+d)", r.Column, prior, count, delta.Change())
+		}
+	} else {
+		value = float64(count.Count)
+		description = fmt.Sprintf("%s is %v", r.Column, count)
+	}
+
+	// Is the rule kept (by complete counts)?
+	if ruleOperators[r.Operator](value, r.Limit) {
+		if incomplete {
+			return description, true
+		}
+		return "", false
+	}
+
+	return description, false
+}
+
+// RuleViolation describes a row of the results that breaks a rule, or whose
+// incomplete counts keep it, so that it cannot be confirmed (Unconfirmed).
+type RuleViolation struct {
+	Rule        Rule
+	AccountID   string
+	Region      string
+	Description string
+	Unconfirmed bool
+}
+
+// String returns a description of the violation.
+func (rv RuleViolation) String() string {
+	if rv.Unconfirmed {
+		return fmt.Sprintf("Account %s, region %s: %s, so rule %s cannot be confirmed", rv.AccountID, rv.Region, rv.Description, rv.Rule.Text)
+	}
+
+	return fmt.Sprintf("Account %s, region %s: %s, breaking rule %s", rv.AccountID, rv.Region, rv.Description, rv.Rule.Text)
+}
+
+// CheckRules checks the supplied rows against every rule. The growth of each
+// row is measured since the latest of the previous rows (of the same account and
+// region) that came before it.
+func CheckRules(rules []Rule, rows []HistoryRow, previousRows []HistoryRow) []RuleViolation {
+	var violations []RuleViolation
+	for _, row := range rows {
+		// Find the previous run of the same account and region
+		var previous *HistoryRow
+		for ix := range previousRows {
+			prior := &previousRows[ix]
+			if prior.AccountID == row.AccountID && prior.Region == row.Region && prior.Timestamp.Before(row.Timestamp) &&
+				(previous == nil || !prior.Timestamp.Before(previous.Timestamp)) {
+				previous = prior
+			}
+		}
+
+		// Check each rule
+		for _, rule := range rules {
+			if description, unconfirmed := rule.Check(row, previous); description != "" {
+				violations = append(violations, RuleViolation{
+					Rule:        rule,
+					AccountID:   row.AccountID,
+					Region:      row.Region,
+					Description: description,
+					Unconfirmed: unconfirmed,
+				})
+			}
+		}
+	}
+
+	return violations
+}
+
+// The contents of a rules file
+type rulesFile struct {
+	Rules []string `yaml:"rules"`
+}
+
+// ReadRulesFile reads the rules from the supplied YAML file, which lists them
+// under the "rules" key. The returned list describes every problem found in the
+// file (rather than just the first one).
+func ReadRulesFile(fileName string) ([]Rule, []string) {
+	// Read the file
+	contents, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("Unable to read rules file: %v", err)}
+	}
+
+	// Parse the file
+	var file rulesFile
+	if err = yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, []string{fmt.Sprintf("Unable to parse rules file %s: %v", fileName, err)}
+	}
+	if len(file.Rules) == 0 {
+		return nil, []string{fmt.Sprintf("%s: no rules are listed under 'rules'", fileName)}
+	}
+
+	// Parse each rule
+	var rules []Rule
+	var problems []string
+	for _, text := range file.Rules {
+		rule, err := ParseRule(text)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", fileName, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, problems
+}
+
+// ReportViolations lists the supplied violations (if any) and returns whether
+// there were any.
+func ReportViolations(violations []RuleViolation, am ActivityMonitor) bool {
+	if len(violations) == 0 {
+		return false
+	}
+
+	am.Message("\nThe following rules were broken (or could not be confirmed):\n")
+	for _, violation := range violations {
+		am.Message(" o %s\n", violation)
+	}
+
+	return true
+}
+
+// RunCheck runs the check subcommand with the supplied arguments: it checks the
+// latest run of each account and region in an output file against the rules of
+// a rules file, measuring growth since the run before it. The output file to read
+// is the only positional argument (resources.csv, if omitted).
+func RunCheck(args []string, am ActivityMonitor) {
+	var rulesFileName, toTime, accountID, regionName string
+
+	// Define a new FlagSet
+	flagSet := flag.NewFlagSet(os.Args[0]+" check", flag.ExitOnError)
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s check --rules FILE [options] [output-file]\n", os.Args[0])
+		flagSet.PrintDefaults()
+	}
+
+	// Define and parse the command line arguments...
+	flagSet.StringVar(&rulesFileName, "rules", "", "Check the runs against the rules in a YAML `file`.")
+	flagSet.StringVar(&toTime, "to", "", "Check the latest run at (or before) this `time` (a timestamp or a date). Defaults to the latest run.")
+	flagSet.StringVar(&accountID, "account", "", "Only check the runs of the account with this `ID`.")
+	flagSet.StringVar(&regionName, "region", "", "Only check the rows of this `region` (e.g., ALL_REGIONS or us-east-1).")
+	flagSet.Parse(args)
+
+	// Which output file should we read?
+	fileName := "resources.csv"
+	if flagSet.NArg() > 0 {
+		fileName = flagSet.Arg(0)
+	}
+
+	// Check our arguments
+	var problems []string
+	var rules []Rule
+	if rulesFileName == "" {
+		problems = append(problems, "A rules file must be supplied with --rules.")
+	} else {
+		var rulesProblems []string
+		rules, rulesProblems = ReadRulesFile(rulesFileName)
+		problems = append(problems, rulesProblems...)
+	}
+	var to time.Time
+	if toTime != "" {
+		var err error
+		if to, err = ParseDiffTime(toTime); err != nil {
+			problems = append(problems, "--to: "+err.Error())
+		}
+	}
+	if flagSet.NArg() > 1 {
+		problems = append(problems, "Only one output file can be checked.")
+	}
+	if len(problems) > 0 {
+		am.ActionError("Error: %s", strings.Join(problems, "\n"))
+		return
+	}
+
+	// Read the runs
+	rows, err := ReadHistoryFile(fileName)
+	if err != nil {
+		am.ActionError("Error: Unable to read %s: %v", fileName, err)
+		return
+	}
+
+	// Find the latest run of each selected account and region. Unless a region is
+	// selected, only the totals of each account are checked (not each region of
+	// a breakdown as well).
+	selected := rows
+	if regionName == "" {
+		selected = TotalsRows(rows)
+	}
+	var latest []HistoryRow
+	for _, group := range GroupHistory(selected) {
+		ix := len(group) - 1
+		if !to.IsZero() {
+			ix = latestRun(group, to)
+		}
+		if ix >= 0 && (accountID == "" || group[ix].AccountID == accountID) && (regionName == "" || group[ix].Region == regionName) {
+			latest = append(latest, group[ix])
+		}
+	}
+
+	// Check them
+	am.Message("Checked %d rule(s) against the latest run of %d account(s) and region(s) in %s.\n", len(rules), len(latest), fileName)
+	if ReportViolations(CheckRules(rules, latest, rows), am) {
+		am.Exit(ExitCodeViolations)
+		return
+	}
+
+	am.Message("No rules were broken.\n")
+}
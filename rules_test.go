@@ -0,0 +1,317 @@
+/******************************************************************************
+Cloud Resource Counter
+File: rules_test.go
+
+Summary: The Unit Test for rules.
+******************************************************************************/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestParseRule(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Text        string
+		Expected    Rule
+		ExpectError bool
+	}{
+		{
+			Text:     `"# of Lightsail Instances" == 0`,
+			Expected: Rule{Column: "lightsail_instances", Operator: "==", Limit: 0},
+		},
+		{
+			Text:     "ec2 growth < 20%",
+			Expected: Rule{Column: "ec2_instances", Growth: true, Percent: true, Operator: "<", Limit: 20},
+		},
+		{
+			Text:     " s3_buckets growth <= -2.5 ",
+			Expected: Rule{Column: "s3_buckets", Growth: true, Operator: "<=", Limit: -2.5},
+		},
+		{
+			Text:     "EC2 growth < 20%",
+			Expected: Rule{Column: "ec2_instances", Growth: true, Percent: true, Operator: "<", Limit: 20},
+		},
+		{
+			Text:     `"# of lambda functions" >= 1`,
+			Expected: Rule{Column: "lambda_functions", Operator: ">=", Limit: 1},
+		},
+		{
+			Text:     "S3_Buckets != 3",
+			Expected: Rule{Column: "s3_buckets", Operator: "!=", Limit: 3},
+		},
+		{
+			Text:        "dynamodb == 0",
+			ExpectError: true,
+		},
+		{
+			Text:        "lambda < 20%",
+			ExpectError: true,
+		},
+		{
+			Text:        "lambda is small",
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		actual, err := ParseRule(c.Text)
+		if c.ExpectError {
+			if err == nil {
+				t.Errorf("Expected an error parsing '%s'", c.Text)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", c.Text, err)
+			continue
+		}
+
+		// Ignore the text of the rule
+		actual.Text = ""
+		if actual != c.Expected {
+			t.Errorf("Unexpected rule parsing '%s': expected %+v, actual %+v", c.Text, c.Expected, actual)
+		}
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	// The previous runs of two accounts...
+	previousRows := []HistoryRow{
+		historyRow("111122223333", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10, "s3_buckets": 0}),
+		historyRow("111122223333", "2024-05-02T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 20, "s3_buckets": 0}),
+		historyRow("444455556666", "2024-05-02T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 1}),
+	}
+
+	// ...and their latest runs (the second account has not run before)
+	rows := []HistoryRow{
+		historyRow("111122223333", "2024-05-03T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 23, "s3_buckets": 4}),
+		historyRow("777788889999", "2024-05-03T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 50, "s3_buckets": 0}),
+	}
+
+	// Create our test cases
+	cases := []struct {
+		Rule     string
+		Expected []string
+	}{
+		{
+			Rule:     "ec2 <= 30",
+			Expected: []string{"777788889999: ec2_instances is 50"},
+		},
+		{
+			Rule:     "ec2 growth < 10%",
+			Expected: []string{"111122223333: ec2_instances grew from 20 to 23 (+15.0%)"},
+		},
+		{
+			Rule: "ec2 growth < 20%",
+		},
+		{
+			// The percentage growth from zero is unknown
+			Rule: "s3 growth <= 50%",
+		},
+		{
+			Rule:     "s3 growth <= 2",
+			Expected: []string{"111122223333: s3_buckets grew from 0 to 4 (+4)"},
+		},
+		{
+			// Lambda functions were not counted
+			Rule: "lambda == 0",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		rule, err := ParseRule(c.Rule)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", c.Rule, err)
+			continue
+		}
+
+		// Describe each violation briefly
+		var actual []string
+		for _, violation := range CheckRules([]Rule{rule}, rows, previousRows) {
+			actual = append(actual, violation.AccountID+": "+violation.Description)
+		}
+		if strings.Join(actual, "\n") != strings.Join(c.Expected, "\n") {
+			t.Errorf("Unexpected violations of '%s': expected %v, actual %v", c.Rule, c.Expected, actual)
+		}
+	}
+}
+
+func TestRuleCheckIncomplete(t *testing.T) {
+	// A previous run and a latest run whose count of instances is incomplete
+	previous := historyRow("111122223333", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10, "s3_buckets": 3})
+	row := historyRow("111122223333", "2024-05-02T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10, "s3_buckets": 3})
+	row.Counts["ec2_instances"] = CountResult{Count: 10, Incomplete: true}
+
+	// Create our test cases
+	cases := []struct {
+		Rule                string
+		ExpectedDescription string
+		ExpectedUnconfirmed bool
+	}{
+		{
+			// Kept, as far as we know
+			Rule:                "ec2 <= 20",
+			ExpectedDescription: "ec2_instances is 10 (incomplete)",
+			ExpectedUnconfirmed: true,
+		},
+		{
+			Rule:                "ec2 growth < 10%",
+			ExpectedDescription: "ec2_instances grew from 10 to 10 (incomplete) (+0.0%)",
+			ExpectedUnconfirmed: true,
+		},
+		{
+			// Broken, even by the incomplete count
+			Rule:                "ec2 < 5",
+			ExpectedDescription: "ec2_instances is 10 (incomplete)",
+		},
+		{
+			// Kept by a complete count
+			Rule: "s3 <= 3",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		rule, err := ParseRule(c.Rule)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %v", c.Rule, err)
+			continue
+		}
+
+		description, unconfirmed := rule.Check(row, &previous)
+		if description != c.ExpectedDescription || unconfirmed != c.ExpectedUnconfirmed {
+			t.Errorf("Unexpected check of '%s': expected %q (unconfirmed %v), actual %q (unconfirmed %v)",
+				c.Rule, c.ExpectedDescription, c.ExpectedUnconfirmed, description, unconfirmed)
+		}
+	}
+
+	// An unconfirmed rule is reported as such
+	rule, _ := ParseRule("ec2 <= 20")
+	violations := CheckRules([]Rule{rule}, []HistoryRow{row}, nil)
+	expected := "Account 111122223333, region ALL_REGIONS: ec2_instances is 10 (incomplete), so rule ec2 <= 20 cannot be confirmed"
+	if len(violations) != 1 || violations[0].String() != expected {
+		t.Errorf("Unexpected violations: expected %q, actual %v", expected, violations)
+	}
+}
+
+func TestReadRulesFile(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		Contents         string
+		ExpectedRules    int
+		ExpectedProblems int
+	}{
+		{
+			Contents:      "rules:\n  - lightsail == 0\n  - ec2 growth < 20%\n",
+			ExpectedRules: 2,
+		},
+		{
+			Contents:         "rules:\n  - lightsail == 0\n  - dynamodb == 0\n  - ec2 < 20%\n",
+			ExpectedRules:    1,
+			ExpectedProblems: 2,
+		},
+		{
+			Contents:         "thresholds:\n  - lightsail == 0\n",
+			ExpectedProblems: 1,
+		},
+		{
+			Contents:         "rules: []\n",
+			ExpectedProblems: 1,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		fileName := filepath.Join(t.TempDir(), "rules.yaml")
+		if err := os.WriteFile(fileName, []byte(c.Contents), 0644); err != nil {
+			t.Fatalf("Unexpected error while writing %s: %v", fileName, err)
+		}
+
+		rules, problems := ReadRulesFile(fileName)
+		if len(rules) != c.ExpectedRules || len(problems) != c.ExpectedProblems {
+			t.Errorf("Unexpected result of reading %q: expected %d rules and %d problems, actual %d rules and problems %v",
+				c.Contents, c.ExpectedRules, c.ExpectedProblems, len(rules), problems)
+		}
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	// Write an output file holding two runs (12 instances, up from 10) and a rules
+	// file
+	tempDir := t.TempDir()
+	fileName := filepath.Join(tempDir, "resources.csv")
+	if err := os.WriteFile(fileName, []byte(historyCSV), 0644); err != nil {
+		t.Fatalf("Unexpected error while writing %s: %v", fileName, err)
+	}
+	rulesFileName := filepath.Join(tempDir, "rules.yaml")
+	if err := os.WriteFile(rulesFileName, []byte("rules:\n  - ec2 growth < 10%\n  - lambda <= 5\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while writing %s: %v", rulesFileName, err)
+	}
+
+	// Construct our test cases...
+	cases := []struct {
+		Args             []string
+		ExpectError      bool
+		ExpectViolations bool
+		ExpectedMessage  string
+	}{
+		{
+			Args:             []string{"--rules", rulesFileName, fileName},
+			ExpectViolations: true,
+			ExpectedMessage:  "ec2_instances grew from 10 to 12 (incomplete) (+20.0%), breaking rule ec2 growth < 10%",
+		},
+		{
+			Args:            []string{"--rules", rulesFileName, "--to", "2024-05-01", fileName},
+			ExpectedMessage: "No rules were broken.",
+		},
+		{
+			Args:            []string{"--rules", rulesFileName, "--account", "444455556666", fileName},
+			ExpectedMessage: "the latest run of 0 account(s)",
+		},
+		{
+			Args:        []string{fileName},
+			ExpectError: true,
+		},
+		{
+			Args:        []string{"--rules", rulesFileName, filepath.Join(tempDir, "missing.csv")},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Check the runs
+		RunCheck(c.Args, mon)
+
+		// Did we expect an error?
+		if c.ExpectError {
+			if !mon.ErrorOccured {
+				t.Errorf("Expected an error to occur for %v, but it did not... :^(", c.Args)
+			}
+			continue
+		} else if mon.ErrorOccured {
+			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
+			continue
+		}
+
+		// Did we exit as expected?
+		if c.ExpectViolations != (mon.ProgramExited && mon.ExitCode == ExitCodeViolations) {
+			t.Errorf("Unexpected exit for %v: exited %v, with code %d", c.Args, mon.ProgramExited, mon.ExitCode)
+		}
+		if messages := strings.Join(mon.Messages, ""); !strings.Contains(messages, c.ExpectedMessage) {
+			t.Errorf("Expected the messages for %v to contain %q:\n%s", c.Args, c.ExpectedMessage, messages)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/******************************************************************************
+Cloud Resource Counter
+File: runContext.go
+
+Summary: The RunContext struct (settings shared by all counters during a run)
+         and the bounded worker pool used to scan regions concurrently.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RunContext carries the settings that control how each counter walks the
+// regions associated with an account.
+type RunContext struct {
+	// Should all regions be examined (or only the region of the session)?
+	AllRegions bool
+
+	// When all regions are examined, only those matching one of the Regions (if
+	// any) and none of the ExcludeRegions are examined. Each is a region name or
+	// a glob pattern (e.g., "ap-*").
+	Regions        []string
+	ExcludeRegions []string
+
+	// The maximum number of regions that are scanned at the same time.
+	// Values less than 1 are treated as 1 (scan serially).
+	Concurrency int
+
+	// Should counts be attributed to individual regions? This is needed by
+	// counters (like S3) that must do extra work to find the region of each
+	// resource.
+	ByRegion bool
+
+	// The counters to run (in order)
+	Counters []Counter
+
+	// The partition of the accounts (e.g., "aws-us-gov"). If empty, the partition
+	// of each account is detected from the identity of its caller.
+	Partition string
+
+	// The inventory of every resource inspected by the counters. This is nil
+	// unless an inventory was requested.
+	Inventory *Inventory
+
+	// The context of the run. It is cancelled when the run is interrupted (or
+	// times out), which stops every AWS request. If nil, the run is never
+	// cancelled.
+	Context context.Context
+
+	// The longest time that a counter may spend examining a single region. It
+	// is not limited if it is zero.
+	RegionTimeout time.Duration
+}
+
+// RequestContext returns the context of the run (which is never nil).
+func (rc *RunContext) RequestContext() context.Context {
+	if rc.Context == nil {
+		return context.Background()
+	}
+
+	return rc.Context
+}
+
+// RegionContext returns a context (derived from that of the run) for a counter
+// to examine a single region, along with the function that releases it. Its
+// deadline is the RegionTimeout (if any).
+func (rc *RunContext) RegionContext() (context.Context, context.CancelFunc) {
+	if rc.RegionTimeout <= 0 {
+		return context.WithCancel(rc.RequestContext())
+	}
+
+	return context.WithTimeout(rc.RequestContext(), rc.RegionTimeout)
+}
+
+// Interrupted returns whether the run was interrupted (or timed out).
+func (rc *RunContext) Interrupted() bool {
+	return rc.RequestContext().Err() != nil
+}
+
+// ResolveRegions returns the list of regions that the counters should examine.
+// If all regions are requested, this is the list of regions enabled for the
+// account (less any that are not selected). Otherwise, it is the region
+// associated with the session (whose opt-in status is not known).
+func (rc *RunContext) ResolveRegions(sf ServiceFactory, am ActivityMonitor) []RegionInfo {
+	// Should we get the list of all enabled regions for this account?
+	if !rc.AllRegions {
+		return []RegionInfo{{Name: sf.GetCurrentRegion()}}
+	}
+
+	// Keep the selected regions. The list is never nil, so that it is only
+	// resolved once (even if it failed).
+	regions := []RegionInfo{}
+	for _, region := range GetEC2Regions(rc.RequestContext(), sf.GetEC2InstanceService(""), am) {
+		if rc.IsRegionSelected(region.Name) {
+			regions = append(regions, region)
+		}
+	}
+
+	return regions
+}
+
+// IsRegionSelected returns whether the named region should be examined when all
+// regions are requested.
+func (rc *RunContext) IsRegionSelected(regionName string) bool {
+	return len(SelectRegions([]string{regionName}, rc.Regions, rc.ExcludeRegions)) > 0
+}
+
+// EveryRegion returns whether every enabled region is examined (i.e., all regions
+// are requested and none are left out by the Regions or ExcludeRegions).
+func (rc *RunContext) EveryRegion() bool {
+	return rc.AllRegions && len(rc.Regions) == 0 && len(rc.ExcludeRegions) == 0
+}
+
+// ScanRegions invokes the supplied function once for each region name, running
+// at most concurrency invocations at the same time. The results are returned in
+// the same order as the supplied region names so that callers can merge them
+// deterministically, regardless of the order in which the regions complete.
+func ScanRegions[T any](regionNames []string, concurrency int, fn func(string) T) []T {
+	// Clamp the number of workers to something reasonable
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(regionNames) {
+		concurrency = len(regionNames)
+	}
+
+	// Feed the index of each region to our workers
+	indexes := make(chan int)
+	go func() {
+		for ix := range regionNames {
+			indexes <- ix
+		}
+		close(indexes)
+	}()
+
+	// Start our workers. Each writes only to its own slots of the results.
+	results := make([]T, len(regionNames))
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ix := range indexes {
+				results[ix] = fn(regionNames[ix])
+			}
+		}()
+	}
+
+	// Wait for all regions to be scanned
+	wg.Wait()
+
+	return results
+}
+
+// SumCounts returns the total of the supplied per-region counts.
+func SumCounts(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	return total
+}
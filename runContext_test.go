@@ -0,0 +1,101 @@
+/******************************************************************************
+Cloud Resource Counter
+File: runContext_test.go
+
+Summary: The Unit Test for runContext.
+******************************************************************************/
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScanRegions(t *testing.T) {
+	// A set of regions to scan
+	regionNames := []string{"us-east-1", "us-east-2", "us-west-1", "us-west-2", "eu-west-1", "af-south-1"}
+
+	// Create our test cases
+	cases := []struct {
+		Concurrency       int
+		ExpectedMaxActive int
+	}{
+		{
+			Concurrency:       0,
+			ExpectedMaxActive: 1,
+		},
+		{
+			Concurrency:       1,
+			ExpectedMaxActive: 1,
+		},
+		{
+			Concurrency:       3,
+			ExpectedMaxActive: 3,
+		},
+		{
+			Concurrency:       100,
+			ExpectedMaxActive: len(regionNames),
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		// Keep track of the number of active scans
+		var mu sync.Mutex
+		var active, maxActive int
+
+		// Scan the regions, returning the upper case version of each name
+		results := ScanRegions(regionNames, c.Concurrency, func(regionName string) string {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			// Give other workers a chance to start
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+
+			return strings.ToUpper(regionName)
+		})
+
+		// Are the results in the same order as the regions?
+		for ix, result := range results {
+			if result != strings.ToUpper(regionNames[ix]) {
+				t.Errorf("Unexpected result at %d: expected %s, actual %s", ix, strings.ToUpper(regionNames[ix]), result)
+			}
+		}
+
+		// Did we exceed our concurrency?
+		if maxActive > c.ExpectedMaxActive {
+			t.Errorf("Too many concurrent scans: expected at most %d, actual %d", c.ExpectedMaxActive, maxActive)
+		}
+	}
+}
+
+func TestScanRegionsEmpty(t *testing.T) {
+	// Scan no regions
+	results := ScanRegions(nil, 4, func(regionName string) int {
+		t.Errorf("Unexpected scan of region %s", regionName)
+		return 0
+	})
+
+	// Did we get an empty result?
+	if len(results) != 0 {
+		t.Errorf("Unexpected number of results: expected %d, actual %d", 0, len(results))
+	}
+}
+
+func TestSumCounts(t *testing.T) {
+	// Sum some counts
+	if actual := SumCounts(map[string]int{"us-east-1": 4, "us-east-2": 5, "us-west-1": 0, "us-west-2": 1}); actual != 10 {
+		t.Errorf("Unexpected sum: expected %d, actual %d", 10, actual)
+	}
+}
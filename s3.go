@@ -8,9 +8,8 @@ Summary: Provides a count of all S3 buckets.
 package main
 
 import (
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
-
-	color "github.com/logrusorgru/aurora"
 )
 
 // S3Buckets retrieves the count of all S3 buckets in ALL REGIONS.
@@ -19,40 +18,87 @@ import (
 //
 // AS SUCH, THIS COUNT WILL BE INCORRECT WHEN A SINGLE REGION IS SPECIFIED.
 //
-// It is unclear if displaying counts of distinct regions will be part
-// of the final CLI.
+// When counts are attributed to regions (rc.ByRegion is true), the
+// location of each bucket is retrieved so that the bucket is counted in
+// the region where it resides.
 //
 // This method gives status back to the user via the supplied
 // ActivityMonitor instance.
-func S3Buckets(sf ServiceFactory, am ActivityMonitor, allRegions bool) int {
+func S3Buckets(sf ServiceFactory, am ActivityMonitor, rc *RunContext) CountResult {
+	return RunCounter(S3Counter, &CountContext{ServiceFactory: sf, Monitor: am, Run: rc})
+}
+
+// s3Counter counts the S3 buckets of all regions.
+type s3Counter struct {
+	CounterInfo
+}
+
+// S3Counter is the registered Counter for S3 buckets. It is a global counter.
+var S3Counter = s3Counter{CounterInfo{
+	CounterName:  "s3",
+	ColumnName:   "# of S3 Buckets",
+	ServiceName:  "S3",
+	ActivityName: "S3 bucket",
+	Actions:      []string{"s3:ListAllMyBuckets"},
+
+	// The location of each bucket is only needed to attribute it to its region
+	BreakdownActions: []string{"s3:GetBucketLocation"},
+}}
+
+// Count the S3 buckets of all regions
+func (s3Counter) Count(ctx *CountContext, regionName string) RegionResult {
 	// Create a new instance of the S3 (abstract) service
-	svc := sf.GetS3Service()
+	svc := ctx.ServiceFactory.GetS3Service()
 
 	// Construct our input to find all S3 buckets
 	input := &s3.ListBucketsInput{}
 
-	// Indicate activity
-	am.StartAction("Retrieving S3 bucket counts")
-
 	// Invoke our service
-	result, err := svc.ListBuckets(input)
+	result, err := svc.ListBuckets(ctx.RequestContext(), input)
 
 	// Check for error
-	if am.CheckError(err) {
-		return 0
+	if err != nil {
+		return NewRegionResult(0, err)
 	}
 
-	// Get our count of buckets
-	count := len(result.Buckets)
+	// Every bucket is counted
+	regionResult := RegionResult{Count: len(result.Buckets)}
+	for _, bucket := range result.Buckets {
+		regionResult.Inventory = append(regionResult.Inventory, CountedItem(aws.StringValue(bucket.Name), "", "bucket"))
+	}
 
-	// Should we "qualify" our count?
-	var qualify string
-	if !allRegions && count > 0 {
-		qualify = "*"
+	// Should we attribute each bucket to its region?
+	if ctx.Run.ByRegion {
+		regionResult.ByRegion, regionResult.Errs = s3BucketsByRegion(ctx.RequestContext(), svc, result.Buckets, regionResult.Inventory, ctx.Monitor)
 	}
 
-	// Indicate end of activity
-	am.EndAction("OK (%d%s)", color.Bold(count), qualify)
+	return regionResult
+}
+
+// Count the supplied buckets by the region in which they reside, noting the
+// region of each in its inventory item
+func s3BucketsByRegion(c aws.Context, svc *S3Service, buckets []*s3.Bucket, items []InventoryItem, am ActivityMonitor) (map[string]int, []error) {
+	var errs []error
+	counts := make(map[string]int)
+	for ix, bucket := range buckets {
+		// Indicate activity
+		am.Message(".")
+
+		// Where is the bucket?
+		result, err := svc.GetBucketLocation(c, &s3.GetBucketLocationInput{
+			Bucket: bucket.Name,
+		})
+
+		// Check for error. We do not know the region of this bucket.
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// Convert the location constraint into a region name (e.g., "" is "us-east-1")
+		items[ix].Region = s3.NormalizeBucketLocation(aws.StringValue(result.LocationConstraint))
+		counts[items[ix].Region]++
+	}
 
-	return count
+	return counts, errs
 }
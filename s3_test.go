@@ -9,9 +9,11 @@ package main
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/expel-io/aws-resource-counter/mock"
@@ -51,6 +53,18 @@ var fakeS3BucketsSlice = &s3.ListBucketsOutput{
 	},
 }
 
+// This simulates the location constraint of each bucket (as returned by AWS)
+var fakeS3BucketLocations = map[string]string{
+	"bucket1": "",
+	"bucket2": "",
+	"bucket3": "us-west-2",
+	"bucket4": "EU",
+	"bucket5": "eu-west-1",
+	"bucket6": "us-west-2",
+	"bucket7": "",
+	"bucket8": "ap-south-1",
+}
+
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
 // Fake S3 Service
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
@@ -60,10 +74,11 @@ var fakeS3BucketsSlice = &s3.ListBucketsOutput{
 // the corresponding function.
 type fakeS3Service struct {
 	s3iface.S3API
-	LBResponse *s3.ListBucketsOutput
+	LBResponse  *s3.ListBucketsOutput
+	GBLResponse map[string]string
 }
 
-func (fs3 *fakeS3Service) ListBuckets(input *s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+func (fs3 *fakeS3Service) ListBucketsWithContext(ctx aws.Context, input *s3.ListBucketsInput, _ ...request.Option) (*s3.ListBucketsOutput, error) {
 	// If there was no supplied response, then simulate a possible error
 	if fs3.LBResponse == nil {
 		return nil, errors.New("ListBuckets returns an unexpected error: 2345")
@@ -72,6 +87,18 @@ func (fs3 *fakeS3Service) ListBuckets(input *s3.ListBucketsInput) (*s3.ListBucke
 	return fs3.LBResponse, nil
 }
 
+func (fs3 *fakeS3Service) GetBucketLocationWithContext(ctx aws.Context, input *s3.GetBucketLocationInput, _ ...request.Option) (*s3.GetBucketLocationOutput, error) {
+	// If there is no location for the bucket, then simulate an error
+	location, ok := fs3.GBLResponse[*input.Bucket]
+	if !ok {
+		return nil, errors.New("GetBucketLocation returns an unexpected error: 3456")
+	}
+
+	return &s3.GetBucketLocationOutput{
+		LocationConstraint: aws.String(location),
+	}, nil
+}
+
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
 // Fake Service Factory
 // =-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=-=
@@ -79,7 +106,8 @@ func (fs3 *fakeS3Service) ListBuckets(input *s3.ListBucketsInput) (*s3.ListBucke
 // This structure simulates the AWS Service Factory by storing some pregenerated
 // responses (that would come from AWS).
 type fakeS3ServiceFactory struct {
-	LBResponse *s3.ListBucketsOutput
+	LBResponse  *s3.ListBucketsOutput
+	GBLResponse map[string]string
 }
 
 // Don't need to implement
@@ -95,6 +123,16 @@ func (fsf fakeS3ServiceFactory) GetAccountIDService() *AccountIDService {
 	return nil
 }
 
+// Don't need to implement
+func (fsf fakeS3ServiceFactory) GetOrganizationService() *OrganizationService {
+	return nil
+}
+
+// Don't need to implement
+func (fsf fakeS3ServiceFactory) GetIAMService() *IAMService {
+	return nil
+}
+
 // Don't need to implement
 func (fsf fakeS3ServiceFactory) GetEC2InstanceService(string) *EC2InstanceService {
 	return nil
@@ -109,7 +147,8 @@ func (fsf fakeS3ServiceFactory) GetRDSInstanceService(regionName string) *RDSIns
 func (fsf fakeS3ServiceFactory) GetS3Service() *S3Service {
 	return &S3Service{
 		Client: &fakeS3Service{
-			LBResponse: fsf.LBResponse,
+			LBResponse:  fsf.LBResponse,
+			GBLResponse: fsf.GBLResponse,
 		},
 	}
 }
@@ -169,20 +208,101 @@ func TestS3Buckets(t *testing.T) {
 		mon := &mock.ActivityMonitorImpl{}
 
 		// Invoke our S3 Buckets function
-		actualCount := S3Buckets(sf, mon, false)
+		actualCount := S3Buckets(sf, mon, &RunContext{})
 
 		// Did we expect an error?
 		if c.ExpectError {
 			// Did it fail to arrive?
 			if !mon.ErrorOccured {
 				t.Error("Expected an error to occur, but it did not... :^(")
+			} else if !actualCount.Incomplete {
+				t.Error("Expected the count to be marked incomplete, but it was not")
 			}
 		} else if mon.ErrorOccured {
 			t.Errorf("Unexpected error occurred: %s", mon.ErrorMessage)
-		} else if actualCount != c.ExpectedCount {
-			t.Errorf("Error: S3Buckets returned %d; expected %d", actualCount, c.ExpectedCount)
+		} else if actualCount.Count != c.ExpectedCount {
+			t.Errorf("Error: S3Buckets returned %d; expected %d", actualCount.Count, c.ExpectedCount)
 		} else if mon.ProgramExited {
 			t.Errorf("Unexpected Exit: The program unexpected exited with status code=%d", mon.ExitCode)
 		}
 	}
 }
+
+func TestS3BucketsByRegion(t *testing.T) {
+	// Describe all of our test cases: 1 failure and 1 success
+	cases := []struct {
+		Locations        map[string]string
+		ExpectedByRegion map[string]int
+		ExpectError      bool
+	}{
+		{
+			Locations: fakeS3BucketLocations,
+			ExpectedByRegion: map[string]int{
+				"us-east-1":  3,
+				"us-west-2":  2,
+				"eu-west-1":  2,
+				"ap-south-1": 1,
+			},
+		}, {
+			Locations: map[string]string{
+				"bucket1": "",
+				"bucket3": "us-west-2",
+			},
+			ExpectedByRegion: map[string]int{
+				"us-east-1": 1,
+				"us-west-2": 1,
+			},
+			ExpectError: true,
+		},
+	}
+
+	// Loop through each test case
+	for _, c := range cases {
+		// Create our fake service factory
+		sf := fakeS3ServiceFactory{
+			LBResponse:  fakeS3BucketsSlice,
+			GBLResponse: c.Locations,
+		}
+
+		// Create a mock activity monitor
+		mon := &mock.ActivityMonitorImpl{}
+
+		// Invoke our S3 Buckets function, attributing buckets to regions
+		actualCount := S3Buckets(sf, mon, &RunContext{AllRegions: true, ByRegion: true})
+
+		// The total is always the number of buckets
+		if actualCount.Count != len(fakeS3BucketsSlice.Buckets) {
+			t.Errorf("Error: S3Buckets returned %d; expected %d", actualCount.Count, len(fakeS3BucketsSlice.Buckets))
+		} else if !reflect.DeepEqual(actualCount.ByRegion, c.ExpectedByRegion) {
+			t.Errorf("Unexpected per-region counts: expected %v, actual %v", c.ExpectedByRegion, actualCount.ByRegion)
+		} else if c.ExpectError != mon.ErrorOccured {
+			t.Errorf("Unexpected ErrorOccured: expected %v, actual %v", c.ExpectError, mon.ErrorOccured)
+		} else if c.ExpectError && !actualCount.ForRegion("us-east-1").Incomplete {
+			t.Error("Expected the per-region counts to be marked incomplete, but they were not")
+		}
+	}
+}
+
+func TestS3CounterActions(t *testing.T) {
+	// Create our test cases
+	cases := []struct {
+		ByRegion bool
+		Expected []string
+	}{
+		{
+			Expected: []string{"s3:ListAllMyBuckets"},
+		},
+		{
+			// The location of each bucket is retrieved
+			ByRegion: true,
+			Expected: []string{"s3:ListAllMyBuckets", "s3:GetBucketLocation"},
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		if actual := S3Counter.IAMActions(c.ByRegion); !reflect.DeepEqual(actual, c.Expected) {
+			t.Errorf("Unexpected actions (by region: %v): expected %v, actual %v", c.ByRegion, c.Expected, actual)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/******************************************************************************
+Cloud Resource Counter
+File: schedule.go
+
+Summary: Schedules for the runs of long-lived subcommands (serve and daemon):
+         a fixed interval or a cron-like specification.
+******************************************************************************/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when the runs of a long-lived subcommand start.
+type Schedule interface {
+	// Next returns the start of the first run after the supplied time (or the
+	// zero time, if there is none)
+	Next(after time.Time) time.Time
+}
+
+// EverySchedule starts a run at a fixed interval after the start of the prior
+// run.
+type EverySchedule struct {
+	Interval time.Duration
+}
+
+// Next returns the supplied time plus the interval.
+func (es EverySchedule) Next(after time.Time) time.Time {
+	return after.Add(es.Interval)
+}
+
+// The macros that can be used in place of the fields of a cron specification
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// CronSchedule starts a run at each minute (in local time) that matches every
+// field of a cron specification: minute, hour, day of month, month and day of
+// week. As in cron, a day matches if either of its fields matches when both are
+// restricted.
+type CronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+
+	// Were the days restricted (rather than "*")?
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// ParseSchedule parses a schedule: a cron specification with five fields (e.g.,
+// "30 2 * * 1-5"), a macro (@hourly, @daily, @weekly or @monthly) or "@every"
+// followed by a duration (e.g., "@every 6h"). Each field of a cron specification
+// is "*" or a list of values, ranges (e.g., 1-5) and steps (e.g., */15 or 0-30/10).
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	// Is it an interval?
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("'%s' is not a valid schedule (expected a positive duration after @every, e.g., @every 6h)", spec)
+		}
+		return EverySchedule{Interval: interval}, nil
+	}
+
+	// Is it a macro?
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	// Parse each field
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("'%s' is not a valid schedule (expected five fields, e.g., '0 2 * * *', or a macro such as @daily)", spec)
+	}
+	limits := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets []map[int]bool
+	for ix, field := range fields {
+		set, err := parseCronField(field, limits[ix][0], limits[ix][1])
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid schedule: %v", spec, err)
+		}
+		sets = append(sets, set)
+	}
+
+	// Sunday is both 0 and 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	schedule := &CronSchedule{
+		minutes:       sets[0],
+		hours:         sets[1],
+		daysOfMonth:   sets[2],
+		months:        sets[3],
+		daysOfWeek:    sets[4],
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+
+	// Does it ever match? (e.g., "0 0 30 2 *" never does)
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("'%s' is not a valid schedule: it never matches", spec)
+	}
+
+	return schedule, nil
+}
+
+// Parse a field of a cron specification into the set of values that it matches
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		// Is there a step?
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return nil, fmt.Errorf("'%s' has an invalid step", part)
+			}
+		}
+
+		// What is the range?
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return nil, fmt.Errorf("'%s' is not a number, range or *", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return nil, fmt.Errorf("'%s' is not a number, range or *", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("'%s' is out of range (%d-%d)", part, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			set[value] = true
+		}
+	}
+
+	return set, nil
+}
+
+// Next returns the first minute after the supplied time that matches the
+// schedule. Rather than checking every minute, it skips over months, days and
+// hours that do not match. It gives up (returning the zero time) after five
+// years.
+func (cs *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !cs.months[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !cs.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !cs.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !cs.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Does the day of the supplied time match the schedule?
+func (cs *CronSchedule) dayMatches(t time.Time) bool {
+	dayOfMonth := cs.daysOfMonth[t.Day()]
+	dayOfWeek := cs.daysOfWeek[int(t.Weekday())]
+
+	switch {
+	case cs.anyDayOfMonth && cs.anyDayOfWeek:
+		return true
+	case cs.anyDayOfMonth:
+		return dayOfWeek
+	case cs.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,116 @@
+/******************************************************************************
+Cloud Resource Counter
+File: schedule_test.go
+
+Summary: The Unit Test for schedule.
+******************************************************************************/
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// A Friday, in local time
+	after := time.Date(2024, time.May, 3, 14, 7, 30, 0, time.Local)
+
+	// Create our test cases
+	cases := []struct {
+		Spec         string
+		ExpectError  bool
+		ExpectedNext time.Time
+	}{
+		{
+			Spec:         "* * * * *",
+			ExpectedNext: time.Date(2024, time.May, 3, 14, 8, 0, 0, time.Local),
+		},
+		{
+			Spec:         "*/15 * * * *",
+			ExpectedNext: time.Date(2024, time.May, 3, 14, 15, 0, 0, time.Local),
+		},
+		{
+			Spec:         "@hourly",
+			ExpectedNext: time.Date(2024, time.May, 3, 15, 0, 0, 0, time.Local),
+		},
+		{
+			Spec:         "@daily",
+			ExpectedNext: time.Date(2024, time.May, 4, 0, 0, 0, 0, time.Local),
+		},
+		{
+			Spec:         "30 2 * * 1-5",
+			ExpectedNext: time.Date(2024, time.May, 6, 2, 30, 0, 0, time.Local),
+		},
+		{
+			Spec:         "0 6,18 * * 7",
+			ExpectedNext: time.Date(2024, time.May, 5, 6, 0, 0, 0, time.Local),
+		},
+		{
+			Spec:         "@monthly",
+			ExpectedNext: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.Local),
+		},
+		{
+			// Either the 15th or a Monday
+			Spec:         "0 0 15 * 1",
+			ExpectedNext: time.Date(2024, time.May, 6, 0, 0, 0, 0, time.Local),
+		},
+		{
+			Spec:         "0 0 29 2 *",
+			ExpectedNext: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.Local),
+		},
+		{
+			Spec:         "@every 90m",
+			ExpectedNext: after.Add(90 * time.Minute),
+		},
+		{
+			Spec:        "0 0 30 2 *",
+			ExpectError: true,
+		},
+		{
+			Spec:        "0 0 * *",
+			ExpectError: true,
+		},
+		{
+			Spec:        "60 * * * *",
+			ExpectError: true,
+		},
+		{
+			Spec:        "0 5-2 * * *",
+			ExpectError: true,
+		},
+		{
+			Spec:        "*/0 * * * *",
+			ExpectError: true,
+		},
+		{
+			Spec:        "0 0 * * mon",
+			ExpectError: true,
+		},
+		{
+			Spec:        "@every -1h",
+			ExpectError: true,
+		},
+		{
+			Spec:        "@yearly",
+			ExpectError: true,
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		schedule, err := ParseSchedule(c.Spec)
+		if c.ExpectError != (err != nil) {
+			t.Errorf("Unexpected error for %s: %v", c.Spec, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// When is the next run?
+		if next := schedule.Next(after); !next.Equal(c.ExpectedNext) {
+			t.Errorf("Unexpected next run for %s: expected %v, actual %v", c.Spec, c.ExpectedNext, next)
+		}
+	}
+}
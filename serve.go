@@ -0,0 +1,75 @@
+/******************************************************************************
+Cloud Resource Counter
+File: serve.go
+
+Summary: The serve subcommand, which counts resources on an interval and serves
+         the counts of the latest run as Prometheus metrics over HTTP.
+******************************************************************************/
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MetricsHandler serves the metrics of the latest run (see RunMetrics) in the
+// Prometheus text exposition format. Until the first run completes, there are no
+// metrics to serve.
+type MetricsHandler struct {
+	mu      sync.Mutex
+	metrics *RunMetrics
+}
+
+// Update replaces the metrics that are served.
+func (mh *MetricsHandler) Update(metrics *RunMetrics) {
+	mh.mu.Lock()
+	defer mh.mu.Unlock()
+
+	mh.metrics = metrics
+}
+
+// ServeHTTP writes the metrics of the latest run.
+func (mh *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mh.mu.Lock()
+	metrics := mh.metrics
+	mh.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if metrics != nil {
+		metrics.WriteTo(w)
+	}
+}
+
+// RunServe runs the serve subcommand with the supplied arguments (those of the
+// tool, along with --listen and --interval). It counts resources every interval
+// until it receives SIGINT or SIGTERM. Errors are recorded (and exported as
+// metrics) rather than ending the server.
+func RunServe(args []string, monitor *TerminalActivityMonitor) {
+	// Process all command line arguments
+	settings := &CommandLineSettings{subcommand: SubcommandServe}
+	cleanupFn := settings.Process(args, monitor)
+	defer cleanupFn()
+
+	// Show command line settings
+	settings.Display(monitor)
+
+	// Start serving our metrics
+	listener, err := net.Listen("tcp", settings.listenAddress)
+	if err != nil {
+		cleanupFn()
+		monitor.ActionError("Error: Unable to listen on %s: %v", settings.listenAddress, err)
+		return
+	}
+	handler := &MetricsHandler{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// Count every interval (serving the metrics of each run) until we are stopped
+	runScheduled(settings, monitor, EverySchedule{Interval: settings.interval}, true, handler.Update)
+}
@@ -0,0 +1,36 @@
+/******************************************************************************
+Cloud Resource Counter
+File: serve_test.go
+
+Summary: The Unit Test for serve.
+******************************************************************************/
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	handler := &MetricsHandler{}
+
+	// Nothing is served before the first run
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Code != 200 || recorder.Body.Len() != 0 {
+		t.Errorf("Unexpected response before the first run: %d\n%s", recorder.Code, recorder.Body.String())
+	}
+
+	// The metrics of the latest run are served
+	handler.Update(testRunMetrics())
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type: %s", recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(recorder.Body.String(), `resource="ec2_instances"} 10`) {
+		t.Errorf("Unexpected metrics:\n%s", recorder.Body.String())
+	}
+}
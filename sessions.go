@@ -0,0 +1,69 @@
+/******************************************************************************
+Cloud Resource Counter
+File: sessions.go
+
+Summary: Keeps the AWS sessions of each profile, so that the runs of long-lived
+         subcommands can reuse them (refreshing their credentials).
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// SessionCache holds an AWS Service Factory for each profile (created on first
+// use) along with the ThrottleControl shared by their sessions. A one-shot run
+// uses each factory once; the daemon and serve subcommands reuse them, calling
+// Refresh before each run.
+type SessionCache struct {
+	Throttling *ThrottleControl
+
+	factories map[string]*AWSServiceFactory
+
+	// The profiles whose credentials could not be refreshed for this run
+	failed map[string]bool
+}
+
+// NewSessionCache constructs an empty SessionCache whose sessions are retried
+// (and rate limited) according to the settings.
+func NewSessionCache(settings *CommandLineSettings) *SessionCache {
+	return &SessionCache{
+		Throttling: &ThrottleControl{Policy: settings.retryPolicy, RateLimit: settings.rateLimit},
+		factories:  make(map[string]*AWSServiceFactory),
+		failed:     make(map[string]bool),
+	}
+}
+
+// Factory returns the AWS Service Factory of the named profile, establishing its
+// session on first use. It returns nil if the credentials of the profile could not
+// be refreshed for this run.
+func (sc *SessionCache) Factory(profileName string, settings *CommandLineSettings) *AWSServiceFactory {
+	if sc.failed[profileName] {
+		return nil
+	}
+
+	// Have we established its session?
+	if sc.factories[profileName] == nil {
+		sc.factories[profileName] = newServiceFactory(profileName, settings, sc.Throttling)
+	}
+
+	return sc.factories[profileName]
+}
+
+// Refresh renews the credentials of every session established so far (see
+// AWSServiceFactory.Refresh) and resets the retries (and throttling errors)
+// counted by the previous run. An error is recorded for each profile whose
+// credentials cannot be renewed (e.g., as its SSO token expired); it is skipped
+// until the next refresh.
+func (sc *SessionCache) Refresh(ctx context.Context, am ActivityMonitor) {
+	sc.Throttling.ResetStats()
+	sc.failed = make(map[string]bool)
+	for profileName, factory := range sc.factories {
+		if err := factory.Refresh(ctx); err != nil {
+			sc.failed[profileName] = true
+			am.CheckError(fmt.Errorf("unable to refresh the credentials of profile %s (it is skipped): %v", profileName, err))
+		}
+	}
+}
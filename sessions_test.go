@@ -0,0 +1,84 @@
+/******************************************************************************
+Cloud Resource Counter
+File: sessions_test.go
+
+Summary: The Unit Test for sessions.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/expel-io/aws-resource-counter/mock"
+)
+
+func TestSessionCache(t *testing.T) {
+	// Keep away from any real AWS credentials
+	tempDir := t.TempDir()
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(tempDir, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(tempDir, "config"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAFAKEAWS")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "fakeaws")
+
+	settings := &CommandLineSettings{regionName: "us-east-1"}
+	sessions := NewSessionCache(settings)
+
+	// The factory of a profile is established once...
+	factory := sessions.Factory("default", settings)
+	if factory == nil || sessions.Factory("default", settings) != factory {
+		t.Fatalf("Expected the factory of the profile to be reused")
+	}
+	if factory.Throttling != sessions.Throttling {
+		t.Errorf("Expected the factory to share the throttling of the cache")
+	}
+
+	// ...and refreshed before each run
+	mon := &mock.ActivityMonitorImpl{}
+	sessions.Refresh(context.Background(), mon)
+	if mon.ErrorOccured || sessions.Factory("default", settings) != factory {
+		t.Errorf("Unexpected refresh of the profile: %s", mon.ErrorMessage)
+	}
+
+	// A profile whose credentials can no longer be found is skipped
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	mon = &mock.ActivityMonitorImpl{}
+	sessions.Refresh(context.Background(), mon)
+	if !mon.ErrorOccured || !strings.Contains(mon.ErrorMessage, "profile default") {
+		t.Errorf("Expected an error refreshing the profile, got %s", mon.ErrorMessage)
+	}
+	if sessions.Factory("default", settings) != nil {
+		t.Errorf("Expected the profile to be skipped")
+	}
+
+	// It is tried again at the next refresh
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAFAKEAWS")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "fakeaws")
+	mon = &mock.ActivityMonitorImpl{}
+	sessions.Refresh(context.Background(), mon)
+	if mon.ErrorOccured || sessions.Factory("default", settings) == nil {
+		t.Errorf("Expected the profile to be refreshed: %s", mon.ErrorMessage)
+	}
+
+	// A profile whose shared configuration became invalid is skipped, too (rather
+	// than ending the daemon)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SDK_LOAD_CONFIG", "1")
+	if err := os.WriteFile(filepath.Join(tempDir, "config"), []byte("[default\nbroken"), 0600); err != nil {
+		t.Fatalf("Unexpected error writing the configuration: %v", err)
+	}
+	mon = &mock.ActivityMonitorImpl{}
+	sessions.Refresh(context.Background(), mon)
+	if !mon.ErrorOccured || !strings.Contains(mon.ErrorMessage, "failed to load config file") {
+		t.Errorf("Expected an error loading the configuration, got %s", mon.ErrorMessage)
+	}
+	if sessions.Factory("default", settings) != nil {
+		t.Errorf("Expected the profile to be skipped")
+	}
+}
@@ -0,0 +1,338 @@
+/******************************************************************************
+Cloud Resource Counter
+File: store.go
+
+Summary: A SQLite history store, which keeps the counts (and errors) of every
+         run in a normalized schema that is upgraded by versioned migrations.
+******************************************************************************/
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// Register the (pure Go) SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+// StoreSchemeSQLite is the scheme of a SQLite store (e.g., sqlite:counts.db)
+const StoreSchemeSQLite = "sqlite"
+
+// The migrations of the schema of a store, in order. The version of a schema is
+// the number of migrations applied to it. A migration that has been released is
+// never changed; another one is added instead.
+var storeMigrations = []string{
+	// Version 1: runs, accounts, regions, counter values and errors
+	`CREATE TABLE runs (
+		id           INTEGER PRIMARY KEY,
+		started_at   TEXT NOT NULL,
+		duration_ms  INTEGER NOT NULL,
+		tool_version TEXT NOT NULL,
+		incomplete   INTEGER NOT NULL
+	);
+	CREATE TABLE accounts (
+		id         INTEGER PRIMARY KEY,
+		account_id TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE regions (
+		id   INTEGER PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE counter_values (
+		run_id     INTEGER NOT NULL REFERENCES runs (id) ON DELETE CASCADE,
+		account_id INTEGER NOT NULL REFERENCES accounts (id),
+		region_id  INTEGER NOT NULL REFERENCES regions (id),
+		resource   TEXT NOT NULL,
+		count      INTEGER NOT NULL,
+		incomplete INTEGER NOT NULL,
+		counted_at TEXT NOT NULL,
+		PRIMARY KEY (run_id, account_id, region_id, resource)
+	);
+	CREATE INDEX counter_values_counted_at ON counter_values (counted_at);
+	CREATE TABLE errors (
+		id      INTEGER PRIMARY KEY,
+		run_id  INTEGER NOT NULL REFERENCES runs (id) ON DELETE CASCADE,
+		service TEXT NOT NULL,
+		region  TEXT NOT NULL,
+		code    TEXT NOT NULL,
+		message TEXT NOT NULL
+	);`,
+
+	// Version 2: the scope of counter values (keeping the rows of a breakdown by
+	// region apart from the totals). The table is rebuilt to change its key;
+	// earlier values are totals.
+	`CREATE TABLE counter_values_v2 (
+		run_id     INTEGER NOT NULL REFERENCES runs (id) ON DELETE CASCADE,
+		account_id INTEGER NOT NULL REFERENCES accounts (id),
+		region_id  INTEGER NOT NULL REFERENCES regions (id),
+		scope      TEXT NOT NULL,
+		resource   TEXT NOT NULL,
+		count      INTEGER NOT NULL,
+		incomplete INTEGER NOT NULL,
+		counted_at TEXT NOT NULL,
+		PRIMARY KEY (run_id, account_id, region_id, scope, resource)
+	);
+	INSERT INTO counter_values_v2 (run_id, account_id, region_id, scope, resource, count, incomplete, counted_at)
+		SELECT run_id, account_id, region_id, 'total', resource, count, incomplete, counted_at FROM counter_values;
+	DROP TABLE counter_values;
+	ALTER TABLE counter_values_v2 RENAME TO counter_values;
+	CREATE INDEX counter_values_counted_at ON counter_values (counted_at);`,
+}
+
+// Store is a history store: a SQLite database holding the counts of each run.
+// Timestamps are stored as RFC3339 text in UTC, so that they sort in order.
+type Store struct {
+	Spec string
+
+	db *sql.DB
+}
+
+// StoredCount is a count read from a store: the count of a resource (the key of
+// a column, e.g., ec2_instances) in a row of results of an account and region.
+// The scope tells the rows of a breakdown by region (ScopeRegion) from the totals
+// (ScopeTotal).
+type StoredCount struct {
+	AccountID string
+	Region    string
+	Scope     string
+	Resource  string
+	Count     CountResult
+	CountedAt time.Time
+}
+
+// ParseStoreSpec splits the specification of a store (e.g., sqlite:counts.db)
+// into its scheme and path. Only SQLite stores are supported.
+func ParseStoreSpec(spec string) (string, string, error) {
+	scheme, path, found := strings.Cut(spec, ":")
+	if !found || scheme != StoreSchemeSQLite || path == "" {
+		return "", "", fmt.Errorf("'%s' is not a valid store (expected %s:FILE, e.g., %s:resources.db)", spec, StoreSchemeSQLite, StoreSchemeSQLite)
+	}
+
+	return scheme, path, nil
+}
+
+// OpenStore opens the store with the supplied specification (creating it, if
+// needed) and migrates its schema to the latest version. A store whose schema is
+// newer than this tool knows of cannot be opened.
+func OpenStore(spec string) (*Store, error) {
+	_, path, err := ParseStoreSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open the database. A single connection is kept, so that our settings apply
+	// to every statement.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	store := &Store{Spec: spec, db: db}
+	if _, err = db.Exec("PRAGMA foreign_keys = ON; PRAGMA busy_timeout = 5000"); err == nil {
+		err = store.migrate()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SchemaVersion returns the version of the schema of the store (the number of
+// migrations applied to it).
+func (s *Store) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+
+	return version, err
+}
+
+// Apply the migrations that are newer than the schema of the store (each in a
+// transaction of its own)
+func (s *Store) migrate() error {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL)"); err != nil {
+		return err
+	}
+
+	// Which version is the schema?
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > len(storeMigrations) {
+		return fmt.Errorf("the schema of the store (version %d) is newer than this tool supports (version %d)", current, len(storeMigrations))
+	}
+
+	// Apply each newer migration
+	for version := current + 1; version <= len(storeMigrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(storeMigrations[version-1]); err == nil {
+			_, err = tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", version, storeTime(time.Now()))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to migrate the schema of the store to version %d: %v", version, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveRun stores a run: its rows of results and the errors recorded while
+// counting them. It returns the ID of the run.
+func (s *Store) SaveRun(rows []HistoryRow, errs []*CounterError, started time.Time, duration time.Duration) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	runID, err := saveRun(tx, rows, errs, started, duration)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return runID, tx.Commit()
+}
+
+// Store a run in the supplied transaction
+func saveRun(tx *sql.Tx, rows []HistoryRow, errs []*CounterError, started time.Time, duration time.Duration) (int64, error) {
+	// Is any count of the run incomplete?
+	incomplete := len(errs) > 0
+	for _, row := range rows {
+		for _, count := range row.Counts {
+			incomplete = incomplete || count.Incomplete
+		}
+	}
+
+	// Store the run
+	result, err := tx.Exec("INSERT INTO runs (started_at, duration_ms, tool_version, incomplete) VALUES (?, ?, ?, ?)",
+		storeTime(started), duration.Milliseconds(), version, incomplete)
+	if err != nil {
+		return 0, err
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Store the count of each column of each row. The same account, region and
+	// scope cannot be counted twice in a run (e.g., from two profiles).
+	for _, row := range rows {
+		accountID, err := storeID(tx, "accounts", "account_id", row.AccountID)
+		if err != nil {
+			return 0, err
+		}
+		regionID, err := storeID(tx, "regions", "name", row.Region)
+		if err != nil {
+			return 0, err
+		}
+		scope := ScopeTotal
+		if row.Scope == ScopeRegion {
+			scope = ScopeRegion
+		}
+		for _, column := range row.Columns {
+			count := row.Counts[column]
+			if _, err = tx.Exec("INSERT INTO counter_values (run_id, account_id, region_id, scope, resource, count, incomplete, counted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+				runID, accountID, regionID, scope, column, count.Count, count.Incomplete, storeTime(row.Timestamp)); err != nil {
+				return 0, fmt.Errorf("unable to store the %s count of %s in account %s, region %s: %v", scope, column, row.AccountID, row.Region, err)
+			}
+		}
+	}
+
+	// Store the errors
+	for _, ce := range errs {
+		if _, err = tx.Exec("INSERT INTO errors (run_id, service, region, code, message) VALUES (?, ?, ?, ?, ?)",
+			runID, ce.Service, ce.Region, ce.Code, ce.Message); err != nil {
+			return 0, err
+		}
+	}
+
+	return runID, nil
+}
+
+// Get the ID of the row of a table (of accounts or regions) with the supplied
+// value, adding the row if needed
+func storeID(tx *sql.Tx, table string, column string, value string) (int64, error) {
+	if _, err := tx.Exec(fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (?)", table, column), value); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := tx.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE %s = ?", table, column), value).Scan(&id)
+
+	return id, err
+}
+
+// LatestCounts returns the latest count of each resource in each account, region
+// and scope (optionally, of a single account or resource only). A resource that was
+// not counted by the latest run keeps the count of the last run that did.
+func (s *Store) LatestCounts(accountID string, resource string) ([]StoredCount, error) {
+	return s.queryCounts(`
+		SELECT a.account_id, r.name, v.scope, v.resource, v.count, v.incomplete, v.counted_at
+		FROM counter_values v
+		JOIN accounts a ON a.id = v.account_id
+		JOIN regions r ON r.id = v.region_id
+		WHERE v.run_id = (SELECT MAX(l.run_id) FROM counter_values l WHERE l.account_id = v.account_id AND l.region_id = v.region_id AND l.scope = v.scope AND l.resource = v.resource)
+		AND (?1 = '' OR a.account_id = ?1) AND (?2 = '' OR v.resource = ?2)
+		ORDER BY a.account_id, r.name, v.scope, v.resource`, accountID, resource)
+}
+
+// MaxCounts returns the largest count of each resource in each account, region
+// and scope since the supplied time (optionally, of a single account or resource
+// only), along with when it was counted.
+func (s *Store) MaxCounts(since time.Time, accountID string, resource string) ([]StoredCount, error) {
+	// SQLite takes the other columns from the row holding the maximum
+	return s.queryCounts(`
+		SELECT a.account_id, r.name, v.scope, v.resource, MAX(v.count), v.incomplete, v.counted_at
+		FROM counter_values v
+		JOIN accounts a ON a.id = v.account_id
+		JOIN regions r ON r.id = v.region_id
+		WHERE v.counted_at >= ?3
+		AND (?1 = '' OR a.account_id = ?1) AND (?2 = '' OR v.resource = ?2)
+		GROUP BY v.account_id, v.region_id, v.scope, v.resource
+		ORDER BY a.account_id, r.name, v.scope, v.resource`, accountID, resource, storeTime(since))
+}
+
+// Run a query of counts
+func (s *Store) queryCounts(query string, args ...interface{}) ([]StoredCount, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []StoredCount
+	for rows.Next() {
+		var count StoredCount
+		var countedAt string
+		if err = rows.Scan(&count.AccountID, &count.Region, &count.Scope, &count.Resource, &count.Count.Count, &count.Count.Incomplete, &countedAt); err != nil {
+			return nil, err
+		}
+		if count.CountedAt, err = time.Parse(time.RFC3339, countedAt); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// Format a time as it is stored
+func storeTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,270 @@
+/******************************************************************************
+Cloud Resource Counter
+File: store_test.go
+
+Summary: The Unit Test for store.
+******************************************************************************/
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Open a new store in a temporary folder, holding three runs of two accounts
+func testStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := OpenStore("sqlite:" + filepath.Join(t.TempDir(), "resources.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error opening the store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// Save the runs (the last of which is incomplete)
+	runs := [][]HistoryRow{
+		{
+			historyRow("111122223333", "2024-01-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 50, "s3_buckets": 3}),
+			historyRow("444455556666", "2024-01-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 1}),
+		},
+		{
+			historyRow("111122223333", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 12, "s3_buckets": 4}),
+		},
+		{
+			historyRow("111122223333", "2024-05-02T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10, "lambda_functions": 2}),
+		},
+	}
+	runs[2][0].Counts["ec2_instances"] = CountResult{Count: 10, Incomplete: true}
+	errs := []*CounterError{NewCounterError("EC2", "us-east-1", errors.New("access denied"))}
+	for ix, rows := range runs {
+		var runErrs []*CounterError
+		if ix == 2 {
+			runErrs = errs
+		}
+		if runID, err := store.SaveRun(rows, runErrs, rows[0].Timestamp, time.Second); err != nil || runID != int64(ix+1) {
+			t.Fatalf("Unexpected result saving run %d: %d, %v", ix+1, runID, err)
+		}
+	}
+
+	return store
+}
+
+// Summarize the counts as ACCOUNT/REGION/RESOURCE=COUNT (with a * if incomplete)
+func storedCountsString(counts []StoredCount) string {
+	var parts []string
+	for _, count := range counts {
+		parts = append(parts, count.AccountID+"/"+count.Region+"/"+count.Resource+"="+formatDiffCount(count.Count, false))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func TestOpenStore(t *testing.T) {
+	spec := "sqlite:" + filepath.Join(t.TempDir(), "resources.db")
+
+	// A new store is migrated to the latest version...
+	store, err := OpenStore(spec)
+	if err != nil {
+		t.Fatalf("Unexpected error opening %s: %v", spec, err)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != len(storeMigrations) {
+		t.Errorf("Unexpected schema version: %d, %v", version, err)
+	}
+
+	// ...which can be opened again
+	store.Close()
+	if store, err = OpenStore(spec); err != nil {
+		t.Fatalf("Unexpected error opening %s again: %v", spec, err)
+	}
+
+	// A store with a newer schema cannot be opened
+	if _, err = store.db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", len(storeMigrations)+1, storeTime(time.Now())); err != nil {
+		t.Fatalf("Unexpected error upgrading the schema: %v", err)
+	}
+	store.Close()
+	if _, err = OpenStore(spec); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected an error opening a newer store, got %v", err)
+	}
+
+	// Only SQLite stores are supported
+	for _, spec := range []string{"resources.db", "sqlite:", "postgres://localhost/counts"} {
+		if _, err = OpenStore(spec); err == nil {
+			t.Errorf("Expected an error opening %s", spec)
+		}
+	}
+}
+
+func TestStoreSaveRun(t *testing.T) {
+	store := testStore(t)
+
+	// Were the runs, accounts, regions and errors stored once each?
+	for table, expected := range map[string]int{"runs": 3, "accounts": 2, "regions": 1, "counter_values": 7, "errors": 1} {
+		var count int
+		if err := store.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil || count != expected {
+			t.Errorf("Unexpected number of %s: expected %d, actual %d (%v)", table, expected, count, err)
+		}
+	}
+
+	// Is the last run marked as incomplete?
+	var incomplete bool
+	if err := store.db.QueryRow("SELECT incomplete FROM runs WHERE id = 3").Scan(&incomplete); err != nil || !incomplete {
+		t.Errorf("Expected the last run to be incomplete (%v)", err)
+	}
+}
+
+func TestStoreQueries(t *testing.T) {
+	store := testStore(t)
+	since, _ := time.Parse(time.RFC3339, "2024-04-01T00:00:00Z")
+
+	// Create our test cases
+	cases := []struct {
+		Max      bool
+		Account  string
+		Resource string
+		Expected string
+	}{
+		{
+			// The S3 buckets were last counted by the second run
+			Expected: "111122223333/ALL_REGIONS/ec2_instances=10* 111122223333/ALL_REGIONS/lambda_functions=2 111122223333/ALL_REGIONS/s3_buckets=4 444455556666/ALL_REGIONS/ec2_instances=1",
+		},
+		{
+			Resource: "s3_buckets",
+			Expected: "111122223333/ALL_REGIONS/s3_buckets=4",
+		},
+		{
+			Account:  "444455556666",
+			Expected: "444455556666/ALL_REGIONS/ec2_instances=1",
+		},
+		{
+			Max:      true,
+			Expected: "111122223333/ALL_REGIONS/ec2_instances=12 111122223333/ALL_REGIONS/lambda_functions=2 111122223333/ALL_REGIONS/s3_buckets=4",
+		},
+		{
+			Max:      true,
+			Resource: "ec2_instances",
+			Expected: "111122223333/ALL_REGIONS/ec2_instances=12",
+		},
+	}
+
+	// Loop through the test cases
+	for _, c := range cases {
+		var counts []StoredCount
+		var err error
+		if c.Max {
+			counts, err = store.MaxCounts(since, c.Account, c.Resource)
+		} else {
+			counts, err = store.LatestCounts(c.Account, c.Resource)
+		}
+		if err != nil {
+			t.Errorf("Unexpected error querying the store: %v", err)
+		} else if actual := storedCountsString(counts); actual != c.Expected {
+			t.Errorf("Unexpected counts (max %v, account %s, resource %s):\nexpected %s\nactual   %s", c.Max, c.Account, c.Resource, c.Expected, actual)
+		}
+	}
+}
+
+func TestStoreLatestCountsByResource(t *testing.T) {
+	store, err := OpenStore("sqlite:" + filepath.Join(t.TempDir(), "resources.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error opening the store: %v", err)
+	}
+	defer store.Close()
+
+	// Two runs of the same account and region that count different resources
+	// (e.g., with --only)
+	runs := []HistoryRow{
+		historyRow("111122223333", "2024-05-01T12:00:00Z", "ALL_REGIONS", map[string]int{"ec2_instances": 10}),
+		historyRow("111122223333", "2024-05-02T12:00:00Z", "ALL_REGIONS", map[string]int{"s3_buckets": 3}),
+	}
+	for _, row := range runs {
+		if _, err = store.SaveRun([]HistoryRow{row}, nil, row.Timestamp, time.Second); err != nil {
+			t.Fatalf("Unexpected error saving a run: %v", err)
+		}
+	}
+
+	// The latest count of each resource is reported
+	expected := "111122223333/ALL_REGIONS/ec2_instances=10 111122223333/ALL_REGIONS/s3_buckets=3"
+	if counts, err := store.LatestCounts("", ""); err != nil || storedCountsString(counts) != expected {
+		t.Errorf("Unexpected latest counts: expected %s, actual %s (%v)", expected, storedCountsString(counts), err)
+	}
+}
+
+func TestStoreSaveRunBreakdown(t *testing.T) {
+	store, err := OpenStore("sqlite:" + filepath.Join(t.TempDir(), "resources.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error opening the store: %v", err)
+	}
+	defer store.Close()
+
+	// A breakdown of a single region, whose row has the same region as the totals
+	region := historyRow("111122223333", "2024-05-01T12:00:00Z", "us-east-1", map[string]int{"ec2_instances": 3})
+	region.Scope = ScopeRegion
+	totals := historyRow("111122223333", "2024-05-01T12:00:00Z", "us-east-1", map[string]int{"ec2_instances": 3})
+	totals.Scope = ScopeTotal
+	if _, err = store.SaveRun([]HistoryRow{region, totals}, nil, region.Timestamp, time.Second); err != nil {
+		t.Fatalf("Unexpected error saving a breakdown: %v", err)
+	}
+
+	// Both rows are kept
+	var scopes []string
+	counts, err := store.LatestCounts("", "")
+	for _, count := range counts {
+		scopes = append(scopes, count.Scope)
+	}
+	if err != nil || strings.Join(scopes, ",") != "region,total" {
+		t.Errorf("Unexpected scopes of the latest counts: %v (%v)", scopes, err)
+	}
+
+	// The same account counted twice in a run (e.g., from two profiles) is an
+	// error, and nothing of the run is saved
+	if _, err = store.SaveRun([]HistoryRow{totals, totals}, nil, totals.Timestamp, time.Second); err == nil {
+		t.Errorf("Expected an error saving the same account twice")
+	}
+	var runs int
+	if err = store.db.QueryRow("SELECT COUNT(*) FROM runs").Scan(&runs); err != nil || runs != 1 {
+		t.Errorf("Unexpected number of runs: expected 1, actual %d (%v)", runs, err)
+	}
+}
+
+func TestStoreMigrateCounterValues(t *testing.T) {
+	spec := "sqlite:" + filepath.Join(t.TempDir(), "resources.db")
+
+	// Create a store of version 1 holding a count
+	store, err := OpenStore(spec)
+	if err != nil {
+		t.Fatalf("Unexpected error opening %s: %v", spec, err)
+	}
+	for _, statement := range []string{
+		"DROP TABLE counter_values",
+		"DROP TABLE errors",
+		"DROP TABLE regions",
+		"DROP TABLE accounts",
+		"DROP TABLE runs",
+		"DELETE FROM schema_migrations",
+		storeMigrations[0],
+		"INSERT INTO schema_migrations (version, applied_at) VALUES (1, '2024-01-01T00:00:00Z')",
+		"INSERT INTO runs (id, started_at, duration_ms, tool_version, incomplete) VALUES (1, '2024-01-01T12:00:00Z', 1000, '1.0.0', 0)",
+		"INSERT INTO accounts (id, account_id) VALUES (1, '111122223333')",
+		"INSERT INTO regions (id, name) VALUES (1, 'ALL_REGIONS')",
+		"INSERT INTO counter_values VALUES (1, 1, 1, 'ec2_instances', 10, 0, '2024-01-01T12:00:00Z')",
+	} {
+		if _, err = store.db.Exec(statement); err != nil {
+			t.Fatalf("Unexpected error creating a store of version 1: %v", err)
+		}
+	}
+	store.Close()
+
+	// Its counts are kept as totals when it is migrated
+	if store, err = OpenStore(spec); err != nil {
+		t.Fatalf("Unexpected error migrating %s: %v", spec, err)
+	}
+	defer store.Close()
+	counts, err := store.LatestCounts("", "")
+	if err != nil || len(counts) != 1 || counts[0].Scope != ScopeTotal || counts[0].Count.Count != 10 {
+		t.Errorf("Unexpected counts after migrating: %+v (%v)", counts, err)
+	}
+}
@@ -0,0 +1,266 @@
+/******************************************************************************
+Cloud Resource Counter
+File: throttle.go
+
+Summary: Controls how AWS requests are retried (and rate limited) so that large
+         accounts are not stopped by throttling errors, and counts the retries
+         and throttling errors of each service.
+******************************************************************************/
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// The names of our session handlers
+const (
+	rateLimitHandlerName = "cloudresourcecounter.RateLimitHandler"
+	throttleHandlerName  = "cloudresourcecounter.ThrottleHandler"
+)
+
+// The defaults of the retry policy
+const (
+	DefaultMaxAttempts = 5
+	DefaultMaxBackoff  = 20 * time.Second
+	DefaultRetryJitter = 0.5
+)
+
+// The delay before the first retry of a request (which doubles with each retry).
+// Throttled requests wait longer.
+const (
+	baseRetryDelay    = 100 * time.Millisecond
+	baseThrottleDelay = 500 * time.Millisecond
+)
+
+// RetryPolicy controls how retryable requests (including throttled ones) are
+// retried: the maximum number of attempts (including the first), the cap on
+// the exponential backoff between attempts and the fraction of each delay
+// (0 to 1) that is random.
+type RetryPolicy struct {
+	MaxAttempts int
+	MaxBackoff  time.Duration
+	Jitter      float64
+}
+
+// Delay returns how long to wait before the supplied retry (0 for the first) of
+// a request. The random number (0 to 1) chooses the jittered part of the delay.
+func (rp RetryPolicy) Delay(retryCount int, throttled bool, random float64) time.Duration {
+	// Double the base delay for each retry, up to the cap
+	base := baseRetryDelay
+	if throttled {
+		base = baseThrottleDelay
+	}
+	delay := time.Duration(math.Min(float64(base)*math.Pow(2, float64(retryCount)), float64(rp.MaxBackoff)))
+
+	// Randomize part of the delay
+	jitter := math.Max(0, math.Min(rp.Jitter, 1))
+
+	return time.Duration(float64(delay) * (1 - jitter + jitter*random))
+}
+
+// ThrottleStats is the number of times that the requests of a service were
+// retried and the number of throttling errors that they received.
+type ThrottleStats struct {
+	Service   string
+	Retries   int
+	Throttles int
+}
+
+// ThrottleControl applies a retry policy and a rate limit to AWS sessions and
+// counts the retries and throttling errors of their requests. The rate limit is
+// the number of requests per second made to each service in each region; it is
+// not limited if it is zero. A single ThrottleControl can be shared by several
+// sessions (e.g., those of several profiles).
+type ThrottleControl struct {
+	Policy    RetryPolicy
+	RateLimit float64
+
+	mu      sync.Mutex
+	buckets map[string]*TokenBucket
+	stats   map[string]*ThrottleStats
+}
+
+// Apply the retry policy and rate limit to the supplied session (and to the
+// sessions copied from it).
+func (tc *ThrottleControl) Apply(sess *session.Session) {
+	// Retry requests according to our policy
+	sess.Config.Retryer = &policyRetryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: tc.Policy.MaxAttempts - 1},
+		control:        tc,
+	}
+
+	// Wait for our rate limit before each request is sent. The request fails if
+	// its context is done while it waits.
+	rateLimiter := request.NamedHandler{Name: rateLimitHandlerName, Fn: func(r *request.Request) {
+		if bucket := tc.bucket(r.ClientInfo.ServiceName, aws.StringValue(r.Config.Region)); bucket != nil {
+			if err := bucket.Wait(r.Context()); err != nil {
+				r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", err)
+			}
+		}
+	}}
+	if !sess.Handlers.Send.SwapNamed(rateLimiter) {
+		sess.Handlers.Send.PushFrontNamed(rateLimiter)
+	}
+
+	// Count each throttling error (before it is retried)
+	throttleCounter := request.NamedHandler{Name: throttleHandlerName, Fn: func(r *request.Request) {
+		if request.IsErrorThrottle(r.Error) {
+			tc.update(r.ClientInfo.ServiceName, func(stats *ThrottleStats) { stats.Throttles++ })
+		}
+	}}
+	if !sess.Handlers.AfterRetry.SwapNamed(throttleCounter) {
+		sess.Handlers.AfterRetry.PushFrontNamed(throttleCounter)
+	}
+}
+
+// Stats returns the retries and throttling errors of each service whose requests
+// were retried or throttled (sorted by service).
+func (tc *ThrottleControl) Stats() []ThrottleStats {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	var stats []ThrottleStats
+	for _, serviceStats := range tc.stats {
+		stats = append(stats, *serviceStats)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Service < stats[j].Service
+	})
+
+	return stats
+}
+
+// ResetStats forgets the retries and throttling errors counted so far (e.g., at
+// the start of another run with the same sessions).
+func (tc *ThrottleControl) ResetStats() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.stats = nil
+}
+
+// Get the token bucket of the supplied service and region (or nil, if there is
+// no rate limit)
+func (tc *ThrottleControl) bucket(serviceName string, regionName string) *TokenBucket {
+	if tc.RateLimit <= 0 {
+		return nil
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	// Create the bucket on first use
+	key := serviceName + "@" + regionName
+	if tc.buckets == nil {
+		tc.buckets = make(map[string]*TokenBucket)
+	}
+	if tc.buckets[key] == nil {
+		tc.buckets[key] = NewTokenBucket(tc.RateLimit, int(math.Ceil(tc.RateLimit)))
+	}
+
+	return tc.buckets[key]
+}
+
+// Update the stats of the supplied service
+func (tc *ThrottleControl) update(serviceName string, fn func(*ThrottleStats)) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.stats == nil {
+		tc.stats = make(map[string]*ThrottleStats)
+	}
+	if tc.stats[serviceName] == nil {
+		tc.stats[serviceName] = &ThrottleStats{Service: serviceName}
+	}
+	fn(tc.stats[serviceName])
+}
+
+// policyRetryer decides which requests are retried as the SDK's DefaultRetryer
+// does, but waits according to the RetryPolicy of its ThrottleControl (and
+// counts each retry).
+type policyRetryer struct {
+	client.DefaultRetryer
+	control *ThrottleControl
+}
+
+// RetryRules returns how long to wait before retrying the supplied request.
+func (pr *policyRetryer) RetryRules(r *request.Request) time.Duration {
+	pr.control.update(r.ClientInfo.ServiceName, func(stats *ThrottleStats) { stats.Retries++ })
+
+	return pr.control.Policy.Delay(r.RetryCount, request.IsErrorThrottle(r.Error), rand.Float64())
+}
+
+// TokenBucket limits the rate of an activity: up to burst tokens are available
+// at once, and they are replenished at rate tokens per second.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// The clock (replaced by tests)
+	now func() time.Time
+}
+
+// NewTokenBucket returns a (full) TokenBucket with the supplied rate and burst.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// Reserve takes a token from the bucket and returns how long the caller must
+// wait before the token is available.
+func (tb *TokenBucket) Reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	// Replenish the tokens since our last reservation (up to the burst)
+	now := tb.now()
+	if !tb.last.IsZero() {
+		tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	}
+	tb.last = now
+
+	// Take a token. If there are none left, the caller waits for it.
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// Wait takes a token from the bucket, waiting until it is available. It returns
+// the error of the supplied context if the context is done first.
+func (tb *TokenBucket) Wait(ctx aws.Context) error {
+	if delay := tb.Reserve(); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
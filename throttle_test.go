@@ -0,0 +1,108 @@
+/******************************************************************************
+Cloud Resource Counter
+File: throttle_test.go
+
+Summary: The Unit Test for throttle.
+******************************************************************************/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, MaxBackoff: 2 * time.Second, Jitter: 0.5}
+
+	// Construct our test cases...
+	cases := []struct {
+		RetryCount int
+		Throttled  bool
+		Random     float64
+		Expected   time.Duration
+	}{
+		{RetryCount: 0, Random: 1, Expected: 100 * time.Millisecond},
+		{RetryCount: 2, Random: 1, Expected: 400 * time.Millisecond},
+		{RetryCount: 2, Random: 0, Expected: 200 * time.Millisecond},
+		{RetryCount: 1, Throttled: true, Random: 1, Expected: time.Second},
+		{RetryCount: 8, Throttled: true, Random: 1, Expected: 2 * time.Second},
+		{RetryCount: 8, Throttled: true, Random: 0.5, Expected: 1500 * time.Millisecond},
+	}
+
+	// Loop through the cases...
+	for _, c := range cases {
+		if actual := policy.Delay(c.RetryCount, c.Throttled, c.Random); actual != c.Expected {
+			t.Errorf("Unexpected delay of retry %d (throttled: %v): expected %v, actual %v", c.RetryCount, c.Throttled, c.Expected, actual)
+		}
+	}
+
+	// Without jitter, the delay is not random
+	policy.Jitter = 0
+	if actual := policy.Delay(1, false, 0); actual != 200*time.Millisecond {
+		t.Errorf("Unexpected delay without jitter: %v", actual)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	// Create a bucket of 2 tokens, replenished at 4 per second (with our own clock)
+	now := time.Now()
+	bucket := NewTokenBucket(4, 2)
+	bucket.now = func() time.Time { return now }
+
+	// The first two tokens are available at once, but the next ones must wait
+	expected := []time.Duration{0, 0, 250 * time.Millisecond, 500 * time.Millisecond}
+	for ix, e := range expected {
+		if actual := bucket.Reserve(); actual != e {
+			t.Errorf("Unexpected wait for token %d: expected %v, actual %v", ix, e, actual)
+		}
+	}
+
+	// After a second, the tokens owed (and then the bucket) have been replenished
+	now = now.Add(time.Second)
+	for ix := 0; ix < 2; ix++ {
+		if actual := bucket.Reserve(); actual != 0 {
+			t.Errorf("Unexpected wait for token %d after a second: %v", ix, actual)
+		}
+	}
+
+	// Wait stops waiting for the next token when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.Wait(ctx); err != context.Canceled {
+		t.Errorf("Unexpected error waiting with a canceled context: %v", err)
+	}
+
+	// ...but a token that is available is taken at once
+	now = now.Add(time.Second)
+	if err := bucket.Wait(ctx); err != nil {
+		t.Errorf("Unexpected error taking an available token: %v", err)
+	}
+}
+
+func TestThrottleControlStats(t *testing.T) {
+	tc := &ThrottleControl{}
+
+	// Record some retries and throttles
+	tc.update("ec2", func(stats *ThrottleStats) { stats.Retries++ })
+	tc.update("ecs", func(stats *ThrottleStats) { stats.Throttles++ })
+	tc.update("ec2", func(stats *ThrottleStats) { stats.Throttles++ })
+
+	// Are they reported (sorted by service)?
+	stats := tc.Stats()
+	if len(stats) != 2 || stats[0] != (ThrottleStats{Service: "ec2", Retries: 1, Throttles: 1}) || stats[1] != (ThrottleStats{Service: "ecs", Throttles: 1}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Without a rate limit, there is no bucket
+	if tc.bucket("ec2", "us-east-1") != nil {
+		t.Error("Expected no bucket without a rate limit")
+	}
+	tc.RateLimit = 2.5
+	if bucket := tc.bucket("ec2", "us-east-1"); bucket == nil || bucket.burst != 3 || bucket != tc.bucket("ec2", "us-east-1") {
+		t.Errorf("Unexpected bucket: %+v", bucket)
+	} else if bucket == tc.bucket("ec2", "us-west-2") {
+		t.Error("Expected a bucket for each region")
+	}
+}
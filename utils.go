@@ -8,11 +8,11 @@ Summary: Various utility functions
 package main
 
 import (
+	"net/url"
 	"os"
 	"reflect"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
@@ -35,8 +35,9 @@ func OpenFileForWriting(fileName string, typeOfFile string, am ActivityMonitor,
 	return file
 }
 
-// GetEC2Regions determines the set of regions associated with the account.
-func GetEC2Regions(ec2is *EC2InstanceService, am ActivityMonitor) []string {
+// GetEC2Regions determines the set of regions associated with the account (along
+// with the opt-in status of each).
+func GetEC2Regions(ctx aws.Context, ec2is *EC2InstanceService, am ActivityMonitor) []RegionInfo {
 	// Construct the input
 	input := &ec2.DescribeRegionsInput{
 		Filters: []*ec2.Filter{
@@ -51,36 +52,30 @@ func GetEC2Regions(ec2is *EC2InstanceService, am ActivityMonitor) []string {
 	}
 
 	// Execute the command
-	result, err := ec2is.GetRegions(input)
+	result, err := ec2is.GetRegions(ctx, input)
 
 	// Do we have an error?
 	if am.CheckError(err) {
 		return nil
 	}
 
-	// Transform the array of results into an array of region names...
-	var regionNames []string
+	// Transform the array of results into an array of regions...
+	var regions []RegionInfo
 	for _, regionInfo := range result.Regions {
-		regionNames = append(regionNames, *regionInfo.RegionName)
+		regions = append(regions, RegionInfo{
+			Name:        aws.StringValue(regionInfo.RegionName),
+			OptInStatus: aws.StringValue(regionInfo.OptInStatus),
+		})
 	}
 
-	return regionNames
+	return regions
 }
 
-// IsValidRegionName returns whether the supplied region name is valid or not.
-func IsValidRegionName(regionName string) bool {
-	// Get the AWS Partition
-	awsPartition := endpoints.AwsPartition()
-
-	// Loop through the region names...
-	for id := range awsPartition.Regions() {
-		// Does it match?
-		if id == regionName {
-			return true
-		}
-	}
-
-	return false
+// IsValidEndpointURL returns whether the supplied URL can be used as the endpoint
+// of AWS requests (i.e., it has a scheme and a host).
+func IsValidEndpointURL(endpointURL string) bool {
+	u, err := url.Parse(endpointURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 // Map applies a function to each element of a string array
@@ -93,6 +88,16 @@ func Map(vs []string, f func(string) string) []string {
 	return vsm
 }
 
+// Contains returns whether the supplied string is an element of a string array
+func Contains(vs []string, s string) bool {
+	for _, v := range vs {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // NilInterface checks whether the supplied interface is nil or not
 func NilInterface(intf interface{}) bool {
 	return intf == nil || reflect.ValueOf(intf).IsNil()
@@ -111,3 +116,14 @@ func FileExists(fileName string) bool {
 
 	return !info.IsDir()
 }
+
+// DirExists checks if a folder exists (and is a folder)
+func DirExists(dirName string) bool {
+	// Stat the folder
+	info, err := os.Stat(dirName)
+	if err != nil {
+		return false
+	}
+
+	return info.IsDir()
+}